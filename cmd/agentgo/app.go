@@ -27,14 +27,19 @@ type App struct {
 	promptTemplateStoreAPI *PromptTemplateStoreWrapper
 	toolStoreAPI           *ToolStoreWrapper
 	providerSetAPI         *ProviderSetWrapper
+	batchJobManagerAPI     *BatchJobManagerWrapper
 
 	dataBasePath string
 
-	settingsDirPath      string
-	conversationsDirPath string
-	modelPresetsDirPath  string
-	promptsDirPath       string
-	toolsDirPath         string
+	settingsDirPath          string
+	conversationsDirPath     string
+	modelPresetsDirPath      string
+	promptsDirPath           string
+	toolsDirPath             string
+	batchJobsDirPath         string
+	completionJournalDirPath string
+	tokenQuotasDirPath       string
+	fileUploadsDirPath       string
 }
 
 func NewApp() *App {
@@ -54,9 +59,15 @@ func NewApp() *App {
 	app.modelPresetsDirPath = filepath.Join(app.dataBasePath, "modelpresetsv1")
 	app.promptsDirPath = filepath.Join(app.dataBasePath, "prompttemplates")
 	app.toolsDirPath = filepath.Join(app.dataBasePath, "toolsv1")
+	app.batchJobsDirPath = filepath.Join(app.dataBasePath, "batchjobsv1")
+	app.completionJournalDirPath = filepath.Join(app.dataBasePath, "completionjournalv1")
+	app.tokenQuotasDirPath = filepath.Join(app.dataBasePath, "tokenquotasv1")
+	app.fileUploadsDirPath = filepath.Join(app.dataBasePath, "fileuploadsv1")
 
 	if app.settingsDirPath == "" || app.conversationsDirPath == "" ||
-		app.modelPresetsDirPath == "" || app.promptsDirPath == "" || app.toolsDirPath == "" {
+		app.modelPresetsDirPath == "" || app.promptsDirPath == "" || app.toolsDirPath == "" ||
+		app.batchJobsDirPath == "" || app.completionJournalDirPath == "" || app.tokenQuotasDirPath == "" ||
+		app.fileUploadsDirPath == "" {
 		slog.Error(
 			"invalid app path configuration",
 			"settingsDirPath", app.settingsDirPath,
@@ -64,6 +75,10 @@ func NewApp() *App {
 			"modelPresetsDirPath", app.modelPresetsDirPath,
 			"promptsDirPath", app.promptsDirPath,
 			"toolsDirPath", app.toolsDirPath,
+			"batchJobsDirPath", app.batchJobsDirPath,
+			"completionJournalDirPath", app.completionJournalDirPath,
+			"tokenQuotasDirPath", app.tokenQuotasDirPath,
+			"fileUploadsDirPath", app.fileUploadsDirPath,
 		)
 		panic("failed to initialize app: invalid path configuration")
 	}
@@ -76,6 +91,7 @@ func NewApp() *App {
 	app.modelPresetStoreAPI = &ModelPresetStoreWrapper{}
 	app.promptTemplateStoreAPI = &PromptTemplateStoreWrapper{}
 	app.toolStoreAPI = &ToolStoreWrapper{}
+	app.batchJobManagerAPI = &BatchJobManagerWrapper{}
 
 	if err := os.MkdirAll(app.settingsDirPath, os.FileMode(0o770)); err != nil {
 		slog.Error(
@@ -117,6 +133,14 @@ func NewApp() *App {
 		)
 		panic("failed to initialize app: could not create tools directory")
 	}
+	if err := os.MkdirAll(app.batchJobsDirPath, os.FileMode(0o770)); err != nil {
+		slog.Error(
+			"failed to create batch jobs directory",
+			"batch jobs path", app.batchJobsDirPath,
+			"error", err,
+		)
+		panic("failed to initialize app: could not create batch jobs directory")
+	}
 	slog.Info(
 		"flexiGPT paths initialized",
 		"app data", app.dataBasePath,
@@ -125,6 +149,10 @@ func NewApp() *App {
 		"modelPresetsDirPath", app.modelPresetsDirPath,
 		"promptsDirPath", app.promptsDirPath,
 		"toolsDirPath", app.toolsDirPath,
+		"batchJobsDirPath", app.batchJobsDirPath,
+		"completionJournalDirPath", app.completionJournalDirPath,
+		"tokenQuotasDirPath", app.tokenQuotasDirPath,
+		"fileUploadsDirPath", app.fileUploadsDirPath,
 	)
 	return app
 }
@@ -338,7 +366,7 @@ func (a *App) initManagers() {
 	}
 	slog.Info("prompt store initialized", "directory", a.promptsDirPath)
 
-	err = InitToolStoreWrapper(a.toolStoreAPI, a.toolsDirPath)
+	err = InitToolStoreWrapper(a.toolStoreAPI, a.toolsDirPath, a.settingStoreAPI, toolNetworkPolicyFromEnv())
 	if err != nil {
 		slog.Error(
 			"couldn't initialize tool store",
@@ -348,7 +376,14 @@ func (a *App) initManagers() {
 		panic("failed to initialize managers: tool store initialization failed")
 	}
 
-	err = InitProviderSetWrapper(a.providerSetAPI, a.toolStoreAPI.store)
+	err = InitProviderSetWrapper(
+		a.providerSetAPI,
+		a.toolStoreAPI.store,
+		a.conversationStoreAPI.store,
+		a.completionJournalDirPath,
+		a.tokenQuotasDirPath,
+		a.fileUploadsDirPath,
+	)
 	if err != nil {
 		slog.Error(
 			"couldn't initialize provider set",
@@ -383,6 +418,23 @@ func (a *App) initManagers() {
 		panic("failed to initialize managers: model presets store initialization failed")
 	}
 	slog.Info("model presets store initialized", "dir", a.modelPresetsDirPath)
+
+	err = InitBatchJobManagerWrapper(
+		a.batchJobManagerAPI,
+		a.providerSetAPI,
+		a.modelPresetStoreAPI,
+		a.promptTemplateStoreAPI,
+		a.batchJobsDirPath,
+	)
+	if err != nil {
+		slog.Error(
+			"couldn't initialize batch job manager",
+			"dir", a.batchJobsDirPath,
+			"error", err,
+		)
+		panic("failed to initialize managers: batch job manager initialization failed")
+	}
+	slog.Info("batch job manager initialized", "dir", a.batchJobsDirPath)
 }
 
 // startup is called at application startup.
@@ -408,6 +460,14 @@ func (a *App) beforeClose(ctx context.Context) (prevent bool) { //nolint:all
 // shutdown is called at application termination.
 func (a *App) shutdown(ctx context.Context) { //nolint:all
 	// Perform your teardown here.
+	if a.batchJobManagerAPI != nil && a.batchJobManagerAPI.manager != nil {
+		// Running jobs stay unfinished on disk and resume on the next start.
+		a.batchJobManagerAPI.manager.Close()
+	}
+	if a.toolStoreAPI != nil && a.toolStoreAPI.store != nil {
+		// Stops the servers of MCP bundles.
+		a.toolStoreAPI.store.Close()
+	}
 }
 
 var defaultRuntimeFilters = func() []runtime.FileFilter {
@@ -101,6 +101,7 @@ func main() {
 			app.modelPresetStoreAPI,
 			app.promptTemplateStoreAPI,
 			app.toolStoreAPI,
+			app.batchJobManagerAPI,
 		},
 
 		Windows: &windows.Options{
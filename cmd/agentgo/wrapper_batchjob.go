@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/flexigpt/flexigpt-app/internal/batchjob"
+	"github.com/flexigpt/flexigpt-app/internal/batchjob/spec"
+	"github.com/flexigpt/flexigpt-app/internal/middleware"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+)
+
+type BatchJobManagerWrapper struct {
+	manager *batchjob.BatchJobManager
+}
+
+// InitBatchJobManagerWrapper starts the manager. Unfinished jobs resume as their providers become ready.
+func InitBatchJobManagerWrapper(
+	w *BatchJobManagerWrapper,
+	providerSetWrapper *ProviderSetWrapper,
+	modelPresetStoreWrapper *ModelPresetStoreWrapper,
+	promptTemplateStoreWrapper *PromptTemplateStoreWrapper,
+	batchJobsDir string,
+) error {
+	if w == nil || providerSetWrapper == nil || modelPresetStoreWrapper == nil || promptTemplateStoreWrapper == nil {
+		panic("initialising BatchJobManagerWrapper with <nil> receivers")
+	}
+	m, err := batchjob.NewBatchJobManager(
+		batchJobsDir,
+		providerSetWrapper.providersetAPI,
+		modelPresetStoreWrapper.store,
+		batchjob.WithLogger(slog.Default()),
+		batchjob.WithPromptTemplateGetter(promptTemplateStoreWrapper.store),
+	)
+	if err != nil {
+		return err
+	}
+	w.manager = m
+	// Unfinished jobs resume once their provider has a key, which for configured providers is right away.
+	providerSetWrapper.providersetAPI.SetProviderReadyFunc(func(provider inferencegoSpec.ProviderName) {
+		m.ResumeJobs(provider)
+	})
+	return nil
+}
+
+func (w *BatchJobManagerWrapper) CreateBatchJob(
+	req *spec.CreateBatchJobRequest,
+) (*spec.CreateBatchJobResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.CreateBatchJobResponse, error) {
+		return w.manager.CreateBatchJob(context.Background(), req)
+	})
+}
+
+func (w *BatchJobManagerWrapper) ListBatchJobs(
+	req *spec.ListBatchJobsRequest,
+) (*spec.ListBatchJobsResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.ListBatchJobsResponse, error) {
+		return w.manager.ListBatchJobs(context.Background(), req)
+	})
+}
+
+func (w *BatchJobManagerWrapper) GetBatchJob(
+	req *spec.GetBatchJobRequest,
+) (*spec.GetBatchJobResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.GetBatchJobResponse, error) {
+		return w.manager.GetBatchJob(context.Background(), req)
+	})
+}
+
+func (w *BatchJobManagerWrapper) CancelBatchJob(
+	req *spec.CancelBatchJobRequest,
+) (*spec.CancelBatchJobResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.CancelBatchJobResponse, error) {
+		return w.manager.CancelBatchJob(context.Background(), req)
+	})
+}
+
+func (w *BatchJobManagerWrapper) GetBatchJobResults(
+	req *spec.GetBatchJobResultsRequest,
+) (*spec.GetBatchJobResultsResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.GetBatchJobResultsResponse, error) {
+		return w.manager.GetBatchJobResults(context.Background(), req)
+	})
+}
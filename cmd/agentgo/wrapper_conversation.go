@@ -75,3 +75,11 @@ func (ccw *ConversationCollectionWrapper) PutMessagesToConversation(
 		return ccw.store.PutMessagesToConversation(context.Background(), req)
 	})
 }
+
+func (ccw *ConversationCollectionWrapper) ListConversationSources(
+	req *spec.ListConversationSourcesRequest,
+) (*spec.ListConversationSourcesResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.ListConversationSourcesResponse, error) {
+		return ccw.store.ListConversationSources(context.Background(), req)
+	})
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"context"
+	"log/slog"
 
 	inferencewrapperSpec "github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
 	"github.com/flexigpt/flexigpt-app/internal/middleware"
@@ -38,6 +39,8 @@ func InitModelPresetStoreWrapper(
 	m.store = s
 	m.settingStoreWrapper = settingStoreWrapper
 	m.providerSetWrapper = providerSetWrapper
+	m.providerSetWrapper.providersetAPI.SetModelRouter(s)
+	m.providerSetWrapper.providersetAPI.SetModelPresetLister(s)
 	err = InitProviderSetUsingSettingsAndPresets(
 		m,
 		m.settingStoreWrapper,
@@ -85,6 +88,7 @@ func (w *ModelPresetStoreWrapper) PutProviderPreset(
 					ChatCompletionPathPrefix: req.Body.ChatCompletionPathPrefix,
 					APIKeyHeaderKey:          req.Body.APIKeyHeaderKey,
 					DefaultHeaders:           req.Body.DefaultHeaders,
+					RateLimits:               req.Body.RateLimits,
 				},
 			}); err != nil {
 			return nil, err
@@ -101,7 +105,25 @@ func (w *ModelPresetStoreWrapper) PatchProviderPreset(
 	req *spec.PatchProviderPresetRequest,
 ) (*spec.PatchProviderPresetResponse, error) {
 	return middleware.WithRecoveryResp(func() (*spec.PatchProviderPresetResponse, error) {
-		return w.store.PatchProviderPreset(context.Background(), req)
+		resp, err := w.store.PatchProviderPreset(context.Background(), req)
+		if err != nil {
+			return nil, err
+		}
+		if req.Body.RateLimits != nil {
+			// Presets are the source of truth; a provider that is not loaded picks the limits up when it is added.
+			if _, err := w.providerSetWrapper.SetProviderRateLimits(
+				&inferencewrapperSpec.SetProviderRateLimitsRequest{
+					Provider: inferencegoSpec.ProviderName(string(req.ProviderName)),
+					Body: &inferencewrapperSpec.SetProviderRateLimitsRequestBody{
+						RateLimits: req.Body.RateLimits,
+					},
+				},
+			); err != nil {
+				slog.Warn("patchProviderPreset: could not apply rate limits",
+					"provider", req.ProviderName, "err", err)
+			}
+		}
+		return resp, nil
 	})
 }
 
@@ -162,3 +184,35 @@ func (w *ModelPresetStoreWrapper) DeleteModelPreset(
 		return w.store.DeleteModelPreset(context.Background(), req)
 	})
 }
+
+func (w *ModelPresetStoreWrapper) PutModelRouter(
+	req *spec.PutModelRouterRequest,
+) (*spec.PutModelRouterResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.PutModelRouterResponse, error) {
+		return w.store.PutModelRouter(context.Background(), req)
+	})
+}
+
+func (w *ModelPresetStoreWrapper) DeleteModelRouter(
+	req *spec.DeleteModelRouterRequest,
+) (*spec.DeleteModelRouterResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.DeleteModelRouterResponse, error) {
+		return w.store.DeleteModelRouter(context.Background(), req)
+	})
+}
+
+func (w *ModelPresetStoreWrapper) ListModelRouters(
+	req *spec.ListModelRoutersRequest,
+) (*spec.ListModelRoutersResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.ListModelRoutersResponse, error) {
+		return w.store.ListModelRouters(context.Background(), req)
+	})
+}
+
+func (w *ModelPresetStoreWrapper) ResolveModelRoute(
+	req *spec.ResolveModelRouteRequest,
+) (*spec.ResolveModelRouteResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.ResolveModelRouteResponse, error) {
+		return w.store.ResolveModelRoute(context.Background(), req)
+	})
+}
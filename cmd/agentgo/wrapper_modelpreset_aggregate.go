@@ -125,6 +125,7 @@ func initProviders(
 			ChatCompletionPathPrefix: pp.ChatCompletionPathPrefix,
 			APIKeyHeaderKey:          pp.APIKeyHeaderKey,
 			DefaultHeaders:           pp.DefaultHeaders,
+			RateLimits:               pp.RateLimits,
 		}
 		r := &inferencewrapperSpec.AddProviderRequest{
 			Provider: inferencegoSpec.ProviderName(string(pp.Name)),
@@ -3,16 +3,13 @@ package main
 import (
 	"context"
 	"errors"
-	"fmt"
 	"log/slog"
-	"runtime/debug"
-	"sync"
-	"time"
 
 	"github.com/flexigpt/inference-go/debugclient"
 	inferencegoSpec "github.com/flexigpt/inference-go/spec"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 
+	conversationStore "github.com/flexigpt/flexigpt-app/internal/conversation/store"
 	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper"
 	inferencewrapperSpec "github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
 	"github.com/flexigpt/flexigpt-app/internal/middleware"
@@ -20,21 +17,27 @@ import (
 )
 
 type ProviderSetWrapper struct {
-	providersetAPI      *inferencewrapper.ProviderSetAPI
-	appContext          context.Context
-	completionCancelMux sync.Mutex
-	completionCancels   map[string]context.CancelFunc
-	preCanceled         map[string]time.Time
+	providersetAPI *inferencewrapper.ProviderSetAPI
+	appContext     context.Context
 }
 
 // InitProviderSetWrapper creates a new ProviderSet with the specified default provider.
+// Partial streamed output is journaled in journalDir and recovered into the conversation store. Token quotas are
+// kept in quotaDir and the file IDs of attachments uploaded to providers in uploadDir.
 func InitProviderSetWrapper(
 	ps *ProviderSetWrapper,
 	ts *toolStore.ToolStore,
+	cs *conversationStore.ConversationCollection,
+	journalDir string,
+	quotaDir string,
+	uploadDir string,
 ) error {
 	p, err := inferencewrapper.NewProviderSetAPI(
 		ts,
 		inferencewrapper.WithLogger(slog.Default()),
+		inferencewrapper.WithRecoveryJournal(journalDir, cs),
+		inferencewrapper.WithTokenQuotas(quotaDir),
+		inferencewrapper.WithFileUploads(uploadDir),
 		inferencewrapper.WithDebugConfig(&debugclient.DebugConfig{
 			Disable:                 false,
 			DisableRequestBody:      false,
@@ -47,8 +50,6 @@ func InitProviderSetWrapper(
 		return errors.Join(err, errors.New("invalid default provider"))
 	}
 	ps.providersetAPI = p
-	ps.completionCancels = map[string]context.CancelFunc{}
-	ps.preCanceled = map[string]time.Time{}
 
 	return nil
 }
@@ -81,6 +82,48 @@ func (w *ProviderSetWrapper) SetProviderAPIKey(
 	})
 }
 
+func (w *ProviderSetWrapper) CheckProvider(
+	req *inferencewrapperSpec.CheckProviderRequest,
+) (*inferencewrapperSpec.CheckProviderResponse, error) {
+	return middleware.WithRecoveryResp(func() (*inferencewrapperSpec.CheckProviderResponse, error) {
+		return w.providersetAPI.CheckProvider(context.Background(), req)
+	})
+}
+
+func (w *ProviderSetWrapper) SetProviderRateLimits(
+	req *inferencewrapperSpec.SetProviderRateLimitsRequest,
+) (*inferencewrapperSpec.SetProviderRateLimitsResponse, error) {
+	return middleware.WithRecoveryResp(func() (*inferencewrapperSpec.SetProviderRateLimitsResponse, error) {
+		return w.providersetAPI.SetProviderRateLimits(context.Background(), req)
+	})
+}
+
+func (w *ProviderSetWrapper) ListProviderQueueStats(
+	req *inferencewrapperSpec.ListProviderQueueStatsRequest,
+) (*inferencewrapperSpec.ListProviderQueueStatsResponse, error) {
+	return middleware.WithRecoveryResp(func() (*inferencewrapperSpec.ListProviderQueueStatsResponse, error) {
+		return w.providersetAPI.ListProviderQueueStats(context.Background(), req)
+	})
+}
+
+// PreviewCompletion returns the hydrated completion request for the provider without sending it.
+func (w *ProviderSetWrapper) PreviewCompletion(
+	provider string,
+	completionData *inferencewrapperSpec.CompletionRequestBody,
+	includeWireJSON bool,
+) (*inferencewrapperSpec.PreviewCompletionResponse, error) {
+	return middleware.WithRecoveryResp(func() (*inferencewrapperSpec.PreviewCompletionResponse, error) {
+		return w.providersetAPI.PreviewCompletion(
+			context.Background(),
+			&inferencewrapperSpec.PreviewCompletionRequest{
+				Provider:        inferencegoSpec.ProviderName(provider),
+				IncludeWireJSON: includeWireJSON,
+				Body:            completionData,
+			},
+		)
+	})
+}
+
 // FetchCompletion handles the completion request and streams data back to the frontend.
 func (w *ProviderSetWrapper) FetchCompletion(
 	provider string,
@@ -96,41 +139,14 @@ func (w *ProviderSetWrapper) FetchCompletion(
 		if w.appContext == nil {
 			return nil, errors.New("appContext is not set (call SetWrappedProviderAppContext during startup)")
 		}
-		if w.completionCancels == nil {
-			w.completionCancels = map[string]context.CancelFunc{}
-		}
-		if w.preCanceled == nil {
-			w.preCanceled = map[string]time.Time{}
-		}
-
+		// The registry in the provider set owns cancellation; this context only ties the call to the app lifetime.
 		ctx, cancel := context.WithCancel(w.appContext)
 		defer cancel()
 
-		w.completionCancelMux.Lock()
-		// If a cancel arrived before the fetch registered, honor it.
-		if _, ok := w.preCanceled[requestID]; ok {
-			delete(w.preCanceled, requestID)
-			w.completionCancelMux.Unlock()
-			return nil, context.Canceled
-		}
-		// Protect against requestID reuse while in-flight.
-		if _, exists := w.completionCancels[requestID]; exists {
-			w.completionCancelMux.Unlock()
-			return nil, errors.New("duplicate requestID: a completion with this id is already in flight")
-		}
-
-		w.completionCancels[requestID] = cancel
-		w.completionCancelMux.Unlock()
-
-		defer func() {
-			w.completionCancelMux.Lock()
-			delete(w.completionCancels, requestID)
-			w.completionCancelMux.Unlock()
-		}()
-
 		req := &inferencewrapperSpec.CompletionRequest{
-			Provider: inferencegoSpec.ProviderName(provider),
-			Body:     completionData,
+			Provider:  inferencegoSpec.ProviderName(provider),
+			RequestID: requestID,
+			Body:      completionData,
 		}
 
 		if textCallbackID != "" {
@@ -153,72 +169,128 @@ func (w *ProviderSetWrapper) FetchCompletion(
 				return nil
 			}
 		}
-		resp, err := w.providersetAPI.FetchCompletion(
-			ctx,
-			req,
-		)
-		if err != nil {
-			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-				// Expected lifecycle event; return partial resp if present without noisy error logging.
-				if resp != nil {
-					return resp, nil
+		return w.fetchCompletion(ctx, req)
+	})
+}
+
+// FetchCompletionWithEvents is FetchCompletion with all stream events (text and thinking deltas, tool calls,
+// citations, usage and errors) emitted as spec.StreamEvent JSON on the single eventCallbackID channel.
+func (w *ProviderSetWrapper) FetchCompletionWithEvents(
+	provider string,
+	completionData *inferencewrapperSpec.CompletionRequestBody,
+	eventCallbackID string,
+	requestID string,
+) (*inferencewrapperSpec.CompletionResponse, error) {
+	return middleware.WithRecoveryResp(func() (*inferencewrapperSpec.CompletionResponse, error) {
+		if requestID == "" {
+			return nil, errors.New("requestID is empty")
+		}
+		if w.appContext == nil {
+			return nil, errors.New("appContext is not set (call SetWrappedProviderAppContext during startup)")
+		}
+		ctx, cancel := context.WithCancel(w.appContext)
+		defer cancel()
+
+		req := &inferencewrapperSpec.CompletionRequest{
+			Provider:  inferencegoSpec.ProviderName(provider),
+			RequestID: requestID,
+			Body:      completionData,
+		}
+		if eventCallbackID != "" {
+			req.OnStreamEvent = func(ev inferencewrapperSpec.StreamEvent) error {
+				if err := ctx.Err(); err != nil {
+					return err
 				}
-				return nil, err
+				//nolint:contextcheck // Need to pass app context here and not new context.
+				runtime.EventsEmit(w.appContext, eventCallbackID, ev)
+				return nil
 			}
-			// If we have a partial response, attach error info there and return it.
-			if resp != nil && resp.Body != nil && resp.Body.InferenceResponse != nil {
-				if resp.Body.InferenceResponse.Error == nil {
-					resp.Body.InferenceResponse.Error = &inferencegoSpec.Error{
-						Message: err.Error(),
-					}
-				}
-				// Log, but do not propagate Go error so Wails resolves the Promise.
-				slog.Error("fetchCompletion failed", "provider", provider, "err", err)
+		}
+		return w.fetchCompletion(ctx, req)
+	})
+}
+
+// fetchCompletion runs the completion and turns provider errors into an error on the partial response, so that the
+// frontend gets whatever was produced.
+func (w *ProviderSetWrapper) fetchCompletion(
+	ctx context.Context,
+	req *inferencewrapperSpec.CompletionRequest,
+) (*inferencewrapperSpec.CompletionResponse, error) {
+	resp, err := w.providersetAPI.FetchCompletion(ctx, req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			// Expected lifecycle event; return partial resp if present without noisy error logging.
+			if resp != nil {
 				return resp, nil
 			}
-			// No response at all => infrastructure error.
 			return nil, err
 		}
-
-		return resp, nil
-	})
+		// If we have a partial response, attach error info there and return it.
+		if resp != nil && resp.Body != nil && resp.Body.InferenceResponse != nil {
+			if resp.Body.InferenceResponse.Error == nil {
+				resp.Body.InferenceResponse.Error = &inferencegoSpec.Error{
+					Message: err.Error(),
+				}
+			}
+			// Log, but do not propagate Go error so Wails resolves the Promise.
+			slog.Error("fetchCompletion failed", "provider", req.Provider, "err", err)
+			return resp, nil
+		}
+		// No response at all => infrastructure error.
+		return nil, err
+	}
+	return resp, nil
 }
 
 func (w *ProviderSetWrapper) CancelCompletion(id string) error {
-	var err error
-	defer func() {
-		if r := recover(); r != nil {
-			// Log the panic plus stack trace.
-			slog.Error("panic recovered",
-				slog.Any("panic", r),
-				slog.String("stacktrace", string(debug.Stack())),
-			)
-
-			// Overwrite err so the caller sees we failed.
-			err = fmt.Errorf("panic recovered: %v", r)
-		}
-	}()
-
 	if id == "" {
-		return err
-	}
-	w.completionCancelMux.Lock()
-	defer w.completionCancelMux.Unlock()
-	if c, ok := w.completionCancels[id]; ok {
-		c()
-		delete(w.completionCancels, id)
-		return err
+		return nil
 	}
+	_, err := middleware.WithRecoveryResp(func() (*inferencewrapperSpec.CancelCompletionResponse, error) {
+		return w.providersetAPI.CancelCompletion(
+			context.Background(),
+			&inferencewrapperSpec.CancelCompletionRequest{RequestID: id},
+		)
+	})
+	return err
+}
 
-	// Cancel arrived before FetchCompletion registered the cancel func.
-	w.preCanceled[id] = time.Now()
+func (w *ProviderSetWrapper) ListActiveCompletions(
+	req *inferencewrapperSpec.ListActiveCompletionsRequest,
+) (*inferencewrapperSpec.ListActiveCompletionsResponse, error) {
+	return middleware.WithRecoveryResp(func() (*inferencewrapperSpec.ListActiveCompletionsResponse, error) {
+		return w.providersetAPI.ListActiveCompletions(context.Background(), req)
+	})
+}
 
-	// Best-effort pruning to avoid unbounded growth.
-	cutoff := time.Now().Add(-2 * time.Minute)
-	for k, t := range w.preCanceled {
-		if t.Before(cutoff) {
-			delete(w.preCanceled, k)
-		}
-	}
-	return err
+func (w *ProviderSetWrapper) GetCompletionStatus(
+	req *inferencewrapperSpec.GetCompletionStatusRequest,
+) (*inferencewrapperSpec.GetCompletionStatusResponse, error) {
+	return middleware.WithRecoveryResp(func() (*inferencewrapperSpec.GetCompletionStatusResponse, error) {
+		return w.providersetAPI.GetCompletionStatus(context.Background(), req)
+	})
+}
+
+func (w *ProviderSetWrapper) SetTokenQuota(
+	req *inferencewrapperSpec.SetTokenQuotaRequest,
+) (*inferencewrapperSpec.SetTokenQuotaResponse, error) {
+	return middleware.WithRecoveryResp(func() (*inferencewrapperSpec.SetTokenQuotaResponse, error) {
+		return w.providersetAPI.SetTokenQuota(context.Background(), req)
+	})
+}
+
+func (w *ProviderSetWrapper) DeleteTokenQuota(
+	req *inferencewrapperSpec.DeleteTokenQuotaRequest,
+) (*inferencewrapperSpec.DeleteTokenQuotaResponse, error) {
+	return middleware.WithRecoveryResp(func() (*inferencewrapperSpec.DeleteTokenQuotaResponse, error) {
+		return w.providersetAPI.DeleteTokenQuota(context.Background(), req)
+	})
+}
+
+func (w *ProviderSetWrapper) ListTokenQuotas(
+	req *inferencewrapperSpec.ListTokenQuotasRequest,
+) (*inferencewrapperSpec.ListTokenQuotasResponse, error) {
+	return middleware.WithRecoveryResp(func() (*inferencewrapperSpec.ListTokenQuotasResponse, error) {
+		return w.providersetAPI.ListTokenQuotas(context.Background(), req)
+	})
 }
@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
 
 	"github.com/flexigpt/flexigpt-app/internal/middleware"
+	settingStore "github.com/flexigpt/flexigpt-app/internal/setting/store"
 	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
 	toolStore "github.com/flexigpt/flexigpt-app/internal/tool/store"
 )
@@ -12,13 +17,28 @@ type ToolStoreWrapper struct {
 	store *toolStore.ToolStore
 }
 
+// Environment variables with the global network policy of HTTP tools, as comma separated lists.
+const (
+	toolAllowedHostsEnv = "FLEXIGPT_TOOL_ALLOWED_HOSTS"
+	toolDeniedCIDRsEnv  = "FLEXIGPT_TOOL_DENIED_CIDRS"
+)
+
 func InitToolStoreWrapper(
 	t *ToolStoreWrapper,
 	toolDir string,
+	settings *SettingStoreWrapper,
+	networkPolicy spec.HTTPNetworkPolicy,
 ) error {
+	tokenEncoder, err := settingStore.NewSecretEncoderDecoder()
+	if err != nil {
+		return err
+	}
 	toolStoreAPI, err := toolStore.NewToolStore(
 		toolDir,
 		toolStore.WithFTS(true),
+		toolStore.WithHTTPNetworkPolicy(networkPolicy),
+		toolStore.WithSecretResolver(settingSecretResolver{settings: settings}),
+		toolStore.WithOAuth2TokenEncoder(tokenEncoder),
 	)
 	if err != nil {
 		return err
@@ -27,6 +47,38 @@ func InitToolStoreWrapper(
 	return nil
 }
 
+// toolNetworkPolicyFromEnv reads the global network policy of HTTP tools. Without denied CIDRs,
+// spec.DefaultHTTPDeniedCIDRs apply.
+func toolNetworkPolicyFromEnv() spec.HTTPNetworkPolicy {
+	return spec.HTTPNetworkPolicy{
+		AllowedHosts: splitEnvList(os.Getenv(toolAllowedHostsEnv)),
+		DeniedCIDRs:  splitEnvList(os.Getenv(toolDeniedCIDRsEnv)),
+	}
+}
+
+func splitEnvList(s string) []string {
+	var out []string
+	for part := range strings.SplitSeq(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// settingSecretResolver resolves secret references of HTTP tools from the settings store, which is initialized
+// after the tool store.
+type settingSecretResolver struct {
+	settings *SettingStoreWrapper
+}
+
+func (r settingSecretResolver) ResolveSecret(ctx context.Context, ref string) (string, error) {
+	if r.settings == nil || r.settings.store == nil {
+		return "", errors.New("settings store is not initialized")
+	}
+	return r.settings.store.ResolveSecret(ctx, ref)
+}
+
 func (tbw *ToolStoreWrapper) PutToolBundle(
 	req *spec.PutToolBundleRequest,
 ) (*spec.PutToolBundleResponse, error) {
@@ -59,6 +111,25 @@ func (tbw *ToolStoreWrapper) ListToolBundles(
 	})
 }
 
+func (tbw *ToolStoreWrapper) ImportOpenAPIBundle(
+	req *spec.ImportOpenAPIBundleRequest,
+) (*spec.ImportOpenAPIBundleResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.ImportOpenAPIBundleResponse, error) {
+		// The store only takes document content; a local file is read here.
+		if req != nil && req.Body != nil && req.Body.FilePath != "" {
+			data, err := os.ReadFile(req.Body.FilePath)
+			if err != nil {
+				return nil, fmt.Errorf("read openapi document: %w", err)
+			}
+			body := *req.Body
+			body.Document = string(data)
+			body.FilePath = ""
+			req = &spec.ImportOpenAPIBundleRequest{BundleID: req.BundleID, Body: &body}
+		}
+		return tbw.store.ImportOpenAPIBundle(context.Background(), req)
+	})
+}
+
 func (tbw *ToolStoreWrapper) PutTool(
 	req *spec.PutToolRequest,
 ) (*spec.PutToolResponse, error) {
@@ -114,3 +185,19 @@ func (tbw *ToolStoreWrapper) SearchTools(
 		return tbw.store.SearchTools(context.Background(), req)
 	})
 }
+
+func (tbw *ToolStoreWrapper) GetMCPServerStatus(
+	req *spec.GetMCPServerStatusRequest,
+) (*spec.GetMCPServerStatusResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.GetMCPServerStatusResponse, error) {
+		return tbw.store.GetMCPServerStatus(context.Background(), req)
+	})
+}
+
+func (tbw *ToolStoreWrapper) RestartMCPServer(
+	req *spec.RestartMCPServerRequest,
+) (*spec.RestartMCPServerResponse, error) {
+	return middleware.WithRecoveryResp(func() (*spec.RestartMCPServerResponse, error) {
+		return tbw.store.RestartMCPServer(context.Background(), req)
+	})
+}
@@ -4,13 +4,16 @@ import (
 	"log/slog"
 	"os"
 
+	"github.com/flexigpt/flexigpt-app/internal/batchjob"
 	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper"
 	"github.com/flexigpt/inference-go/debugclient"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
 
 	conversationStore "github.com/flexigpt/flexigpt-app/internal/conversation/store"
 	modelpresetStore "github.com/flexigpt/flexigpt-app/internal/modelpreset/store"
 	promptStore "github.com/flexigpt/flexigpt-app/internal/prompt/store"
 	settingStore "github.com/flexigpt/flexigpt-app/internal/setting/store"
+	toolSpec "github.com/flexigpt/flexigpt-app/internal/tool/spec"
 	toolStore "github.com/flexigpt/flexigpt-app/internal/tool/store"
 )
 
@@ -21,19 +24,29 @@ type BackendApp struct {
 	modelPresetStoreAPI    *modelpresetStore.ModelPresetStore
 	promptTemplateStoreAPI *promptStore.PromptTemplateStore
 	toolStoreAPI           *toolStore.ToolStore
+	batchJobManagerAPI     *batchjob.BatchJobManager
 
-	settingsDirPath      string
-	conversationsDirPath string
-	modelPresetsDirPath  string
-	promptsDirPath       string
-	toolsDirPath         string
+	settingsDirPath          string
+	conversationsDirPath     string
+	modelPresetsDirPath      string
+	promptsDirPath           string
+	toolsDirPath             string
+	batchJobsDirPath         string
+	completionJournalDirPath string
+	tokenQuotasDirPath       string
+	fileUploadsDirPath       string
+
+	toolNetworkPolicy toolSpec.HTTPNetworkPolicy
 }
 
 func NewBackendApp(
-	settingsDirPath, conversationsDirPath, modelPresetsDirPath, promptsDirPath, toolsDirPath string,
+	settingsDirPath, conversationsDirPath, modelPresetsDirPath, promptsDirPath, toolsDirPath, batchJobsDirPath,
+	completionJournalDirPath, tokenQuotasDirPath, fileUploadsDirPath string,
+	toolNetworkPolicy toolSpec.HTTPNetworkPolicy,
 ) *BackendApp {
 	if settingsDirPath == "" || conversationsDirPath == "" ||
-		modelPresetsDirPath == "" || promptsDirPath == "" || toolsDirPath == "" {
+		modelPresetsDirPath == "" || promptsDirPath == "" || toolsDirPath == "" || batchJobsDirPath == "" ||
+		completionJournalDirPath == "" || tokenQuotasDirPath == "" || fileUploadsDirPath == "" {
 		slog.Error(
 			"invalid app path configuration",
 			"settingsDirPath", settingsDirPath,
@@ -41,6 +54,10 @@ func NewBackendApp(
 			"modelPresetsDirPath", modelPresetsDirPath,
 			"promptsDirPath", promptsDirPath,
 			"toolsDirPath", toolsDirPath,
+			"batchJobsDirPath", batchJobsDirPath,
+			"completionJournalDirPath", completionJournalDirPath,
+			"tokenQuotasDirPath", tokenQuotasDirPath,
+			"fileUploadsDirPath", fileUploadsDirPath,
 		)
 		panic("failed to initialize BackendApp: invalid path configuration")
 	}
@@ -51,6 +68,13 @@ func NewBackendApp(
 		modelPresetsDirPath:  modelPresetsDirPath,
 		promptsDirPath:       promptsDirPath,
 		toolsDirPath:         toolsDirPath,
+		batchJobsDirPath:     batchJobsDirPath,
+
+		completionJournalDirPath: completionJournalDirPath,
+		tokenQuotasDirPath:       tokenQuotasDirPath,
+		fileUploadsDirPath:       fileUploadsDirPath,
+
+		toolNetworkPolicy: toolNetworkPolicy,
 	}
 
 	app.initSettingsStore()
@@ -59,6 +83,7 @@ func NewBackendApp(
 	app.initProviderSet()
 	app.initModelPresetStore()
 	app.initPromptTemplateStore()
+	app.initBatchJobManager()
 	return app
 }
 
@@ -131,6 +156,8 @@ func (a *BackendApp) initModelPresetStore() {
 		panic("failed to initialize BackendApp: model presets store initialization failed")
 	}
 	a.modelPresetStoreAPI = ms
+	a.providerSetAPI.SetModelRouter(ms)
+	a.providerSetAPI.SetModelPresetLister(ms)
 
 	slog.Info("model presets store initialized", "filepath", a.modelPresetsDirPath)
 }
@@ -171,9 +198,17 @@ func (a *BackendApp) initToolStore() {
 		panic("failed to initialize BackendApp: could not create tools directory")
 	}
 
+	tokenEncoder, err := settingStore.NewSecretEncoderDecoder()
+	if err != nil {
+		slog.Error("couldn't get the tool token encoder", "error", err)
+		panic("failed to initialize BackendApp: tool token encoder initialization failed")
+	}
 	ps, err := toolStore.NewToolStore(
 		a.toolsDirPath,
 		toolStore.WithFTS(true),
+		toolStore.WithHTTPNetworkPolicy(a.toolNetworkPolicy),
+		toolStore.WithSecretResolver(a.settingStoreAPI),
+		toolStore.WithOAuth2TokenEncoder(tokenEncoder),
 	)
 	if err != nil {
 		slog.Error(
@@ -191,6 +226,9 @@ func (a *BackendApp) initProviderSet() {
 	p, err := inferencewrapper.NewProviderSetAPI(
 		a.toolStoreAPI,
 		inferencewrapper.WithLogger(slog.Default()),
+		inferencewrapper.WithRecoveryJournal(a.completionJournalDirPath, a.conversationStoreAPI),
+		inferencewrapper.WithTokenQuotas(a.tokenQuotasDirPath),
+		inferencewrapper.WithFileUploads(a.fileUploadsDirPath),
 		inferencewrapper.WithDebugConfig(&debugclient.DebugConfig{
 			Disable:                 false,
 			DisableRequestBody:      false,
@@ -208,3 +246,36 @@ func (a *BackendApp) initProviderSet() {
 	}
 	a.providerSetAPI = p
 }
+
+func (a *BackendApp) initBatchJobManager() {
+	if err := os.MkdirAll(a.batchJobsDirPath, os.FileMode(0o770)); err != nil {
+		slog.Error(
+			"failed to create batch jobs directory",
+			"batchJobsDirPath", a.batchJobsDirPath,
+			"error", err,
+		)
+		panic("failed to initialize BackendApp: could not create batch jobs directory")
+	}
+
+	m, err := batchjob.NewBatchJobManager(
+		a.batchJobsDirPath,
+		a.providerSetAPI,
+		a.modelPresetStoreAPI,
+		batchjob.WithLogger(slog.Default()),
+		batchjob.WithPromptTemplateGetter(a.promptTemplateStoreAPI),
+	)
+	if err != nil {
+		slog.Error(
+			"couldn't initialize batch job manager",
+			"batchJobsDirPath", a.batchJobsDirPath,
+			"error", err,
+		)
+		panic("failed to initialize BackendApp: batch job manager initialization failed")
+	}
+	a.batchJobManagerAPI = m
+	// Unfinished jobs resume once their provider is added with a key.
+	a.providerSetAPI.SetProviderReadyFunc(func(provider inferencegoSpec.ProviderName) {
+		m.ResumeJobs(provider)
+	})
+	slog.Info("batch job manager initialized", "directory", a.batchJobsDirPath)
+}
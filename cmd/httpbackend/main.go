@@ -4,21 +4,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humago"
 	"github.com/danielgtaylor/huma/v2/humacli"
+	"github.com/flexigpt/flexigpt-app/internal/batchjob"
 	conversationStore "github.com/flexigpt/flexigpt-app/internal/conversation/store"
 	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper"
 	"github.com/flexigpt/flexigpt-app/internal/logrotate"
+	"github.com/flexigpt/flexigpt-app/internal/mcpserver"
 	modelpresetStore "github.com/flexigpt/flexigpt-app/internal/modelpreset/store"
 	promptStore "github.com/flexigpt/flexigpt-app/internal/prompt/store"
 	settingStore "github.com/flexigpt/flexigpt-app/internal/setting/store"
+	toolSpec "github.com/flexigpt/flexigpt-app/internal/tool/spec"
 	toolStore "github.com/flexigpt/flexigpt-app/internal/tool/store"
 
 	// Run registry init.
@@ -27,21 +32,42 @@ import (
 
 // Options for the server cli.
 type Options struct {
-	Host                   string `doc:"Hostname to listen on."                  default:"127.0.0.1"`
-	Port                   int    `doc:"Port to listen on"                       default:"8888"`
-	SettingsDirPath        string `doc:"path to directory of settings file"`
-	ConversationsDirPath   string `doc:"path to conversations directory"`
-	ModelPresetsDirPath    string `doc:"path to modelPresets data directory"`
-	PromptTemplatesDirPath string `doc:"path to prompt templates data directory"`
-	ToolsDirPath           string `doc:"path to tools data directory"`
-	LogsDirPath            string `doc:"path to logs directory"`
-	Debug                  bool   `doc:"Enable debug logs"`
+	Host                     string `doc:"Hostname to listen on."                  default:"127.0.0.1"`
+	Port                     int    `doc:"Port to listen on"                       default:"8888"`
+	SettingsDirPath          string `doc:"path to directory of settings file"`
+	ConversationsDirPath     string `doc:"path to conversations directory"`
+	ModelPresetsDirPath      string `doc:"path to modelPresets data directory"`
+	PromptTemplatesDirPath   string `doc:"path to prompt templates data directory"`
+	ToolsDirPath             string `doc:"path to tools data directory"`
+	BatchJobsDirPath         string `doc:"path to batch jobs data directory"`
+	CompletionJournalDirPath string `doc:"path to directory of the completion recovery journal"`
+	TokenQuotasDirPath       string `doc:"path to directory of token quotas and their consumption"`
+	FileUploadsDirPath       string `doc:"path to directory of the provider file upload cache"`
+	LogsDirPath              string `doc:"path to logs directory"`
+	Debug                    bool   `doc:"Enable debug logs"`
+	MCPTransport             string `doc:"Serve tools and prompts over MCP: 'stdio' instead of the API, 'http' at /mcp"`
+	ToolAllowedHosts         string `doc:"Comma separated hosts HTTP tools may call; '*.example.com' matches subdomains"`
+	ToolDeniedCIDRs          string `doc:"Comma separated CIDRs HTTP tools may not reach; replaces the defaults"`
 }
 
+const (
+	mcpTransportStdio = "stdio"
+	mcpTransportHTTP  = "http"
+	mcpHTTPPath       = "/mcp"
+)
+
 func main() {
 	cli := humacli.New(func(hooks humacli.Hooks, opts *Options) {
 		log.Printf("Options are %+v\n", opts)
-		writer := initSlog(opts.LogsDirPath, opts.Debug)
+		if opts.MCPTransport != "" && opts.MCPTransport != mcpTransportStdio && opts.MCPTransport != mcpTransportHTTP {
+			log.Fatalf("invalid mcp transport %q, want %q or %q", opts.MCPTransport, mcpTransportStdio, mcpTransportHTTP)
+		}
+		// Over stdio, stdout carries the MCP messages.
+		var console io.Writer = os.Stdout
+		if opts.MCPTransport == mcpTransportStdio {
+			console = os.Stderr
+		}
+		writer := initSlog(console, opts.LogsDirPath, opts.Debug)
 		router := http.NewServeMux()
 		api := humago.New(router, huma.DefaultConfig("FlexiGPTServer API", "1.0.0"))
 		app := NewBackendApp(
@@ -50,6 +76,14 @@ func main() {
 			opts.ModelPresetsDirPath,
 			opts.PromptTemplatesDirPath,
 			opts.ToolsDirPath,
+			opts.BatchJobsDirPath,
+			opts.CompletionJournalDirPath,
+			opts.TokenQuotasDirPath,
+			opts.FileUploadsDirPath,
+			toolSpec.HTTPNetworkPolicy{
+				AllowedHosts: splitList(opts.ToolAllowedHosts),
+				DeniedCIDRs:  splitList(opts.ToolDeniedCIDRs),
+			},
 		)
 		settingStore.InitSettingStoreHandlers(api, app.settingStoreAPI)
 		conversationStore.InitConversationStoreHandlers(api, app.conversationStoreAPI)
@@ -57,6 +91,28 @@ func main() {
 		modelpresetStore.InitModelPresetStoreHandlers(api, app.modelPresetStoreAPI)
 		promptStore.InitPromptTemplateStoreHandlers(api, app.promptTemplateStoreAPI)
 		toolStore.InitToolStoreHandlers(api, app.toolStoreAPI)
+		batchjob.InitBatchJobHandlers(api, app.batchJobManagerAPI)
+
+		if opts.MCPTransport != "" {
+			mcpServer, err := mcpserver.NewServer(app.toolStoreAPI, app.promptTemplateStoreAPI)
+			if err != nil {
+				log.Fatalf("mcp server: %s\n", err)
+			}
+			if opts.MCPTransport == mcpTransportStdio {
+				hooks.OnStart(func() {
+					// Serve until the client closes stdin.
+					if err := mcpServer.ServeStdio(context.Background(), os.Stdin, os.Stdout); err != nil {
+						slog.Error("mcp stdio server failed", "error", err)
+					}
+					app.batchJobManagerAPI.Close()
+					app.toolStoreAPI.Close()
+					_ = writer.Close()
+				})
+				return
+			}
+			router.Handle(mcpHTTPPath, mcpServer.HTTPHandler())
+		}
+
 		// Create the HTTP server.
 		server := http.Server{
 			Addr:              fmt.Sprintf("%s:%d", opts.Host, opts.Port),
@@ -75,13 +131,26 @@ func main() {
 			defer cancel()
 			defer writer.Close()
 			_ = server.Shutdown(ctx)
+			app.batchJobManagerAPI.Close()
+			app.toolStoreAPI.Close()
 		})
 	})
 
 	cli.Run()
 }
 
-func initSlog(logsDirPath string, debug bool) *logrotate.Writer {
+// splitList splits a comma separated option, dropping empty entries. An empty option gives nil.
+func splitList(s string) []string {
+	var out []string
+	for part := range strings.SplitSeq(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func initSlog(console io.Writer, logsDirPath string, debug bool) *logrotate.Writer {
 	level := slog.LevelInfo
 	if debug {
 		level = slog.LevelDebug
@@ -90,7 +159,7 @@ func initSlog(logsDirPath string, debug bool) *logrotate.Writer {
 		Level: level,
 	}
 
-	var stdoutHandler slog.Handler = slog.NewTextHandler(os.Stdout, slogOpts)
+	var stdoutHandler slog.Handler = slog.NewTextHandler(console, slogOpts)
 	stdoutLogger := slog.New(stdoutHandler)
 
 	// Init logger.
@@ -76,4 +76,5 @@ export interface PromptTemplateListItem {
 	templateSlug: string;
 	templateVersion: string;
 	isBuiltIn: boolean;
+	templateDefinition: PromptTemplate;
 }
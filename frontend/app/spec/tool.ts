@@ -25,6 +25,8 @@ export enum ToolImplType {
 	Go = 'go',
 	HTTP = 'http',
 	SDK = 'sdk',
+	MCP = 'mcp',
+	Exec = 'exec',
 }
 
 /**
@@ -40,14 +42,69 @@ export interface SDKToolImpl {
 	sdkType: string;
 }
 
+/**
+ * @public
+ */
+export interface HTTPOAuth2 {
+	tokenURL: string;
+	clientIDTemplate?: string; // may contain ${SECRET}
+	clientSecretTemplate?: string; // may contain ${SECRET}
+	refreshTokenTemplate?: string; // oauth2RefreshToken only
+	scopes?: string[];
+	clientAuth?: string; // "basic"(dflt) | "body"
+}
+
 /**
  * @public
  */
 export interface HTTPAuth {
-	type: string;
+	type: string; // "apiKey" | "bearer" | "basic" | "oauth2ClientCredentials" | "oauth2RefreshToken"
 	in?: string; // "header" | "query" (apiKey only)
 	name?: string;
-	valueTemplate: string; // may contain ${SECRET}
+	valueTemplate?: string; // may contain ${SECRET}
+	oauth2?: HTTPOAuth2; // oauth2 types only
+}
+
+/**
+ * @public
+ */
+export interface HTTPNetworkPolicy {
+	allowedHosts?: string[];
+	deniedCIDRs?: string[];
+}
+
+/**
+ * @public
+ */
+export interface HTTPRetryPolicy {
+	maxAttempts?: number; // including the first; default 3
+	statusCodes?: number[];
+	baseDelayMs?: number; // default 500
+	maxDelayMs?: number; // default 30_000
+	retryNonIdempotent?: boolean;
+}
+
+/**
+ * @public
+ */
+export enum HTTPPaginationType {
+	LinkHeader = 'linkHeader',
+	Cursor = 'cursor',
+	Page = 'page',
+}
+
+/**
+ * @public
+ */
+export interface HTTPPagination {
+	type: HTTPPaginationType;
+	itemsPath?: string; // empty: the page is the array
+	cursorPath?: string; // cursor only
+	cursorParam?: string; // cursor only
+	pageParam?: string; // page only
+	startPage?: number; // page only; default 1
+	maxPages?: number; // default 10
+	maxBytes?: number; // total of all pages; default 5 MiB
 }
 
 /**
@@ -61,6 +118,10 @@ export interface HTTPRequest {
 	body?: string; // raw or template
 	auth?: HTTPAuth;
 	timeoutMs?: number; // default 10_000
+	bodyFromArg?: boolean; // body "${x}" sends arg x as JSON
+	networkPolicy?: HTTPNetworkPolicy;
+	retry?: HTTPRetryPolicy;
+	pagination?: HTTPPagination;
 }
 
 /**
@@ -73,6 +134,16 @@ export enum HTTPBodyOutputMode {
 	Image = 'image',
 }
 
+/**
+ * @public
+ */
+export interface HTTPOutputTransform {
+	select?: string; // dot-path or JSONPath into the JSON body
+	fields?: string[];
+	template?: string; // Go text/template
+	maxBytes?: number; // 0: no cap
+}
+
 /**
  * @public
  */
@@ -80,6 +151,28 @@ export interface HTTPResponse {
 	successCodes?: number[]; // default: 2xx
 	errorMode?: string; // "fail"(dflt) | "empty"
 	bodyOutputMode?: HTTPBodyOutputMode;
+	transform?: HTTPOutputTransform;
+}
+
+/**
+ * @public
+ */
+export interface HTTPPoll {
+	until: string; // path into the JSON response body
+	values: string[];
+	intervalMs?: number; // default 1000
+	maxAttempts?: number; // default 10
+}
+
+/**
+ * @public
+ */
+export interface HTTPStep {
+	name: string;
+	request: HTTPRequest;
+	response?: HTTPResponse;
+	extract?: Record<string, string>; // var:path, referenced as ${step:<name>.<var>}
+	poll?: HTTPPoll;
 }
 
 /**
@@ -88,6 +181,68 @@ export interface HTTPResponse {
 export interface HTTPToolImpl {
 	request: HTTPRequest;
 	response: HTTPResponse;
+	steps?: HTTPStep[]; // replaces request and response
+	outputStep?: string; // default: the last step
+}
+
+/**
+ * @public
+ */
+export enum ExecArgsMode {
+	Stdin = 'stdin',
+	Argv = 'argv',
+}
+
+/**
+ * @public
+ */
+export interface ExecToolImpl {
+	command: string; // absolute, relative to workDir, or looked up in PATH
+	args?: string[]; // may contain ${var}
+	argsMode?: ExecArgsMode; // default "stdin"
+	workDir: string;
+	pathArgs?: string[];
+	env?: Record<string, string>;
+	envAllowlist?: string[];
+	outputEncoding?: string; // "text"(dflt) | "json"
+	successExitCodes?: number[]; // default: 0
+	timeoutMs?: number; // default 30_000
+	maxOutputBytes?: number; // default 1 MiB
+}
+
+/**
+ * @public
+ */
+export interface MCPToolImpl {
+	/** Name of the tool on the MCP server; the slug may differ */
+	toolName: string;
+}
+
+/**
+ * @public
+ */
+export enum MCPTransport {
+	Stdio = 'stdio',
+	StreamableHTTP = 'streamableHTTP',
+}
+
+/**
+ * @public
+ */
+export interface MCPServerConfig {
+	transport: MCPTransport;
+
+	// stdio
+	command?: string;
+	args?: string[];
+	env?: Record<string, string>;
+	workDir?: string;
+
+	// streamable HTTP
+	url?: string;
+	headers?: Record<string, string>;
+
+	timeoutMs?: number; // default 60_000
 }
 
 /**
@@ -158,6 +313,8 @@ export interface Tool {
 	goImpl?: GoToolImpl;
 	httpImpl?: HTTPToolImpl;
 	sdkImpl?: SDKToolImpl;
+	mcpImpl?: MCPToolImpl;
+	execImpl?: ExecToolImpl;
 
 	isEnabled: boolean;
 	isBuiltIn: boolean;
@@ -173,6 +330,7 @@ export interface ToolBundle {
 
 	displayName?: string;
 	description?: string;
+	mcpServer?: MCPServerConfig;
 	isEnabled: boolean;
 	isBuiltIn: boolean;
 	createdAt: string;
@@ -17,6 +17,7 @@ require (
 	github.com/ppipada/mapstore-go v0.1.0
 	github.com/wailsapp/wails/v2 v2.11.0
 	golang.org/x/net v0.49.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -324,15 +324,21 @@ func BuildContentBlocks(ctx context.Context, atts []Attachment, opts ...ContentB
 				slog.Warn("got existing att", "a", att)
 
 			case errors.Is(err, ErrAttachmentModifiedSinceSnapshot) && !buildContentOptions.OverrideOriginal:
-				displayBlock, err := att.GetTextBlockWithDisplayNameOnly(
+				displayBlock, dErr := att.GetTextBlockWithDisplayNameOnly(
 					"attachment modified since this message was sent",
 				)
-				if err != nil {
+				if dErr != nil {
+					if buildContentOptions.OnSkip != nil {
+						buildContentOptions.OnSkip(att, errors.Join(err, dErr))
+					}
 					continue
 				}
 				b = displayBlock
 			default:
 				slog.Warn("failed to build content block for attachment", "err", err, "attachment", att)
+				if buildContentOptions.OnSkip != nil {
+					buildContentOptions.OnSkip(att, err)
+				}
 				// Skip this content block. It is ok if the build block skipped this because OnlyIfTextKind was set or
 				// any other error.
 				continue
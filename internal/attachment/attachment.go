@@ -32,6 +32,7 @@ type buildContentBlockOptions struct {
 	OverrideOriginal bool
 	OnlyIfTextKind   bool
 	ForceFetch       bool
+	OnSkip           func(att *Attachment, err error)
 }
 
 type ContentBlockOption func(*buildContentBlockOptions)
@@ -63,6 +64,14 @@ func WithForceFetchContentBlock(forceFetch bool) ContentBlockOption {
 	}
 }
 
+// WithOnSkippedContentBlock. Default nil.
+// If set, BuildContentBlocks calls fn for every attachment it had to skip, along with the reason.
+func WithOnSkippedContentBlock(fn func(att *Attachment, err error)) ContentBlockOption {
+	return func(o *buildContentBlockOptions) {
+		o.OnSkip = fn
+	}
+}
+
 // BuildContentBlock function builds and returns a content block for an attachment.
 // It does NOT attach the content block to the attachment.
 func (att *Attachment) BuildContentBlock(ctx context.Context, opts ...ContentBlockOption,
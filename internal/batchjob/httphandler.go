@@ -0,0 +1,59 @@
+package batchjob
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+const (
+	tag        = "BatchJobs"
+	pathPrefix = "/batchjobs"
+)
+
+func InitBatchJobHandlers(api huma.API, batchJobManager *BatchJobManager) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-batch-job",
+		Method:      http.MethodPost,
+		Path:        pathPrefix,
+		Summary:     "Create a batch job",
+		Description: "Run a model preset with a prompt template or messages over every line of a JSONL file",
+		Tags:        []string{tag},
+	}, batchJobManager.CreateBatchJob)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-batch-jobs",
+		Method:      http.MethodGet,
+		Path:        pathPrefix,
+		Summary:     "List batch jobs",
+		Description: "List batch jobs, newest first",
+		Tags:        []string{tag},
+	}, batchJobManager.ListBatchJobs)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-batch-job",
+		Method:      http.MethodGet,
+		Path:        pathPrefix + "/{jobID}",
+		Summary:     "Get a batch job",
+		Description: "Get the status and progress of a batch job",
+		Tags:        []string{tag},
+	}, batchJobManager.GetBatchJob)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "cancel-batch-job",
+		Method:      http.MethodPost,
+		Path:        pathPrefix + "/{jobID}/cancel",
+		Summary:     "Cancel a batch job",
+		Description: "Cancel a queued or running batch job",
+		Tags:        []string{tag},
+	}, batchJobManager.CancelBatchJob)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-batch-job-results",
+		Method:      http.MethodGet,
+		Path:        pathPrefix + "/{jobID}/results",
+		Summary:     "Get batch job results",
+		Description: "Page through the results of a batch job",
+		Tags:        []string{tag},
+	}, batchJobManager.GetBatchJobResults)
+}
@@ -0,0 +1,590 @@
+// Package batchjob runs one prompt over every line of a JSONL file. Jobs live in their own directory with a copy of
+// the input and an append-only results file, so unfinished jobs resume where they stopped after a restart.
+package batchjob
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/flexigpt/flexigpt-app/internal/batchjob/spec"
+	inferencewrapperSpec "github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+	promptSpec "github.com/flexigpt/flexigpt-app/internal/prompt/spec"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+)
+
+// CompletionFetcher runs a single completion. Implemented by inferencewrapper.ProviderSetAPI.
+type CompletionFetcher interface {
+	FetchCompletion(
+		ctx context.Context,
+		req *inferencewrapperSpec.CompletionRequest,
+	) (*inferencewrapperSpec.CompletionResponse, error)
+}
+
+// ModelPresetLister resolves model presets. Implemented by the model preset store.
+type ModelPresetLister interface {
+	ListProviderPresets(
+		ctx context.Context,
+		req *modelpresetSpec.ListProviderPresetsRequest,
+	) (*modelpresetSpec.ListProviderPresetsResponse, error)
+}
+
+// PromptTemplateGetter resolves prompt templates. Implemented by the prompt template store.
+type PromptTemplateGetter interface {
+	GetPromptTemplate(
+		ctx context.Context,
+		req *promptSpec.GetPromptTemplateRequest,
+	) (*promptSpec.GetPromptTemplateResponse, error)
+}
+
+// BatchJobManager creates, runs and tracks batch jobs stored under baseDir.
+type BatchJobManager struct {
+	baseDir   string
+	fetcher   CompletionFetcher
+	presets   ModelPresetLister
+	templates PromptTemplateGetter
+	logger    *slog.Logger
+
+	// Parent of all job contexts; cancelled by Close.
+	ctx  context.Context
+	stop context.CancelFunc
+
+	mu   sync.Mutex
+	jobs map[spec.JobID]*jobState
+}
+
+type jobState struct {
+	dir string
+
+	// Guards job, metaWrittenAt and the results file.
+	mu  sync.Mutex
+	job spec.BatchJob
+	// Last time record persisted job.
+	metaWrittenAt time.Time
+
+	// Set while the job runs. Guarded by the manager mutex.
+	cancel          context.CancelFunc
+	cancelRequested bool
+	done            chan struct{}
+}
+
+type Option func(*BatchJobManager)
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(m *BatchJobManager) {
+		m.logger = logger
+	}
+}
+
+// WithPromptTemplateGetter enables jobs that reference a prompt template.
+func WithPromptTemplateGetter(g PromptTemplateGetter) Option {
+	return func(m *BatchJobManager) {
+		m.templates = g
+	}
+}
+
+// NewBatchJobManager loads the jobs in baseDir. Unfinished jobs stay idle until ResumeJobs is called.
+func NewBatchJobManager(
+	baseDir string,
+	fetcher CompletionFetcher,
+	presets ModelPresetLister,
+	opts ...Option,
+) (*BatchJobManager, error) {
+	if baseDir == "" {
+		return nil, errors.New("no batch jobs directory provided")
+	}
+	if fetcher == nil || presets == nil {
+		return nil, errors.New("batch jobs need a completion fetcher and a model preset lister")
+	}
+	if err := os.MkdirAll(baseDir, 0o770); err != nil {
+		return nil, err
+	}
+	m := &BatchJobManager{
+		baseDir: filepath.Clean(baseDir),
+		fetcher: fetcher,
+		presets: presets,
+		jobs:    map[spec.JobID]*jobState{},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	if m.logger == nil {
+		m.logger = slog.Default()
+	}
+	m.ctx, m.stop = context.WithCancel(context.Background())
+
+	entries, err := os.ReadDir(m.baseDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(m.baseDir, e.Name())
+		job, err := readJobMeta(dir)
+		if err != nil {
+			m.logger.Warn("skipping unreadable batch job", "dir", dir, "error", err)
+			continue
+		}
+		m.jobs[job.ID] = &jobState{dir: dir, job: *job}
+	}
+	return m, nil
+}
+
+// ResumeJobs restarts the unfinished jobs that are not running, limited to the given providers when any are given.
+// Call it once a job's provider is registered and has credentials, otherwise its items fail.
+func (m *BatchJobManager) ResumeJobs(providers ...inferencegoSpec.ProviderName) {
+	if m.ctx.Err() != nil {
+		return
+	}
+	m.mu.Lock()
+	states := make([]*jobState, 0)
+	for _, js := range m.jobs {
+		if js.done == nil {
+			states = append(states, js)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, js := range states {
+		job := js.snapshot()
+		if job.Status.IsTerminal() || (len(providers) > 0 && !slices.Contains(providers, job.Provider)) {
+			continue
+		}
+		if m.start(js) {
+			m.logger.Info("resuming batch job", "id", job.ID, "status", job.Status)
+		}
+	}
+}
+
+// Close stops all running jobs without marking them cancelled, so they resume on the next start.
+func (m *BatchJobManager) Close() {
+	m.stop()
+	m.mu.Lock()
+	running := make([]chan struct{}, 0)
+	for _, js := range m.jobs {
+		if js.done != nil {
+			running = append(running, js.done)
+		}
+	}
+	m.mu.Unlock()
+	for _, d := range running {
+		<-d
+	}
+}
+
+// CreateBatchJob resolves the model preset and prompt, copies the input file into the job directory and starts the
+// job.
+func (m *BatchJobManager) CreateBatchJob(
+	ctx context.Context,
+	req *spec.CreateBatchJobRequest,
+) (*spec.CreateBatchJobResponse, error) {
+	if req == nil || req.Body == nil {
+		return nil, fmt.Errorf("%w: missing body", spec.ErrInvalidRequest)
+	}
+	body := req.Body
+	if body.Provider == "" || body.ModelPresetID == "" || strings.TrimSpace(body.InputFilePath) == "" {
+		return nil, fmt.Errorf("%w: provider, modelPresetID and inputFilePath are required", spec.ErrInvalidRequest)
+	}
+	if (body.PromptTemplate == nil) == (len(body.Messages) == 0) {
+		return nil, fmt.Errorf("%w: exactly one of promptTemplate and messages is required", spec.ErrInvalidRequest)
+	}
+	concurrency := body.Concurrency
+	if concurrency == 0 {
+		concurrency = spec.DefaultConcurrency
+	}
+	if concurrency < 0 || concurrency > spec.MaxConcurrency {
+		return nil, fmt.Errorf("%w: concurrency must be between 1 and %d", spec.ErrInvalidRequest, spec.MaxConcurrency)
+	}
+
+	modelParam, err := m.resolveModelParam(ctx, body.Provider, body.ModelPresetID)
+	if err != nil {
+		return nil, err
+	}
+	blocks := body.Messages
+	var variables []promptSpec.PromptVariable
+	if body.PromptTemplate != nil {
+		tpl, err := m.resolveTemplate(ctx, body.PromptTemplate)
+		if err != nil {
+			return nil, err
+		}
+		blocks, variables = tpl.Blocks, tpl.Variables
+	}
+	if err := validateBlocks(blocks); err != nil {
+		return nil, err
+	}
+
+	u, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	id := spec.JobID(u.String())
+	dir := filepath.Join(m.baseDir, string(id))
+	if err := os.MkdirAll(dir, 0o770); err != nil {
+		return nil, err
+	}
+	total, err := copyInput(body.InputFilePath, filepath.Join(dir, spec.JobInputFileName))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	job := spec.BatchJob{
+		ID:             id,
+		Provider:       body.Provider,
+		ModelPresetID:  body.ModelPresetID,
+		ModelParam:     *modelParam,
+		PromptTemplate: body.PromptTemplate,
+		Blocks:         slices.Clone(blocks),
+		Variables:      slices.Clone(variables),
+		SourceFilePath: body.InputFilePath,
+		Concurrency:    concurrency,
+		Status:         spec.JobStatusQueued,
+		TotalItems:     total,
+		CreatedAt:      now,
+		ModifiedAt:     now,
+	}
+	if err := writeJobMeta(dir, &job); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	js := &jobState{dir: dir, job: job}
+	m.mu.Lock()
+	m.jobs[id] = js
+	m.mu.Unlock()
+	m.start(js)
+
+	m.logger.Info("createBatchJob", "id", id, "provider", job.Provider, "items", total)
+	return &spec.CreateBatchJobResponse{Body: &job}, nil
+}
+
+func (m *BatchJobManager) GetBatchJob(
+	ctx context.Context,
+	req *spec.GetBatchJobRequest,
+) (*spec.GetBatchJobResponse, error) {
+	if req == nil || req.JobID == "" {
+		return nil, fmt.Errorf("%w: missing jobID", spec.ErrInvalidRequest)
+	}
+	js, err := m.getJob(req.JobID)
+	if err != nil {
+		return nil, err
+	}
+	job := js.snapshot()
+	return &spec.GetBatchJobResponse{Body: &job}, nil
+}
+
+// ListBatchJobs returns all jobs, newest first.
+func (m *BatchJobManager) ListBatchJobs(
+	ctx context.Context,
+	req *spec.ListBatchJobsRequest,
+) (*spec.ListBatchJobsResponse, error) {
+	m.mu.Lock()
+	states := make([]*jobState, 0, len(m.jobs))
+	for _, js := range m.jobs {
+		states = append(states, js)
+	}
+	m.mu.Unlock()
+
+	jobs := make([]spec.BatchJob, 0, len(states))
+	for _, js := range states {
+		jobs = append(jobs, js.snapshot())
+	}
+	slices.SortFunc(jobs, func(a, b spec.BatchJob) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(string(b.ID), string(a.ID))
+	})
+	return &spec.ListBatchJobsResponse{Body: &spec.ListBatchJobsResponseBody{Jobs: jobs}}, nil
+}
+
+// CancelBatchJob stops a queued or running job. Items in flight are abandoned and not written to the results.
+func (m *BatchJobManager) CancelBatchJob(
+	ctx context.Context,
+	req *spec.CancelBatchJobRequest,
+) (*spec.CancelBatchJobResponse, error) {
+	if req == nil || req.JobID == "" {
+		return nil, fmt.Errorf("%w: missing jobID", spec.ErrInvalidRequest)
+	}
+	js, err := m.getJob(req.JobID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	done := js.done
+	if done != nil {
+		js.cancelRequested = true
+		js.cancel()
+	}
+	m.mu.Unlock()
+
+	if done == nil {
+		job := js.snapshot()
+		if job.Status.IsTerminal() {
+			return nil, fmt.Errorf("%w: %s is %s", spec.ErrJobFinished, req.JobID, job.Status)
+		}
+		// Not running and not finished happens before the job is resumed or after the manager is closed.
+		if err := js.finish(spec.JobStatusCancelled, ""); err != nil {
+			return nil, err
+		}
+	} else {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	m.logger.Info("cancelBatchJob", "id", req.JobID)
+	job := js.snapshot()
+	return &spec.CancelBatchJobResponse{Body: &job}, nil
+}
+
+// GetBatchJobResults pages through the results written so far.
+func (m *BatchJobManager) GetBatchJobResults(
+	ctx context.Context,
+	req *spec.GetBatchJobResultsRequest,
+) (*spec.GetBatchJobResultsResponse, error) {
+	if req == nil || req.JobID == "" {
+		return nil, fmt.Errorf("%w: missing jobID", spec.ErrInvalidRequest)
+	}
+	if req.Offset < 0 || req.Limit < 0 {
+		return nil, fmt.Errorf("%w: offset and limit must not be negative", spec.ErrInvalidRequest)
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = spec.DefaultResultsPageSize
+	}
+	limit = min(limit, spec.MaxResultsPageSize)
+
+	js, err := m.getJob(req.JobID)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(js.dir, spec.JobResultsFileName)
+
+	js.mu.Lock()
+	results, more, err := readResults(path, req.Offset, limit)
+	js.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &spec.GetBatchJobResultsResponseBody{Results: results, ResultsFilePath: path}
+	if more {
+		next := req.Offset + len(results)
+		out.NextOffset = &next
+	}
+	return &spec.GetBatchJobResultsResponse{Body: out}, nil
+}
+
+func (m *BatchJobManager) getJob(id spec.JobID) (*jobState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	js, ok := m.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", spec.ErrJobNotFound, id)
+	}
+	return js, nil
+}
+
+// resolveModelParam builds the model param of an enabled model preset. Streaming is always off for batch items.
+func (m *BatchJobManager) resolveModelParam(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	presetID modelpresetSpec.ModelPresetID,
+) (*inferencegoSpec.ModelParam, error) {
+	resp, err := m.presets.ListProviderPresets(ctx, &modelpresetSpec.ListProviderPresetsRequest{
+		Names: []inferencegoSpec.ProviderName{provider},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Body == nil || len(resp.Body.Providers) == 0 {
+		return nil, fmt.Errorf("%w: %s", modelpresetSpec.ErrProviderNotFound, provider)
+	}
+	mp, ok := resp.Body.Providers[0].ModelPresets[presetID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", modelpresetSpec.ErrModelPresetNotFound, provider, presetID)
+	}
+	if !mp.IsEnabled {
+		return nil, fmt.Errorf("%w: model preset %s/%s is disabled", spec.ErrInvalidRequest, provider, presetID)
+	}
+
+	p := mp.ModelParam()
+	p.Stream = false
+	return &p, nil
+}
+
+func (m *BatchJobManager) resolveTemplate(
+	ctx context.Context,
+	ref *spec.PromptTemplateRef,
+) (*promptSpec.PromptTemplate, error) {
+	if m.templates == nil {
+		return nil, fmt.Errorf("%w: prompt templates are not available", spec.ErrInvalidRequest)
+	}
+	resp, err := m.templates.GetPromptTemplate(ctx, &promptSpec.GetPromptTemplateRequest{
+		BundleID:     ref.BundleID,
+		TemplateSlug: ref.TemplateSlug,
+		Version:      ref.Version,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Body == nil {
+		return nil, promptSpec.ErrTemplateNotFound
+	}
+	if !resp.Body.IsEnabled {
+		return nil, fmt.Errorf("%w: template %s is disabled", spec.ErrInvalidRequest, ref.TemplateSlug)
+	}
+	return resp.Body, nil
+}
+
+func validateBlocks(blocks []promptSpec.MessageBlock) error {
+	hasUser := false
+	for _, b := range blocks {
+		switch b.Role {
+		case promptSpec.User:
+			hasUser = true
+		case promptSpec.System, promptSpec.Developer, promptSpec.Assistant:
+		default:
+			return fmt.Errorf("%w: unknown message role %q", spec.ErrInvalidRequest, b.Role)
+		}
+	}
+	if !hasUser {
+		return fmt.Errorf("%w: prompt needs at least one user message", spec.ErrInvalidRequest)
+	}
+	return nil
+}
+
+// copyInput copies the non-blank lines of src to dst, checking that each one is valid JSON, and returns the number
+// of items.
+func copyInput(src, dst string) (int, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	var buf bytes.Buffer
+	sc := newLineScanner(in)
+	n := 0
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return 0, fmt.Errorf("%w: line %d of the input is not valid JSON", spec.ErrInvalidRequest, lineNo)
+		}
+		n++
+		if n > spec.MaxInputItems {
+			return 0, fmt.Errorf("%w: input has more than %d items", spec.ErrInvalidRequest, spec.MaxInputItems)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("%w: input file has no items", spec.ErrInvalidRequest)
+	}
+	return n, os.WriteFile(dst, buf.Bytes(), 0o600)
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), spec.MaxInputLineBytes)
+	return sc
+}
+
+func readJobMeta(dir string) (*spec.BatchJob, error) {
+	b, err := os.ReadFile(filepath.Join(dir, spec.JobMetaFileName))
+	if err != nil {
+		return nil, err
+	}
+	var job spec.BatchJob
+	if err := json.Unmarshal(b, &job); err != nil {
+		return nil, err
+	}
+	if job.ID == "" {
+		return nil, errors.New("job has no id")
+	}
+	return &job, nil
+}
+
+func writeJobMeta(dir string, job *spec.BatchJob) error {
+	b, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, spec.JobMetaFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readResults returns up to limit results starting at offset, and whether more follow.
+func readResults(path string, offset, limit int) ([]spec.BatchResult, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []spec.BatchResult{}, false, nil
+		}
+		return nil, false, err
+	}
+	defer f.Close()
+
+	out := make([]spec.BatchResult, 0)
+	sc := newLineScanner(f)
+	for i := 0; sc.Scan(); i++ {
+		if i < offset {
+			continue
+		}
+		if len(out) == limit {
+			return out, true, nil
+		}
+		var r spec.BatchResult
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, false, fmt.Errorf("invalid result on line %d: %w", i+1, err)
+		}
+		out = append(out, r)
+	}
+	return out, false, sc.Err()
+}
+
+func (js *jobState) snapshot() spec.BatchJob {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	job := js.job
+	job.Blocks = slices.Clone(job.Blocks)
+	job.Variables = slices.Clone(job.Variables)
+	if job.Usage != nil {
+		u := *job.Usage
+		job.Usage = &u
+	}
+	return job
+}
@@ -0,0 +1,426 @@
+package batchjob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/batchjob/spec"
+	inferencewrapperSpec "github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+	promptSpec "github.com/flexigpt/flexigpt-app/internal/prompt/spec"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+)
+
+type fakePresets struct{}
+
+func (fakePresets) ListProviderPresets(
+	ctx context.Context,
+	req *modelpresetSpec.ListProviderPresetsRequest,
+) (*modelpresetSpec.ListProviderPresetsResponse, error) {
+	sys := "You are terse."
+	return &modelpresetSpec.ListProviderPresetsResponse{Body: &modelpresetSpec.ListProviderPresetsResponseBody{
+		Providers: []modelpresetSpec.ProviderPreset{{
+			Name: "p",
+			ModelPresets: map[modelpresetSpec.ModelPresetID]modelpresetSpec.ModelPreset{
+				"m":   {ID: "m", Name: "model-1", IsEnabled: true, SystemPrompt: &sys},
+				"off": {ID: "off", Name: "model-2"},
+			},
+		}},
+	}}, nil
+}
+
+// fakeFetcher echoes the user text of each request. Inputs listed in block wait until released, and inputs listed in
+// fail or containing "boom" fail.
+type fakeFetcher struct {
+	mu      sync.Mutex
+	calls   []string
+	systems []string
+	block   map[string]chan struct{}
+	fail    map[string]bool
+}
+
+func (f *fakeFetcher) FetchCompletion(
+	ctx context.Context,
+	req *inferencewrapperSpec.CompletionRequest,
+) (*inferencewrapperSpec.CompletionResponse, error) {
+	in := req.Body.Current.Inputs[len(req.Body.Current.Inputs)-1].InputMessage.Contents[0].TextItem.Text
+	f.mu.Lock()
+	f.calls = append(f.calls, in)
+	f.systems = append(f.systems, req.Body.ModelParam.SystemPrompt)
+	wait := f.block[in]
+	fail := f.fail[in]
+	f.mu.Unlock()
+
+	if wait != nil {
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if fail || strings.Contains(in, "boom") {
+		return nil, errors.New("provider error")
+	}
+	return &inferencewrapperSpec.CompletionResponse{Body: &inferencewrapperSpec.CompletionResponseBody{
+		InferenceResponse: &inferencegoSpec.FetchCompletionResponse{
+			Outputs: []inferencegoSpec.OutputUnion{{
+				Kind: inferencegoSpec.OutputKindOutputMessage,
+				OutputMessage: &inferencegoSpec.InputOutputContent{
+					Role: inferencegoSpec.RoleAssistant,
+					Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+						Kind:     inferencegoSpec.ContentItemKindText,
+						TextItem: &inferencegoSpec.ContentItemText{Text: "out:" + in},
+					}},
+				},
+			}},
+			Usage: &inferencegoSpec.Usage{InputTokensTotal: 10, OutputTokens: 2},
+		},
+	}}, nil
+}
+
+func writeInput(t *testing.T, lines ...string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "input.jsonl")
+	if err := os.WriteFile(p, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func waitForStatus(t *testing.T, m *BatchJobManager, id spec.JobID, want spec.JobStatus) *spec.BatchJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := m.GetBatchJob(t.Context(), &spec.GetBatchJobRequest{JobID: id})
+		if err != nil {
+			t.Fatalf("GetBatchJob: %v", err)
+		}
+		if resp.Body.Status == want {
+			return resp.Body
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach status %s", id, want)
+	return nil
+}
+
+func allResults(t *testing.T, m *BatchJobManager, id spec.JobID) map[int]spec.BatchResult {
+	t.Helper()
+	out := map[int]spec.BatchResult{}
+	offset := 0
+	for {
+		resp, err := m.GetBatchJobResults(t.Context(), &spec.GetBatchJobResultsRequest{
+			JobID: id, Offset: offset, Limit: 2,
+		})
+		if err != nil {
+			t.Fatalf("GetBatchJobResults: %v", err)
+		}
+		for _, r := range resp.Body.Results {
+			if _, dup := out[r.Index]; dup {
+				t.Fatalf("duplicate result for item %d", r.Index)
+			}
+			out[r.Index] = r
+		}
+		if resp.Body.NextOffset == nil {
+			return out
+		}
+		offset = *resp.Body.NextOffset
+	}
+}
+
+func TestBatchJobRun(t *testing.T) {
+	f := &fakeFetcher{}
+	m, err := NewBatchJobManager(t.TempDir(), f, fakePresets{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+
+	input := writeInput(t, `{"topic":"cats","n":3}`, ``, `"plain"`, `{"topic":"boom"}`)
+	resp, err := m.CreateBatchJob(t.Context(), &spec.CreateBatchJobRequest{Body: &spec.CreateBatchJobRequestBody{
+		Provider:      "p",
+		ModelPresetID: "m",
+		Messages: []promptSpec.MessageBlock{
+			{Role: promptSpec.System, Content: "Topic is {{topic}}."},
+			{Role: promptSpec.User, Content: "{{topic}}{{input}} x{{n}} {{missing}}"},
+		},
+		InputFilePath: input,
+		Concurrency:   2,
+	}})
+	if err != nil {
+		t.Fatalf("CreateBatchJob: %v", err)
+	}
+	if resp.Body.TotalItems != 3 {
+		t.Fatalf("total items = %d, want 3", resp.Body.TotalItems)
+	}
+
+	job := waitForStatus(t, m, resp.Body.ID, spec.JobStatusCompleted)
+	if job.SucceededItems != 2 || job.FailedItems != 1 || job.Usage == nil || job.Usage.InputTokensTotal != 20 {
+		t.Fatalf("unexpected job counters %+v", job)
+	}
+
+	results := allResults(t, m, job.ID)
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if r := results[0]; r.Status != spec.ItemStatusSucceeded || r.Output != "out:cats{{input}} x3 {{missing}}" {
+		t.Errorf("item 0 = %+v", r)
+	}
+	if r := results[1]; r.Output != "out:{{topic}}plain x{{n}} {{missing}}" {
+		t.Errorf("item 1 = %+v", r)
+	}
+	if r := results[2]; r.Status != spec.ItemStatusFailed || r.Error == "" {
+		t.Errorf("item 2 = %+v", r)
+	}
+	for _, s := range f.systems {
+		if !strings.HasPrefix(s, "You are terse.\n\nTopic is ") {
+			t.Errorf("system prompt = %q", s)
+		}
+	}
+}
+
+// fakeTemplates serves one prompt template with a hyphenated variable that has a default, a static variable and a
+// required variable.
+type fakeTemplates struct{}
+
+func (fakeTemplates) GetPromptTemplate(
+	ctx context.Context,
+	req *promptSpec.GetPromptTemplateRequest,
+) (*promptSpec.GetPromptTemplateResponse, error) {
+	return &promptSpec.GetPromptTemplateResponse{Body: &promptSpec.PromptTemplate{
+		Slug:      req.TemplateSlug,
+		IsEnabled: true,
+		Blocks: []promptSpec.MessageBlock{
+			{Role: promptSpec.User, Content: "{{tone-of-voice}} {{lang}} {{text}}"},
+		},
+		Variables: []promptSpec.PromptVariable{
+			{Name: "tone-of-voice", Type: promptSpec.VarString, Source: promptSpec.SourceUser, Default: "plain"},
+			{Name: "lang", Type: promptSpec.VarString, Source: promptSpec.SourceStatic, StaticVal: "en"},
+			{Name: "text", Type: promptSpec.VarString, Source: promptSpec.SourceUser, Required: true},
+		},
+	}}, nil
+}
+
+func TestBatchJobPromptTemplateVariables(t *testing.T) {
+	f := &fakeFetcher{}
+	m, err := NewBatchJobManager(t.TempDir(), f, fakePresets{}, WithPromptTemplateGetter(fakeTemplates{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+
+	input := writeInput(t, `{"text":"hi"}`, `{"text":"yo","tone-of-voice":"formal","lang":"fr"}`, `{"other":1}`)
+	resp, err := m.CreateBatchJob(t.Context(), &spec.CreateBatchJobRequest{Body: &spec.CreateBatchJobRequestBody{
+		Provider:       "p",
+		ModelPresetID:  "m",
+		PromptTemplate: &spec.PromptTemplateRef{BundleID: "b", TemplateSlug: "t", Version: "v1"},
+		InputFilePath:  input,
+	}})
+	if err != nil {
+		t.Fatalf("CreateBatchJob: %v", err)
+	}
+
+	job := waitForStatus(t, m, resp.Body.ID, spec.JobStatusCompleted)
+	results := allResults(t, m, job.ID)
+	if r := results[0]; r.Output != "out:plain en hi" {
+		t.Errorf("item 0 = %+v", r)
+	}
+	// Static variables are not overridden by the input.
+	if r := results[1]; r.Output != "out:formal en yo" {
+		t.Errorf("item 1 = %+v", r)
+	}
+	if r := results[2]; r.Status != spec.ItemStatusFailed || !strings.Contains(r.Error, `"text"`) {
+		t.Errorf("item 2 = %+v", r)
+	}
+}
+
+func TestBatchJobCreateValidation(t *testing.T) {
+	m, err := NewBatchJobManager(t.TempDir(), &fakeFetcher{}, fakePresets{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	good := writeInput(t, `{"a":1}`)
+	user := []promptSpec.MessageBlock{{Role: promptSpec.User, Content: "hi"}}
+
+	tests := []struct {
+		name string
+		body spec.CreateBatchJobRequestBody
+	}{
+		{"no_prompt", spec.CreateBatchJobRequestBody{Provider: "p", ModelPresetID: "m", InputFilePath: good}},
+		{"no_user_block", spec.CreateBatchJobRequestBody{
+			Provider: "p", ModelPresetID: "m", InputFilePath: good,
+			Messages: []promptSpec.MessageBlock{{Role: promptSpec.System, Content: "x"}},
+		}},
+		{"disabled_preset", spec.CreateBatchJobRequestBody{
+			Provider: "p", ModelPresetID: "off", InputFilePath: good, Messages: user,
+		}},
+		{"unknown_preset", spec.CreateBatchJobRequestBody{
+			Provider: "p", ModelPresetID: "nope", InputFilePath: good, Messages: user,
+		}},
+		{"template_without_store", spec.CreateBatchJobRequestBody{
+			Provider: "p", ModelPresetID: "m", InputFilePath: good,
+			PromptTemplate: &spec.PromptTemplateRef{BundleID: "b", TemplateSlug: "t", Version: "v1"},
+		}},
+		{"invalid_json_line", spec.CreateBatchJobRequestBody{
+			Provider: "p", ModelPresetID: "m", InputFilePath: writeInput(t, `{"a":1}`, `{oops`), Messages: user,
+		}},
+		{"bad_concurrency", spec.CreateBatchJobRequestBody{
+			Provider: "p", ModelPresetID: "m", InputFilePath: good, Messages: user, Concurrency: 100,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.CreateBatchJob(t.Context(), &spec.CreateBatchJobRequest{Body: &tt.body}); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	list, err := m.ListBatchJobs(t.Context(), &spec.ListBatchJobsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Body.Jobs) != 0 {
+		t.Fatalf("failed creates left jobs behind: %+v", list.Body.Jobs)
+	}
+}
+
+func TestBatchJobCancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	f := &fakeFetcher{block: map[string]chan struct{}{"slow": release}}
+	m, err := NewBatchJobManager(t.TempDir(), f, fakePresets{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+
+	resp, err := m.CreateBatchJob(t.Context(), &spec.CreateBatchJobRequest{Body: &spec.CreateBatchJobRequestBody{
+		Provider:      "p",
+		ModelPresetID: "m",
+		Messages:      []promptSpec.MessageBlock{{Role: promptSpec.User, Content: "{{input}}"}},
+		InputFilePath: writeInput(t, `"slow"`, `"never"`),
+		Concurrency:   1,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, m, resp.Body.ID, spec.JobStatusRunning)
+
+	c, err := m.CancelBatchJob(t.Context(), &spec.CancelBatchJobRequest{JobID: resp.Body.ID})
+	if err != nil {
+		t.Fatalf("CancelBatchJob: %v", err)
+	}
+	if c.Body.Status != spec.JobStatusCancelled || c.Body.FinishedAt == nil {
+		t.Fatalf("job after cancel = %+v", c.Body)
+	}
+	if r := allResults(t, m, resp.Body.ID); len(r) != 0 {
+		t.Fatalf("abandoned items were recorded: %+v", r)
+	}
+	if _, err := m.CancelBatchJob(t.Context(), &spec.CancelBatchJobRequest{JobID: resp.Body.ID}); !errors.Is(
+		err, spec.ErrJobFinished) {
+		t.Fatalf("second cancel error = %v", err)
+	}
+}
+
+func TestBatchJobResume(t *testing.T) {
+	dir := t.TempDir()
+	release := make(chan struct{})
+	f := &fakeFetcher{block: map[string]chan struct{}{"c": release}, fail: map[string]bool{"b": true}}
+	m, err := NewBatchJobManager(dir, f, fakePresets{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := m.CreateBatchJob(t.Context(), &spec.CreateBatchJobRequest{Body: &spec.CreateBatchJobRequestBody{
+		Provider:      "p",
+		ModelPresetID: "m",
+		Messages:      []promptSpec.MessageBlock{{Role: promptSpec.User, Content: "{{input}}"}},
+		InputFilePath: writeInput(t, `"a"`, `"b"`, `"c"`, `"d"`),
+		Concurrency:   1,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := resp.Body.ID
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		j, _ := m.GetBatchJob(t.Context(), &spec.GetBatchJobRequest{JobID: id})
+		if j.Body.SucceededItems == 1 && j.Body.FailedItems == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("first two items did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Simulate shutdown while "c" is in flight and a crash that left a partial line behind.
+	m.Close()
+	resultsPath := filepath.Join(dir, string(id), spec.JobResultsFileName)
+	rf, err := os.OpenFile(resultsPath, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rf.WriteString(`{"index":2,"status":"succ`)
+	_ = rf.Close()
+
+	close(release)
+	f.mu.Lock()
+	f.fail = nil
+	f.mu.Unlock()
+	m2, err := NewBatchJobManager(dir, f, fakePresets{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m2.Close)
+	// Jobs stay idle until their provider is ready.
+	m2.ResumeJobs("other")
+	time.Sleep(50 * time.Millisecond)
+	if job := waitForStatus(t, m2, id, spec.JobStatusRunning); job.FinishedAt != nil {
+		t.Fatalf("job finished before resume %+v", job)
+	}
+	f.mu.Lock()
+	idleCalls := len(f.calls)
+	f.mu.Unlock()
+	if idleCalls != 3 {
+		t.Fatalf("%d calls before resume, want 3", idleCalls)
+	}
+
+	m2.ResumeJobs("p")
+	job := waitForStatus(t, m2, id, spec.JobStatusCompleted)
+	if job.SucceededItems != 4 || job.FailedItems != 0 {
+		t.Fatalf("unexpected counters after resume %+v", job)
+	}
+
+	results := allResults(t, m2, id)
+	for i, want := range []string{"out:a", "out:b", "out:c", "out:d"} {
+		if results[i].Output != want {
+			t.Errorf("item %d output = %q, want %q", i, results[i].Output, want)
+		}
+	}
+	f.mu.Lock()
+	calls := fmt.Sprint(f.calls)
+	f.mu.Unlock()
+	if calls != "[a b c b c d]" {
+		t.Fatalf("calls = %s, want only failed and unfinished items to be redone", calls)
+	}
+
+	b, err := os.ReadFile(resultsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if !json.Valid([]byte(line)) {
+			t.Fatalf("results line %d is not valid JSON: %q", i+1, line)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package batchjob
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/batchjob/spec"
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/responseutil"
+	inferencewrapperSpec "github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	promptSpec "github.com/flexigpt/flexigpt-app/internal/prompt/spec"
+	promptStore "github.com/flexigpt/flexigpt-app/internal/prompt/store"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+)
+
+// How often record persists the job counters while a job runs.
+const metaWriteInterval = 2 * time.Second
+
+type batchItem struct {
+	index int
+	raw   json.RawMessage
+}
+
+// start runs the job in the background and reports whether it was started; a job that is already running is left
+// alone. The manager mutex must not be held.
+func (m *BatchJobManager) start(js *jobState) bool {
+	m.mu.Lock()
+	if js.done != nil {
+		m.mu.Unlock()
+		return false
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	done := make(chan struct{})
+	js.cancel = cancel
+	js.cancelRequested = false
+	js.done = done
+	m.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer cancel()
+		m.run(ctx, js)
+
+		m.mu.Lock()
+		js.cancel = nil
+		js.done = nil
+		m.mu.Unlock()
+	}()
+	return true
+}
+
+func (m *BatchJobManager) run(ctx context.Context, js *jobState) {
+	resultsPath := filepath.Join(js.dir, spec.JobResultsFileName)
+	finished, err := js.loadFinished(resultsPath)
+	if err != nil {
+		m.failJob(js, fmt.Errorf("cannot read results: %w", err))
+		return
+	}
+
+	js.mu.Lock()
+	now := time.Now().UTC()
+	js.job.Status = spec.JobStatusRunning
+	js.job.Error = ""
+	if js.job.StartedAt == nil {
+		js.job.StartedAt = &now
+	}
+	js.job.ModifiedAt = now
+	job := js.job
+	err = writeJobMeta(js.dir, &js.job)
+	js.mu.Unlock()
+	if err != nil {
+		m.failJob(js, err)
+		return
+	}
+
+	out, err := os.OpenFile(resultsPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		m.failJob(js, err)
+		return
+	}
+	defer out.Close()
+
+	in, err := os.Open(filepath.Join(js.dir, spec.JobInputFileName))
+	if err != nil {
+		m.failJob(js, err)
+		return
+	}
+	defer in.Close()
+
+	items := make(chan batchItem)
+	var wg sync.WaitGroup
+	var writeErr error
+	var writeErrOnce sync.Once
+	for range job.Concurrency {
+		wg.Go(func() {
+			for it := range items {
+				res := m.processItem(ctx, &job, it)
+				if ctx.Err() != nil {
+					// Abandoned items are retried when the job resumes.
+					continue
+				}
+				if err := js.record(out, res); err != nil {
+					writeErrOnce.Do(func() { writeErr = err })
+				}
+			}
+		})
+	}
+
+	sc := newLineScanner(in)
+	index := 0
+feed:
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		it := batchItem{index: index, raw: json.RawMessage(bytes.Clone(line))}
+		index++
+		if _, ok := finished[it.index]; ok {
+			continue
+		}
+		select {
+		case items <- it:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(items)
+	wg.Wait()
+
+	switch {
+	case ctx.Err() != nil:
+		m.mu.Lock()
+		cancelled := js.cancelRequested
+		m.mu.Unlock()
+		if cancelled {
+			m.finishJob(js, spec.JobStatusCancelled, "")
+		}
+		// Otherwise the manager is closing and the job stays running so that it resumes.
+	case sc.Err() != nil:
+		m.failJob(js, fmt.Errorf("cannot read input: %w", sc.Err()))
+	case writeErr != nil:
+		m.failJob(js, fmt.Errorf("cannot write results: %w", writeErr))
+	default:
+		m.finishJob(js, spec.JobStatusCompleted, "")
+	}
+}
+
+func (m *BatchJobManager) failJob(js *jobState, err error) {
+	m.finishJob(js, spec.JobStatusFailed, err.Error())
+}
+
+func (m *BatchJobManager) finishJob(js *jobState, status spec.JobStatus, errMsg string) {
+	if err := js.finish(status, errMsg); err != nil {
+		m.logger.Error("cannot persist batch job", "id", js.job.ID, "error", err)
+		return
+	}
+	m.logger.Info("batch job finished", "id", js.job.ID, "status", status, "error", errMsg)
+}
+
+func (js *jobState) finish(status spec.JobStatus, errMsg string) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	now := time.Now().UTC()
+	js.job.Status = status
+	js.job.Error = errMsg
+	js.job.ModifiedAt = now
+	js.job.FinishedAt = &now
+	return writeJobMeta(js.dir, &js.job)
+}
+
+// loadFinished reads the results written by earlier runs and returns the items that succeeded. Failed results, and
+// a trailing partial line left by a crash, are dropped from the results file so that those items run again. The job
+// counters are recomputed from the results that are kept.
+func (js *jobState) loadFinished(path string) (map[int]struct{}, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	finished := map[int]struct{}{}
+	var usage *inferencegoSpec.Usage
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return finished, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var kept bytes.Buffer
+	dropped := false
+	r := bufio.NewReaderSize(f, 64*1024)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			dropped = dropped || len(line) > 0
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var res spec.BatchResult
+		if json.Unmarshal(line, &res) != nil {
+			dropped = true
+			break
+		}
+		if _, dup := finished[res.Index]; dup || res.Status != spec.ItemStatusSucceeded {
+			dropped = true
+			continue
+		}
+		finished[res.Index] = struct{}{}
+		usage = responseutil.AddUsage(usage, res.Usage)
+		kept.Write(line)
+	}
+	if dropped {
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, kept.Bytes(), 0o600); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return nil, err
+		}
+	}
+
+	js.job.SucceededItems = len(finished)
+	js.job.FailedItems = 0
+	js.job.Usage = usage
+	return finished, nil
+}
+
+// record appends a result and updates the job counters. The counters are persisted at most once per
+// metaWriteInterval; loadFinished recomputes them from the results after a crash.
+func (js *jobState) record(out *os.File, res *spec.BatchResult) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if _, err := out.Write(b); err != nil {
+		return err
+	}
+	if res.Status == spec.ItemStatusSucceeded {
+		js.job.SucceededItems++
+	} else {
+		js.job.FailedItems++
+	}
+	js.job.Usage = responseutil.AddUsage(js.job.Usage, res.Usage)
+	now := time.Now().UTC()
+	js.job.ModifiedAt = now
+	if now.Sub(js.metaWrittenAt) < metaWriteInterval {
+		return nil
+	}
+	js.metaWrittenAt = now
+	return writeJobMeta(js.dir, &js.job)
+}
+
+func (m *BatchJobManager) processItem(ctx context.Context, job *spec.BatchJob, it batchItem) *spec.BatchResult {
+	start := time.Now()
+	res := &spec.BatchResult{Index: it.index, Input: it.raw}
+	output, usage, err := m.complete(ctx, job, it)
+	res.Usage = usage
+	res.DurationMs = time.Since(start).Milliseconds()
+	res.FinishedAt = time.Now().UTC()
+	if err != nil {
+		res.Status = spec.ItemStatusFailed
+		res.Error = err.Error()
+		return res
+	}
+	res.Status = spec.ItemStatusSucceeded
+	res.Output = output
+	return res
+}
+
+func (m *BatchJobManager) complete(
+	ctx context.Context,
+	job *spec.BatchJob,
+	it batchItem,
+) (string, *inferencegoSpec.Usage, error) {
+	vars := itemVars(it.raw)
+	resolved, err := promptStore.ResolveVariables(job.Variables, vars)
+	if err != nil {
+		return "", nil, err
+	}
+	maps.Copy(vars, resolved)
+	modelParam := job.ModelParam
+	modelParam.Stream = false
+
+	systemParts := make([]string, 0)
+	if s := strings.TrimSpace(modelParam.SystemPrompt); s != "" {
+		systemParts = append(systemParts, s)
+	}
+	inputs := make([]inferencegoSpec.InputUnion, 0, len(job.Blocks))
+	for _, b := range job.Blocks {
+		text := promptStore.FillPlaceholders(b.Content, vars)
+		switch b.Role {
+		case promptSpec.System, promptSpec.Developer:
+			systemParts = append(systemParts, text)
+		case promptSpec.Assistant:
+			inputs = append(inputs, inferencegoSpec.InputUnion{
+				Kind:          inferencegoSpec.InputKindOutputMessage,
+				OutputMessage: textContent(inferencegoSpec.RoleAssistant, text),
+			})
+		default:
+			inputs = append(inputs, inferencegoSpec.InputUnion{
+				Kind:         inferencegoSpec.InputKindInputMessage,
+				InputMessage: textContent(inferencegoSpec.RoleUser, text),
+			})
+		}
+	}
+	modelParam.SystemPrompt = strings.Join(systemParts, "\n\n")
+
+	resp, err := m.fetcher.FetchCompletion(ctx, &inferencewrapperSpec.CompletionRequest{
+		Provider:  job.Provider,
+		RequestID: fmt.Sprintf("%s-%d", job.ID, it.index),
+		Body: &inferencewrapperSpec.CompletionRequestBody{
+			ModelParam:    &modelParam,
+			ModelPresetID: job.ModelPresetID,
+			Current: conversationSpec.ConversationMessage{
+				ID:        fmt.Sprintf("%s-%d", job.ID, it.index),
+				CreatedAt: time.Now().UTC(),
+				Role:      inferencegoSpec.RoleUser,
+				Provider:  job.Provider,
+				Inputs:    inputs,
+			},
+		},
+	})
+	var infResp *inferencegoSpec.FetchCompletionResponse
+	if resp != nil && resp.Body != nil {
+		infResp = resp.Body.InferenceResponse
+	}
+	var usage *inferencegoSpec.Usage
+	if infResp != nil {
+		usage = infResp.Usage
+	}
+	if err != nil {
+		return "", usage, err
+	}
+	if infResp == nil {
+		return "", usage, errors.New("empty completion response")
+	}
+	if infResp.Error != nil {
+		return "", usage, fmt.Errorf("%s: %s", infResp.Error.Code, infResp.Error.Message)
+	}
+	return responseutil.OutputText(infResp), usage, nil
+}
+
+// itemVars maps an input line to template variables. The fields of a JSON object become variables, with strings
+// used as is and other values as JSON. Any other line is available as {{input}}.
+func itemVars(raw json.RawMessage) map[string]string {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(raw, &obj) == nil && obj != nil {
+		vars := make(map[string]string, len(obj))
+		for k, v := range obj {
+			if s, ok := jsonString(v); ok {
+				vars[k] = s
+			} else if string(v) != "null" {
+				vars[k] = string(v)
+			}
+		}
+		return vars
+	}
+	if s, ok := jsonString(raw); ok {
+		return map[string]string{spec.InputVarName: s}
+	}
+	return map[string]string{spec.InputVarName: string(raw)}
+}
+
+func jsonString(raw json.RawMessage) (string, bool) {
+	var s string
+	if json.Unmarshal(raw, &s) != nil {
+		return "", false
+	}
+	return s, true
+}
+
+func textContent(role inferencegoSpec.RoleEnum, text string) *inferencegoSpec.InputOutputContent {
+	return &inferencegoSpec.InputOutputContent{
+		Role: role,
+		Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+			Kind:     inferencegoSpec.ContentItemKindText,
+			TextItem: &inferencegoSpec.ContentItemText{Text: text},
+		}},
+	}
+}
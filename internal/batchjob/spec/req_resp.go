@@ -0,0 +1,75 @@
+package spec
+
+import (
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+	promptSpec "github.com/flexigpt/flexigpt-app/internal/prompt/spec"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+)
+
+type CreateBatchJobRequestBody struct {
+	Provider      inferencegoSpec.ProviderName  `json:"provider"      required:"true"`
+	ModelPresetID modelpresetSpec.ModelPresetID `json:"modelPresetID" required:"true"`
+
+	// Exactly one of PromptTemplate and Messages must be set. Blocks may use {{var}} placeholders that are filled
+	// from the fields of each input line, as prompt templates fill them. Template variables get their static value
+	// or, when the line does not set them, their default.
+	PromptTemplate *PromptTemplateRef        `json:"promptTemplate,omitempty"`
+	Messages       []promptSpec.MessageBlock `json:"messages,omitempty"`
+
+	// InputFilePath is a JSONL file with one item per line. Blank lines are skipped.
+	InputFilePath string `json:"inputFilePath" required:"true"`
+	Concurrency   int    `json:"concurrency,omitempty" minimum:"0" maximum:"32"`
+}
+
+type CreateBatchJobRequest struct {
+	Body *CreateBatchJobRequestBody
+}
+
+type CreateBatchJobResponse struct {
+	Body *BatchJob
+}
+
+type GetBatchJobRequest struct {
+	JobID JobID `path:"jobID" required:"true"`
+}
+
+type GetBatchJobResponse struct {
+	Body *BatchJob
+}
+
+type ListBatchJobsRequest struct{}
+
+type ListBatchJobsResponseBody struct {
+	Jobs []BatchJob `json:"jobs"`
+}
+
+type ListBatchJobsResponse struct {
+	Body *ListBatchJobsResponseBody
+}
+
+type CancelBatchJobRequest struct {
+	JobID JobID `path:"jobID" required:"true"`
+}
+
+type CancelBatchJobResponse struct {
+	Body *BatchJob
+}
+
+type GetBatchJobResultsRequest struct {
+	JobID JobID `path:"jobID" required:"true"`
+	// Offset and Limit page through the results file in completion order.
+	Offset int `query:"offset" minimum:"0"`
+	Limit  int `query:"limit"  minimum:"0"`
+}
+
+type GetBatchJobResultsResponseBody struct {
+	Results []BatchResult `json:"results"`
+	// NextOffset is set when more results are available.
+	NextOffset *int `json:"nextOffset,omitempty"`
+	// ResultsFilePath is the JSONL file results are written to.
+	ResultsFilePath string `json:"resultsFilePath"`
+}
+
+type GetBatchJobResultsResponse struct {
+	Body *GetBatchJobResultsResponseBody
+}
@@ -0,0 +1,110 @@
+package spec
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+	promptSpec "github.com/flexigpt/flexigpt-app/internal/prompt/spec"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+)
+
+const (
+	JobMetaFileName    = "job.json"
+	JobInputFileName   = "input.jsonl"
+	JobResultsFileName = "results.jsonl"
+
+	DefaultConcurrency = 4
+	MaxConcurrency     = 32
+	MaxInputItems      = 100_000
+	// MaxInputLineBytes bounds a single JSONL input line.
+	MaxInputLineBytes = 4 << 20
+
+	DefaultResultsPageSize = 100
+	MaxResultsPageSize     = 1000
+
+	// InputVarName is the template variable that holds input lines that are not JSON objects.
+	InputVarName = "input"
+)
+
+var (
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrJobNotFound    = errors.New("batch job not found")
+	ErrJobFinished    = errors.New("batch job already finished")
+)
+
+type JobID string
+
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+// IsTerminal reports whether a job in this status will not run again.
+func (s JobStatus) IsTerminal() bool {
+	return s == JobStatusCompleted || s == JobStatusFailed || s == JobStatusCancelled
+}
+
+type ItemStatus string
+
+const (
+	ItemStatusSucceeded ItemStatus = "succeeded"
+	ItemStatusFailed    ItemStatus = "failed"
+)
+
+type PromptTemplateRef struct {
+	BundleID     bundleitemutils.BundleID    `json:"bundleID"     required:"true"`
+	TemplateSlug bundleitemutils.ItemSlug    `json:"templateSlug" required:"true"`
+	Version      bundleitemutils.ItemVersion `json:"version"      required:"true"`
+}
+
+// BatchJob is the persisted state of a job. Model param and message blocks are resolved at creation, so later edits
+// to the preset or template do not change a running or resumed job.
+type BatchJob struct {
+	ID            JobID                         `json:"id"`
+	Provider      inferencegoSpec.ProviderName  `json:"provider"`
+	ModelPresetID modelpresetSpec.ModelPresetID `json:"modelPresetID"`
+	ModelParam    inferencegoSpec.ModelParam    `json:"modelParam"`
+
+	PromptTemplate *PromptTemplateRef        `json:"promptTemplate,omitempty"`
+	Blocks         []promptSpec.MessageBlock `json:"blocks"`
+	// Variables are the variables of the prompt template, whose defaults and static values fill the blocks.
+	Variables []promptSpec.PromptVariable `json:"variables,omitempty"`
+
+	// SourceFilePath is the input file the job was created from. The job runs from its own copy.
+	SourceFilePath string `json:"sourceFilePath"`
+	Concurrency    int    `json:"concurrency"`
+
+	Status JobStatus `json:"status"`
+	// Error is set when the job as a whole failed. Per item errors are in the results.
+	Error string `json:"error,omitempty"`
+
+	TotalItems     int                    `json:"totalItems"`
+	SucceededItems int                    `json:"succeededItems"`
+	FailedItems    int                    `json:"failedItems"`
+	Usage          *inferencegoSpec.Usage `json:"usage,omitempty"`
+
+	CreatedAt  time.Time  `json:"createdAt"`
+	ModifiedAt time.Time  `json:"modifiedAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// BatchResult is one line of the results file. Index is the zero based line number of the item in the input file.
+type BatchResult struct {
+	Index      int                    `json:"index"`
+	Status     ItemStatus             `json:"status"`
+	Input      json.RawMessage        `json:"input"`
+	Output     string                 `json:"output,omitempty"`
+	Usage      *inferencegoSpec.Usage `json:"usage,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMs int64                  `json:"durationMs"`
+	FinishedAt time.Time              `json:"finishedAt"`
+}
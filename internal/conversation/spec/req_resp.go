@@ -81,3 +81,16 @@ type SearchConversationsResponseBody struct {
 type SearchConversationsResponse struct {
 	Body *SearchConversationsResponseBody
 }
+
+type ListConversationSourcesRequest struct {
+	ID    string `path:"id" required:"true"`
+	Title string `          required:"true" query:"title"`
+}
+
+type ListConversationSourcesResponseBody struct {
+	Sources []ConversationSource `json:"sources"`
+}
+
+type ListConversationSourcesResponse struct {
+	Body *ListConversationSourcesResponseBody
+}
@@ -30,6 +30,8 @@ type ConversationMessage struct {
 	// Default model configuration for this turn. This can be empty and would mean that model param have been carried
 	// over from previous messages.
 	ModelParam *inferencegoSpec.ModelParam `json:"modelParam,omitempty"`
+	// Provider that served this turn. Like ModelParam it may be empty and carried over from previous messages.
+	Provider inferencegoSpec.ProviderName `json:"provider,omitempty"`
 
 	// Canonical, lossless events for this turn, in the order they occurred.
 	//
@@ -55,11 +57,80 @@ type ConversationMessage struct {
 	Usage        *inferencegoSpec.Usage `json:"usage,omitempty"`
 	Error        *inferencegoSpec.Error `json:"error,omitempty"`
 	DebugDetails any                    `json:"debugDetails,omitempty"`
+	// Prompt cache breakpoints used for this turn and the cache tokens reported for it.
+	PromptCache *PromptCacheUsage `json:"promptCache,omitempty"`
+	// Sources cited in this turn's output, normalized from the provider specific annotations in Outputs.
+	Citations []Citation `json:"citations,omitempty"`
+	// Route is set when a model router picked the provider and model of this turn.
+	Route *ModelRoute `json:"route,omitempty"`
 
 	// Arbitrary UI/app metadata (tags, pinned, read state, etc.).
 	Meta map[string]any `json:"meta,omitempty"`
 }
 
+// PromptCacheBreakpoint names a request prefix that was marked cacheable.
+type PromptCacheBreakpoint string
+
+const (
+	PromptCacheBreakpointSystemPrompt  PromptCacheBreakpoint = "systemPrompt"
+	PromptCacheBreakpointTools         PromptCacheBreakpoint = "tools"
+	PromptCacheBreakpointHistoryPrefix PromptCacheBreakpoint = "historyPrefix"
+)
+
+type PromptCacheUsage struct {
+	// CacheKey is the prompt cache key sent to providers that route on one (OpenAI).
+	CacheKey    string                  `json:"cacheKey,omitempty"`
+	Breakpoints []PromptCacheBreakpoint `json:"breakpoints,omitempty"`
+	// ReadTokens are the input tokens served from the cache, as reported in Usage.
+	ReadTokens int64 `json:"readTokens"`
+	// EstimatedWriteTokens approximates the tokens written to the cache: the estimated size of the cached prefix
+	// minus what was read. Usage does not report writes separately.
+	EstimatedWriteTokens int64 `json:"estimatedWriteTokens"`
+}
+
+// ModelRoute records how a model router resolved a turn.
+type ModelRoute struct {
+	RouterID      string                       `json:"routerID"`
+	ProviderName  inferencegoSpec.ProviderName `json:"providerName"`
+	ModelPresetID string                       `json:"modelPresetID"`
+	// RuleName is the matched rule. It is empty when the router's fallback was used.
+	RuleName    string `json:"ruleName,omitempty"`
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// CitationSourceTool is the tool call that surfaced a cited source.
+type CitationSourceTool struct {
+	Type   inferencegoSpec.ToolType `json:"type"`
+	CallID string                   `json:"callID"`
+	Name   string                   `json:"name,omitempty"`
+}
+
+// Citation is a source cited by an assistant turn.
+type Citation struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+
+	// OutputIndex and ContentIndex locate the text item in Outputs that carries the citation. StartIndex and
+	// EndIndex are the cited span within that text, as reported by the provider; both are zero when unknown.
+	OutputIndex  int    `json:"outputIndex"`
+	ContentIndex int    `json:"contentIndex"`
+	StartIndex   int64  `json:"startIndex,omitempty"`
+	EndIndex     int64  `json:"endIndex,omitempty"`
+	CitedText    string `json:"citedText,omitempty"`
+
+	// SourceTool is nil when the citation cannot be tied to a tool call of the turn.
+	SourceTool *CitationSourceTool `json:"sourceTool,omitempty"`
+}
+
+// ConversationSource is a URL cited in a conversation, aggregated over its turns.
+type ConversationSource struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	// MessageIDs are the turns citing the URL, in conversation order.
+	MessageIDs    []string `json:"messageIDs"`
+	CitationCount int      `json:"citationCount"`
+}
+
 // Conversation is the full chat, stored as a single JSON file.
 type Conversation struct {
 	SchemaVersion string    `json:"schemaVersion"`
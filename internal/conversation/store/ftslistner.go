@@ -144,6 +144,7 @@ func extractFTS(fullPath string, m map[string]any) map[string]string {
 		system   bytes.Buffer
 		user     bytes.Buffer
 		assist   bytes.Buffer
+		sources  bytes.Buffer
 	)
 
 	appendByRole := func(role, txt string) {
@@ -169,6 +170,21 @@ func extractFTS(fullPath string, m map[string]any) map[string]string {
 		}
 		role, _ := msg["role"].(string)
 
+		// Cited sources are indexed by URL, title and cited text.
+		if citations, ok := msg["citations"].([]any); ok {
+			for _, cRaw := range citations {
+				c, ok := cRaw.(map[string]any)
+				if !ok {
+					continue
+				}
+				for _, key := range []string{"url", "title", "citedText"} {
+					if v, ok := c[key].(string); ok && v != "" {
+						sources.WriteString(v + "\n")
+					}
+				}
+			}
+		}
+
 		// 2) New shape: nested "messages" -> "contents".
 		var ioList []any
 		if inList, ok := msg["inputs"].([]any); ok {
@@ -218,6 +234,7 @@ func extractFTS(fullPath string, m map[string]any) map[string]string {
 		"system":    system.String(),
 		"user":      user.String(),
 		"assistant": assist.String(),
+		"sources":   sources.String(),
 		"mtime":     fileMTime(fullPath),
 	}
 }
@@ -157,6 +157,26 @@ func TestFTSAddMessageUpdatesIndex(t *testing.T) {
 	}
 }
 
+func TestFTSSearchCitedSources(t *testing.T) {
+	dir := t.TempDir()
+	cc := newCollection(t, dir, true)
+
+	c := newConv(t, "Reading list")
+	msg := newTextTurn("m1", inferencegoSpec.RoleAssistant, "see the docs")
+	msg.Citations = []spec.Citation{{URL: "https://go.dev/doc", Title: "Gopher handbook"}}
+	c.Messages = []spec.ConversationMessage{msg}
+	_, _ = cc.PutConversation(t.Context(), getNewPutRequestFromConversation(c))
+
+	res, err := cc.SearchConversations(t.Context(),
+		&spec.SearchConversationsRequest{Query: "handbook"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(res.Body.ConversationListItems) != 1 || res.Body.ConversationListItems[0].ID != c.ID {
+		t.Fatalf("want hit on cited source title, got %v", res.Body.ConversationListItems)
+	}
+}
+
 func TestFTSDisabled(t *testing.T) {
 	dir := t.TempDir()
 	cc := newCollection(t, dir, false)
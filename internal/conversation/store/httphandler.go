@@ -65,4 +65,13 @@ func InitConversationStoreHandlers(api huma.API, conversationStoreAPI *Conversat
 		Description: "Get a conversation",
 		Tags:        []string{tag},
 	}, conversationStoreAPI.GetConversation)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-conversation-sources",
+		Method:      http.MethodGet,
+		Path:        pathPrefix + "/{id}/sources",
+		Summary:     "List conversation sources",
+		Description: "List the sources cited in a conversation, grouped by URL",
+		Tags:        []string{tag},
+	}, conversationStoreAPI.ListConversationSources)
 }
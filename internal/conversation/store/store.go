@@ -78,6 +78,7 @@ func NewConversationCollection(baseDir string, opts ...Option) (*ConversationCol
 				{Name: "system", Weight: 2},
 				{Name: "user", Weight: 3},
 				{Name: "assistant", Weight: 4},
+				{Name: "sources", Weight: 5},
 				{Name: "mtime", Unindexed: true},
 			},
 		}, ftsengine.WithLogger(slog.Default()))
@@ -354,6 +355,47 @@ func (cc *ConversationCollection) SearchConversations(
 	}, nil
 }
 
+// ListConversationSources groups the citations of a conversation by URL, in the order they were first cited.
+func (cc *ConversationCollection) ListConversationSources(
+	ctx context.Context,
+	req *spec.ListConversationSourcesRequest,
+) (*spec.ListConversationSourcesResponse, error) {
+	if req == nil || req.ID == "" || req.Title == "" {
+		return nil, errors.New("request ID and title are required")
+	}
+	convo, err := cc.GetConversation(ctx, &spec.GetConversationRequest{ID: req.ID, Title: req.Title})
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]spec.ConversationSource, 0)
+	byURL := map[string]int{}
+	for _, msg := range convo.Body.Messages {
+		for _, c := range msg.Citations {
+			if c.URL == "" {
+				continue
+			}
+			idx, ok := byURL[c.URL]
+			if !ok {
+				idx = len(sources)
+				byURL[c.URL] = idx
+				sources = append(sources, spec.ConversationSource{URL: c.URL, MessageIDs: []string{}})
+			}
+			src := &sources[idx]
+			src.CitationCount++
+			if src.Title == "" {
+				src.Title = c.Title
+			}
+			if n := len(src.MessageIDs); n == 0 || src.MessageIDs[n-1] != msg.ID {
+				src.MessageIDs = append(src.MessageIDs, msg.ID)
+			}
+		}
+	}
+	return &spec.ListConversationSourcesResponse{
+		Body: &spec.ListConversationSourcesResponseBody{Sources: sources},
+	}, nil
+}
+
 func (cc *ConversationCollection) fileNameFromConversation(c spec.Conversation) (string, error) {
 	info, err := uuidv7filename.Build(c.ID, c.Title, spec.ConversationFileExtension)
 	if err != nil {
@@ -3,6 +3,7 @@ package store
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -547,6 +548,47 @@ func TestConversationCollectionListing(t *testing.T) {
 	})
 }
 
+func TestListConversationSources(t *testing.T) {
+	cc, err := NewConversationCollection(t.TempDir())
+	if err != nil {
+		t.Fatalf("new collection: %v", err)
+	}
+	c, err := initConversation("Sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a1 := newTextTurn("a1", inferencegoSpec.RoleAssistant, "first")
+	a1.Citations = []spec.Citation{
+		{URL: "https://a.example", StartIndex: 0, EndIndex: 5},
+		{URL: "https://a.example", Title: "A", StartIndex: 6, EndIndex: 9},
+		{URL: "https://b.example", Title: "B"},
+	}
+	a2 := newTextTurn("a2", inferencegoSpec.RoleAssistant, "second")
+	a2.Citations = []spec.Citation{{URL: "https://a.example", Title: "A again"}}
+	c.Messages = []spec.ConversationMessage{newTextTurn("u1", inferencegoSpec.RoleUser, "q"), a1, a2}
+	if _, err := cc.PutConversation(t.Context(), getNewPutRequestFromConversation(c)); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := cc.ListConversationSources(t.Context(),
+		&spec.ListConversationSourcesRequest{ID: c.ID, Title: c.Title})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []spec.ConversationSource{
+		{URL: "https://a.example", Title: "A", MessageIDs: []string{"a1", "a2"}, CitationCount: 3},
+		{URL: "https://b.example", Title: "B", MessageIDs: []string{"a1"}, CitationCount: 1},
+	}
+	if !reflect.DeepEqual(resp.Body.Sources, want) {
+		t.Errorf("sources = %+v, want %+v", resp.Body.Sources, want)
+	}
+
+	if _, err := cc.ListConversationSources(t.Context(),
+		&spec.ListConversationSourcesRequest{ID: c.ID}); err == nil {
+		t.Error("expected error without title")
+	}
+}
+
 func getNewPutRequestFromConversation(c *spec.Conversation) *spec.PutConversationRequest {
 	return &spec.PutConversationRequest{
 		ID: c.ID,
@@ -0,0 +1,106 @@
+package inferencewrapper
+
+import (
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+)
+
+// extractCitations normalizes the URL citations annotated on the text outputs of a response.
+//
+// Each citation is tied to the web search call that surfaced its URL: a call whose results or opened pages include
+// the URL, else the last web search call before the cited text. Duplicate annotations of the same span are dropped.
+func extractCitations(outputs []inferencegoSpec.OutputUnion) []conversationSpec.Citation {
+	var (
+		out       []conversationSpec.Citation
+		seen      = map[conversationSpec.Citation]bool{}
+		toolByURL = webSearchToolsByURL(outputs)
+		lastTool  *conversationSpec.CitationSourceTool
+	)
+	for oIdx, o := range outputs {
+		if o.Kind == inferencegoSpec.OutputKindWebSearchToolCall && o.WebSearchToolCall != nil {
+			lastTool = webSearchSourceTool(o.WebSearchToolCall)
+			continue
+		}
+		if o.Kind != inferencegoSpec.OutputKindOutputMessage || o.OutputMessage == nil {
+			continue
+		}
+		for cIdx, item := range o.OutputMessage.Contents {
+			if item.TextItem == nil {
+				continue
+			}
+			for _, c := range item.TextItem.Citations {
+				u := c.URLCitation
+				if c.Kind != inferencegoSpec.CitationKindURL || u == nil || u.URL == "" {
+					continue
+				}
+				nc := conversationSpec.Citation{
+					URL:          u.URL,
+					Title:        u.Title,
+					OutputIndex:  oIdx,
+					ContentIndex: cIdx,
+					StartIndex:   u.StartIndex,
+					EndIndex:     u.EndIndex,
+					CitedText:    u.CitedText,
+				}
+				if seen[nc] {
+					continue
+				}
+				seen[nc] = true
+				if tool, ok := toolByURL[u.URL]; ok {
+					nc.SourceTool = tool
+				} else {
+					nc.SourceTool = lastTool
+				}
+				out = append(out, nc)
+			}
+		}
+	}
+	return out
+}
+
+// webSearchToolsByURL maps the URLs a web search call found or opened to the first such call.
+func webSearchToolsByURL(outputs []inferencegoSpec.OutputUnion) map[string]*conversationSpec.CitationSourceTool {
+	calls := map[string]*conversationSpec.CitationSourceTool{}
+	byURL := map[string]*conversationSpec.CitationSourceTool{}
+	add := func(url string, tool *conversationSpec.CitationSourceTool) {
+		if _, ok := byURL[url]; url != "" && tool != nil && !ok {
+			byURL[url] = tool
+		}
+	}
+	for _, o := range outputs {
+		switch {
+		case o.Kind == inferencegoSpec.OutputKindWebSearchToolCall && o.WebSearchToolCall != nil:
+			tool := webSearchSourceTool(o.WebSearchToolCall)
+			calls[tool.CallID] = tool
+			for _, item := range o.WebSearchToolCall.WebSearchToolCallItems {
+				switch {
+				case item.SearchItem != nil:
+					for _, src := range item.SearchItem.Sources {
+						add(src.URL, tool)
+					}
+				case item.OpenPageItem != nil:
+					add(item.OpenPageItem.URL, tool)
+				case item.FindItem != nil:
+					add(item.FindItem.URL, tool)
+				}
+			}
+		case o.Kind == inferencegoSpec.OutputKindWebSearchToolOutput && o.WebSearchToolOutput != nil:
+			tool := calls[o.WebSearchToolOutput.CallID]
+			for _, item := range o.WebSearchToolOutput.WebSearchToolOutputItems {
+				if item.SearchItem != nil {
+					add(item.SearchItem.URL, tool)
+				}
+			}
+		}
+	}
+	return byURL
+}
+
+func webSearchSourceTool(call *inferencegoSpec.ToolCall) *conversationSpec.CitationSourceTool {
+	return &conversationSpec.CitationSourceTool{
+		Type:   inferencegoSpec.ToolTypeWebSearch,
+		CallID: call.CallID,
+		Name:   call.Name,
+	}
+}
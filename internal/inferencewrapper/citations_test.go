@@ -0,0 +1,74 @@
+package inferencewrapper
+
+import (
+	"testing"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+)
+
+func TestExtractCitations(t *testing.T) {
+	urlCitation := func(url string, start, end int64) inferencegoSpec.Citation {
+		return inferencegoSpec.Citation{
+			Kind:        inferencegoSpec.CitationKindURL,
+			URLCitation: &inferencegoSpec.URLCitation{URL: url, Title: url + " title", StartIndex: start, EndIndex: end},
+		}
+	}
+	outputs := []inferencegoSpec.OutputUnion{
+		{
+			Kind:              inferencegoSpec.OutputKindWebSearchToolCall,
+			WebSearchToolCall: &inferencegoSpec.ToolCall{CallID: "ws1", Name: "web_search"},
+		},
+		{
+			Kind: inferencegoSpec.OutputKindWebSearchToolOutput,
+			WebSearchToolOutput: &inferencegoSpec.ToolOutput{
+				CallID: "ws1",
+				WebSearchToolOutputItems: []inferencegoSpec.WebSearchToolOutputItemUnion{{
+					Kind:       inferencegoSpec.WebSearchToolOutputKindSearch,
+					SearchItem: &inferencegoSpec.WebSearchToolOutputSearch{URL: "https://a.example"},
+				}},
+			},
+		},
+		{
+			Kind:              inferencegoSpec.OutputKindWebSearchToolCall,
+			WebSearchToolCall: &inferencegoSpec.ToolCall{CallID: "ws2"},
+		},
+		{
+			Kind: inferencegoSpec.OutputKindOutputMessage,
+			OutputMessage: &inferencegoSpec.InputOutputContent{
+				Contents: []inferencegoSpec.InputOutputContentItemUnion{
+					{Kind: inferencegoSpec.ContentItemKindText, TextItem: &inferencegoSpec.ContentItemText{Text: "no cites"}},
+					{Kind: inferencegoSpec.ContentItemKindText, TextItem: &inferencegoSpec.ContentItemText{
+						Text: "cited text",
+						Citations: []inferencegoSpec.Citation{
+							urlCitation("https://a.example", 0, 5),
+							urlCitation("https://a.example", 0, 5),
+							urlCitation("https://b.example", 6, 10),
+							{Kind: inferencegoSpec.CitationKindURL},
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	got := extractCitations(outputs)
+	if len(got) != 2 {
+		t.Fatalf("got %d citations, want 2: %+v", len(got), got)
+	}
+	a, b := got[0], got[1]
+	if a.URL != "https://a.example" || a.OutputIndex != 3 || a.ContentIndex != 1 || a.EndIndex != 5 ||
+		a.Title != "https://a.example title" {
+		t.Errorf("first citation = %+v", a)
+	}
+	// a.example is in the results of ws1; b.example falls back to the last search before the text.
+	if a.SourceTool == nil || a.SourceTool.CallID != "ws1" || a.SourceTool.Type != inferencegoSpec.ToolTypeWebSearch {
+		t.Errorf("first source tool = %+v", a.SourceTool)
+	}
+	if b.SourceTool == nil || b.SourceTool.CallID != "ws2" {
+		t.Errorf("second source tool = %+v", b.SourceTool)
+	}
+
+	if got := extractCitations(outputs[3:]); len(got) != 2 || got[0].SourceTool != nil {
+		t.Errorf("citations without web search = %+v", got)
+	}
+}
@@ -0,0 +1,222 @@
+package inferencewrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+	"github.com/google/uuid"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+// preCancelTTL bounds how long a cancel for an unknown ID is remembered.
+const preCancelTTL = 2 * time.Minute
+
+var errDuplicateRequestID = errors.New("duplicate requestID: a completion with this id is already in flight")
+
+// completionRegistry tracks in-flight completions so they can be listed and cancelled by request ID.
+//
+// Cancels may race ahead of the completion they target (e.g. the UI cancels right after issuing the request), so a
+// cancel for an unknown ID is remembered for a short while and honored when the completion registers.
+type completionRegistry struct {
+	mu          sync.Mutex
+	active      map[string]*activeCompletion
+	preCanceled map[string]time.Time
+}
+
+type activeCompletion struct {
+	id        string
+	provider  inferencegoSpec.ProviderName
+	startedAt time.Time
+	cancel    context.CancelFunc
+
+	// Guarded by the registry mutex.
+	modelName inferencegoSpec.ModelName
+	status    spec.CompletionStatus
+}
+
+type activeCompletionCtxKey struct{}
+
+func newCompletionRegistry() *completionRegistry {
+	return &completionRegistry{
+		active:      map[string]*activeCompletion{},
+		preCanceled: map[string]time.Time{},
+	}
+}
+
+// register adds a completion under id, generating one when empty. The returned context is cancelled by cancel and
+// done must be called when the completion finishes.
+func (r *completionRegistry) register(
+	ctx context.Context,
+	id string,
+	provider inferencegoSpec.ProviderName,
+) (cctx context.Context, ac *activeCompletion, done func(), err error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		u, err := uuid.NewV7()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		id = u.String()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.preCanceled[id]; ok {
+		delete(r.preCanceled, id)
+		return nil, nil, nil, context.Canceled
+	}
+	if _, exists := r.active[id]; exists {
+		return nil, nil, nil, errDuplicateRequestID
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	ac = &activeCompletion{
+		id:        id,
+		provider:  provider,
+		startedAt: time.Now(),
+		cancel:    cancel,
+		status:    spec.CompletionStatusPreparing,
+	}
+	r.active[id] = ac
+	cctx = context.WithValue(cctx, activeCompletionCtxKey{}, ac)
+
+	done = func() {
+		cancel()
+		r.mu.Lock()
+		if r.active[id] == ac {
+			delete(r.active, id)
+		}
+		r.mu.Unlock()
+	}
+	return cctx, ac, done, nil
+}
+
+// setStatus updates the status of the completion carried by ctx, if any. A completion being cancelled keeps that
+// status.
+func (r *completionRegistry) setStatus(ctx context.Context, status spec.CompletionStatus) {
+	ac, ok := ctx.Value(activeCompletionCtxKey{}).(*activeCompletion)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ac.status != spec.CompletionStatusCancelling {
+		ac.status = status
+	}
+}
+
+func (r *completionRegistry) setModelName(ac *activeCompletion, name inferencegoSpec.ModelName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ac.modelName = name
+}
+
+// cancel cancels the completion with id. If it is not in flight the cancel is remembered and found is false.
+func (r *completionRegistry) cancel(id string) (found bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ac, ok := r.active[id]; ok {
+		ac.status = spec.CompletionStatusCancelling
+		ac.cancel()
+		return true
+	}
+
+	now := time.Now()
+	r.preCanceled[id] = now
+	// Best-effort pruning to avoid unbounded growth.
+	for k, t := range r.preCanceled {
+		if now.Sub(t) > preCancelTTL {
+			delete(r.preCanceled, k)
+		}
+	}
+	return false
+}
+
+func (r *completionRegistry) get(id string) (spec.ActiveCompletion, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ac, ok := r.active[id]
+	if !ok {
+		return spec.ActiveCompletion{}, false
+	}
+	return ac.snapshot(time.Now()), true
+}
+
+// list returns all in-flight completions, oldest first.
+func (r *completionRegistry) list() []spec.ActiveCompletion {
+	r.mu.Lock()
+	now := time.Now()
+	out := make([]spec.ActiveCompletion, 0, len(r.active))
+	for _, ac := range r.active {
+		out = append(out, ac.snapshot(now))
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(out, func(a, b spec.ActiveCompletion) int {
+		if c := a.StartedAt.Compare(b.StartedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.RequestID, b.RequestID)
+	})
+	return out
+}
+
+// snapshot must be called with the registry mutex held.
+func (ac *activeCompletion) snapshot(now time.Time) spec.ActiveCompletion {
+	return spec.ActiveCompletion{
+		RequestID: ac.id,
+		Provider:  ac.provider,
+		ModelName: ac.modelName,
+		Status:    ac.status,
+		StartedAt: ac.startedAt.UTC(),
+		ElapsedMs: now.Sub(ac.startedAt).Milliseconds(),
+	}
+}
+
+// ListActiveCompletions lists the completions currently in flight, oldest first.
+func (ps *ProviderSetAPI) ListActiveCompletions(
+	ctx context.Context,
+	req *spec.ListActiveCompletionsRequest,
+) (*spec.ListActiveCompletionsResponse, error) {
+	return &spec.ListActiveCompletionsResponse{
+		Body: &spec.ListActiveCompletionsResponseBody{Completions: ps.completions.list()},
+	}, nil
+}
+
+// GetCompletionStatus reports the status and elapsed time of an in-flight completion.
+func (ps *ProviderSetAPI) GetCompletionStatus(
+	ctx context.Context,
+	req *spec.GetCompletionStatusRequest,
+) (*spec.GetCompletionStatusResponse, error) {
+	if req == nil || req.RequestID == "" {
+		return nil, errors.New("missing requestID")
+	}
+	ac, ok := ps.completions.get(req.RequestID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", spec.ErrCompletionNotFound, req.RequestID)
+	}
+	return &spec.GetCompletionStatusResponse{Body: &ac}, nil
+}
+
+// CancelCompletion cancels an in-flight completion. Cancelling an ID that has not started yet makes that completion
+// fail with context.Canceled when it starts.
+func (ps *ProviderSetAPI) CancelCompletion(
+	ctx context.Context,
+	req *spec.CancelCompletionRequest,
+) (*spec.CancelCompletionResponse, error) {
+	if req == nil || req.RequestID == "" {
+		return nil, errors.New("missing requestID")
+	}
+	found := ps.completions.cancel(req.RequestID)
+	ps.logger.Info("cancelCompletion", "requestID", req.RequestID, "found", found)
+	return &spec.CancelCompletionResponse{
+		Body: &spec.CancelCompletionResponseBody{Found: found},
+	}, nil
+}
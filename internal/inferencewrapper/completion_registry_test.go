@@ -0,0 +1,105 @@
+package inferencewrapper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+func TestCompletionRegistryCancelBeforeStart(t *testing.T) {
+	r := newCompletionRegistry()
+	if found := r.cancel("early"); found {
+		t.Fatal("cancel found a completion that was never registered")
+	}
+	if _, _, _, err := r.register(t.Context(), "early", "p"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("register after cancel: err = %v, want context.Canceled", err)
+	}
+	// The remembered cancel is used up by the completion it stopped.
+	_, _, done, err := r.register(t.Context(), "early", "p")
+	if err != nil {
+		t.Fatalf("register again: %v", err)
+	}
+	done()
+
+	r.preCanceled["stale"] = time.Now().Add(-2 * preCancelTTL)
+	r.cancel("other")
+	if _, ok := r.preCanceled["stale"]; ok {
+		t.Error("expired pre-cancel was not pruned")
+	}
+}
+
+func TestCompletionRegistryDuplicateIDs(t *testing.T) {
+	r := newCompletionRegistry()
+	_, first, done, err := r.register(t.Context(), " dup ", "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.id != "dup" {
+		t.Errorf("id = %q, want it trimmed", first.id)
+	}
+	if _, _, _, err := r.register(t.Context(), "dup", "p"); !errors.Is(err, errDuplicateRequestID) {
+		t.Fatalf("duplicate register: err = %v", err)
+	}
+	done()
+	_, _, done, err = r.register(t.Context(), "dup", "p")
+	if err != nil {
+		t.Fatalf("register after done: %v", err)
+	}
+	done()
+}
+
+func TestCompletionRegistryLifecycle(t *testing.T) {
+	r := newCompletionRegistry()
+	ctx, ac, done, err := r.register(t.Context(), "", "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ac.id == "" {
+		t.Fatal("no request ID was generated")
+	}
+	r.setModelName(ac, "m")
+	r.setStatus(ctx, spec.CompletionStatusRunning)
+	got, ok := r.get(ac.id)
+	if !ok || got.RequestID != ac.id || got.Provider != "p" || got.ModelName != "m" ||
+		got.Status != spec.CompletionStatusRunning {
+		t.Fatalf("get = %+v, %v", got, ok)
+	}
+
+	if !r.cancel(ac.id) {
+		t.Fatal("cancel did not find the active completion")
+	}
+	if ctx.Err() == nil {
+		t.Error("context was not cancelled")
+	}
+	r.setStatus(ctx, spec.CompletionStatusRunning)
+	if got, _ := r.get(ac.id); got.Status != spec.CompletionStatusCancelling {
+		t.Errorf("status = %s, want it to stay cancelling", got.Status)
+	}
+
+	done()
+	if _, ok := r.get(ac.id); ok {
+		t.Error("completion still registered after done")
+	}
+	if l := r.list(); len(l) != 0 {
+		t.Errorf("list after done = %+v", l)
+	}
+	if len(r.preCanceled) != 0 {
+		t.Errorf("pre-cancels = %v, want none", r.preCanceled)
+	}
+
+	// Finishing normally cancels the context too, so nothing started by the completion outlives it.
+	ctx, _, done, err = r.register(t.Context(), "", "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done()
+	if ctx.Err() == nil {
+		t.Error("context not cancelled after done")
+	}
+	if l := r.list(); len(l) != 0 {
+		t.Errorf("list after done = %+v", l)
+	}
+}
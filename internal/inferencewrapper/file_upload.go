@@ -0,0 +1,447 @@
+package inferencewrapper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flexigpt/inference-go"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+const (
+	fileUploadsFile          = "fileuploads.json"
+	fileUploadsSchemaVersion = "2026-10-19"
+	// Smaller files are cheaper to send inline than to upload.
+	fileUploadMinBytes = 32 << 10
+	fileUploadMaxBytes = 512 << 20
+	// fileUploadTTL bounds the reuse of an uploaded file when the provider reports no expiry.
+	fileUploadTTL     = 30 * 24 * time.Hour
+	fileUploadTimeout = 5 * time.Minute
+
+	anthropicFilesBetaPrefix = "files-api-"
+)
+
+// WithFileUploads uploads large file attachments to providers that offer a Files API and references them by file ID
+// instead of sending them inline on every turn. File IDs are cached per provider and content hash in dir.
+//
+// Uploads are used for OpenAI (api.openai.com) and for Anthropic providers whose default headers enable the files
+// API beta, which message requests that reference files need too. Uploaded files are referenced through the content
+// item ID, which inference-go sends as the provider file ID.
+func WithFileUploads(dir string) ProviderSetOption {
+	return func(ps *ProviderSetAPI) {
+		ps.files = &fileUploadCache{dir: dir}
+	}
+}
+
+type fileUploadKey struct {
+	provider inferencegoSpec.ProviderName
+	sha256   string
+}
+
+type uploadedFile struct {
+	Provider   inferencegoSpec.ProviderName `json:"provider"`
+	SHA256     string                       `json:"sha256"`
+	FileID     string                       `json:"fileID"`
+	SizeBytes  int64                        `json:"sizeBytes"`
+	UploadedAt time.Time                    `json:"uploadedAt"`
+	ExpiresAt  time.Time                    `json:"expiresAt"`
+}
+
+type fileUploadsSchema struct {
+	SchemaVersion string         `json:"schemaVersion"`
+	Files         []uploadedFile `json:"files"`
+}
+
+// fileUploadCache maps file contents to the IDs they were uploaded under.
+type fileUploadCache struct {
+	dir string
+
+	mu     sync.Mutex
+	store  *jsonLedger
+	files  map[fileUploadKey]uploadedFile
+	client *http.Client
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+func (c *fileUploadCache) init(logger *slog.Logger) error {
+	if strings.TrimSpace(c.dir) == "" {
+		return errors.New("file uploads need a directory")
+	}
+	if c.client == nil {
+		return errors.New("file uploads need an HTTP client")
+	}
+	var all fileUploadsSchema
+	store, err := openJSONLedger(c.dir, fileUploadsFile, fileUploadsSchema{
+		SchemaVersion: fileUploadsSchemaVersion,
+		Files:         []uploadedFile{},
+	}, &all, logger)
+	if err != nil {
+		return err
+	}
+	c.store = store
+	if c.now == nil {
+		c.now = time.Now
+	}
+	c.logger = logger
+	c.files = make(map[fileUploadKey]uploadedFile, len(all.Files))
+	for _, f := range all.Files {
+		// Expired entries are dropped on the next save.
+		if c.now().Before(f.ExpiresAt) {
+			c.files[fileUploadKey{f.Provider, f.SHA256}] = f
+		}
+	}
+	return nil
+}
+
+// fileUploadTarget is the provider files are uploaded to.
+type fileUploadTarget struct {
+	provider inferencegoSpec.ProviderName
+	api      spec.ModelCatalogKind
+	cfg      inference.AddProviderConfig
+	apiKey   string
+}
+
+// fileUploadAPI returns the Files API flavor of a provider. The model catalog kinds double as API flavors.
+func fileUploadAPI(cfg *inference.AddProviderConfig) (spec.ModelCatalogKind, bool) {
+	switch cfg.SDKType {
+	case inferencegoSpec.ProviderSDKTypeAnthropic:
+		if hasAnthropicBeta(cfg, anthropicFilesBetaPrefix) {
+			return spec.ModelCatalogKindAnthropic, true
+		}
+	case inferencegoSpec.ProviderSDKTypeOpenAIChatCompletions, inferencegoSpec.ProviderSDKTypeOpenAIResponses:
+		// OpenAI compatible servers rarely implement the Files API.
+		if isOpenAIOrigin(cfg.Origin) {
+			return spec.ModelCatalogKindOpenAI, true
+		}
+	default:
+	}
+	return "", false
+}
+
+// hasAnthropicBeta reports whether the default headers of a provider enable an Anthropic beta feature whose version
+// starts with prefix.
+func hasAnthropicBeta(cfg *inference.AddProviderConfig, prefix string) bool {
+	for k, v := range cfg.DefaultHeaders {
+		if strings.EqualFold(k, "anthropic-beta") && strings.Contains(v, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileRef is an inline file of a request that was replaced by an uploaded file.
+type fileRef struct {
+	item     *inferencegoSpec.InputOutputContentItemUnion
+	original *inferencegoSpec.ContentItemFile
+	data     []byte
+}
+
+// fileUploadPlan records the uploaded files of one request so they can be uploaded again when rejected.
+type fileUploadPlan struct {
+	c      *fileUploadCache
+	target fileUploadTarget
+	refs   []fileRef
+}
+
+// uploadFiles replaces large inline files of infReq with uploaded files where the provider supports it. Inputs are
+// copied before they are changed, as they may be shared with the caller. A failed upload leaves the file inline.
+// It returns nil when no file was replaced.
+func (ps *ProviderSetAPI) uploadFiles(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	infReq *inferencegoSpec.FetchCompletionRequest,
+) *fileUploadPlan {
+	if ps.files == nil || ps.getReplayProvider(provider) != nil {
+		return nil
+	}
+	ps.providersMu.RLock()
+	cfg, ok := ps.providers[provider]
+	apiKey := ps.apiKeys[provider]
+	ps.providersMu.RUnlock()
+	if !ok {
+		return nil
+	}
+	api, ok := fileUploadAPI(&cfg)
+	if !ok {
+		return nil
+	}
+
+	plan := &fileUploadPlan{
+		c:      ps.files,
+		target: fileUploadTarget{provider: provider, api: api, cfg: cfg, apiKey: apiKey},
+	}
+	infReq.Inputs = slices.Clone(infReq.Inputs)
+	for i := range infReq.Inputs {
+		in := &infReq.Inputs[i]
+		if in.Kind != inferencegoSpec.InputKindInputMessage || in.InputMessage == nil {
+			continue
+		}
+		var contents []inferencegoSpec.InputOutputContentItemUnion
+		for j, item := range in.InputMessage.Contents {
+			if item.Kind != inferencegoSpec.ContentItemKindFile || item.FileItem == nil || item.FileItem.FileData == "" {
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(item.FileItem.FileData)
+			if err != nil || len(data) < fileUploadMinBytes || len(data) > fileUploadMaxBytes {
+				continue
+			}
+			fileID, err := plan.c.fileID(ctx, plan.target, item.FileItem, data, false)
+			if err != nil {
+				ps.logger.Warn("upload file, sending inline",
+					"name", provider, "fileName", item.FileItem.FileName, "error", err)
+				continue
+			}
+			if contents == nil {
+				msg := *in.InputMessage
+				contents = slices.Clone(msg.Contents)
+				msg.Contents = contents
+				in.InputMessage = &msg
+			}
+			contents[j].FileItem = fileItemWithID(item.FileItem, fileID)
+			plan.refs = append(plan.refs, fileRef{item: &contents[j], original: item.FileItem, data: data})
+		}
+	}
+	if len(plan.refs) == 0 {
+		return nil
+	}
+	return plan
+}
+
+// retryRejected uploads files of the plan again after the request failed with err, when the provider no longer has
+// their IDs, e.g. because they expired or were deleted. Each ID is looked up in the Files API, which answers 404 for
+// unknown files. The request of the plan is updated in place; it reports whether to resend it.
+func (p *fileUploadPlan) retryRejected(ctx context.Context, err error) bool {
+	if p == nil || err == nil || ctx.Err() != nil {
+		return false
+	}
+	retry := false
+	for _, r := range p.refs {
+		found, cErr := p.c.exists(ctx, p.target, r.item.FileItem.ID)
+		if cErr != nil {
+			p.c.logger.Debug("look up uploaded file", "name", p.target.provider, "fileID", r.item.FileItem.ID,
+				"error", cErr)
+			continue
+		}
+		if found {
+			continue
+		}
+		retry = true
+		fileID, uErr := p.c.fileID(ctx, p.target, r.original, r.data, true)
+		if uErr != nil {
+			p.c.logger.Warn("upload file again, sending inline",
+				"name", p.target.provider, "fileName", r.original.FileName, "error", uErr)
+			r.item.FileItem = r.original
+			continue
+		}
+		r.item.FileItem = fileItemWithID(r.original, fileID)
+	}
+	return retry
+}
+
+func fileItemWithID(fi *inferencegoSpec.ContentItemFile, fileID string) *inferencegoSpec.ContentItemFile {
+	out := *fi
+	out.FileData = ""
+	out.FileURL = ""
+	out.ID = fileID
+	return &out
+}
+
+// fileID returns the cached file ID of data, uploading it when there is none, it expired or force is set.
+func (c *fileUploadCache) fileID(
+	ctx context.Context,
+	target fileUploadTarget,
+	fi *inferencegoSpec.ContentItemFile,
+	data []byte,
+	force bool,
+) (string, error) {
+	sum := sha256.Sum256(data)
+	key := fileUploadKey{target.provider, hex.EncodeToString(sum[:])}
+
+	c.mu.Lock()
+	f, ok := c.files[key]
+	c.mu.Unlock()
+	if ok && !force && c.now().Before(f.ExpiresAt) {
+		return f.FileID, nil
+	}
+
+	fileID, expiresAt, err := c.upload(ctx, target, fi, data)
+	if err != nil {
+		return "", err
+	}
+	now := c.now().UTC()
+	if expiresAt.IsZero() || expiresAt.After(now.Add(fileUploadTTL)) {
+		expiresAt = now.Add(fileUploadTTL)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[key] = uploadedFile{
+		Provider:   target.provider,
+		SHA256:     key.sha256,
+		FileID:     fileID,
+		SizeBytes:  int64(len(data)),
+		UploadedAt: now,
+		ExpiresAt:  expiresAt,
+	}
+	if err := c.saveLocked(); err != nil {
+		c.logger.Warn("save file upload cache", "error", err)
+	}
+	c.logger.Info("uploaded file", "name", target.provider, "fileID", fileID, "sizeBytes", len(data))
+	return fileID, nil
+}
+
+func (c *fileUploadCache) saveLocked() error {
+	all := fileUploadsSchema{SchemaVersion: fileUploadsSchemaVersion, Files: make([]uploadedFile, 0, len(c.files))}
+	now := c.now()
+	for k, f := range c.files {
+		if !now.Before(f.ExpiresAt) {
+			delete(c.files, k)
+			continue
+		}
+		all.Files = append(all.Files, f)
+	}
+	return c.store.save(all)
+}
+
+// upload sends data to the provider's Files API and returns the file ID and, if reported, its expiry.
+func (c *fileUploadCache) upload(
+	ctx context.Context,
+	target fileUploadTarget,
+	fi *inferencegoSpec.ContentItemFile,
+	data []byte,
+) (fileID string, expiresAt time.Time, err error) {
+	rawURL, err := filesURL(target)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	headers := catalogHeaders(target.api, &target.cfg, target.apiKey)
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if target.api != spec.ModelCatalogKindAnthropic {
+		if err := w.WriteField("purpose", "user_data"); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	name := fi.FileName
+	if name == "" {
+		name = "attachment"
+	}
+	mime := fi.FileMIME
+	if mime == "" {
+		mime = inferencegoSpec.DefaultFileDataMIME
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, name))
+	h.Set("Content-Type", mime)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", time.Time{}, err
+	}
+	if err := w.Close(); err != nil {
+		return "", time.Time{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fileUploadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, &body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header = headers
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, modelCatalogMaxErrBody))
+		return "", time.Time{}, fmt.Errorf("files endpoint returned status %d: %s",
+			resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	var out struct {
+		ID        string `json:"id"`
+		ExpiresAt *int64 `json:"expires_at"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, modelCatalogMaxBody)).Decode(&out); err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid files response: %w", err)
+	}
+	if out.ID == "" {
+		return "", time.Time{}, errors.New("files response has no file ID")
+	}
+	if out.ExpiresAt != nil && *out.ExpiresAt > 0 {
+		expiresAt = time.Unix(*out.ExpiresAt, 0).UTC()
+	}
+	return out.ID, expiresAt, nil
+}
+
+// exists reports whether the provider still has the uploaded file fileID.
+func (c *fileUploadCache) exists(ctx context.Context, target fileUploadTarget, fileID string) (bool, error) {
+	rawURL, err := filesURL(target)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, modelCatalogTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL+"/"+url.PathEscape(fileID), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header = catalogHeaders(target.api, &target.cfg, target.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, modelCatalogMaxErrBody))
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return false, nil
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return true, nil
+	default:
+		return false, fmt.Errorf("files endpoint returned status %d", resp.StatusCode)
+	}
+}
+
+// filesURL returns the Files API endpoint of target.
+func filesURL(target fileUploadTarget) (string, error) {
+	origin := strings.TrimRight(strings.TrimSpace(target.cfg.Origin), "/")
+	if origin == "" {
+		return "", errors.New("provider has no origin")
+	}
+	if target.api == spec.ModelCatalogKindAnthropic {
+		return origin + "/v1/files", nil
+	}
+	return origin + openAIFilesPath(target.cfg.ChatCompletionPathPrefix), nil
+}
+
+// openAIFilesPath derives the files path from the completions path prefix, like openAIModelsPath.
+func openAIFilesPath(completionPrefix string) string {
+	return strings.TrimSuffix(openAIModelsPath(completionPrefix), "/models") + "/files"
+}
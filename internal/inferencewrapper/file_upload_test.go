@@ -0,0 +1,149 @@
+package inferencewrapper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flexigpt/inference-go"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+)
+
+func TestUploadFiles(t *testing.T) {
+	var uploads atomic.Int32
+	var deleted sync.Map
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("anthropic-beta") == "" {
+			http.Error(w, "missing beta header", http.StatusBadRequest)
+			return
+		}
+		if id, ok := strings.CutPrefix(r.URL.Path, "/v1/files/"); ok && r.Method == http.MethodGet {
+			if _, gone := deleted.Load(id); gone {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprintf(w, `{"id":%q}`, id)
+			return
+		}
+		if r.URL.Path != "/v1/files" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if _, _, err := r.FormFile("file"); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"id":"file_%d"}`, uploads.Add(1))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	newPS := func() *ProviderSetAPI {
+		ps := &ProviderSetAPI{
+			logger: slog.Default(),
+			providers: map[inferencegoSpec.ProviderName]inference.AddProviderConfig{
+				"claude": {
+					SDKType:        inferencegoSpec.ProviderSDKTypeAnthropic,
+					Origin:         srv.URL,
+					DefaultHeaders: map[string]string{"anthropic-beta": "files-api-2025-04-14"},
+				},
+				"plain": {SDKType: inferencegoSpec.ProviderSDKTypeAnthropic, Origin: srv.URL},
+			},
+			apiKeys: map[inferencegoSpec.ProviderName]string{"claude": "k"},
+			files:   &fileUploadCache{dir: dir, client: srv.Client()},
+		}
+		if err := ps.files.init(ps.logger); err != nil {
+			t.Fatal(err)
+		}
+		return ps
+	}
+
+	large := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), fileUploadMinBytes))
+	newReq := func() *inferencegoSpec.FetchCompletionRequest {
+		return &inferencegoSpec.FetchCompletionRequest{Inputs: []inferencegoSpec.InputUnion{{
+			Kind: inferencegoSpec.InputKindInputMessage,
+			InputMessage: &inferencegoSpec.InputOutputContent{
+				Contents: []inferencegoSpec.InputOutputContentItemUnion{
+					{
+						Kind:     inferencegoSpec.ContentItemKindFile,
+						FileItem: &inferencegoSpec.ContentItemFile{FileName: "big.pdf", FileData: large},
+					},
+					{
+						Kind:     inferencegoSpec.ContentItemKindFile,
+						FileItem: &inferencegoSpec.ContentItemFile{FileName: "small.pdf", FileData: "YQ=="},
+					},
+				},
+			},
+		}}}
+	}
+	fileItem := func(req *inferencegoSpec.FetchCompletionRequest, i int) *inferencegoSpec.ContentItemFile {
+		return req.Inputs[0].InputMessage.Contents[i].FileItem
+	}
+
+	ps := newPS()
+	if plan := ps.uploadFiles(t.Context(), "plain", newReq()); plan != nil {
+		t.Fatal("provider without the files beta must not upload")
+	}
+
+	orig := newReq()
+	req := *orig
+	plan := ps.uploadFiles(t.Context(), "claude", &req)
+	if plan == nil || uploads.Load() != 1 {
+		t.Fatalf("expected one upload, got %d", uploads.Load())
+	}
+	if fi := fileItem(&req, 0); fi.ID != "file_1" || fi.FileData != "" || fi.FileName != "big.pdf" {
+		t.Errorf("uploaded item = %+v", fi)
+	}
+	if fi := fileItem(&req, 1); fi.FileData != "YQ==" {
+		t.Error("small file must stay inline")
+	}
+	if fileItem(orig, 0).FileData != large {
+		t.Error("caller inputs were modified")
+	}
+	// The provider request references the uploaded file instead of carrying its data.
+	req.ModelParam = inferencegoSpec.ModelParam{Name: "claude-test", MaxOutputLength: 16}
+	wire, err := ps.captureWireJSON(t.Context(), "claude", &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(wire, `"file_1"`) || strings.Contains(wire, large[:64]) {
+		t.Errorf("wire request does not reference the uploaded file:\n%s", wire)
+	}
+
+	// The cache survives restarts and serves later turns.
+	ps = newPS()
+	req = *newReq()
+	ps.uploadFiles(t.Context(), "claude", &req)
+	if uploads.Load() != 1 || fileItem(&req, 0).ID != "file_1" {
+		t.Fatalf("expected cached file ID, uploads = %d", uploads.Load())
+	}
+
+	// Expired entries are uploaded again.
+	ps.files.now = func() time.Time { return time.Now().Add(fileUploadTTL + time.Hour) }
+	req = *newReq()
+	plan = ps.uploadFiles(t.Context(), "claude", &req)
+	if uploads.Load() != 2 || fileItem(&req, 0).ID != "file_2" {
+		t.Fatalf("expected upload of expired file, uploads = %d", uploads.Load())
+	}
+	ps.files.now = time.Now
+
+	if plan.retryRejected(t.Context(), errors.New("rate limited")) {
+		t.Error("errors while the provider still has the file must not trigger a new upload")
+	}
+	deleted.Store("file_2", true)
+	if !plan.retryRejected(t.Context(), errors.New("invalid request")) {
+		t.Fatal("a file the provider no longer has must be uploaded again")
+	}
+	if uploads.Load() != 3 || fileItem(&req, 0).ID != "file_3" {
+		t.Errorf("expected new upload after rejection, uploads = %d, item = %+v", uploads.Load(), fileItem(&req, 0))
+	}
+}
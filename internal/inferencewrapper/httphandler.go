@@ -39,6 +39,59 @@ func InitProviderSetHandlers(api huma.API, providerSetAPI *ProviderSetAPI) {
 		Tags:        []string{tag},
 	}, providerSetAPI.SetProviderAPIKey)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "check-provider",
+		Method:      http.MethodPost,
+		Path:        pathPrefix + "/providers/{provider}/check",
+		Summary:     "Check provider connectivity",
+		Description: "Verify access by listing the provider's models, and diff them against its stored model presets",
+		Tags:        []string{tag},
+	}, providerSetAPI.CheckProvider)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "set-provider-ratelimits",
+		Method:      http.MethodPatch,
+		Path:        pathPrefix + "/providers/{provider}/ratelimits",
+		Summary:     "Set provider rate limits",
+		Description: "Replace the client side rate limits of a provider",
+		Tags:        []string{tag},
+	}, providerSetAPI.SetProviderRateLimits)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-provider-queue-stats",
+		Method:      http.MethodGet,
+		Path:        pathPrefix + "/queues",
+		Summary:     "List provider queue stats",
+		Description: "List queue depth and wait times of rate limited providers",
+		Tags:        []string{tag},
+	}, providerSetAPI.ListProviderQueueStats)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "set-token-quota",
+		Method:      http.MethodPut,
+		Path:        pathPrefix + "/quotas/{provider}",
+		Summary:     "Set a token quota",
+		Description: "Add or replace the daily and monthly token quota of a provider, or of one of its model presets",
+		Tags:        []string{tag},
+	}, providerSetAPI.SetTokenQuota)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-token-quota",
+		Method:      http.MethodDelete,
+		Path:        pathPrefix + "/quotas/{provider}",
+		Summary:     "Delete a token quota",
+		Tags:        []string{tag},
+	}, providerSetAPI.DeleteTokenQuota)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-token-quotas",
+		Method:      http.MethodGet,
+		Path:        pathPrefix + "/quotas",
+		Summary:     "List token quotas",
+		Description: "List token quotas with their consumption in the current day and month",
+		Tags:        []string{tag},
+	}, providerSetAPI.ListTokenQuotas)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "fetch-provider-completion",
 		Method:      http.MethodPost,
@@ -47,4 +100,40 @@ func InitProviderSetHandlers(api huma.API, providerSetAPI *ProviderSetAPI) {
 		Description: "Fetch completion for a provider",
 		Tags:        []string{tag},
 	}, providerSetAPI.FetchCompletion)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-active-completions",
+		Method:      http.MethodGet,
+		Path:        pathPrefix + "/completions",
+		Summary:     "List active completions",
+		Description: "List in-flight completions with their status and elapsed time",
+		Tags:        []string{tag},
+	}, providerSetAPI.ListActiveCompletions)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-completion-status",
+		Method:      http.MethodGet,
+		Path:        pathPrefix + "/completions/{requestID}",
+		Summary:     "Get completion status",
+		Description: "Get the status and elapsed time of an in-flight completion",
+		Tags:        []string{tag},
+	}, providerSetAPI.GetCompletionStatus)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "cancel-completion",
+		Method:      http.MethodPost,
+		Path:        pathPrefix + "/completions/{requestID}/cancel",
+		Summary:     "Cancel completion",
+		Description: "Cancel an in-flight completion by request ID",
+		Tags:        []string{tag},
+	}, providerSetAPI.CancelCompletion)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "preview-provider-completion",
+		Method:      http.MethodPost,
+		Path:        pathPrefix + "/providers/{provider}/completion/preview",
+		Summary:     "Preview completion request for a provider",
+		Description: "Build the fully hydrated completion request for a provider without sending it",
+		Tags:        []string{tag},
+	}, providerSetAPI.PreviewCompletion)
 }
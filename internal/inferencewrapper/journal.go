@@ -0,0 +1,326 @@
+package inferencewrapper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+	"github.com/google/uuid"
+
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+const (
+	journalFileExtension = ".json"
+	// journalCheckpointInterval bounds how often a streaming completion is written to disk.
+	journalCheckpointInterval = 500 * time.Millisecond
+	// journalMaxAge is how long an entry that cannot be saved (e.g. its conversation was deleted) is retried.
+	journalMaxAge = 7 * 24 * time.Hour
+)
+
+// ConversationStore is the part of the conversation store the recovery journal saves partial turns to.
+type ConversationStore interface {
+	GetConversation(
+		ctx context.Context,
+		req *conversationSpec.GetConversationRequest,
+	) (*conversationSpec.GetConversationResponse, error)
+	PutMessagesToConversation(
+		ctx context.Context,
+		req *conversationSpec.PutMessagesToConversationRequest,
+	) (*conversationSpec.PutMessagesToConversationResponse, error)
+}
+
+// WithRecoveryJournal checkpoints streamed output of completions that have a recovery target into dir. When such a
+// completion is cancelled or fails, or the app exits while it streams, the partial output is saved into its
+// conversation as an assistant turn with incomplete status. Entries left by a previous run are recovered when the
+// provider set is created.
+func WithRecoveryJournal(dir string, conversations ConversationStore) ProviderSetOption {
+	return func(ps *ProviderSetAPI) {
+		ps.journal = &recoveryJournal{dir: dir, conversations: conversations}
+	}
+}
+
+// recoveryJournal keeps one JSON file per streaming completion.
+type recoveryJournal struct {
+	dir           string
+	conversations ConversationStore
+	logger        *slog.Logger
+}
+
+func (j *recoveryJournal) init(logger *slog.Logger) error {
+	if strings.TrimSpace(j.dir) == "" || j.conversations == nil {
+		return errors.New("recovery journal needs a directory and a conversation store")
+	}
+	j.logger = logger
+	return os.MkdirAll(j.dir, 0o770)
+}
+
+// entryPath hashes the request ID, as callers choose it freely.
+func (j *recoveryJournal) entryPath(requestID string) string {
+	sum := sha256.Sum256([]byte(requestID))
+	return filepath.Join(j.dir, hex.EncodeToString(sum[:16])+journalFileExtension)
+}
+
+// begin starts journaling a completion. It returns nil when there is no journal or the request has no recovery
+// target, and all journalEntry methods accept a nil receiver.
+func (j *recoveryJournal) begin(
+	requestID string,
+	provider inferencegoSpec.ProviderName,
+	modelName inferencegoSpec.ModelName,
+	body *spec.CompletionRequestBody,
+) (*journalEntry, error) {
+	if j == nil || body == nil || body.Recovery == nil {
+		return nil, nil
+	}
+	target := *body.Recovery
+	if strings.TrimSpace(target.ConversationID) == "" || strings.TrimSpace(target.ConversationTitle) == "" {
+		return nil, errors.New("recovery target needs a conversation ID and title")
+	}
+	if target.AssistantMessageID == "" {
+		u, err := uuid.NewV7()
+		if err != nil {
+			return nil, err
+		}
+		target.AssistantMessageID = u.String()
+	}
+	now := time.Now().UTC()
+	return &journalEntry{
+		j: j,
+		rc: spec.RecoveredCompletion{
+			RequestID:   requestID,
+			Provider:    provider,
+			ModelName:   modelName,
+			Target:      target,
+			UserMessage: body.Current,
+			StartedAt:   now,
+			UpdatedAt:   now,
+		},
+	}, nil
+}
+
+func (j *recoveryJournal) write(rc *spec.RecoveredCompletion) error {
+	b, err := json.MarshalIndent(rc, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := j.entryPath(rc.RequestID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (j *recoveryJournal) remove(requestID string) {
+	if err := os.Remove(j.entryPath(requestID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		j.logger.Warn("remove recovery journal entry", "requestID", requestID, "error", err)
+	}
+}
+
+// recoverAll saves the entries left by a previous run into their conversations. Entries that cannot be saved are
+// kept for the next run until they exceed journalMaxAge.
+func (j *recoveryJournal) recoverAll(ctx context.Context) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		j.logger.Warn("read recovery journal", "dir", j.dir, "error", err)
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != journalFileExtension {
+			continue
+		}
+		path := filepath.Join(j.dir, e.Name())
+		b, err := os.ReadFile(path)
+		if err != nil {
+			j.logger.Warn("read recovery journal entry", "file", path, "error", err)
+			continue
+		}
+		var rc spec.RecoveredCompletion
+		if err := json.Unmarshal(b, &rc); err != nil {
+			j.logger.Warn("discard invalid recovery journal entry", "file", path, "error", err)
+			_ = os.Remove(path)
+			continue
+		}
+		if rc.Reason == "" {
+			rc.Reason = spec.RecoveryReasonInterrupted
+		}
+		if err := j.materialize(ctx, &rc); err != nil {
+			if time.Since(rc.UpdatedAt) > journalMaxAge {
+				j.logger.Warn("discard stale recovery journal entry", "requestID", rc.RequestID, "error", err)
+				_ = os.Remove(path)
+			} else {
+				j.logger.Warn("recover partial completion", "requestID", rc.RequestID, "error", err)
+			}
+			continue
+		}
+		_ = os.Remove(path)
+		j.logger.Info("recovered partial completion",
+			"requestID", rc.RequestID, "conversationID", rc.Target.ConversationID, "reason", rc.Reason)
+	}
+}
+
+// materialize appends the partial assistant turn to its conversation, after the user turn if that is missing.
+// The conversation is left alone when it already has the assistant turn.
+func (j *recoveryJournal) materialize(ctx context.Context, rc *spec.RecoveredCompletion) error {
+	convo, err := j.conversations.GetConversation(ctx, &conversationSpec.GetConversationRequest{
+		ID:         rc.Target.ConversationID,
+		Title:      rc.Target.ConversationTitle,
+		ForceFetch: true,
+	})
+	if err != nil {
+		return fmt.Errorf("get conversation: %w", err)
+	}
+	if convo == nil || convo.Body == nil {
+		return errors.New("conversation not found")
+	}
+
+	messages := convo.Body.Messages
+	hasMessage := func(id string) bool {
+		return slices.ContainsFunc(messages, func(m conversationSpec.ConversationMessage) bool { return m.ID == id })
+	}
+	if hasMessage(rc.Target.AssistantMessageID) {
+		return nil
+	}
+	if rc.UserMessage.ID != "" && !hasMessage(rc.UserMessage.ID) {
+		messages = append(messages, rc.UserMessage)
+	}
+	messages = append(messages, partialAssistantMessage(rc))
+
+	_, err = j.conversations.PutMessagesToConversation(ctx, &conversationSpec.PutMessagesToConversationRequest{
+		ID: rc.Target.ConversationID,
+		Body: &conversationSpec.PutMessagesToConversationRequestBody{
+			Title:    rc.Target.ConversationTitle,
+			Messages: messages,
+		},
+	})
+	return err
+}
+
+// partialAssistantMessage builds the incomplete assistant turn of a journal entry.
+func partialAssistantMessage(rc *spec.RecoveredCompletion) conversationSpec.ConversationMessage {
+	msg := conversationSpec.ConversationMessage{
+		ID:        rc.Target.AssistantMessageID,
+		CreatedAt: rc.UpdatedAt,
+		Role:      inferencegoSpec.RoleAssistant,
+		Status:    inferencegoSpec.StatusIncomplete,
+		Provider:  rc.Provider,
+		Meta:      map[string]any{"recoveryReason": string(rc.Reason)},
+	}
+	if rc.ModelName != "" {
+		msg.ModelParam = &inferencegoSpec.ModelParam{Name: rc.ModelName}
+	}
+	if rc.Thinking != "" {
+		msg.Outputs = append(msg.Outputs, inferencegoSpec.OutputUnion{
+			Kind: inferencegoSpec.OutputKindReasoningMessage,
+			ReasoningMessage: &inferencegoSpec.ReasoningContent{
+				Role:     inferencegoSpec.RoleAssistant,
+				Status:   inferencegoSpec.StatusIncomplete,
+				Thinking: []string{rc.Thinking},
+			},
+		})
+	}
+	if rc.Text != "" {
+		msg.Outputs = append(msg.Outputs, inferencegoSpec.OutputUnion{
+			Kind: inferencegoSpec.OutputKindOutputMessage,
+			OutputMessage: &inferencegoSpec.InputOutputContent{
+				Role:   inferencegoSpec.RoleAssistant,
+				Status: inferencegoSpec.StatusIncomplete,
+				Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+					Kind:     inferencegoSpec.ContentItemKindText,
+					TextItem: &inferencegoSpec.ContentItemText{Text: rc.Text},
+				}},
+			},
+		})
+	}
+	if rc.Error != "" {
+		msg.Error = &inferencegoSpec.Error{Message: rc.Error}
+	}
+	return msg
+}
+
+// journalEntry accumulates the streamed output of one completion and checkpoints it.
+type journalEntry struct {
+	j *recoveryJournal
+
+	mu             sync.Mutex
+	rc             spec.RecoveredCompletion
+	text           strings.Builder
+	thinking       strings.Builder
+	lastCheckpoint time.Time
+}
+
+// wrap records the deltas passed to fn. Completions without a stream callback do not stream, so fn is returned
+// unchanged when nil.
+func (e *journalEntry) wrap(thinking bool, fn func(string) error) func(string) error {
+	if e == nil || fn == nil {
+		return fn
+	}
+	return func(s string) error {
+		e.append(thinking, s)
+		return fn(s)
+	}
+}
+
+func (e *journalEntry) append(thinking bool, s string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if thinking {
+		e.thinking.WriteString(s)
+	} else {
+		e.text.WriteString(s)
+	}
+	if time.Since(e.lastCheckpoint) >= journalCheckpointInterval {
+		e.checkpointLocked()
+	}
+}
+
+func (e *journalEntry) checkpointLocked() {
+	e.rc.Text = e.text.String()
+	e.rc.Thinking = e.thinking.String()
+	e.rc.UpdatedAt = time.Now().UTC()
+	e.lastCheckpoint = time.Now()
+	if err := e.j.write(&e.rc); err != nil {
+		e.j.logger.Warn("checkpoint partial completion", "requestID", e.rc.RequestID, "error", err)
+	}
+}
+
+// finish removes the entry of a successful completion. Otherwise the partial output, if any, is saved into the
+// conversation; the entry is kept for the next start if that fails.
+func (e *journalEntry) finish(ctx context.Context, callErr error) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if callErr == nil || (e.text.Len() == 0 && e.thinking.Len() == 0) {
+		e.j.remove(e.rc.RequestID)
+		return
+	}
+
+	e.rc.Reason = spec.RecoveryReasonFailed
+	if errors.Is(callErr, context.Canceled) || ctx.Err() != nil {
+		e.rc.Reason = spec.RecoveryReasonCancelled
+	} else {
+		e.rc.Error = callErr.Error()
+	}
+	e.checkpointLocked()
+
+	// The completion context is usually done here, the save must not depend on it.
+	if err := e.j.materialize(context.WithoutCancel(ctx), &e.rc); err != nil {
+		e.j.logger.Warn("save partial completion", "requestID", e.rc.RequestID, "error", err)
+		return
+	}
+	e.j.remove(e.rc.RequestID)
+}
@@ -0,0 +1,171 @@
+package inferencewrapper
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+type fakeConversationStore struct {
+	convo *conversationSpec.Conversation
+	puts  int
+}
+
+func (f *fakeConversationStore) GetConversation(
+	_ context.Context,
+	req *conversationSpec.GetConversationRequest,
+) (*conversationSpec.GetConversationResponse, error) {
+	if f.convo == nil || f.convo.ID != req.ID || f.convo.Title != req.Title {
+		return nil, errors.New("file does not exist")
+	}
+	c := *f.convo
+	return &conversationSpec.GetConversationResponse{Body: &c}, nil
+}
+
+func (f *fakeConversationStore) PutMessagesToConversation(
+	_ context.Context,
+	req *conversationSpec.PutMessagesToConversationRequest,
+) (*conversationSpec.PutMessagesToConversationResponse, error) {
+	f.puts++
+	f.convo.Messages = req.Body.Messages
+	return &conversationSpec.PutMessagesToConversationResponse{}, nil
+}
+
+func newTestJournal(t *testing.T, store *fakeConversationStore) *recoveryJournal {
+	t.Helper()
+	j := &recoveryJournal{dir: t.TempDir(), conversations: store}
+	if err := j.init(slog.Default()); err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func journalBody() *spec.CompletionRequestBody {
+	return &spec.CompletionRequestBody{
+		Current: conversationSpec.ConversationMessage{ID: "u1", Role: inferencegoSpec.RoleUser},
+		Recovery: &spec.CompletionRecoveryTarget{
+			ConversationID: "c1", ConversationTitle: "Chat", AssistantMessageID: "a1",
+		},
+	}
+}
+
+func TestJournalCancelMaterializesPartialTurn(t *testing.T) {
+	store := &fakeConversationStore{convo: &conversationSpec.Conversation{ID: "c1", Title: "Chat"}}
+	j := newTestJournal(t, store)
+
+	e, err := j.begin("req-1", "p", "m", journalBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	noop := func(string) error { return nil }
+	onText, onThinking := e.wrap(false, noop), e.wrap(true, noop)
+	for _, fn := range []func() error{
+		func() error { return onThinking("plan") },
+		func() error { return onText("Hel") },
+		func() error { return onText("lo") },
+	} {
+		if err := fn(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	e.finish(ctx, context.Canceled)
+
+	msgs := store.convo.Messages
+	if len(msgs) != 2 || msgs[0].ID != "u1" || msgs[1].ID != "a1" {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	a := msgs[1]
+	if a.Status != inferencegoSpec.StatusIncomplete || a.Meta["recoveryReason"] != string(spec.RecoveryReasonCancelled) {
+		t.Errorf("assistant status = %s, meta = %v", a.Status, a.Meta)
+	}
+	if a.Provider != "p" || a.ModelParam == nil || a.ModelParam.Name != "m" {
+		t.Errorf("assistant provider = %q, model param = %+v", a.Provider, a.ModelParam)
+	}
+	if len(a.Outputs) != 2 || a.Outputs[0].ReasoningMessage.Thinking[0] != "plan" ||
+		a.Outputs[1].OutputMessage.Contents[0].TextItem.Text != "Hello" {
+		t.Errorf("outputs = %+v", a.Outputs)
+	}
+	if _, err := os.Stat(j.entryPath("req-1")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal entry not removed: %v", err)
+	}
+
+	// A second save of the same turn leaves the conversation alone.
+	if err := j.materialize(t.Context(), &e.rc); err != nil || store.puts != 1 {
+		t.Errorf("materialize again: err = %v, puts = %d", err, store.puts)
+	}
+}
+
+func TestJournalSuccessRemovesEntry(t *testing.T) {
+	store := &fakeConversationStore{convo: &conversationSpec.Conversation{ID: "c1", Title: "Chat"}}
+	j := newTestJournal(t, store)
+
+	e, err := j.begin("req-1", "p", "m", journalBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.wrap(false, func(string) error { return nil })("Hi"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(j.entryPath("req-1")); err != nil {
+		t.Fatalf("first delta was not checkpointed: %v", err)
+	}
+	e.finish(t.Context(), nil)
+	if _, err := os.Stat(j.entryPath("req-1")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal entry not removed: %v", err)
+	}
+	if store.puts != 0 {
+		t.Errorf("puts = %d, want 0", store.puts)
+	}
+
+	var nilJournal *recoveryJournal
+	if e, err := nilJournal.begin("req-2", "p", "m", journalBody()); e != nil || err != nil {
+		t.Errorf("nil journal begin = %v, %v", e, err)
+	}
+	if _, err := j.begin("req-3", "p", "m", &spec.CompletionRequestBody{
+		Recovery: &spec.CompletionRecoveryTarget{ConversationID: "c1"},
+	}); err == nil {
+		t.Error("expected error for target without title")
+	}
+}
+
+func TestJournalRecoverInterrupted(t *testing.T) {
+	store := &fakeConversationStore{}
+	j := newTestJournal(t, store)
+
+	e, err := j.begin("req-1", "p", "m", journalBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.wrap(false, func(string) error { return nil })("partial"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The conversation is missing, so the entry is kept for the next run.
+	j.recoverAll(t.Context())
+	if _, err := os.Stat(j.entryPath("req-1")); err != nil {
+		t.Fatalf("entry dropped although it could not be saved: %v", err)
+	}
+
+	store.convo = &conversationSpec.Conversation{
+		ID: "c1", Title: "Chat",
+		Messages: []conversationSpec.ConversationMessage{{ID: "u1", Role: inferencegoSpec.RoleUser}},
+	}
+	j.recoverAll(t.Context())
+	msgs := store.convo.Messages
+	if len(msgs) != 2 || msgs[1].Meta["recoveryReason"] != string(spec.RecoveryReasonInterrupted) {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	if _, err := os.Stat(j.entryPath("req-1")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal entry not removed: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package inferencewrapper
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/ppipada/mapstore-go"
+	"github.com/ppipada/mapstore-go/jsonencdec"
+)
+
+// jsonLedger is a small JSON document persisted in one file, such as the token quotas or the uploaded files. Every
+// save is flushed to disk.
+type jsonLedger struct {
+	store *mapstore.MapFileStore
+}
+
+// openJSONLedger opens the ledger file name in dir and decodes it into out. The directory and, from empty, the file
+// are created when missing.
+func openJSONLedger(dir, name string, empty, out any, logger *slog.Logger) (*jsonLedger, error) {
+	if err := os.MkdirAll(dir, 0o770); err != nil {
+		return nil, err
+	}
+	def, err := jsonencdec.StructWithJSONTagsToMap(empty)
+	if err != nil {
+		return nil, err
+	}
+	store, err := mapstore.NewMapFileStore(
+		filepath.Join(dir, name),
+		def,
+		jsonencdec.JSONEncoderDecoder{},
+		mapstore.WithCreateIfNotExists(true),
+		mapstore.WithFileAutoFlush(true),
+		mapstore.WithFileLogger(logger),
+	)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := store.GetAll(false)
+	if err != nil {
+		return nil, err
+	}
+	if err := jsonencdec.MapToStructWithJSONTags(raw, out); err != nil {
+		return nil, err
+	}
+	return &jsonLedger{store: store}, nil
+}
+
+// save replaces the stored document with v.
+func (l *jsonLedger) save(v any) error {
+	m, err := jsonencdec.StructWithJSONTagsToMap(v)
+	if err != nil {
+		return err
+	}
+	return l.store.SetAll(m)
+}
@@ -0,0 +1,346 @@
+package inferencewrapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flexigpt/inference-go"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+)
+
+const (
+	modelCatalogTimeout  = 30 * time.Second
+	modelCatalogMaxPages = 20
+	modelCatalogMaxBody  = 16 << 20
+	// Only a prefix of error bodies is kept; they are shown to the user as is.
+	modelCatalogMaxErrBody = 512
+
+	anthropicDefaultAPIVersion = "2023-06-01"
+	geminiAPIHost              = "generativelanguage.googleapis.com"
+)
+
+// catalogStatusError is returned when a models endpoint answers with a non 2xx status.
+type catalogStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *catalogStatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("models endpoint returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("models endpoint returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// CheckProvider verifies the credentials and reachability of a provider by listing its models, and diffs the remote
+// catalog against the provider's stored model presets. Connectivity and auth failures are reported in the response
+// body, not as errors.
+func (ps *ProviderSetAPI) CheckProvider(
+	ctx context.Context,
+	req *spec.CheckProviderRequest,
+) (*spec.CheckProviderResponse, error) {
+	if req == nil || req.Provider == "" {
+		return nil, errors.New("missing provider")
+	}
+	if ps.getReplayProvider(req.Provider) != nil {
+		return nil, errors.New("replay providers have no model catalog")
+	}
+	ps.providersMu.RLock()
+	cfg, ok := ps.providers[req.Provider]
+	apiKey := ps.apiKeys[req.Provider]
+	ps.providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("provider %q is not configured", req.Provider)
+	}
+
+	body := req.Body
+	if body == nil {
+		body = &spec.CheckProviderRequestBody{}
+	}
+	kind := body.CatalogKind
+	if kind == "" {
+		kind = inferModelCatalogKind(&cfg)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, modelCatalogTimeout)
+	defer cancel()
+
+	// A provider without stored presets has every remote model without a preset.
+	var presets map[modelpresetSpec.ModelPresetID]modelpresetSpec.ModelPreset
+	pp, err := ps.providerPreset(ctx, req.Provider)
+	switch {
+	case err == nil:
+		presets = pp.ModelPresets
+	case !errors.Is(err, modelpresetSpec.ErrProviderNotFound):
+		return nil, err
+	}
+
+	start := time.Now()
+	models, err := listRemoteModels(ctx, ps.httpClient, kind, &cfg, apiKey)
+	out := &spec.CheckProviderResponseBody{
+		Provider:    req.Provider,
+		CatalogKind: kind,
+		LatencyMs:   time.Since(start).Milliseconds(),
+	}
+
+	var statusErr *catalogStatusError
+	switch {
+	case err == nil:
+		out.Reachable = true
+		out.Authenticated = true
+		out.StatusCode = http.StatusOK
+		out.RemoteModels = models
+		out.StaleModelPresets, out.ModelsWithoutPreset = diffModelCatalog(models, presets)
+	case errors.As(err, &statusErr):
+		out.Reachable = true
+		out.StatusCode = statusErr.StatusCode
+		out.Error = err.Error()
+	default:
+		out.Error = err.Error()
+	}
+	ps.logger.Info("checkProvider",
+		"name", req.Provider,
+		"catalogKind", kind,
+		"reachable", out.Reachable,
+		"statusCode", out.StatusCode,
+		"remoteModels", len(out.RemoteModels),
+	)
+	return &spec.CheckProviderResponse{Body: out}, nil
+}
+
+func inferModelCatalogKind(cfg *inference.AddProviderConfig) spec.ModelCatalogKind {
+	if cfg.SDKType == inferencegoSpec.ProviderSDKTypeAnthropic {
+		return spec.ModelCatalogKindAnthropic
+	}
+	if u, err := url.Parse(cfg.Origin); err == nil && strings.EqualFold(u.Hostname(), geminiAPIHost) {
+		return spec.ModelCatalogKindGemini
+	}
+	return spec.ModelCatalogKindOpenAI
+}
+
+// listRemoteModels fetches all pages of a provider's model catalog.
+func listRemoteModels(
+	ctx context.Context,
+	client *http.Client,
+	kind spec.ModelCatalogKind,
+	cfg *inference.AddProviderConfig,
+	apiKey string,
+) ([]spec.RemoteModel, error) {
+	origin := strings.TrimRight(strings.TrimSpace(cfg.Origin), "/")
+	if origin == "" {
+		return nil, errors.New("provider has no origin")
+	}
+
+	switch kind {
+	case spec.ModelCatalogKindOpenAI:
+		var page struct {
+			Data []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"data"`
+		}
+		if err := getCatalogPage(ctx, client, origin+openAIModelsPath(cfg.ChatCompletionPathPrefix),
+			catalogHeaders(kind, cfg, apiKey), &page); err != nil {
+			return nil, err
+		}
+		out := make([]spec.RemoteModel, 0, len(page.Data))
+		for _, m := range page.Data {
+			out = append(out, spec.RemoteModel{ID: m.ID, DisplayName: m.Name})
+		}
+		return out, nil
+
+	case spec.ModelCatalogKindAnthropic:
+		out := make([]spec.RemoteModel, 0)
+		afterID := ""
+		for range modelCatalogMaxPages {
+			q := url.Values{"limit": {"1000"}}
+			if afterID != "" {
+				q.Set("after_id", afterID)
+			}
+			var page struct {
+				Data []struct {
+					ID          string `json:"id"`
+					DisplayName string `json:"display_name"`
+				} `json:"data"`
+				HasMore bool   `json:"has_more"`
+				LastID  string `json:"last_id"`
+			}
+			if err := getCatalogPage(ctx, client, origin+"/v1/models?"+q.Encode(),
+				catalogHeaders(kind, cfg, apiKey), &page); err != nil {
+				return nil, err
+			}
+			for _, m := range page.Data {
+				out = append(out, spec.RemoteModel{ID: m.ID, DisplayName: m.DisplayName})
+			}
+			if !page.HasMore || page.LastID == "" {
+				return out, nil
+			}
+			afterID = page.LastID
+		}
+		return nil, fmt.Errorf("model catalog exceeded %d pages", modelCatalogMaxPages)
+
+	case spec.ModelCatalogKindGemini:
+		out := make([]spec.RemoteModel, 0)
+		pageToken := ""
+		for range modelCatalogMaxPages {
+			q := url.Values{"pageSize": {"1000"}}
+			if pageToken != "" {
+				q.Set("pageToken", pageToken)
+			}
+			var page struct {
+				Models []struct {
+					Name        string `json:"name"`
+					DisplayName string `json:"displayName"`
+				} `json:"models"`
+				NextPageToken string `json:"nextPageToken"`
+			}
+			if err := getCatalogPage(ctx, client, origin+"/v1beta/models?"+q.Encode(),
+				catalogHeaders(kind, cfg, apiKey), &page); err != nil {
+				return nil, err
+			}
+			for _, m := range page.Models {
+				out = append(out, spec.RemoteModel{ID: normalizeRemoteModelID(m.Name), DisplayName: m.DisplayName})
+			}
+			if page.NextPageToken == "" {
+				return out, nil
+			}
+			pageToken = page.NextPageToken
+		}
+		return nil, fmt.Errorf("model catalog exceeded %d pages", modelCatalogMaxPages)
+
+	default:
+		return nil, fmt.Errorf("unsupported model catalog kind %q", kind)
+	}
+}
+
+func getCatalogPage(
+	ctx context.Context,
+	client *http.Client,
+	rawURL string,
+	headers http.Header,
+	out any,
+) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = headers.Clone()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, modelCatalogMaxErrBody))
+		return &catalogStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(b))}
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, modelCatalogMaxBody)).Decode(out); err != nil {
+		return fmt.Errorf("invalid models response: %w", err)
+	}
+	return nil
+}
+
+// catalogHeaders returns the provider default headers plus the auth headers of the catalog API.
+func catalogHeaders(kind spec.ModelCatalogKind, cfg *inference.AddProviderConfig, apiKey string) http.Header {
+	h := http.Header{}
+	for k, v := range cfg.DefaultHeaders {
+		h.Set(k, v)
+	}
+	h.Set("Accept", "application/json")
+	h.Del("Content-Type")
+
+	if kind == spec.ModelCatalogKindAnthropic && h.Get("anthropic-version") == "" {
+		h.Set("anthropic-version", anthropicDefaultAPIVersion)
+	}
+	if apiKey == "" {
+		return h
+	}
+
+	switch kind {
+	case spec.ModelCatalogKindGemini:
+		// The OpenAI compatible Gemini endpoint takes a bearer token; the native one takes this header.
+		h.Set("x-goog-api-key", apiKey)
+	case spec.ModelCatalogKindAnthropic:
+		key := cfg.APIKeyHeaderKey
+		if key == "" {
+			key = modelpresetSpec.DefaultAnthropicAuthorizationHeaderKey
+		}
+		h.Set(key, apiKey)
+	default:
+		key := cfg.APIKeyHeaderKey
+		if key == "" {
+			key = modelpresetSpec.DefaultAuthorizationHeaderKey
+		}
+		if strings.EqualFold(key, modelpresetSpec.DefaultAuthorizationHeaderKey) {
+			h.Set(key, "Bearer "+apiKey)
+		} else {
+			h.Set(key, apiKey)
+		}
+	}
+	return h
+}
+
+// openAIModelsPath derives the models path from the completions path prefix, e.g. /api/v1/chat/completions becomes
+// /api/v1/models.
+func openAIModelsPath(completionPrefix string) string {
+	p := strings.TrimRight(strings.TrimSpace(completionPrefix), "/")
+	for _, suffix := range []string{"/chat/completions", "/responses", "/completions", "/messages"} {
+		if base, ok := strings.CutSuffix(p, suffix); ok {
+			return base + "/models"
+		}
+	}
+	if p == "" {
+		return "/v1/models"
+	}
+	return p + "/models"
+}
+
+func normalizeRemoteModelID(id string) string {
+	return strings.TrimPrefix(strings.TrimSpace(id), "models/")
+}
+
+// diffModelCatalog returns the presets whose model is missing from the remote catalog, and the remote models no
+// preset refers to. Both are sorted by ID.
+func diffModelCatalog(
+	remote []spec.RemoteModel,
+	presets map[modelpresetSpec.ModelPresetID]modelpresetSpec.ModelPreset,
+) (stale []spec.StaleModelPreset, withoutPreset []spec.RemoteModel) {
+	remoteIDs := make(map[string]struct{}, len(remote))
+	for _, m := range remote {
+		remoteIDs[normalizeRemoteModelID(m.ID)] = struct{}{}
+	}
+	presetModels := make(map[string]struct{}, len(presets))
+	for id, mp := range presets {
+		name := normalizeRemoteModelID(string(mp.Name))
+		presetModels[name] = struct{}{}
+		if _, ok := remoteIDs[name]; !ok {
+			stale = append(stale, spec.StaleModelPreset{ModelPresetID: id, ModelName: mp.Name})
+		}
+	}
+	for _, m := range remote {
+		if _, ok := presetModels[normalizeRemoteModelID(m.ID)]; !ok {
+			withoutPreset = append(withoutPreset, m)
+		}
+	}
+
+	slices.SortFunc(stale, func(a, b spec.StaleModelPreset) int {
+		return strings.Compare(string(a.ModelPresetID), string(b.ModelPresetID))
+	})
+	slices.SortFunc(withoutPreset, func(a, b spec.RemoteModel) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return stale, withoutPreset
+}
@@ -0,0 +1,257 @@
+package inferencewrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/flexigpt/inference-go"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+)
+
+const testAPIKey = "sk-test"
+
+// newCatalogStub serves the models endpoints of all catalog kinds and rejects requests without the expected auth.
+func newCatalogStub(t *testing.T) *httptest.Server {
+	t.Helper()
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testAPIKey {
+			http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, map[string]any{"data": []map[string]string{
+			{"id": "gpt-a", "name": "GPT A"},
+			{"id": "gpt-b"},
+		}})
+	})
+	mux.HandleFunc("GET /v1/models", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != testAPIKey || r.Header.Get("anthropic-version") == "" {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("after_id") == "" {
+			writeJSON(w, map[string]any{
+				"data":     []map[string]string{{"id": "claude-a", "display_name": "Claude A"}},
+				"has_more": true,
+				"last_id":  "claude-a",
+			})
+			return
+		}
+		writeJSON(w, map[string]any{
+			"data":     []map[string]string{{"id": "claude-b", "display_name": "Claude B"}},
+			"has_more": false,
+		})
+	})
+	mux.HandleFunc("GET /v1beta/models", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-goog-api-key") != testAPIKey {
+			http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Get("pageToken") == "" {
+			writeJSON(w, map[string]any{
+				"models":        []map[string]string{{"name": "models/gemini-a", "displayName": "Gemini A"}},
+				"nextPageToken": "p2",
+			})
+			return
+		}
+		writeJSON(w, map[string]any{
+			"models": []map[string]string{{"name": "models/gemini-b", "displayName": "Gemini B"}},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestListRemoteModels(t *testing.T) {
+	srv := newCatalogStub(t)
+
+	tests := []struct {
+		name    string
+		kind    spec.ModelCatalogKind
+		cfg     inference.AddProviderConfig
+		apiKey  string
+		wantIDs []string
+		wantErr bool
+	}{
+		{
+			name: "openai_compatible",
+			kind: spec.ModelCatalogKindOpenAI,
+			cfg: inference.AddProviderConfig{
+				Origin:                   srv.URL,
+				ChatCompletionPathPrefix: "/api/v1/chat/completions",
+				APIKeyHeaderKey:          "Authorization",
+			},
+			apiKey:  testAPIKey,
+			wantIDs: []string{"gpt-a", "gpt-b"},
+		},
+		{
+			name: "anthropic_paginated",
+			kind: spec.ModelCatalogKindAnthropic,
+			cfg: inference.AddProviderConfig{
+				SDKType:                  inferencegoSpec.ProviderSDKTypeAnthropic,
+				Origin:                   srv.URL,
+				ChatCompletionPathPrefix: "/v1/messages",
+				APIKeyHeaderKey:          "x-api-key",
+			},
+			apiKey:  testAPIKey,
+			wantIDs: []string{"claude-a", "claude-b"},
+		},
+		{
+			name: "gemini_paginated",
+			kind: spec.ModelCatalogKindGemini,
+			cfg: inference.AddProviderConfig{
+				Origin:                   srv.URL,
+				ChatCompletionPathPrefix: "/v1beta/openai/chat/completions",
+			},
+			apiKey:  testAPIKey,
+			wantIDs: []string{"gemini-a", "gemini-b"},
+		},
+		{
+			name: "bad_key",
+			kind: spec.ModelCatalogKindOpenAI,
+			cfg: inference.AddProviderConfig{
+				Origin:                   srv.URL,
+				ChatCompletionPathPrefix: "/api/v1/chat/completions",
+			},
+			apiKey:  "wrong",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := listRemoteModels(t.Context(), srv.Client(), tt.kind, &tt.cfg, tt.apiKey)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("listRemoteModels: %v", err)
+			}
+			ids := make([]string, 0, len(got))
+			for _, m := range got {
+				ids = append(ids, m.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Fatalf("got %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+// fakePresetLister serves fixed provider presets.
+type fakePresetLister struct {
+	providers []modelpresetSpec.ProviderPreset
+}
+
+func (f *fakePresetLister) ListProviderPresets(
+	_ context.Context,
+	req *modelpresetSpec.ListProviderPresetsRequest,
+) (*modelpresetSpec.ListProviderPresetsResponse, error) {
+	out := make([]modelpresetSpec.ProviderPreset, 0)
+	for _, p := range f.providers {
+		if len(req.Names) == 0 || slices.Contains(req.Names, p.Name) {
+			out = append(out, p)
+		}
+	}
+	return &modelpresetSpec.ListProviderPresetsResponse{
+		Body: &modelpresetSpec.ListProviderPresetsResponseBody{Providers: out},
+	}, nil
+}
+
+func TestCheckProvider(t *testing.T) {
+	srv := newCatalogStub(t)
+	ps := &ProviderSetAPI{
+		logger:     slog.Default(),
+		httpClient: srv.Client(),
+		providers: map[inferencegoSpec.ProviderName]inference.AddProviderConfig{
+			"stub": {
+				SDKType:                  inferencegoSpec.ProviderSDKTypeOpenAIChatCompletions,
+				Origin:                   srv.URL,
+				ChatCompletionPathPrefix: "/api/v1/chat/completions",
+				APIKeyHeaderKey:          "Authorization",
+			},
+		},
+		apiKeys:         map[inferencegoSpec.ProviderName]string{"stub": testAPIKey},
+		replayProviders: map[inferencegoSpec.ProviderName]*replayProvider{},
+	}
+
+	if _, err := ps.CheckProvider(t.Context(), &spec.CheckProviderRequest{Provider: "stub"}); err == nil {
+		t.Fatal("expected error without a model preset store")
+	}
+	ps.SetModelPresetLister(&fakePresetLister{providers: []modelpresetSpec.ProviderPreset{{
+		Name:      "stub",
+		IsEnabled: false,
+		ModelPresets: map[modelpresetSpec.ModelPresetID]modelpresetSpec.ModelPreset{
+			"a":   {ID: "a", Name: "gpt-a"},
+			"old": {ID: "old", Name: "gpt-retired"},
+		},
+	}}})
+
+	resp, err := ps.CheckProvider(t.Context(), &spec.CheckProviderRequest{Provider: "stub"})
+	if err != nil {
+		t.Fatalf("CheckProvider: %v", err)
+	}
+	b := resp.Body
+	if !b.Reachable || !b.Authenticated || b.CatalogKind != spec.ModelCatalogKindOpenAI {
+		t.Fatalf("unexpected status %+v", b)
+	}
+	if len(b.StaleModelPresets) != 1 || b.StaleModelPresets[0].ModelPresetID != "old" {
+		t.Fatalf("stale presets = %+v", b.StaleModelPresets)
+	}
+	if len(b.ModelsWithoutPreset) != 1 || b.ModelsWithoutPreset[0].ID != "gpt-b" {
+		t.Fatalf("models without preset = %+v", b.ModelsWithoutPreset)
+	}
+
+	ps.apiKeys["stub"] = "wrong"
+	resp, err = ps.CheckProvider(t.Context(), &spec.CheckProviderRequest{Provider: "stub"})
+	if err != nil {
+		t.Fatalf("CheckProvider: %v", err)
+	}
+	if b := resp.Body; !b.Reachable || b.Authenticated || b.StatusCode != http.StatusUnauthorized || b.Error == "" {
+		t.Fatalf("unexpected status for bad key %+v", b)
+	}
+
+	srv.Close()
+	resp, err = ps.CheckProvider(t.Context(), &spec.CheckProviderRequest{Provider: "stub"})
+	if err != nil {
+		t.Fatalf("CheckProvider: %v", err)
+	}
+	if b := resp.Body; b.Reachable || b.Error == "" {
+		t.Fatalf("unexpected status for unreachable provider %+v", b)
+	}
+
+	if _, err := ps.CheckProvider(t.Context(), &spec.CheckProviderRequest{Provider: "ghost"}); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
+
+func TestOpenAIModelsPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"/v1/chat/completions":            "/v1/models",
+		"/api/v1/chat/completions/":       "/api/v1/models",
+		"/v1/responses":                   "/v1/models",
+		"/v1beta/openai/chat/completions": "/v1beta/openai/models",
+		"":                                "/v1/models",
+		"/custom":                         "/custom/models",
+	} {
+		if got := openAIModelsPath(in); got != want {
+			t.Errorf("openAIModelsPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
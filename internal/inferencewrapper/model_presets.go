@@ -0,0 +1,96 @@
+package inferencewrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+)
+
+var errNoModelPresetLister = errors.New("no model preset store configured")
+
+// ModelPresetLister lists the stored provider presets. It is implemented by the model preset store.
+type ModelPresetLister interface {
+	ListProviderPresets(
+		ctx context.Context,
+		req *modelpresetSpec.ListProviderPresetsRequest,
+	) (*modelpresetSpec.ListProviderPresetsResponse, error)
+}
+
+// SetModelPresetLister sets the source of the stored model presets. Like the model router it is wired in after the
+// model preset store is created.
+func (ps *ProviderSetAPI) SetModelPresetLister(l ModelPresetLister) {
+	ps.providersMu.Lock()
+	defer ps.providersMu.Unlock()
+	ps.presets = l
+}
+
+// WithHTTPClient sets the client of the calls the wrapper makes itself, such as model catalog checks and file
+// uploads. Completions go through inference-go.
+func WithHTTPClient(client *http.Client) ProviderSetOption {
+	return func(ps *ProviderSetAPI) {
+		ps.httpClient = client
+	}
+}
+
+// modelPreset returns the stored preset a completion runs with: presetID when it is a preset of provider for
+// modelName, otherwise the only preset of provider for modelName. It returns nil when there is no such preset, when
+// several presets share modelName, or when the presets cannot be listed.
+func (ps *ProviderSetAPI) modelPreset(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	presetID modelpresetSpec.ModelPresetID,
+	modelName inferencegoSpec.ModelName,
+) *modelpresetSpec.ModelPreset {
+	pp, err := ps.providerPreset(ctx, provider)
+	if err != nil {
+		if !errors.Is(err, errNoModelPresetLister) && !errors.Is(err, modelpresetSpec.ErrProviderNotFound) {
+			ps.logger.Debug("list model presets", "provider", provider, "error", err)
+		}
+		return nil
+	}
+	if mp, ok := pp.ModelPresets[presetID]; ok && inferencegoSpec.ModelName(mp.Name) == modelName {
+		return &mp
+	}
+	var found *modelpresetSpec.ModelPreset
+	for id := range pp.ModelPresets {
+		mp := pp.ModelPresets[id]
+		if inferencegoSpec.ModelName(mp.Name) != modelName {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = &mp
+	}
+	return found
+}
+
+// providerPreset returns the stored preset of provider, disabled or not. It returns modelpresetSpec.ErrProviderNotFound
+// when the store has no such provider and errNoModelPresetLister when no store is wired in.
+func (ps *ProviderSetAPI) providerPreset(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+) (*modelpresetSpec.ProviderPreset, error) {
+	ps.providersMu.RLock()
+	lister := ps.presets
+	ps.providersMu.RUnlock()
+	if lister == nil {
+		return nil, errNoModelPresetLister
+	}
+	resp, err := lister.ListProviderPresets(ctx, &modelpresetSpec.ListProviderPresetsRequest{
+		Names:           []inferencegoSpec.ProviderName{provider},
+		IncludeDisabled: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Body == nil || len(resp.Body.Providers) == 0 {
+		return nil, fmt.Errorf("%w: %s", modelpresetSpec.ErrProviderNotFound, provider)
+	}
+	return &resp.Body.Providers[0], nil
+}
@@ -0,0 +1,314 @@
+package inferencewrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flexigpt/inference-go"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/attachment"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+const (
+	// Rough heuristic used across providers; good enough for budgeting and previews.
+	approxCharsPerToken = 4
+	// Flat per-image estimate, roughly a mid-sized image for most vision models.
+	approxImageTokens = 1000
+
+	wireCaptureTimeout = 10 * time.Second
+	// Request bodies carry inline attachments; anything larger is not worth previewing.
+	maxWireCaptureBytes = 64 << 20
+	// API key used for the capture provider. The real key is never sent to the capture server.
+	wireCaptureAPIKey = "flexigpt-preview"
+)
+
+// PreviewCompletion runs the same request building pipeline as FetchCompletion (model param resolution, input
+// flattening with attachment hydration and tool hydration) and returns the resulting request without sending it.
+func (ps *ProviderSetAPI) PreviewCompletion(
+	ctx context.Context,
+	req *spec.PreviewCompletionRequest,
+) (*spec.PreviewCompletionResponse, error) {
+	if req == nil || req.Body == nil {
+		return nil, errors.New("got empty completion input")
+	}
+	if req.Provider == "" && req.Body.Route == nil {
+		return nil, errors.New("missing provider")
+	}
+	provider, reqBody, decision, err := ps.applyRoute(ctx, req.Provider, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	attErrs := make([]spec.AttachmentHydrationError, 0)
+	onSkip := func(att *attachment.Attachment, err error) {
+		if att == nil || err == nil {
+			return
+		}
+		attErrs = append(attErrs, spec.AttachmentHydrationError{
+			Label: att.Label,
+			Kind:  string(att.Kind),
+			Error: err.Error(),
+		})
+	}
+
+	infReq, currentInputs, _, err := ps.buildFetchCompletionRequest(ctx, provider, reqBody, onSkip)
+	if err != nil {
+		return nil, err
+	}
+
+	estimates, total := estimateRequestTokens(infReq)
+	body := &spec.PreviewCompletionResponseBody{
+		Request:               infReq,
+		HydratedCurrentInputs: currentInputs,
+		PartTokenEstimates:    estimates,
+		EstimatedInputTokens:  total,
+		RouteDecision:         decision,
+	}
+	if len(attErrs) > 0 {
+		body.AttachmentErrors = attErrs
+	}
+
+	if req.IncludeWireJSON {
+		wire, err := ps.captureWireJSON(ctx, provider, infReq)
+		if err != nil {
+			body.WireJSONError = err.Error()
+		} else {
+			body.WireJSON = wire
+		}
+	}
+
+	return &spec.PreviewCompletionResponse{Body: body}, nil
+}
+
+// captureWireJSON renders the provider specific request body by sending the request through a throw-away provider
+// set whose origin points to a loopback capture server. The server records the body and rejects the call, so nothing
+// ever reaches the real provider.
+func (ps *ProviderSetAPI) captureWireJSON(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	infReq *inferencegoSpec.FetchCompletionRequest,
+) (string, error) {
+	ps.providersMu.RLock()
+	cfg, ok := ps.providers[provider]
+	_, isReplay := ps.replayProviders[provider]
+	ps.providersMu.RUnlock()
+	if isReplay {
+		return "", errors.New("replay providers have no wire format")
+	}
+	if !ok {
+		return "", fmt.Errorf("provider %q is not configured", provider)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wireCaptureTimeout)
+	defer cancel()
+
+	capture := &wireCapture{onCapture: cancel}
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	srv := &http.Server{Handler: capture, ReadHeaderTimeout: wireCaptureTimeout}
+	go func() { _ = srv.Serve(ln) }()
+	defer func() { _ = srv.Close() }()
+
+	// The capture call always fails; keep its errors out of the app log.
+	inner, err := inference.NewProviderSetAPI(inference.WithLogger(slog.New(slog.DiscardHandler)))
+	if err != nil {
+		return "", err
+	}
+	captureCfg := cfg
+	captureCfg.Origin = "http://" + ln.Addr().String()
+	if _, err := inner.AddProvider(ctx, provider, &captureCfg); err != nil {
+		return "", err
+	}
+	if err := inner.SetProviderAPIKey(ctx, provider, wireCaptureAPIKey); err != nil {
+		return "", err
+	}
+
+	_, fetchErr := inner.FetchCompletion(ctx, provider, infReq, nil)
+	body, err := capture.result()
+	if err != nil {
+		return "", err
+	}
+	if body == nil {
+		if fetchErr == nil {
+			fetchErr = errors.New("no request was sent")
+		}
+		return "", fmt.Errorf("provider did not produce a request body: %w", fetchErr)
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		return string(body), nil //nolint:nilerr // Non JSON bodies are returned verbatim.
+	}
+	return out.String(), nil
+}
+
+// wireCapture is the handler of the capture server. It keeps the body of the first POST request and answers every
+// request with a non retryable client error.
+type wireCapture struct {
+	// onCapture is called once a body was kept, to stop the client early.
+	onCapture func()
+
+	mu   sync.Mutex
+	body []byte
+	err  error
+}
+
+func (c *wireCapture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWireCaptureBytes))
+		c.mu.Lock()
+		if c.body == nil && c.err == nil {
+			if err != nil {
+				c.err = fmt.Errorf("read request body: %w", err)
+			} else {
+				c.body = b
+			}
+		}
+		c.mu.Unlock()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"flexigpt preview capture"}}`))
+	if r.Method == http.MethodPost && c.onCapture != nil {
+		c.onCapture()
+	}
+}
+
+// result returns the captured body, nil if no POST request was seen.
+func (c *wireCapture) result() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.body, c.err
+}
+
+// estimateRequestTokens returns per-part token estimates for a request and their total.
+func estimateRequestTokens(
+	r *inferencegoSpec.FetchCompletionRequest,
+) (estimates []spec.PreviewPartTokenEstimate, total int) {
+	estimates = make([]spec.PreviewPartTokenEstimate, 0)
+	if r == nil {
+		return estimates, 0
+	}
+	add := func(e spec.PreviewPartTokenEstimate) {
+		estimates = append(estimates, e)
+		total += e.EstimatedTokens
+	}
+
+	if sp := strings.TrimSpace(r.ModelParam.SystemPrompt); sp != "" {
+		add(spec.PreviewPartTokenEstimate{
+			Part:            spec.PreviewPartKindSystemPrompt,
+			ItemIndex:       -1,
+			Kind:            "text",
+			EstimatedTokens: estimateTextTokens(sp),
+		})
+	}
+
+	for i := range r.Inputs {
+		in := &r.Inputs[i]
+		var msg *inferencegoSpec.InputOutputContent
+		switch in.Kind {
+		case inferencegoSpec.InputKindInputMessage:
+			msg = in.InputMessage
+		case inferencegoSpec.InputKindOutputMessage:
+			msg = in.OutputMessage
+		default:
+		}
+		if msg != nil {
+			for j, item := range msg.Contents {
+				add(spec.PreviewPartTokenEstimate{
+					Part:            spec.PreviewPartKindInput,
+					Index:           i,
+					ItemIndex:       j,
+					Kind:            string(item.Kind),
+					Label:           contentItemLabel(item),
+					EstimatedTokens: estimateContentItemTokens(item),
+				})
+			}
+			continue
+		}
+		add(spec.PreviewPartTokenEstimate{
+			Part:            spec.PreviewPartKindInput,
+			Index:           i,
+			ItemIndex:       -1,
+			Kind:            string(in.Kind),
+			EstimatedTokens: estimateJSONTokens(in),
+		})
+	}
+
+	for i := range r.ToolChoices {
+		tc := &r.ToolChoices[i]
+		add(spec.PreviewPartTokenEstimate{
+			Part:            spec.PreviewPartKindTool,
+			Index:           i,
+			ItemIndex:       -1,
+			Kind:            string(tc.Type),
+			Label:           tc.Name,
+			EstimatedTokens: estimateJSONTokens(tc),
+		})
+	}
+
+	return estimates, total
+}
+
+func estimateContentItemTokens(item inferencegoSpec.InputOutputContentItemUnion) int {
+	switch item.Kind {
+	case inferencegoSpec.ContentItemKindText:
+		if item.TextItem != nil {
+			return estimateTextTokens(item.TextItem.Text)
+		}
+	case inferencegoSpec.ContentItemKindImage:
+		return approxImageTokens
+	case inferencegoSpec.ContentItemKindFile:
+		if item.FileItem != nil {
+			// Base64 inflates by 4/3; providers mostly bill on the extracted content, which this over-estimates.
+			return estimateTextTokens(item.FileItem.FileData) * 3 / 4
+		}
+	default:
+		return estimateJSONTokens(item)
+	}
+	return 0
+}
+
+func contentItemLabel(item inferencegoSpec.InputOutputContentItemUnion) string {
+	switch item.Kind {
+	case inferencegoSpec.ContentItemKindImage:
+		if item.ImageItem != nil {
+			return item.ImageItem.ImageName
+		}
+	case inferencegoSpec.ContentItemKindFile:
+		if item.FileItem != nil {
+			return item.FileItem.FileName
+		}
+	default:
+	}
+	return ""
+}
+
+func estimateTextTokens(s string) int {
+	if s == "" {
+		return 0
+	}
+	return (len(s) + approxCharsPerToken - 1) / approxCharsPerToken
+}
+
+func estimateJSONTokens(v any) int {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return estimateTextTokens(string(b))
+}
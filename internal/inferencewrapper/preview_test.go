@@ -0,0 +1,185 @@
+package inferencewrapper
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/flexigpt/inference-go"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+func TestEstimateRequestTokens(t *testing.T) {
+	tool := inferencegoSpec.ToolChoice{Type: inferencegoSpec.ToolTypeFunction, Name: "search"}
+	req := &inferencegoSpec.FetchCompletionRequest{
+		ModelParam: inferencegoSpec.ModelParam{Name: "m", SystemPrompt: "  be brief  "},
+		Inputs: []inferencegoSpec.InputUnion{
+			{
+				Kind: inferencegoSpec.InputKindInputMessage,
+				InputMessage: &inferencegoSpec.InputOutputContent{
+					Role: inferencegoSpec.RoleUser,
+					Contents: []inferencegoSpec.InputOutputContentItemUnion{
+						{Kind: inferencegoSpec.ContentItemKindText, TextItem: &inferencegoSpec.ContentItemText{
+							Text: "hello world!",
+						}},
+						{Kind: inferencegoSpec.ContentItemKindImage, ImageItem: &inferencegoSpec.ContentItemImage{
+							ImageName: "chart.png",
+						}},
+						{Kind: inferencegoSpec.ContentItemKindFile, FileItem: &inferencegoSpec.ContentItemFile{
+							FileName: "a.pdf",
+							FileData: strings.Repeat("A", 40),
+						}},
+					},
+				},
+			},
+			{
+				Kind:             inferencegoSpec.InputKindReasoningMessage,
+				ReasoningMessage: &inferencegoSpec.ReasoningContent{},
+			},
+		},
+		ToolChoices: []inferencegoSpec.ToolChoice{tool},
+	}
+
+	got, total := estimateRequestTokens(req)
+	want := []spec.PreviewPartTokenEstimate{
+		{Part: spec.PreviewPartKindSystemPrompt, ItemIndex: -1, Kind: "text", EstimatedTokens: 2},
+		{Part: spec.PreviewPartKindInput, Kind: "text", EstimatedTokens: 3},
+		{Part: spec.PreviewPartKindInput, ItemIndex: 1, Kind: "image", Label: "chart.png", EstimatedTokens: 1000},
+		{Part: spec.PreviewPartKindInput, ItemIndex: 2, Kind: "file", Label: "a.pdf", EstimatedTokens: 7},
+		{
+			Part:            spec.PreviewPartKindInput,
+			Index:           1,
+			ItemIndex:       -1,
+			Kind:            string(inferencegoSpec.InputKindReasoningMessage),
+			EstimatedTokens: estimateJSONTokens(req.Inputs[1]),
+		},
+		{
+			Part:            spec.PreviewPartKindTool,
+			ItemIndex:       -1,
+			Kind:            string(tool.Type),
+			Label:           "search",
+			EstimatedTokens: estimateJSONTokens(tool),
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d estimates, want %d: %+v", len(got), len(want), got)
+	}
+	sum := 0
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("estimate %d = %+v, want %+v", i, got[i], want[i])
+		}
+		sum += want[i].EstimatedTokens
+	}
+	if total != sum {
+		t.Errorf("total = %d, want %d", total, sum)
+	}
+
+	if got, total := estimateRequestTokens(nil); len(got) != 0 || total != 0 {
+		t.Errorf("nil request = %+v, %d", got, total)
+	}
+}
+
+func TestWireCapture(t *testing.T) {
+	var captures atomic.Int32
+	c := &wireCapture{onCapture: func() { captures.Add(1) }}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if body, err := c.result(); body != nil || err != nil || captures.Load() != 0 {
+		t.Fatalf("GET captured %q, %v (%d)", body, err, captures.Load())
+	}
+
+	for _, b := range []string{`{"model":"first"}`, `{"model":"second"}`} {
+		resp, err := http.Post(srv.URL+"/v1/chat/completions", "application/json", strings.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", resp.StatusCode)
+		}
+	}
+	body, err := c.result()
+	if err != nil || string(body) != `{"model":"first"}` {
+		t.Errorf("captured %q, %v", body, err)
+	}
+	if n := captures.Load(); n != 2 {
+		t.Errorf("onCapture called %d times, want 2", n)
+	}
+}
+
+func TestPreviewCompletion(t *testing.T) {
+	ps := &ProviderSetAPI{
+		logger: slog.Default(),
+		providers: map[inferencegoSpec.ProviderName]inference.AddProviderConfig{
+			"openai": {
+				SDKType:                  inferencegoSpec.ProviderSDKTypeOpenAIChatCompletions,
+				Origin:                   "https://api.openai.invalid",
+				ChatCompletionPathPrefix: "/v1/chat/completions",
+			},
+		},
+		replayProviders: map[inferencegoSpec.ProviderName]*replayProvider{"recorded": {}},
+	}
+	newReq := func(provider inferencegoSpec.ProviderName) *spec.PreviewCompletionRequest {
+		return &spec.PreviewCompletionRequest{
+			Provider:        provider,
+			IncludeWireJSON: true,
+			Body: &spec.CompletionRequestBody{
+				ModelParam: &inferencegoSpec.ModelParam{Name: "gpt-preview", SystemPrompt: "be brief"},
+				Current: conversationSpec.ConversationMessage{
+					Role: inferencegoSpec.RoleUser,
+					Inputs: []inferencegoSpec.InputUnion{{
+						Kind: inferencegoSpec.InputKindInputMessage,
+						InputMessage: &inferencegoSpec.InputOutputContent{
+							Role: inferencegoSpec.RoleUser,
+							Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+								Kind:     inferencegoSpec.ContentItemKindText,
+								TextItem: &inferencegoSpec.ContentItemText{Text: "preview this"},
+							}},
+						},
+					}},
+				},
+			},
+		}
+	}
+
+	resp, err := ps.PreviewCompletion(t.Context(), newReq("openai"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := resp.Body
+	if b.Request.ModelParam.Name != "gpt-preview" || len(b.HydratedCurrentInputs) != 1 {
+		t.Errorf("request = %+v", b.Request)
+	}
+	if len(b.PartTokenEstimates) != 2 || b.EstimatedInputTokens != 2+3 {
+		t.Errorf("estimates = %+v, total %d", b.PartTokenEstimates, b.EstimatedInputTokens)
+	}
+	if b.WireJSONError != "" || !strings.Contains(b.WireJSON, `"gpt-preview"`) ||
+		!strings.Contains(b.WireJSON, "preview this") {
+		t.Errorf("wire JSON = %q, error %q", b.WireJSON, b.WireJSONError)
+	}
+
+	resp, err = ps.PreviewCompletion(t.Context(), newReq("recorded"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body.WireJSON != "" || resp.Body.WireJSONError == "" {
+		t.Errorf("replay provider wire JSON = %q, error %q", resp.Body.WireJSON, resp.Body.WireJSONError)
+	}
+
+	if _, err := ps.PreviewCompletion(t.Context(), newReq("")); err == nil {
+		t.Error("expected error without a provider")
+	}
+}
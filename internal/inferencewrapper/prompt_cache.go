@@ -0,0 +1,216 @@
+package inferencewrapper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+const (
+	openAIAPIHost = "api.openai.com"
+	// Prefix of derived prompt cache keys; keeps them recognizable in provider dashboards.
+	promptCacheKeyPrefix = "flexigpt-"
+)
+
+// promptCachePlan records what applyPromptCacheHints did, so usage can be attributed after the call.
+type promptCachePlan struct {
+	usage conversationSpec.PromptCacheUsage
+	// Estimated tokens of the prefix that was marked cacheable with explicit breakpoints.
+	prefixTokens int
+}
+
+// applyPromptCacheHints translates provider agnostic cache hints onto the request. historyLen is the number of
+// leading inputs that come from stored history.
+func (ps *ProviderSetAPI) applyPromptCacheHints(
+	provider inferencegoSpec.ProviderName,
+	infReq *inferencegoSpec.FetchCompletionRequest,
+	historyLen int,
+	hints *spec.PromptCacheHints,
+) (*promptCachePlan, error) {
+	plan := &promptCachePlan{}
+	ps.providersMu.RLock()
+	cfg := ps.providers[provider]
+	ps.providersMu.RUnlock()
+
+	switch cfg.SDKType {
+	case inferencegoSpec.ProviderSDKTypeAnthropic:
+		applyAnthropicCacheBreakpoints(infReq, historyLen, hints, plan)
+
+	case inferencegoSpec.ProviderSDKTypeOpenAIChatCompletions, inferencegoSpec.ProviderSDKTypeOpenAIResponses:
+		key := strings.TrimSpace(hints.CacheKey)
+		if key == "" && isOpenAIOrigin(cfg.Origin) {
+			key = derivePromptCacheKey(infReq)
+		}
+		if key == "" {
+			break
+		}
+		if err := setAdditionalParameter(&infReq.ModelParam, "prompt_cache_key", key); err != nil {
+			return nil, err
+		}
+		plan.usage.CacheKey = key
+		// OpenAI caches the longest matching prefix on its own; report what was asked to be cached.
+		if hints.Tools && len(infReq.ToolChoices) > 0 {
+			plan.usage.Breakpoints = append(plan.usage.Breakpoints, conversationSpec.PromptCacheBreakpointTools)
+		}
+		if hints.SystemPrompt && infReq.ModelParam.SystemPrompt != "" {
+			plan.usage.Breakpoints = append(plan.usage.Breakpoints, conversationSpec.PromptCacheBreakpointSystemPrompt)
+		}
+		if hints.HistoryPrefix && historyLen > 0 {
+			plan.usage.Breakpoints = append(plan.usage.Breakpoints, conversationSpec.PromptCacheBreakpointHistoryPrefix)
+		}
+
+	default:
+	}
+	return plan, nil
+}
+
+// applyAnthropicCacheBreakpoints places cache_control breakpoints. Anthropic caches the prompt in the order tools,
+// system, messages, so a breakpoint covers everything before it. At most three of the allowed four are used.
+func applyAnthropicCacheBreakpoints(
+	infReq *inferencegoSpec.FetchCompletionRequest,
+	historyLen int,
+	hints *spec.PromptCacheHints,
+	plan *promptCachePlan,
+) {
+	cc := &inferencegoSpec.CacheControl{Kind: inferencegoSpec.CacheControlKindEphemeral}
+	if ttl := strings.TrimSpace(hints.TTL); ttl != "" {
+		cc.CacheControlEphemeral = &inferencegoSpec.CacheControlEphemeral{TTL: ttl}
+	}
+
+	toolsCached := false
+	if hints.Tools && len(infReq.ToolChoices) > 0 {
+		// Tool choices are built fresh per request, so they can be modified in place.
+		infReq.ToolChoices[len(infReq.ToolChoices)-1].CacheControl = cc
+		toolsCached = true
+		plan.usage.Breakpoints = append(plan.usage.Breakpoints, conversationSpec.PromptCacheBreakpointTools)
+	}
+
+	lastMarked := -1
+	if hints.HistoryPrefix && historyLen > 0 {
+		for i := min(historyLen, len(infReq.Inputs)) - 1; i >= 0; i-- {
+			if setInputCacheControl(&infReq.Inputs[i], cc) {
+				lastMarked = i
+				plan.usage.Breakpoints = append(plan.usage.Breakpoints,
+					conversationSpec.PromptCacheBreakpointHistoryPrefix)
+				break
+			}
+		}
+	}
+
+	if hints.SystemPrompt && infReq.ModelParam.SystemPrompt != "" {
+		if lastMarked < 0 {
+			// There is no breakpoint on the system prompt itself; the closest is the first input after it.
+			for i := range infReq.Inputs {
+				if setInputCacheControl(&infReq.Inputs[i], cc) {
+					lastMarked = i
+					break
+				}
+			}
+		}
+		if lastMarked >= 0 {
+			plan.usage.Breakpoints = append(plan.usage.Breakpoints, conversationSpec.PromptCacheBreakpointSystemPrompt)
+		}
+	}
+
+	if lastMarked >= 0 {
+		prefix := *infReq
+		prefix.Inputs = infReq.Inputs[:lastMarked+1]
+		_, plan.prefixTokens = estimateRequestTokens(&prefix)
+	} else if toolsCached {
+		prefix := inferencegoSpec.FetchCompletionRequest{ToolChoices: infReq.ToolChoices}
+		_, plan.prefixTokens = estimateRequestTokens(&prefix)
+	}
+}
+
+// setInputCacheControl sets the cache control of an input that supports one. The content is copied first because
+// history inputs share pointers with the caller's conversation. Reasoning inputs cannot carry breakpoints.
+func setInputCacheControl(in *inferencegoSpec.InputUnion, cc *inferencegoSpec.CacheControl) bool {
+	switch in.Kind {
+	case inferencegoSpec.InputKindInputMessage:
+		if in.InputMessage != nil {
+			m := *in.InputMessage
+			m.CacheControl = cc
+			in.InputMessage = &m
+			return true
+		}
+	case inferencegoSpec.InputKindOutputMessage:
+		if in.OutputMessage != nil {
+			m := *in.OutputMessage
+			m.CacheControl = cc
+			in.OutputMessage = &m
+			return true
+		}
+	case inferencegoSpec.InputKindFunctionToolCall:
+		if in.FunctionToolCall != nil {
+			c := *in.FunctionToolCall
+			c.CacheControl = cc
+			in.FunctionToolCall = &c
+			return true
+		}
+	case inferencegoSpec.InputKindFunctionToolOutput:
+		if in.FunctionToolOutput != nil {
+			o := *in.FunctionToolOutput
+			o.CacheControl = cc
+			in.FunctionToolOutput = &o
+			return true
+		}
+	case inferencegoSpec.InputKindCustomToolCall:
+		if in.CustomToolCall != nil {
+			c := *in.CustomToolCall
+			c.CacheControl = cc
+			in.CustomToolCall = &c
+			return true
+		}
+	case inferencegoSpec.InputKindCustomToolOutput:
+		if in.CustomToolOutput != nil {
+			o := *in.CustomToolOutput
+			o.CacheControl = cc
+			in.CustomToolOutput = &o
+			return true
+		}
+	default:
+	}
+	return false
+}
+
+// recordPromptCacheUsage fills the cache token counts of the plan from the response usage.
+func (p *promptCachePlan) recordPromptCacheUsage(
+	resp *inferencegoSpec.FetchCompletionResponse,
+) *conversationSpec.PromptCacheUsage {
+	if p == nil {
+		return nil
+	}
+	u := p.usage
+	if resp != nil && resp.Usage != nil {
+		u.ReadTokens = resp.Usage.InputTokensCached
+	}
+	if w := int64(p.prefixTokens) - u.ReadTokens; w > 0 {
+		u.EstimatedWriteTokens = w
+	}
+	return &u
+}
+
+// derivePromptCacheKey keys the cache on what stays stable across the turns of a chat: model, system prompt and
+// tool names.
+func derivePromptCacheKey(infReq *inferencegoSpec.FetchCompletionRequest) string {
+	h := sha256.New()
+	h.Write([]byte(infReq.ModelParam.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(infReq.ModelParam.SystemPrompt))
+	for _, tc := range infReq.ToolChoices {
+		h.Write([]byte{0})
+		h.Write([]byte(tc.Name))
+	}
+	return promptCacheKeyPrefix + hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func isOpenAIOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Hostname(), openAIAPIHost)
+}
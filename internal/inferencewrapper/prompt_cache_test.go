@@ -0,0 +1,180 @@
+package inferencewrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/flexigpt/inference-go"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+func newPromptCacheRequest() *inferencegoSpec.FetchCompletionRequest {
+	msg := func(role inferencegoSpec.RoleEnum) *inferencegoSpec.InputOutputContent {
+		return &inferencegoSpec.InputOutputContent{Role: role}
+	}
+	return &inferencegoSpec.FetchCompletionRequest{
+		ModelParam: inferencegoSpec.ModelParam{Name: "m", SystemPrompt: "be brief"},
+		Inputs: []inferencegoSpec.InputUnion{
+			{Kind: inferencegoSpec.InputKindInputMessage, InputMessage: msg(inferencegoSpec.RoleUser)},
+			{Kind: inferencegoSpec.InputKindOutputMessage, OutputMessage: msg(inferencegoSpec.RoleAssistant)},
+			{Kind: inferencegoSpec.InputKindReasoningMessage, ReasoningMessage: &inferencegoSpec.ReasoningContent{}},
+			{Kind: inferencegoSpec.InputKindInputMessage, InputMessage: msg(inferencegoSpec.RoleUser)},
+		},
+		ToolChoices: []inferencegoSpec.ToolChoice{{Name: "a"}, {Name: "b"}},
+	}
+}
+
+func TestApplyPromptCacheHintsAnthropic(t *testing.T) {
+	ps := &ProviderSetAPI{
+		logger: slog.Default(),
+		providers: map[inferencegoSpec.ProviderName]inference.AddProviderConfig{
+			"anthropic": {SDKType: inferencegoSpec.ProviderSDKTypeAnthropic},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		hints           spec.PromptCacheHints
+		wantMarked      []int
+		wantToolCached  bool
+		wantBreakpoints []conversationSpec.PromptCacheBreakpoint
+	}{
+		{
+			name:           "history_skips_reasoning",
+			hints:          spec.PromptCacheHints{HistoryPrefix: true, Tools: true, TTL: "1h"},
+			wantMarked:     []int{1},
+			wantToolCached: true,
+			wantBreakpoints: []conversationSpec.PromptCacheBreakpoint{
+				conversationSpec.PromptCacheBreakpointTools,
+				conversationSpec.PromptCacheBreakpointHistoryPrefix,
+			},
+		},
+		{
+			name:       "system_prompt_only",
+			hints:      spec.PromptCacheHints{SystemPrompt: true},
+			wantMarked: []int{0},
+			wantBreakpoints: []conversationSpec.PromptCacheBreakpoint{
+				conversationSpec.PromptCacheBreakpointSystemPrompt,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			infReq := newPromptCacheRequest()
+			original := infReq.Inputs[1].OutputMessage
+			plan, err := ps.applyPromptCacheHints("anthropic", infReq, 3, &tt.hints)
+			if err != nil {
+				t.Fatalf("applyPromptCacheHints: %v", err)
+			}
+
+			var marked []int
+			for i, in := range infReq.Inputs {
+				var cc *inferencegoSpec.CacheControl
+				switch {
+				case in.InputMessage != nil:
+					cc = in.InputMessage.CacheControl
+				case in.OutputMessage != nil:
+					cc = in.OutputMessage.CacheControl
+				}
+				if cc != nil {
+					marked = append(marked, i)
+					if tt.hints.TTL != "" && (cc.CacheControlEphemeral == nil || cc.CacheControlEphemeral.TTL != tt.hints.TTL) {
+						t.Errorf("input %d: ttl not set: %+v", i, cc)
+					}
+				}
+			}
+			if fmt.Sprint(marked) != fmt.Sprint(tt.wantMarked) {
+				t.Errorf("marked inputs = %v, want %v", marked, tt.wantMarked)
+			}
+			if got := infReq.ToolChoices[1].CacheControl != nil; got != tt.wantToolCached {
+				t.Errorf("last tool cached = %v, want %v", got, tt.wantToolCached)
+			}
+			if infReq.ToolChoices[0].CacheControl != nil {
+				t.Error("only the last tool should carry a breakpoint")
+			}
+			if original.CacheControl != nil {
+				t.Error("history content must be copied before it is modified")
+			}
+			if fmt.Sprint(plan.usage.Breakpoints) != fmt.Sprint(tt.wantBreakpoints) {
+				t.Errorf("breakpoints = %v, want %v", plan.usage.Breakpoints, tt.wantBreakpoints)
+			}
+			if plan.prefixTokens <= 0 {
+				t.Errorf("prefix tokens not estimated")
+			}
+
+			u := plan.recordPromptCacheUsage(&inferencegoSpec.FetchCompletionResponse{
+				Usage: &inferencegoSpec.Usage{InputTokensCached: int64(plan.prefixTokens)},
+			})
+			if u.ReadTokens != int64(plan.prefixTokens) || u.EstimatedWriteTokens != 0 {
+				t.Errorf("usage on full cache hit = %+v", u)
+			}
+		})
+	}
+}
+
+func TestApplyPromptCacheHintsOpenAI(t *testing.T) {
+	ps := &ProviderSetAPI{
+		logger: slog.Default(),
+		providers: map[inferencegoSpec.ProviderName]inference.AddProviderConfig{
+			"openai": {
+				SDKType: inferencegoSpec.ProviderSDKTypeOpenAIResponses,
+				Origin:  "https://api.openai.com",
+			},
+			"local": {
+				SDKType: inferencegoSpec.ProviderSDKTypeOpenAIChatCompletions,
+				Origin:  "http://127.0.0.1:8080",
+			},
+		},
+	}
+	cacheKey := func(r *inferencegoSpec.FetchCompletionRequest) string {
+		if r.ModelParam.AdditionalParametersRawJSON == nil {
+			return ""
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(*r.ModelParam.AdditionalParametersRawJSON), &m); err != nil {
+			t.Fatalf("invalid additional parameters: %v", err)
+		}
+		s, _ := m["prompt_cache_key"].(string)
+		return s
+	}
+
+	infReq := newPromptCacheRequest()
+	plan, err := ps.applyPromptCacheHints("openai", infReq, 3, &spec.PromptCacheHints{SystemPrompt: true})
+	if err != nil {
+		t.Fatalf("applyPromptCacheHints: %v", err)
+	}
+	derived := cacheKey(infReq)
+	if !strings.HasPrefix(derived, promptCacheKeyPrefix) || plan.usage.CacheKey != derived {
+		t.Fatalf("derived key = %q, plan key = %q", derived, plan.usage.CacheKey)
+	}
+	if again := derivePromptCacheKey(newPromptCacheRequest()); again != derived {
+		t.Fatalf("derived key is not stable: %q != %q", again, derived)
+	}
+	for _, in := range infReq.Inputs {
+		if in.InputMessage != nil && in.InputMessage.CacheControl != nil {
+			t.Fatal("openai requests must not get cache_control breakpoints")
+		}
+	}
+
+	infReq = newPromptCacheRequest()
+	if _, err := ps.applyPromptCacheHints("local", infReq, 3, &spec.PromptCacheHints{SystemPrompt: true}); err != nil {
+		t.Fatalf("applyPromptCacheHints: %v", err)
+	}
+	if k := cacheKey(infReq); k != "" {
+		t.Fatalf("derived key sent to a non OpenAI origin: %q", k)
+	}
+
+	infReq = newPromptCacheRequest()
+	if _, err := ps.applyPromptCacheHints("local", infReq, 3, &spec.PromptCacheHints{CacheKey: "chat-1"}); err != nil {
+		t.Fatalf("applyPromptCacheHints: %v", err)
+	}
+	if k := cacheKey(infReq); k != "chat-1" {
+		t.Fatalf("explicit key = %q, want chat-1", k)
+	}
+}
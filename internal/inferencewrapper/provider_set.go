@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/flexigpt/inference-go"
 	"github.com/flexigpt/inference-go/debugclient"
@@ -16,6 +18,7 @@ import (
 	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
 	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
 	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	"github.com/flexigpt/flexigpt-app/internal/ratelimit"
 	toolSpec "github.com/flexigpt/flexigpt-app/internal/tool/spec"
 	toolStore "github.com/flexigpt/flexigpt-app/internal/tool/store"
 )
@@ -30,6 +33,33 @@ type ProviderSetAPI struct {
 	toolStore   *toolStore.ToolStore
 	logger      *slog.Logger
 	debugConfig *debugclient.DebugConfig
+
+	// Configs of the providers added via AddProvider, kept for features that need
+	// to know the provider wiring (e.g. wire request previews).
+	providersMu sync.RWMutex
+	providers   map[inferencegoSpec.ProviderName]inference.AddProviderConfig
+	// API keys set via SetProviderAPIKey, needed for calls made outside inference-go (e.g. model catalog checks).
+	apiKeys map[inferencegoSpec.ProviderName]string
+	// Record/replay providers are served by the wrapper and are never added to inference-go.
+	replayProviders map[inferencegoSpec.ProviderName]*replayProvider
+	// Client side rate limiters of providers that have rate limits configured.
+	limiters map[inferencegoSpec.ProviderName]*ratelimit.Limiter
+
+	completions *completionRegistry
+	// Checkpoints streamed output for recovery, nil unless WithRecoveryJournal is given.
+	journal *recoveryJournal
+	// Daily and monthly token quotas, nil unless WithTokenQuotas is given.
+	quotas *quotaLedger
+	// Provider file IDs of uploaded attachments, nil unless WithFileUploads is given.
+	files *fileUploadCache
+	// Resolves route selections, set via SetModelRouter.
+	router ModelRouteResolver
+	// Stored model presets, set via SetModelPresetLister.
+	presets ModelPresetLister
+	// Client of the HTTP calls made outside inference-go.
+	httpClient *http.Client
+	// Called when a provider becomes usable, set via SetProviderReadyFunc.
+	onProviderReady func(provider inferencegoSpec.ProviderName)
 }
 
 type ProviderSetOption func(*ProviderSetAPI)
@@ -49,7 +79,8 @@ func WithDebugConfig(debugConfig *debugclient.DebugConfig) ProviderSetOption {
 // NewProviderSetAPI creates a new ProviderSetAPI wrapper.
 //
 //   - ts:   tool store used to hydrate ToolChoices when needed.
-//   - opts: functional options for configuring the wrapper (e.g. WithLogger, WithDebugConfig).
+//   - opts: functional options for configuring the wrapper (e.g. WithLogger, WithDebugConfig, WithRecoveryJournal,
+//     WithTokenQuotas, WithFileUploads, WithHTTPClient).
 func NewProviderSetAPI(
 	ts *toolStore.ToolStore,
 	opts ...ProviderSetOption,
@@ -58,7 +89,12 @@ func NewProviderSetAPI(
 		return nil, errors.New("no tool store provided to inference wrapper provider set")
 	}
 	ps := &ProviderSetAPI{
-		toolStore: ts,
+		toolStore:       ts,
+		providers:       map[inferencegoSpec.ProviderName]inference.AddProviderConfig{},
+		apiKeys:         map[inferencegoSpec.ProviderName]string{},
+		replayProviders: map[inferencegoSpec.ProviderName]*replayProvider{},
+		limiters:        map[inferencegoSpec.ProviderName]*ratelimit.Limiter{},
+		completions:     newCompletionRegistry(),
 	}
 	for _, opt := range opts {
 		if opt != nil {
@@ -69,6 +105,9 @@ func NewProviderSetAPI(
 	if ps.logger == nil {
 		ps.logger = slog.Default()
 	}
+	if ps.httpClient == nil {
+		ps.httpClient = &http.Client{}
+	}
 	allOpts = append(allOpts, inference.WithLogger(ps.logger))
 	if ps.debugConfig != nil {
 		allOpts = append(allOpts,
@@ -85,6 +124,26 @@ func NewProviderSetAPI(
 	}
 	ps.inner = inner
 
+	if ps.journal != nil {
+		if err := ps.journal.init(ps.logger); err != nil {
+			return nil, err
+		}
+		ps.journal.recoverAll(context.Background())
+	}
+	if ps.quotas != nil {
+		if err := ps.quotas.init(ps.logger); err != nil {
+			return nil, err
+		}
+	}
+	if ps.files != nil {
+		if ps.files.client == nil {
+			ps.files.client = ps.httpClient
+		}
+		if err := ps.files.init(ps.logger); err != nil {
+			return nil, err
+		}
+	}
+
 	return ps, nil
 }
 
@@ -93,7 +152,25 @@ func (ps *ProviderSetAPI) AddProvider(
 	ctx context.Context,
 	req *spec.AddProviderRequest,
 ) (*spec.AddProviderResponse, error) {
-	if req == nil || req.Body == nil || req.Provider == "" || strings.TrimSpace(req.Body.Origin) == "" {
+	if req == nil || req.Body == nil || req.Provider == "" {
+		return nil, errors.New("invalid params")
+	}
+	if err := validateRateLimits(req.Body.RateLimits); err != nil {
+		return nil, err
+	}
+	if req.Body.SDKType == spec.ProviderSDKTypeReplay {
+		rp, err := newReplayProvider(req.Provider, req.Body.Replay)
+		if err != nil {
+			return nil, err
+		}
+		ps.providersMu.Lock()
+		ps.replayProviders[req.Provider] = rp
+		ps.providersMu.Unlock()
+		ps.logger.Info("add replay provider", "name", req.Provider, "mode", rp.cfg.Mode)
+		ps.providerReady(req.Provider)
+		return &spec.AddProviderResponse{}, nil
+	}
+	if strings.TrimSpace(req.Body.Origin) == "" {
 		return nil, errors.New("invalid params")
 	}
 
@@ -107,6 +184,10 @@ func (ps *ProviderSetAPI) AddProvider(
 	if _, err := ps.inner.AddProvider(ctx, req.Provider, cfg); err != nil {
 		return nil, err
 	}
+	ps.providersMu.Lock()
+	ps.providers[req.Provider] = *cfg
+	ps.providersMu.Unlock()
+	ps.setRateLimits(req.Provider, req.Body.RateLimits)
 	ps.logger.Info("add provider", "name", req.Provider)
 	return &spec.AddProviderResponse{}, nil
 }
@@ -119,9 +200,21 @@ func (ps *ProviderSetAPI) DeleteProvider(
 	if req == nil || req.Provider == "" {
 		return nil, errors.New("got empty provider input")
 	}
+	if ps.getReplayProvider(req.Provider) != nil {
+		ps.providersMu.Lock()
+		delete(ps.replayProviders, req.Provider)
+		ps.providersMu.Unlock()
+		ps.logger.Info("deleteProvider", "name", req.Provider)
+		return &spec.DeleteProviderResponse{}, nil
+	}
 	if err := ps.inner.DeleteProvider(ctx, req.Provider); err != nil {
 		return nil, err
 	}
+	ps.providersMu.Lock()
+	delete(ps.providers, req.Provider)
+	delete(ps.apiKeys, req.Provider)
+	delete(ps.limiters, req.Provider)
+	ps.providersMu.Unlock()
 	ps.logger.Info("deleteProvider", "name", req.Provider)
 	return &spec.DeleteProviderResponse{}, nil
 }
@@ -134,14 +227,59 @@ func (ps *ProviderSetAPI) SetProviderAPIKey(
 	if req == nil || req.Body == nil {
 		return nil, errors.New("got empty provider input")
 	}
+	if ps.getReplayProvider(req.Provider) != nil {
+		// Replay providers need no credentials.
+		return &spec.SetProviderAPIKeyResponse{}, nil
+	}
 	if err := ps.inner.SetProviderAPIKey(ctx, req.Provider, req.Body.APIKey); err != nil {
 		return nil, err
 	}
+	ps.providersMu.Lock()
+	ps.apiKeys[req.Provider] = req.Body.APIKey
+	ps.providersMu.Unlock()
+	if req.Body.APIKey != "" {
+		ps.providerReady(req.Provider)
+	}
 	return &spec.SetProviderAPIKeyResponse{}, nil
 }
 
+// SetProviderReadyFunc sets fn to be called with every provider that has an API key or is a replay provider, first
+// for the ones that are ready now and then for each one that becomes ready. Components created after the provider
+// set use it to start work that needs a provider, such as resuming batch jobs.
+func (ps *ProviderSetAPI) SetProviderReadyFunc(fn func(provider inferencegoSpec.ProviderName)) {
+	ps.providersMu.Lock()
+	ps.onProviderReady = fn
+	ready := make([]inferencegoSpec.ProviderName, 0, len(ps.apiKeys)+len(ps.replayProviders))
+	for name, key := range ps.apiKeys {
+		if key != "" {
+			ready = append(ready, name)
+		}
+	}
+	for name := range ps.replayProviders {
+		ready = append(ready, name)
+	}
+	ps.providersMu.Unlock()
+	if fn == nil {
+		return
+	}
+	for _, name := range ready {
+		fn(name)
+	}
+}
+
+func (ps *ProviderSetAPI) providerReady(provider inferencegoSpec.ProviderName) {
+	ps.providersMu.RLock()
+	fn := ps.onProviderReady
+	ps.providersMu.RUnlock()
+	if fn != nil {
+		fn(provider)
+	}
+}
+
 // FetchCompletion builds a normalized inference-go FetchCompletionRequest from
 // app-level conversation types and calls inference-go's FetchCompletion.
+// The call is tracked in the completion registry under req.RequestID until it returns. A failed call always ends
+// the typed event stream with an error event.
 func (ps *ProviderSetAPI) FetchCompletion(
 	ctx context.Context,
 	req *spec.CompletionRequest,
@@ -149,62 +287,196 @@ func (ps *ProviderSetAPI) FetchCompletion(
 	if req == nil || req.Body == nil {
 		return nil, errors.New("got empty completion input")
 	}
-	if req.Provider == "" {
+	events := newStreamEmitter(ctx, strings.TrimSpace(req.RequestID), req.OnStreamEvent)
+	resp, err := ps.fetchCompletion(ctx, req, events)
+	var b *inferencegoSpec.FetchCompletionResponse
+	if resp != nil && resp.Body != nil {
+		b = resp.Body.InferenceResponse
+	}
+	if evErr := events.emitError(b, err); evErr != nil {
+		ps.logger.Debug("stream event callback failed", "requestID", events.id(), "error", evErr)
+	}
+	return resp, err
+}
+
+func (ps *ProviderSetAPI) fetchCompletion(
+	ctx context.Context,
+	req *spec.CompletionRequest,
+	events *streamEmitter,
+) (*spec.CompletionResponse, error) {
+	if req.Provider == "" && req.Body.Route == nil {
 		return nil, errors.New("missing provider")
 	}
+	provider, body, decision, err := ps.applyRoute(ctx, req.Provider, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, ac, done, err := ps.completions.register(ctx, req.RequestID, provider)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	events.bind(ctx, ac.id)
 
-	body := req.Body
+	infReq, currentInputs, cachePlan, err := ps.buildFetchCompletionRequest(ctx, provider, body, nil)
+	if err != nil {
+		return nil, err
+	}
+	ps.completions.setModelName(ac, infReq.ModelParam.Name)
+	entry, err := ps.journal.begin(ac.id, provider, infReq.ModelParam.Name, body)
+	if err != nil {
+		return nil, err
+	}
+	// Quotas are checked against the same estimate the rate limiter uses.
+	_, estimate := estimateRequestTokens(infReq)
+	quotaPresetID, err := ps.quotaModelPresetID(ctx, provider, body.ModelPresetID, infReq.ModelParam.Name)
+	if err != nil {
+		return nil, err
+	}
+	reservation, err := ps.quotas.reserve(provider, quotaPresetID, int64(estimate+infReq.ModelParam.MaxOutputLength))
+	if err != nil {
+		return nil, err
+	}
 
+	uploads := ps.uploadFiles(ctx, provider, infReq)
+
+	onText := entry.wrap(
+		false,
+		events.deltaCallback(spec.StreamEventKindTextDelta, stopOnCancel(ctx, req.OnStreamText)),
+	)
+	onThinking := entry.wrap(
+		true,
+		events.deltaCallback(spec.StreamEventKindThinkingDelta, stopOnCancel(ctx, req.OnStreamThinking)),
+	)
+	b, err := ps.fetch(ctx, provider, infReq, onText, onThinking)
+	if err != nil && uploads.retryRejected(ctx, err) {
+		ps.logger.Info("provider rejected uploaded files, retrying", "requestID", ac.id, "error", err)
+		b, err = ps.fetch(ctx, provider, infReq, onText, onThinking)
+	}
+	entry.finish(ctx, err)
+	if evErr := events.emitResponse(b); evErr != nil {
+		ps.logger.Debug("stream event callback failed", "requestID", ac.id, "error", evErr)
+	}
+
+	resp := &spec.CompletionResponse{Body: &spec.CompletionResponseBody{
+		RequestID:             ac.id,
+		Provider:              provider,
+		InferenceResponse:     b,
+		HydratedCurrentInputs: currentInputs,
+		PromptCache:           cachePlan.recordPromptCacheUsage(b),
+	}}
+	if decision != nil {
+		resp.Body.Route = modelRoute(decision)
+		resp.Body.ModelParam = &infReq.ModelParam
+	}
+	if err == nil && body.ResponseFormat != nil {
+		var structured *spec.StructuredOutputResult
+		b, structured, err = ps.validateStructuredOutput(ctx, provider, infReq, body.ResponseFormat, b, events)
+		resp.Body.InferenceResponse = b
+		resp.Body.StructuredOutput = structured
+	}
+	if b != nil {
+		resp.Body.Citations = extractCitations(b.Outputs)
+	}
+	var usage *inferencegoSpec.Usage
+	if b != nil {
+		usage = b.Usage
+	}
+	if qErr := reservation.settle(usage); qErr != nil {
+		ps.logger.Warn("debit token quota", "requestID", ac.id, "error", qErr)
+	}
+	return resp, err
+}
+
+// fetch sends a built request to the provider, routing record/replay providers to the wrapper implementation.
+func (ps *ProviderSetAPI) fetch(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	infReq *inferencegoSpec.FetchCompletionRequest,
+	onText func(string) error,
+	onThinking func(string) error,
+) (*inferencegoSpec.FetchCompletionResponse, error) {
+	if rp := ps.getReplayProvider(provider); rp != nil {
+		return rp.fetchCompletion(ctx, ps.fetchUpstream, infReq, onText, onThinking)
+	}
+	var opts *inferencegoSpec.FetchCompletionOptions
+	if onText != nil || onThinking != nil {
+		opts = &inferencegoSpec.FetchCompletionOptions{
+			StreamHandler: makeStreamHandler(onText, onThinking),
+		}
+	}
+	return ps.fetchUpstream(ctx, provider, infReq, opts)
+}
+
+func (ps *ProviderSetAPI) getReplayProvider(name inferencegoSpec.ProviderName) *replayProvider {
+	ps.providersMu.RLock()
+	defer ps.providersMu.RUnlock()
+	return ps.replayProviders[name]
+}
+
+// buildFetchCompletionRequest resolves the model param, flattens history and current turn into inputs (hydrating
+// attachments), hydrates tool choices and applies the response format and prompt cache hints for the provider.
+// onAttachmentSkip, if non-nil, is told about attachments that were dropped. cachePlan is nil without cache hints.
+func (ps *ProviderSetAPI) buildFetchCompletionRequest(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	body *spec.CompletionRequestBody,
+	onAttachmentSkip func(att *attachment.Attachment, err error),
+) (
+	infReq *inferencegoSpec.FetchCompletionRequest,
+	currentInputs []inferencegoSpec.InputUnion,
+	cachePlan *promptCachePlan,
+	err error,
+) {
 	// Resolve model param for this call (prefer explicit body.ModelParam,
 	// otherwise last non-nil ModelParam from history).
 	modelParam, err := ps.resolveModelParam(body)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	if modelParam.Name == "" {
-		return nil, errors.New("model name is required")
+		return nil, nil, nil, errors.New("model name is required")
 	}
 
 	if len(body.Current.ToolChoices) > 0 {
-		return nil, errors.New("prepopulated tool choices are not allowed in fetch completion, need tool store choices")
+		return nil, nil, nil, errors.New(
+			"prepopulated tool choices are not allowed in fetch completion, need tool store choices",
+		)
 	}
 
 	// Flatten full conversation (history + current) into InputUnion list.
-	inputs, currentInputs, err := ps.buildInputs(ctx, body)
+	inputs, currentInputs, err := ps.buildInputs(ctx, provider, modelParam.Name, body, onAttachmentSkip)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	if len(inputs) == 0 {
-		return nil, errors.New("no usable inputs to send to inference-go")
+		return nil, nil, nil, errors.New("no usable inputs to send to inference-go")
 	}
 
 	// Build tool choices for this call.
 	toolChoices, err := ps.buildToolChoices(ctx, body.ToolStoreChoices)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	infReq := &inferencegoSpec.FetchCompletionRequest{
+	infReq = &inferencegoSpec.FetchCompletionRequest{
 		ModelParam:  *modelParam,
 		Inputs:      inputs,
 		ToolChoices: toolChoices,
 	}
-
-	var opts *inferencegoSpec.FetchCompletionOptions
-	if req.OnStreamText != nil || req.OnStreamThinking != nil {
-		opts = &inferencegoSpec.FetchCompletionOptions{
-			StreamHandler: makeStreamHandler(req.OnStreamText, req.OnStreamThinking),
+	if body.ResponseFormat != nil {
+		if err := ps.applyResponseFormat(provider, infReq, body.ResponseFormat); err != nil {
+			return nil, nil, nil, err
 		}
 	}
-
-	b, err := ps.inner.FetchCompletion(ctx, req.Provider, infReq, opts)
-
-	resp := &spec.CompletionResponse{Body: &spec.CompletionResponseBody{
-		InferenceResponse:     b,
-		HydratedCurrentInputs: currentInputs,
-	}}
-
-	return resp, err
+	if body.PromptCache != nil {
+		cachePlan, err = ps.applyPromptCacheHints(provider, infReq, len(inputs)-len(currentInputs), body.PromptCache)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return infReq, currentInputs, cachePlan, nil
 }
 
 // resolveModelParam chooses the effective ModelParam for this call.
@@ -240,17 +512,49 @@ func (ps *ProviderSetAPI) resolveModelParam(
 	return mp, nil
 }
 
+// setAdditionalParameter sets a top level key of the provider specific additional parameters JSON object.
+func setAdditionalParameter(mp *inferencegoSpec.ModelParam, key string, value any) error {
+	params := map[string]any{}
+	if raw := mp.AdditionalParametersRawJSON; raw != nil && strings.TrimSpace(*raw) != "" {
+		if err := json.Unmarshal([]byte(*raw), &params); err != nil {
+			return fmt.Errorf("additionalParametersRawJSON must be a JSON object: %w", err)
+		}
+	}
+	params[key] = value
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	// Assign a new pointer; the original may be shared with the caller's ModelParam.
+	merged := string(b)
+	mp.AdditionalParametersRawJSON = &merged
+	return nil
+}
+
 // buildInputs flattens History + Current into a single InputUnion slice.
 // Attachments are always built from top level param and added to the union.
 // If the caller hydrates it then there is a possibility of duplicates.
+// Reasoning outputs in History are replayed according to the reasoning replay policy of the request, else of the
+// stored model preset, else the default for provider.
 func (ps *ProviderSetAPI) buildInputs(
 	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	modelName inferencegoSpec.ModelName,
 	body *spec.CompletionRequestBody,
+	onAttachmentSkip func(att *attachment.Attachment, err error),
 ) (all, current []inferencegoSpec.InputUnion, err error) {
 	out := make([]inferencegoSpec.InputUnion, 0)
+	policy := body.ReasoningReplay
+	if policy == "" {
+		if mp := ps.modelPreset(ctx, provider, body.ModelPresetID, modelName); mp != nil {
+			policy = mp.ReasoningReplay
+		}
+	}
+	replay := newReasoningReplay(ps.reasoningReplayPolicy(provider, policy), provider, modelName)
 
 	// 1) History: replay stored unions exactly as they were.
 	for _, turn := range body.History {
+		replay.observeTurn(&turn)
 		// Inputs first, then Outputs, preserving stored order.
 
 		out = append(out, turn.Inputs...)
@@ -258,6 +562,12 @@ func (ps *ProviderSetAPI) buildInputs(
 			// Outputs are not directly part of InputUnion; but for replay
 			// we want them to be visible as prior context. We embed them
 			// as InputUnion using the matching InputKind* variants.
+			if outEv.Kind == inferencegoSpec.OutputKindReasoningMessage {
+				if o := replay.reasoningInput(outEv.ReasoningMessage); o != nil {
+					out = append(out, *o)
+				}
+				continue
+			}
 			o := outputToInput(outEv)
 			if o != nil {
 				out = append(out, *o)
@@ -277,7 +587,7 @@ func (ps *ProviderSetAPI) buildInputs(
 	}
 
 	// Always process attachments into content items.
-	msgContentItems, err := buildContentItemsFromAttachments(ctx, &cur)
+	msgContentItems, err := buildContentItemsFromAttachments(ctx, &cur, onAttachmentSkip)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -363,6 +673,7 @@ func outputToInput(o inferencegoSpec.OutputUnion) *inferencegoSpec.InputUnion {
 func buildContentItemsFromAttachments(
 	ctx context.Context,
 	turn *conversationSpec.ConversationMessage,
+	onSkip func(att *attachment.Attachment, err error),
 ) ([]inferencegoSpec.InputOutputContentItemUnion, error) {
 	items := make([]inferencegoSpec.InputOutputContentItemUnion, 0)
 	if len(turn.Attachments) == 0 {
@@ -374,6 +685,7 @@ func buildContentItemsFromAttachments(
 		turn.Attachments,
 		attachment.WithOverrideOriginalContentBlock(true),
 		attachment.WithOnlyTextKindContentBlock(false),
+		attachment.WithOnSkippedContentBlock(onSkip),
 	)
 	if err != nil {
 		return nil, err
@@ -568,7 +880,7 @@ func (ps *ProviderSetAPI) hydrateToolChoice(
 	}
 
 	switch tool.Type {
-	case toolSpec.ToolTypeGo, toolSpec.ToolTypeHTTP:
+	case toolSpec.ToolTypeGo, toolSpec.ToolTypeHTTP, toolSpec.ToolTypeExec, toolSpec.ToolTypeMCP:
 		argSchema, err := decodeToolArgSchema(string(tool.ArgSchema))
 		if err != nil {
 			return nil, fmt.Errorf(
@@ -634,6 +946,20 @@ func decodeToolArgSchema(raw toolSpec.JSONRawString) (map[string]any, error) {
 	return schema, nil
 }
 
+// stopOnCancel makes a stream callback fail once ctx is done, so a cancelled completion stops emitting chunks right
+// away instead of when the provider client notices.
+func stopOnCancel(ctx context.Context, fn func(string) error) func(string) error {
+	if fn == nil {
+		return nil
+	}
+	return func(s string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(s)
+	}
+}
+
 // makeStreamHandler adapts inference-go streaming into the legacy
 // text/thinking callback pair.
 func makeStreamHandler(
@@ -0,0 +1,118 @@
+package inferencewrapper
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	toolSpec "github.com/flexigpt/flexigpt-app/internal/tool/spec"
+	toolStore "github.com/flexigpt/flexigpt-app/internal/tool/store"
+)
+
+// mcpLookupHandler is a streamable HTTP MCP server that lists one lookup tool.
+func mcpLookupHandler(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil || msg.ID == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	var result any
+	switch msg.Method {
+	case "initialize":
+		result = map[string]any{
+			"protocolVersion": "2025-06-18",
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "stub", "version": "1.0.0"},
+		}
+	case "tools/list":
+		result = map[string]any{"tools": []map[string]any{{
+			"name":        "lookup",
+			"description": "Looks up a key.",
+			"inputSchema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"key": map[string]any{"type": "string"}},
+			},
+		}}}
+	default:
+		result = map[string]any{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+}
+
+func TestBuildFetchCompletionRequestMCPTool(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(mcpLookupHandler))
+	defer srv.Close()
+
+	ts, err := toolStore.NewToolStore(t.TempDir(), toolStore.WithFTS(false))
+	if err != nil {
+		t.Fatalf("NewToolStore: %v", err)
+	}
+	defer ts.Close()
+
+	const bundleID bundleitemutils.BundleID = "mcp-bundle"
+	if _, err := ts.PutToolBundle(t.Context(), &toolSpec.PutToolBundleRequest{
+		BundleID: bundleID,
+		Body: &toolSpec.PutToolBundleRequestBody{
+			Slug:        "mcp",
+			DisplayName: "MCP",
+			IsEnabled:   true,
+			MCPServer:   &toolSpec.MCPServerConfig{Transport: toolSpec.MCPTransportStreamableHTTP, URL: srv.URL},
+		},
+	}); err != nil {
+		t.Fatalf("PutToolBundle: %v", err)
+	}
+
+	ps := &ProviderSetAPI{logger: slog.Default(), toolStore: ts}
+	body := &spec.CompletionRequestBody{
+		ModelParam: &inferencegoSpec.ModelParam{Name: "m"},
+		Current: conversationSpec.ConversationMessage{
+			Role: inferencegoSpec.RoleUser,
+			Inputs: []inferencegoSpec.InputUnion{{
+				Kind: inferencegoSpec.InputKindInputMessage,
+				InputMessage: &inferencegoSpec.InputOutputContent{
+					Role: inferencegoSpec.RoleUser,
+					Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+						Kind:     inferencegoSpec.ContentItemKindText,
+						TextItem: &inferencegoSpec.ContentItemText{Text: "look up a"},
+					}},
+				},
+			}},
+		},
+		ToolStoreChoices: []toolSpec.ToolStoreChoice{{
+			ChoiceID:    "c1",
+			BundleID:    bundleID,
+			ToolSlug:    "lookup",
+			ToolVersion: string(toolSpec.MCPToolVersion),
+			ToolType:    toolSpec.ToolStoreChoiceTypeFunction,
+		}},
+	}
+
+	infReq, _, _, err := ps.buildFetchCompletionRequest(t.Context(), "openai", body, nil)
+	if err != nil {
+		t.Fatalf("buildFetchCompletionRequest: %v", err)
+	}
+	if len(infReq.ToolChoices) != 1 {
+		t.Fatalf("tool choices = %+v", infReq.ToolChoices)
+	}
+	tc := infReq.ToolChoices[0]
+	if tc.ID != "c1" || tc.Name != "lookup" || tc.Type != inferencegoSpec.ToolTypeFunction ||
+		tc.Description != "Looks up a key." {
+		t.Errorf("tool choice = %+v", tc)
+	}
+	if _, ok := tc.Arguments["properties"].(map[string]any)["key"]; !ok {
+		t.Errorf("arguments = %+v", tc.Arguments)
+	}
+}
@@ -0,0 +1,357 @@
+package inferencewrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+)
+
+const (
+	tokenQuotasFile          = "tokenquotas.json"
+	tokenQuotasSchemaVersion = "2026-10-19"
+)
+
+var errTokenQuotasNotConfigured = errors.New("token quotas are not configured")
+
+// WithTokenQuotas enables daily and monthly token quotas per provider and per model preset. Limits and consumption
+// are kept in a file in dir.
+func WithTokenQuotas(dir string) ProviderSetOption {
+	return func(ps *ProviderSetAPI) {
+		ps.quotas = &quotaLedger{dir: dir}
+	}
+}
+
+// SetTokenQuota adds or replaces a token quota.
+func (ps *ProviderSetAPI) SetTokenQuota(
+	ctx context.Context,
+	req *spec.SetTokenQuotaRequest,
+) (*spec.SetTokenQuotaResponse, error) {
+	if req == nil || req.Body == nil || req.Provider == "" {
+		return nil, errors.New("invalid params")
+	}
+	if ps.quotas == nil {
+		return nil, errTokenQuotasNotConfigured
+	}
+	l := req.Body.Limits
+	if l.DailyTokens < 0 || l.MonthlyTokens < 0 {
+		return nil, errors.New("token quota limits must not be negative")
+	}
+	if l == (spec.TokenQuotaLimits{}) {
+		return nil, errors.New("token quota needs a daily or monthly limit")
+	}
+	if err := ps.quotas.set(req.Provider, req.ModelPresetID, l); err != nil {
+		return nil, err
+	}
+	ps.logger.Info("setTokenQuota", "name", req.Provider, "modelPresetID", req.ModelPresetID)
+	return &spec.SetTokenQuotaResponse{}, nil
+}
+
+// DeleteTokenQuota removes a token quota together with its consumption.
+func (ps *ProviderSetAPI) DeleteTokenQuota(
+	ctx context.Context,
+	req *spec.DeleteTokenQuotaRequest,
+) (*spec.DeleteTokenQuotaResponse, error) {
+	if req == nil || req.Provider == "" {
+		return nil, errors.New("invalid params")
+	}
+	if ps.quotas == nil {
+		return nil, errTokenQuotasNotConfigured
+	}
+	if err := ps.quotas.delete(req.Provider, req.ModelPresetID); err != nil {
+		return nil, err
+	}
+	ps.logger.Info("deleteTokenQuota", "name", req.Provider, "modelPresetID", req.ModelPresetID)
+	return &spec.DeleteTokenQuotaResponse{}, nil
+}
+
+// ListTokenQuotas returns all token quotas with their consumption in the current day and month, sorted by provider
+// and model preset.
+func (ps *ProviderSetAPI) ListTokenQuotas(
+	ctx context.Context,
+	req *spec.ListTokenQuotasRequest,
+) (*spec.ListTokenQuotasResponse, error) {
+	quotas := []spec.TokenQuota{}
+	if ps.quotas != nil {
+		quotas = ps.quotas.list()
+	}
+	return &spec.ListTokenQuotasResponse{
+		Body: &spec.ListTokenQuotasResponseBody{Quotas: quotas},
+	}, nil
+}
+
+type quotaScope struct {
+	provider      inferencegoSpec.ProviderName
+	modelPresetID modelpresetSpec.ModelPresetID
+}
+
+type tokenQuotasSchema struct {
+	SchemaVersion string            `json:"schemaVersion"`
+	Quotas        []spec.TokenQuota `json:"quotas"`
+}
+
+// quotaLedger checks and debits token quotas. Completions in flight reserve their estimate so that concurrent
+// calls cannot overrun a quota together; reservations are not persisted.
+type quotaLedger struct {
+	dir string
+
+	mu       sync.Mutex
+	store    *jsonLedger
+	quotas   map[quotaScope]*spec.TokenQuota
+	reserved map[quotaScope]int64
+	now      func() time.Time
+}
+
+func (q *quotaLedger) init(logger *slog.Logger) error {
+	if strings.TrimSpace(q.dir) == "" {
+		return errors.New("token quotas need a directory")
+	}
+	var all tokenQuotasSchema
+	store, err := openJSONLedger(q.dir, tokenQuotasFile, tokenQuotasSchema{
+		SchemaVersion: tokenQuotasSchemaVersion,
+		Quotas:        []spec.TokenQuota{},
+	}, &all, logger)
+	if err != nil {
+		return err
+	}
+	q.store = store
+	q.quotas = make(map[quotaScope]*spec.TokenQuota, len(all.Quotas))
+	for i := range all.Quotas {
+		tq := all.Quotas[i]
+		q.quotas[quotaScope{tq.Provider, tq.ModelPresetID}] = &tq
+	}
+	q.reserved = map[quotaScope]int64{}
+	if q.now == nil {
+		q.now = time.Now
+	}
+	return nil
+}
+
+func (q *quotaLedger) set(
+	provider inferencegoSpec.ProviderName,
+	modelPresetID modelpresetSpec.ModelPresetID,
+	limits spec.TokenQuotaLimits,
+) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	scope := quotaScope{provider, modelPresetID}
+	tq, ok := q.quotas[scope]
+	if !ok {
+		tq = &spec.TokenQuota{Provider: provider, ModelPresetID: modelPresetID}
+		q.quotas[scope] = tq
+	}
+	tq.Limits = limits
+	tq.ModifiedAt = q.now().UTC()
+	q.rollOverLocked(tq)
+	return q.saveLocked()
+}
+
+func (q *quotaLedger) delete(provider inferencegoSpec.ProviderName, modelPresetID modelpresetSpec.ModelPresetID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	scope := quotaScope{provider, modelPresetID}
+	if _, ok := q.quotas[scope]; !ok {
+		return fmt.Errorf("no token quota for %s %q", provider, modelPresetID)
+	}
+	delete(q.quotas, scope)
+	return q.saveLocked()
+}
+
+func (q *quotaLedger) list() []spec.TokenQuota {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]spec.TokenQuota, 0, len(q.quotas))
+	for _, tq := range q.quotas {
+		q.rollOverLocked(tq)
+		out = append(out, *tq)
+	}
+	slices.SortFunc(out, func(a, b spec.TokenQuota) int {
+		if c := strings.Compare(string(a.Provider), string(b.Provider)); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.ModelPresetID), string(b.ModelPresetID))
+	})
+	return out
+}
+
+// hasModelPresetQuotas reports whether any model preset of provider has a quota. It accepts a nil receiver.
+func (q *quotaLedger) hasModelPresetQuotas(provider inferencegoSpec.ProviderName) bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for scope := range q.quotas {
+		if scope.provider == provider && scope.modelPresetID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// quotaModelPresetID returns the model preset whose quota a completion of modelName counts against. The preset is
+// resolved from the stored presets, with requested only picking between presets of the same model, so that a caller
+// cannot charge another preset's quota. When provider has model preset quotas and the preset cannot be resolved, the
+// completion is rejected.
+func (ps *ProviderSetAPI) quotaModelPresetID(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	requested modelpresetSpec.ModelPresetID,
+	modelName inferencegoSpec.ModelName,
+) (modelpresetSpec.ModelPresetID, error) {
+	if !ps.quotas.hasModelPresetQuotas(provider) {
+		return "", nil
+	}
+	mp := ps.modelPreset(ctx, provider, requested, modelName)
+	if mp == nil {
+		return "", fmt.Errorf(
+			"provider %s has model preset token quotas but no single stored preset matches model %s",
+			provider, modelName,
+		)
+	}
+	return mp.ID, nil
+}
+
+// reserve checks the provider quota and, when modelPresetID is set, the model preset quota against the estimated
+// tokens of a completion and reserves them until the reservation is settled. It accepts a nil receiver, as do the
+// reservation methods.
+func (q *quotaLedger) reserve(
+	provider inferencegoSpec.ProviderName,
+	modelPresetID modelpresetSpec.ModelPresetID,
+	estimate int64,
+) (*quotaReservation, error) {
+	if q == nil {
+		return nil, nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	scopes := []quotaScope{{provider: provider}}
+	if modelPresetID != "" {
+		scopes = append(scopes, quotaScope{provider, modelPresetID})
+	}
+	held := make([]quotaScope, 0, len(scopes))
+	for _, scope := range scopes {
+		tq, ok := q.quotas[scope]
+		if !ok {
+			continue
+		}
+		q.rollOverLocked(tq)
+		if err := q.checkLocked(tq, q.reserved[scope], estimate); err != nil {
+			return nil, err
+		}
+		held = append(held, scope)
+	}
+	if len(held) == 0 {
+		return nil, nil
+	}
+	for _, scope := range held {
+		q.reserved[scope] += estimate
+	}
+	return &quotaReservation{q: q, scopes: held, estimate: estimate}, nil
+}
+
+func (q *quotaLedger) checkLocked(tq *spec.TokenQuota, reserved, estimate int64) error {
+	now := q.now().UTC()
+	periods := []struct {
+		period   spec.TokenQuotaPeriod
+		limit    int64
+		used     int64
+		resetsAt time.Time
+	}{
+		{
+			spec.TokenQuotaPeriodDaily, tq.Limits.DailyTokens, tq.DailyUsedTokens,
+			time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			spec.TokenQuotaPeriodMonthly, tq.Limits.MonthlyTokens, tq.MonthlyUsedTokens,
+			time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, p := range periods {
+		if p.limit > 0 && p.used+reserved+estimate > p.limit {
+			return &spec.TokenQuotaExceededError{
+				Provider:        tq.Provider,
+				ModelPresetID:   tq.ModelPresetID,
+				Period:          p.period,
+				LimitTokens:     p.limit,
+				UsedTokens:      p.used + reserved,
+				RequestedTokens: estimate,
+				ResetsAt:        p.resetsAt,
+			}
+		}
+	}
+	return nil
+}
+
+// rollOverLocked resets the counters of a quota whose day or month has passed.
+func (q *quotaLedger) rollOverLocked(tq *spec.TokenQuota) {
+	now := q.now().UTC()
+	if day := now.Format(time.DateOnly); tq.Day != day {
+		tq.Day = day
+		tq.DailyUsedTokens = 0
+	}
+	if month := now.Format("2006-01"); tq.Month != month {
+		tq.Month = month
+		tq.MonthlyUsedTokens = 0
+	}
+}
+
+func (q *quotaLedger) saveLocked() error {
+	all := tokenQuotasSchema{
+		SchemaVersion: tokenQuotasSchemaVersion,
+		Quotas:        make([]spec.TokenQuota, 0, len(q.quotas)),
+	}
+	for _, tq := range q.quotas {
+		all.Quotas = append(all.Quotas, *tq)
+	}
+	return q.store.save(all)
+}
+
+// quotaReservation holds the estimate of one completion against its quotas.
+type quotaReservation struct {
+	q        *quotaLedger
+	scopes   []quotaScope
+	estimate int64
+}
+
+// settle releases the reservation and debits the tokens reported in usage. Without usage (e.g. the call failed)
+// nothing is debited. Quotas deleted in the meantime are skipped.
+func (r *quotaReservation) settle(usage *inferencegoSpec.Usage) error {
+	if r == nil {
+		return nil
+	}
+	var used int64
+	if usage != nil {
+		used = usage.InputTokensTotal + usage.OutputTokens
+	}
+	q := r.q
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, scope := range r.scopes {
+		if q.reserved[scope] -= r.estimate; q.reserved[scope] <= 0 {
+			delete(q.reserved, scope)
+		}
+		tq, ok := q.quotas[scope]
+		if !ok || used == 0 {
+			continue
+		}
+		q.rollOverLocked(tq)
+		tq.DailyUsedTokens += used
+		tq.MonthlyUsedTokens += used
+		tq.ModifiedAt = q.now().UTC()
+	}
+	if used == 0 {
+		return nil
+	}
+	return q.saveLocked()
+}
@@ -0,0 +1,134 @@
+package inferencewrapper
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+)
+
+func newTestQuotaLedger(t *testing.T, dir string, now *time.Time) *quotaLedger {
+	t.Helper()
+	q := &quotaLedger{dir: dir, now: func() time.Time { return *now }}
+	if err := q.init(slog.Default()); err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestQuotaLedger(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC)
+	q := newTestQuotaLedger(t, dir, &now)
+
+	if err := q.set("p", "", spec.TokenQuotaLimits{DailyTokens: 1000, MonthlyTokens: 1500}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.set("p", "small", spec.TokenQuotaLimits{DailyTokens: 300}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a quota for the scope nothing is reserved.
+	if r, err := q.reserve("other", "", 1_000_000); r != nil || err != nil {
+		t.Fatalf("unlimited provider: %v, %v", r, err)
+	}
+
+	r1, err := q.reserve("p", "small", 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The in-flight reservation counts against the preset quota.
+	var qErr *spec.TokenQuotaExceededError
+	if _, err := q.reserve("p", "small", 200); !errors.As(err, &qErr) ||
+		!errors.Is(err, spec.ErrTokenQuotaExceeded) {
+		t.Fatalf("expected preset quota error, got %v", err)
+	}
+	if qErr.ModelPresetID != "small" || qErr.Period != spec.TokenQuotaPeriodDaily || qErr.UsedTokens != 200 ||
+		!qErr.ResetsAt.Equal(time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("quota error = %+v", qErr)
+	}
+	if err := r1.settle(&inferencegoSpec.Usage{InputTokensTotal: 100, OutputTokens: 50}); err != nil {
+		t.Fatal(err)
+	}
+	r2, err := q.reserve("p", "", 800)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r2.settle(&inferencegoSpec.Usage{InputTokensTotal: 700, OutputTokens: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.reserve("p", "", 100); !errors.As(err, &qErr) || qErr.Period != spec.TokenQuotaPeriodDaily {
+		t.Fatalf("expected daily provider quota error, got %v", err)
+	}
+
+	// Counters survive a restart and roll over with the day, but not the month.
+	now = now.Add(2 * time.Hour)
+	q = newTestQuotaLedger(t, dir, &now)
+	got := q.list()
+	if len(got) != 2 || got[0].ModelPresetID != "" || got[0].DailyUsedTokens != 0 || got[0].MonthlyUsedTokens != 950 ||
+		got[1].ModelPresetID != "small" || got[1].Day != "2026-10-20" {
+		t.Fatalf("quotas after restart = %+v", got)
+	}
+	if _, err := q.reserve("p", "", 600); !errors.As(err, &qErr) || qErr.Period != spec.TokenQuotaPeriodMonthly {
+		t.Fatalf("expected monthly quota error, got %v", err)
+	}
+
+	if err := q.delete("p", ""); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := q.reserve("p", "", 600); r != nil || err != nil {
+		t.Errorf("deleted quota still applies: %v, %v", r, err)
+	}
+}
+
+func TestQuotaModelPresetID(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	q := newTestQuotaLedger(t, t.TempDir(), &now)
+	if err := q.set("p", "small", spec.TokenQuotaLimits{DailyTokens: 300}); err != nil {
+		t.Fatal(err)
+	}
+	ps := &ProviderSetAPI{logger: slog.Default(), quotas: q}
+
+	if _, err := ps.quotaModelPresetID(t.Context(), "p", "small", "m-small"); err == nil {
+		t.Error("expected error without a model preset store")
+	}
+	ps.SetModelPresetLister(&fakePresetLister{providers: []modelpresetSpec.ProviderPreset{{
+		Name: "p",
+		ModelPresets: map[modelpresetSpec.ModelPresetID]modelpresetSpec.ModelPreset{
+			"small": {ID: "small", Name: "m-small"},
+			"big":   {ID: "big", Name: "m-big"},
+			"dup1":  {ID: "dup1", Name: "m-dup"},
+			"dup2":  {ID: "dup2", Name: "m-dup"},
+		},
+	}}})
+
+	tests := []struct {
+		name      string
+		provider  inferencegoSpec.ProviderName
+		requested modelpresetSpec.ModelPresetID
+		model     inferencegoSpec.ModelName
+		want      modelpresetSpec.ModelPresetID
+		wantErr   bool
+	}{
+		{name: "NoPresetQuotas", provider: "other", requested: "small", model: "m-big"},
+		{name: "RequestedMatches", provider: "p", requested: "small", model: "m-small", want: "small"},
+		{name: "RequestedOtherModel", provider: "p", requested: "small", model: "m-big", want: "big"},
+		{name: "Derived", provider: "p", model: "m-small", want: "small"},
+		{name: "SharedModel", provider: "p", requested: "dup2", model: "m-dup", want: "dup2"},
+		{name: "Ambiguous", provider: "p", model: "m-dup", wantErr: true},
+		{name: "Unknown", provider: "p", requested: "small", model: "m-new", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ps.quotaModelPresetID(t.Context(), tc.provider, tc.requested, tc.model)
+			if (err != nil) != tc.wantErr || got != tc.want {
+				t.Errorf("got %q, %v; want %q, error %v", got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
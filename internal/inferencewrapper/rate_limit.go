@@ -0,0 +1,163 @@
+package inferencewrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+	"github.com/flexigpt/flexigpt-app/internal/ratelimit"
+)
+
+// SetProviderRateLimits replaces the rate limits of a provider. Calls already queued are re-evaluated against the new
+// limits.
+func (ps *ProviderSetAPI) SetProviderRateLimits(
+	ctx context.Context,
+	req *spec.SetProviderRateLimitsRequest,
+) (*spec.SetProviderRateLimitsResponse, error) {
+	if req == nil || req.Body == nil || req.Provider == "" {
+		return nil, errors.New("invalid params")
+	}
+	if err := validateRateLimits(req.Body.RateLimits); err != nil {
+		return nil, err
+	}
+	// Replay providers are never rate limited; in record mode the upstream provider's limits apply.
+	ps.providersMu.RLock()
+	_, ok := ps.providers[req.Provider]
+	ps.providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("provider %q is not configured", req.Provider)
+	}
+	ps.setRateLimits(req.Provider, req.Body.RateLimits)
+	ps.logger.Info("setProviderRateLimits", "name", req.Provider)
+	return &spec.SetProviderRateLimitsResponse{}, nil
+}
+
+// ListProviderQueueStats returns the queue state of every rate limited provider, sorted by provider name.
+func (ps *ProviderSetAPI) ListProviderQueueStats(
+	ctx context.Context,
+	req *spec.ListProviderQueueStatsRequest,
+) (*spec.ListProviderQueueStatsResponse, error) {
+	ps.providersMu.RLock()
+	limiters := make(map[inferencegoSpec.ProviderName]*ratelimit.Limiter, len(ps.limiters))
+	for name, l := range ps.limiters {
+		limiters[name] = l
+	}
+	ps.providersMu.RUnlock()
+
+	queues := make([]spec.ProviderQueueStats, 0, len(limiters))
+	for name, l := range limiters {
+		cfg := l.Config()
+		s := l.Stats()
+		q := spec.ProviderQueueStats{
+			Provider: name,
+			RateLimits: modelpresetSpec.ProviderRateLimits{
+				RequestsPerMinute: cfg.RequestsPerMinute,
+				TokensPerMinute:   cfg.TokensPerMinute,
+				MaxConcurrency:    cfg.MaxConcurrency,
+			},
+			InFlight:      s.InFlight,
+			QueueDepth:    s.QueueDepth,
+			AdmittedCount: s.Admitted,
+			LastWaitMs:    s.LastWait.Milliseconds(),
+			MaxWaitMs:     s.MaxWait.Milliseconds(),
+		}
+		if s.Admitted > 0 {
+			q.AvgWaitMs = s.TotalWait.Milliseconds() / s.Admitted
+		}
+		if !s.PausedUntil.IsZero() {
+			t := s.PausedUntil.UTC()
+			q.PausedUntil = &t
+		}
+		queues = append(queues, q)
+	}
+	slices.SortFunc(queues, func(a, b spec.ProviderQueueStats) int {
+		return strings.Compare(string(a.Provider), string(b.Provider))
+	})
+	return &spec.ListProviderQueueStatsResponse{
+		Body: &spec.ListProviderQueueStatsResponseBody{Queues: queues},
+	}, nil
+}
+
+// setRateLimits installs, updates or removes the limiter of a provider. An existing limiter is updated in place so
+// that queued and in-flight calls keep their accounting.
+func (ps *ProviderSetAPI) setRateLimits(
+	provider inferencegoSpec.ProviderName,
+	rl *modelpresetSpec.ProviderRateLimits,
+) {
+	ps.providersMu.Lock()
+	defer ps.providersMu.Unlock()
+	if rl == nil || *rl == (modelpresetSpec.ProviderRateLimits{}) {
+		delete(ps.limiters, provider)
+		return
+	}
+	cfg := ratelimit.Config{
+		RequestsPerMinute: rl.RequestsPerMinute,
+		TokensPerMinute:   rl.TokensPerMinute,
+		MaxConcurrency:    rl.MaxConcurrency,
+	}
+	if l, ok := ps.limiters[provider]; ok {
+		l.SetConfig(cfg)
+		return
+	}
+	ps.limiters[provider] = ratelimit.NewLimiter(cfg)
+}
+
+func (ps *ProviderSetAPI) getLimiter(provider inferencegoSpec.ProviderName) *ratelimit.Limiter {
+	ps.providersMu.RLock()
+	defer ps.providersMu.RUnlock()
+	return ps.limiters[provider]
+}
+
+// fetchUpstream calls inference-go, waiting for the provider's limiter first. Token usage is estimated from the
+// request and corrected with the reported usage once the call is done. A retry-after from the provider pauses the
+// queue.
+func (ps *ProviderSetAPI) fetchUpstream(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	infReq *inferencegoSpec.FetchCompletionRequest,
+	opts *inferencegoSpec.FetchCompletionOptions,
+) (*inferencegoSpec.FetchCompletionResponse, error) {
+	l := ps.getLimiter(provider)
+	if l == nil {
+		ps.completions.setStatus(ctx, spec.CompletionStatusRunning)
+		return ps.inner.FetchCompletion(ctx, provider, infReq, opts)
+	}
+
+	_, estimate := estimateRequestTokens(infReq)
+	estimate += infReq.ModelParam.MaxOutputLength
+	ps.completions.setStatus(ctx, spec.CompletionStatusQueued)
+	ticket, err := l.Acquire(ctx, estimate)
+	if err != nil {
+		return nil, err
+	}
+	ps.completions.setStatus(ctx, spec.CompletionStatusRunning)
+
+	resp, err := ps.inner.FetchCompletion(ctx, provider, infReq, opts)
+
+	used := 0
+	if resp != nil && resp.Usage != nil {
+		used = int(resp.Usage.InputTokensTotal + resp.Usage.OutputTokens)
+	}
+	ticket.Release(used)
+	if d, ok := ratelimit.RetryAfterFromError(err); ok {
+		ps.logger.Warn("provider asked to retry later, pausing queue", "name", provider, "retryAfter", d)
+		l.PauseFor(d)
+	}
+	return resp, err
+}
+
+func validateRateLimits(rl *modelpresetSpec.ProviderRateLimits) error {
+	if rl == nil {
+		return nil
+	}
+	if rl.RequestsPerMinute < 0 || rl.TokensPerMinute < 0 || rl.MaxConcurrency < 0 {
+		return errors.New("rateLimits must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package inferencewrapper
+
+import (
+	"strings"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+)
+
+// reasoningReplayPolicy returns the explicit policy, or the default for the provider's SDK type: providers that
+// accept their own signed or encrypted reasoning back keep it for the same model, the rest drop it.
+func (ps *ProviderSetAPI) reasoningReplayPolicy(
+	provider inferencegoSpec.ProviderName,
+	policy modelpresetSpec.ReasoningReplayPolicy,
+) modelpresetSpec.ReasoningReplayPolicy {
+	if policy != "" {
+		return policy
+	}
+	switch ps.providerSDKType(provider) {
+	case inferencegoSpec.ProviderSDKTypeAnthropic, inferencegoSpec.ProviderSDKTypeOpenAIResponses:
+		return modelpresetSpec.ReasoningReplaySameModel
+	default:
+		return modelpresetSpec.ReasoningReplayDrop
+	}
+}
+
+// reasoningReplay applies a reasoning replay policy while history turns are flattened into inputs.
+type reasoningReplay struct {
+	policy    modelpresetSpec.ReasoningReplayPolicy
+	provider  inferencegoSpec.ProviderName
+	modelName inferencegoSpec.ModelName
+
+	// Provider and model of the current history turn, carried over from earlier turns when unset.
+	turnProvider  inferencegoSpec.ProviderName
+	turnModelName inferencegoSpec.ModelName
+}
+
+func newReasoningReplay(
+	policy modelpresetSpec.ReasoningReplayPolicy,
+	provider inferencegoSpec.ProviderName,
+	modelName inferencegoSpec.ModelName,
+) *reasoningReplay {
+	return &reasoningReplay{policy: policy, provider: provider, modelName: modelName}
+}
+
+func (r *reasoningReplay) observeTurn(turn *conversationSpec.ConversationMessage) {
+	if turn.Provider != "" {
+		r.turnProvider = turn.Provider
+	}
+	if turn.ModelParam != nil && turn.ModelParam.Name != "" {
+		r.turnModelName = turn.ModelParam.Name
+	}
+}
+
+// reasoningInput converts a stored reasoning output of the current history turn, or returns nil to drop it.
+//
+// Under ReasoningReplaySameModel, a turn without a recorded provider (older conversations) is matched on the model
+// name alone.
+func (r *reasoningReplay) reasoningInput(rm *inferencegoSpec.ReasoningContent) *inferencegoSpec.InputUnion {
+	if rm == nil {
+		return nil
+	}
+	switch r.policy {
+	case modelpresetSpec.ReasoningReplaySameModel:
+		if r.turnModelName != r.modelName || (r.turnProvider != "" && r.turnProvider != r.provider) {
+			return nil
+		}
+		return &inferencegoSpec.InputUnion{
+			Kind:             inferencegoSpec.InputKindReasoningMessage,
+			ReasoningMessage: rm,
+		}
+	case modelpresetSpec.ReasoningReplayText:
+		return reasoningAsText(rm)
+	default:
+		return nil
+	}
+}
+
+// reasoningAsText replays the readable parts of a reasoning output as assistant text. Redacted and encrypted
+// parts are dropped, as is reasoning without readable parts.
+func reasoningAsText(rm *inferencegoSpec.ReasoningContent) *inferencegoSpec.InputUnion {
+	parts := make([]string, 0, len(rm.Summary)+len(rm.Thinking))
+	for _, p := range append(append([]string{}, rm.Summary...), rm.Thinking...) {
+		if strings.TrimSpace(p) != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return &inferencegoSpec.InputUnion{
+		Kind: inferencegoSpec.InputKindOutputMessage,
+		OutputMessage: &inferencegoSpec.InputOutputContent{
+			Role:   inferencegoSpec.RoleAssistant,
+			Status: rm.Status,
+			Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+				Kind:     inferencegoSpec.ContentItemKindText,
+				TextItem: &inferencegoSpec.ContentItemText{Text: strings.Join(parts, "\n\n")},
+			}},
+		},
+	}
+}
@@ -0,0 +1,134 @@
+package inferencewrapper
+
+import (
+	"testing"
+
+	"github.com/flexigpt/inference-go"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+)
+
+func TestBuildInputsReasoningReplay(t *testing.T) {
+	ps := &ProviderSetAPI{providers: map[inferencegoSpec.ProviderName]inference.AddProviderConfig{
+		"anthropic": {SDKType: inferencegoSpec.ProviderSDKTypeAnthropic},
+		"openai":    {SDKType: inferencegoSpec.ProviderSDKTypeOpenAIChatCompletions},
+	}}
+	reasoningTurn := func(provider inferencegoSpec.ProviderName, model inferencegoSpec.ModelName, thinking string) conversationSpec.ConversationMessage {
+		return conversationSpec.ConversationMessage{
+			Role:       inferencegoSpec.RoleAssistant,
+			Provider:   provider,
+			ModelParam: &inferencegoSpec.ModelParam{Name: model},
+			Outputs: []inferencegoSpec.OutputUnion{{
+				Kind: inferencegoSpec.OutputKindReasoningMessage,
+				ReasoningMessage: &inferencegoSpec.ReasoningContent{
+					Thinking: []string{thinking}, Signature: "sig", EncryptedContent: []string{"enc"},
+				},
+			}},
+		}
+	}
+	history := []conversationSpec.ConversationMessage{
+		reasoningTurn("anthropic", "claude", "from claude"),
+		reasoningTurn("openai", "gpt", "from gpt"),
+		// Provider and model are carried over from the previous turn.
+		{Role: inferencegoSpec.RoleAssistant, Outputs: []inferencegoSpec.OutputUnion{{
+			Kind:             inferencegoSpec.OutputKindReasoningMessage,
+			ReasoningMessage: &inferencegoSpec.ReasoningContent{Summary: []string{"gpt summary"}},
+		}}},
+	}
+	current := conversationSpec.ConversationMessage{
+		Role: inferencegoSpec.RoleUser,
+		Inputs: []inferencegoSpec.InputUnion{{
+			Kind:         inferencegoSpec.InputKindInputMessage,
+			InputMessage: &inferencegoSpec.InputOutputContent{Role: inferencegoSpec.RoleUser},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		provider inferencegoSpec.ProviderName
+		model    inferencegoSpec.ModelName
+		policy   modelpresetSpec.ReasoningReplayPolicy
+		want     []inferencegoSpec.InputKind
+		wantText string
+	}{
+		{
+			name: "AutoAnthropicKeepsSameModel", provider: "anthropic", model: "claude",
+			want: []inferencegoSpec.InputKind{inferencegoSpec.InputKindReasoningMessage},
+		},
+		{
+			name: "AutoChatCompletionsDrops", provider: "openai", model: "gpt",
+		},
+		{
+			name: "SameModelOtherModelDrops", provider: "anthropic", model: "claude-2",
+			policy: modelpresetSpec.ReasoningReplaySameModel,
+		},
+		{
+			name: "SameModelCarriesOver", provider: "openai", model: "gpt",
+			policy: modelpresetSpec.ReasoningReplaySameModel,
+			want: []inferencegoSpec.InputKind{
+				inferencegoSpec.InputKindReasoningMessage, inferencegoSpec.InputKindReasoningMessage,
+			},
+		},
+		{
+			name: "Text", provider: "anthropic", model: "claude", policy: modelpresetSpec.ReasoningReplayText,
+			want: []inferencegoSpec.InputKind{
+				inferencegoSpec.InputKindOutputMessage,
+				inferencegoSpec.InputKindOutputMessage,
+				inferencegoSpec.InputKindOutputMessage,
+			},
+			wantText: "from claude",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body := &spec.CompletionRequestBody{History: history, Current: current, ReasoningReplay: tc.policy}
+			all, cur, err := ps.buildInputs(t.Context(), tc.provider, tc.model, body, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			replayed := all[:len(all)-len(cur)]
+			if len(replayed) != len(tc.want) {
+				t.Fatalf("replayed %d inputs, want %d: %+v", len(replayed), len(tc.want), replayed)
+			}
+			for i, in := range replayed {
+				if in.Kind != tc.want[i] {
+					t.Errorf("input %d kind = %s, want %s", i, in.Kind, tc.want[i])
+				}
+			}
+			if tc.wantText != "" {
+				if got := replayed[0].OutputMessage.Contents[0].TextItem.Text; got != tc.wantText {
+					t.Errorf("text = %q, want %q", got, tc.wantText)
+				}
+			}
+		})
+	}
+
+	t.Run("PresetPolicy", func(t *testing.T) {
+		withPresets := &ProviderSetAPI{
+			providers: ps.providers,
+			presets: &fakePresetLister{providers: []modelpresetSpec.ProviderPreset{{
+				Name: "openai",
+				ModelPresets: map[modelpresetSpec.ModelPresetID]modelpresetSpec.ModelPreset{
+					"gpt-text": {ID: "gpt-text", Name: "gpt", ReasoningReplay: modelpresetSpec.ReasoningReplayText},
+				},
+			}}},
+		}
+		for _, policy := range []modelpresetSpec.ReasoningReplayPolicy{"", modelpresetSpec.ReasoningReplayDrop} {
+			body := &spec.CompletionRequestBody{History: history, Current: current, ReasoningReplay: policy}
+			all, cur, err := withPresets.buildInputs(t.Context(), "openai", "gpt", body, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 3
+			if policy != "" {
+				want = 0
+			}
+			if replayed := all[:len(all)-len(cur)]; len(replayed) != want {
+				t.Errorf("policy %q: replayed %d inputs, want %d", policy, len(replayed), want)
+			}
+		}
+	})
+}
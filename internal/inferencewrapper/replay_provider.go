@@ -0,0 +1,298 @@
+package inferencewrapper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+var ErrReplayFixtureNotFound = errors.New("no replay fixture for request")
+
+// replayProvider records completions of an upstream provider to fixture files, or serves them back.
+//
+// Fixtures are keyed by a hash of the normalized FetchCompletionRequest. In replay mode a request without a recorded
+// fixture is served from the next unused step of the optional script file.
+type replayProvider struct {
+	cfg spec.ReplayProviderConfig
+
+	mu         sync.Mutex
+	scriptNext int
+}
+
+func newReplayProvider(
+	name inferencegoSpec.ProviderName,
+	cfg *spec.ReplayProviderConfig,
+) (*replayProvider, error) {
+	if cfg == nil {
+		return nil, errors.New("replay provider requires replay config")
+	}
+	dir := strings.TrimSpace(cfg.FixtureDir)
+	if dir == "" {
+		return nil, errors.New("replay provider requires a fixture directory")
+	}
+	switch cfg.Mode {
+	case spec.ReplayModeRecord:
+		if cfg.UpstreamProvider == "" {
+			return nil, errors.New("record mode requires an upstream provider")
+		}
+		if cfg.UpstreamProvider == name {
+			return nil, errors.New("replay provider cannot record itself")
+		}
+		if err := os.MkdirAll(dir, os.FileMode(0o770)); err != nil {
+			return nil, err
+		}
+	case spec.ReplayModeReplay:
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("fixture path %q is not a directory", dir)
+		}
+	default:
+		return nil, fmt.Errorf("invalid replay mode %q", cfg.Mode)
+	}
+
+	c := *cfg
+	c.FixtureDir = dir
+	return &replayProvider{cfg: c}, nil
+}
+
+// upstreamFetchFunc forwards a request to a real provider.
+type upstreamFetchFunc func(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	req *inferencegoSpec.FetchCompletionRequest,
+	opts *inferencegoSpec.FetchCompletionOptions,
+) (*inferencegoSpec.FetchCompletionResponse, error)
+
+// fetchCompletion serves the request according to the provider mode. upstream is used only in record mode.
+func (rp *replayProvider) fetchCompletion(
+	ctx context.Context,
+	upstream upstreamFetchFunc,
+	req *inferencegoSpec.FetchCompletionRequest,
+	onText func(string) error,
+	onThinking func(string) error,
+) (*inferencegoSpec.FetchCompletionResponse, error) {
+	hash, err := replayRequestHash(req)
+	if err != nil {
+		return nil, err
+	}
+	if rp.cfg.Mode == spec.ReplayModeRecord {
+		return rp.record(ctx, upstream, hash, req, onText, onThinking)
+	}
+	return rp.replay(ctx, hash, onText, onThinking)
+}
+
+func (rp *replayProvider) record(
+	ctx context.Context,
+	upstream upstreamFetchFunc,
+	hash string,
+	req *inferencegoSpec.FetchCompletionRequest,
+	onText func(string) error,
+	onThinking func(string) error,
+) (*inferencegoSpec.FetchCompletionResponse, error) {
+	fixture := spec.ReplayFixture{
+		SchemaVersion: spec.ReplayFixtureSchemaVersion,
+		RequestHash:   hash,
+		// Fixtures keep the digests of inline attachments, not the data.
+		Request: digestInlineData(req),
+	}
+
+	var chunksMu sync.Mutex
+	capture := func(kind spec.ReplayStreamChunkKind, next func(string) error) func(string) error {
+		return func(text string) error {
+			chunksMu.Lock()
+			fixture.StreamChunks = append(fixture.StreamChunks, spec.ReplayStreamChunk{Kind: kind, Text: text})
+			chunksMu.Unlock()
+			if next != nil {
+				return next(text)
+			}
+			return nil
+		}
+	}
+	opts := &inferencegoSpec.FetchCompletionOptions{
+		StreamHandler: makeStreamHandler(
+			capture(spec.ReplayStreamChunkKindText, onText),
+			capture(spec.ReplayStreamChunkKindThinking, onThinking),
+		),
+	}
+
+	resp, callErr := upstream(ctx, rp.cfg.UpstreamProvider, req, opts)
+	fixture.Response = resp
+	if callErr != nil {
+		fixture.Error = callErr.Error()
+	}
+
+	// A cancelled call is not a useful fixture.
+	if ctx.Err() == nil {
+		if err := rp.writeFixture(&fixture); err != nil {
+			return resp, errors.Join(callErr, err)
+		}
+	}
+	return resp, callErr
+}
+
+func (rp *replayProvider) replay(
+	ctx context.Context,
+	hash string,
+	onText func(string) error,
+	onThinking func(string) error,
+) (*inferencegoSpec.FetchCompletionResponse, error) {
+	fixture, err := rp.readFixture(hash)
+	if errors.Is(err, os.ErrNotExist) {
+		fixture, err = rp.nextScriptStep()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fixture == nil {
+		return nil, fmt.Errorf("%w: hash %s", ErrReplayFixtureNotFound, hash)
+	}
+
+	for _, c := range fixture.StreamChunks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var cb func(string) error
+		switch c.Kind {
+		case spec.ReplayStreamChunkKindText:
+			cb = onText
+		case spec.ReplayStreamChunkKindThinking:
+			cb = onThinking
+		default:
+		}
+		if cb == nil {
+			continue
+		}
+		if err := cb(c.Text); err != nil {
+			return nil, err
+		}
+	}
+
+	if fixture.Error != "" {
+		return fixture.Response, errors.New(fixture.Error)
+	}
+	return fixture.Response, nil
+}
+
+func (rp *replayProvider) fixturePath(hash string) string {
+	return filepath.Join(rp.cfg.FixtureDir, hash+spec.ReplayFixtureFileExtension)
+}
+
+func (rp *replayProvider) readFixture(hash string) (*spec.ReplayFixture, error) {
+	b, err := os.ReadFile(rp.fixturePath(hash))
+	if err != nil {
+		return nil, err
+	}
+	var f spec.ReplayFixture
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("invalid replay fixture %s: %w", hash, err)
+	}
+	return &f, nil
+}
+
+func (rp *replayProvider) writeFixture(f *spec.ReplayFixture) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := rp.fixturePath(f.RequestHash)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// nextScriptStep returns the next unused scripted fixture, or nil if there is no script or it is exhausted.
+func (rp *replayProvider) nextScriptStep() (*spec.ReplayFixture, error) {
+	b, err := os.ReadFile(filepath.Join(rp.cfg.FixtureDir, spec.ReplayScriptFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var script spec.ReplayScript
+	if err := json.Unmarshal(b, &script); err != nil {
+		return nil, fmt.Errorf("invalid replay script: %w", err)
+	}
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.scriptNext >= len(script.Steps) {
+		return nil, nil
+	}
+	step := script.Steps[rp.scriptNext]
+	rp.scriptNext++
+	return &step, nil
+}
+
+// replayRequestHash is a stable hash of the normalized request. Streaming does not change the recorded answer, so it
+// is excluded to let the same fixture serve both modes. Inline attachment data is hashed by its digest.
+func replayRequestHash(req *inferencegoSpec.FetchCompletionRequest) (string, error) {
+	if req == nil {
+		return "", errors.New("nil request")
+	}
+	r := digestInlineData(req)
+	r.ModelParam.Stream = false
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// digestInlineData returns a copy of req whose inline image and file data is replaced by a "sha256:<hex>" digest.
+// The messages of req are not modified.
+func digestInlineData(req *inferencegoSpec.FetchCompletionRequest) *inferencegoSpec.FetchCompletionRequest {
+	r := *req
+	r.Inputs = slices.Clone(req.Inputs)
+	for i := range r.Inputs {
+		in := &r.Inputs[i]
+		in.InputMessage = digestMessageData(in.InputMessage)
+		in.OutputMessage = digestMessageData(in.OutputMessage)
+	}
+	return &r
+}
+
+func digestMessageData(msg *inferencegoSpec.InputOutputContent) *inferencegoSpec.InputOutputContent {
+	if msg == nil {
+		return nil
+	}
+	m := *msg
+	m.Contents = slices.Clone(msg.Contents)
+	for i := range m.Contents {
+		item := &m.Contents[i]
+		if item.ImageItem != nil && item.ImageItem.ImageData != "" {
+			img := *item.ImageItem
+			img.ImageData = dataDigest(img.ImageData)
+			item.ImageItem = &img
+		}
+		if item.FileItem != nil && item.FileItem.FileData != "" {
+			file := *item.FileItem
+			file.FileData = dataDigest(file.FileData)
+			item.FileItem = &file
+		}
+	}
+	return &m
+}
+
+func dataDigest(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
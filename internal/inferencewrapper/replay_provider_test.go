@@ -0,0 +1,161 @@
+package inferencewrapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/responseutil"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+func newReplayRequest(text, imageData string) *inferencegoSpec.FetchCompletionRequest {
+	return &inferencegoSpec.FetchCompletionRequest{
+		ModelParam: inferencegoSpec.ModelParam{Name: "m"},
+		Inputs: []inferencegoSpec.InputUnion{{
+			Kind: inferencegoSpec.InputKindInputMessage,
+			InputMessage: &inferencegoSpec.InputOutputContent{
+				Role: inferencegoSpec.RoleUser,
+				Contents: []inferencegoSpec.InputOutputContentItemUnion{
+					{Kind: inferencegoSpec.ContentItemKindText, TextItem: &inferencegoSpec.ContentItemText{Text: text}},
+					{Kind: inferencegoSpec.ContentItemKindImage, ImageItem: &inferencegoSpec.ContentItemImage{
+						ImageName: "a.png",
+						ImageData: imageData,
+					}},
+				},
+			},
+		}},
+	}
+}
+
+func TestReplayProviderRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := newReplayProvider("rec", &spec.ReplayProviderConfig{
+		Mode: spec.ReplayModeRecord, FixtureDir: dir, UpstreamProvider: "real",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstreamCalls := 0
+	upstream := func(
+		_ context.Context,
+		provider inferencegoSpec.ProviderName,
+		req *inferencegoSpec.FetchCompletionRequest,
+		_ *inferencegoSpec.FetchCompletionOptions,
+	) (*inferencegoSpec.FetchCompletionResponse, error) {
+		upstreamCalls++
+		if provider != "real" {
+			t.Errorf("upstream provider = %q", provider)
+		}
+		if got := req.Inputs[0].InputMessage.Contents[1].ImageItem.ImageData; got != "aW1hZ2U=" {
+			t.Errorf("upstream got image data %q", got)
+		}
+		return &inferencegoSpec.FetchCompletionResponse{Outputs: []inferencegoSpec.OutputUnion{{
+			Kind: inferencegoSpec.OutputKindOutputMessage,
+			OutputMessage: &inferencegoSpec.InputOutputContent{
+				Role: inferencegoSpec.RoleAssistant,
+				Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+					Kind:     inferencegoSpec.ContentItemKindText,
+					TextItem: &inferencegoSpec.ContentItemText{Text: "recorded answer"},
+				}},
+			},
+		}}}, nil
+	}
+
+	req := newReplayRequest("hi", "aW1hZ2U=")
+	resp, err := recorder.fetchCompletion(t.Context(), upstream, req, nil, nil)
+	if err != nil || responseutil.OutputText(resp) != "recorded answer" || upstreamCalls != 1 {
+		t.Fatalf("record = %q, %v (%d upstream calls)", responseutil.OutputText(resp), err, upstreamCalls)
+	}
+	if got := req.Inputs[0].InputMessage.Contents[1].ImageItem.ImageData; got != "aW1hZ2U=" {
+		t.Errorf("request image data was modified: %q", got)
+	}
+
+	hash, err := replayRequestHash(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, hash+spec.ReplayFixtureFileExtension))
+	if err != nil {
+		t.Fatalf("fixture not written: %v", err)
+	}
+	if strings.Contains(string(raw), "aW1hZ2U=") || !strings.Contains(string(raw), dataDigest("aW1hZ2U=")) {
+		t.Error("fixture stores inline attachment data instead of its digest")
+	}
+
+	player, err := newReplayProvider("play", &spec.ReplayProviderConfig{Mode: spec.ReplayModeReplay, FixtureDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed := newReplayRequest("hi", "aW1hZ2U=")
+	streamed.ModelParam.Stream = true
+	resp, err = player.fetchCompletion(t.Context(), nil, streamed, nil, nil)
+	if err != nil || responseutil.OutputText(resp) != "recorded answer" {
+		t.Fatalf("replay = %q, %v", responseutil.OutputText(resp), err)
+	}
+
+	for name, r := range map[string]*inferencegoSpec.FetchCompletionRequest{
+		"text":  newReplayRequest("hello", "aW1hZ2U="),
+		"image": newReplayRequest("hi", "b3RoZXI="),
+	} {
+		if _, err := player.fetchCompletion(t.Context(), nil, r, nil, nil); !errors.Is(err, ErrReplayFixtureNotFound) {
+			t.Errorf("%s mismatch: err = %v, want ErrReplayFixtureNotFound", name, err)
+		}
+	}
+}
+
+func TestReplayProviderScript(t *testing.T) {
+	dir := t.TempDir()
+	script := spec.ReplayScript{
+		SchemaVersion: spec.ReplayFixtureSchemaVersion,
+		Steps: []spec.ReplayFixture{
+			{
+				StreamChunks: []spec.ReplayStreamChunk{
+					{Kind: spec.ReplayStreamChunkKindThinking, Text: "plan"},
+					{Kind: spec.ReplayStreamChunkKindText, Text: "step "},
+					{Kind: spec.ReplayStreamChunkKindText, Text: "one"},
+				},
+				Response: &inferencegoSpec.FetchCompletionResponse{},
+			},
+			{Error: "scripted failure"},
+		},
+	}
+	b, err := json.Marshal(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, spec.ReplayScriptFileName), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rp, err := newReplayProvider("play", &spec.ReplayProviderConfig{Mode: spec.ReplayModeReplay, FixtureDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text, thinking strings.Builder
+	onText := func(s string) error { text.WriteString(s); return nil }
+	onThinking := func(s string) error { thinking.WriteString(s); return nil }
+
+	resp, err := rp.fetchCompletion(t.Context(), nil, newReplayRequest("a", ""), onText, onThinking)
+	if err != nil || resp == nil {
+		t.Fatalf("step 1 = %v, %v", resp, err)
+	}
+	if text.String() != "step one" || thinking.String() != "plan" {
+		t.Errorf("streamed text %q, thinking %q", text.String(), thinking.String())
+	}
+	if _, err := rp.fetchCompletion(t.Context(), nil, newReplayRequest("b", ""), nil, nil); err == nil ||
+		err.Error() != "scripted failure" {
+		t.Errorf("step 2 err = %v", err)
+	}
+	if _, err := rp.fetchCompletion(
+		t.Context(), nil, newReplayRequest("c", ""), nil, nil,
+	); !errors.Is(err, ErrReplayFixtureNotFound) {
+		t.Errorf("exhausted script err = %v, want ErrReplayFixtureNotFound", err)
+	}
+}
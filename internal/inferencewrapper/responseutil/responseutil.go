@@ -0,0 +1,44 @@
+// Package responseutil has helpers for reading inference-go completion responses.
+package responseutil
+
+import (
+	"strings"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+)
+
+// OutputText concatenates the text items of all output messages in a response.
+func OutputText(resp *inferencegoSpec.FetchCompletionResponse) string {
+	if resp == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, o := range resp.Outputs {
+		if o.Kind != inferencegoSpec.OutputKindOutputMessage || o.OutputMessage == nil {
+			continue
+		}
+		for _, c := range o.OutputMessage.Contents {
+			if c.Kind == inferencegoSpec.ContentItemKindText && c.TextItem != nil {
+				sb.WriteString(c.TextItem.Text)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// AddUsage accumulates u into total, allocating total on first use. u is never modified or retained.
+func AddUsage(total, u *inferencegoSpec.Usage) *inferencegoSpec.Usage {
+	if u == nil {
+		return total
+	}
+	if total == nil {
+		c := *u
+		return &c
+	}
+	total.InputTokensTotal += u.InputTokensTotal
+	total.InputTokensCached += u.InputTokensCached
+	total.InputTokensUncached += u.InputTokensUncached
+	total.OutputTokens += u.OutputTokens
+	total.ReasoningTokens += u.ReasoningTokens
+	return total
+}
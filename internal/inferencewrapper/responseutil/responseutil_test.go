@@ -0,0 +1,70 @@
+package responseutil
+
+import (
+	"testing"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+)
+
+func TestOutputText(t *testing.T) {
+	text := func(s string) inferencegoSpec.InputOutputContentItemUnion {
+		return inferencegoSpec.InputOutputContentItemUnion{
+			Kind:     inferencegoSpec.ContentItemKindText,
+			TextItem: &inferencegoSpec.ContentItemText{Text: s},
+		}
+	}
+	resp := &inferencegoSpec.FetchCompletionResponse{Outputs: []inferencegoSpec.OutputUnion{
+		{
+			Kind: inferencegoSpec.OutputKindOutputMessage,
+			OutputMessage: &inferencegoSpec.InputOutputContent{
+				Contents: []inferencegoSpec.InputOutputContentItemUnion{
+					text("Hello"),
+					{Kind: inferencegoSpec.ContentItemKindImage, ImageItem: &inferencegoSpec.ContentItemImage{}},
+					text(", "),
+				},
+			},
+		},
+		{
+			Kind:             inferencegoSpec.OutputKindReasoningMessage,
+			ReasoningMessage: &inferencegoSpec.ReasoningContent{},
+		},
+		{Kind: inferencegoSpec.OutputKindOutputMessage},
+		{
+			Kind: inferencegoSpec.OutputKindOutputMessage,
+			OutputMessage: &inferencegoSpec.InputOutputContent{
+				Contents: []inferencegoSpec.InputOutputContentItemUnion{text("world")},
+			},
+		},
+	}}
+
+	if got := OutputText(resp); got != "Hello, world" {
+		t.Errorf("OutputText = %q", got)
+	}
+	if got := OutputText(nil); got != "" {
+		t.Errorf("OutputText(nil) = %q", got)
+	}
+}
+
+func TestAddUsage(t *testing.T) {
+	first := &inferencegoSpec.Usage{InputTokensTotal: 10, InputTokensCached: 4, InputTokensUncached: 6, OutputTokens: 3}
+	second := &inferencegoSpec.Usage{InputTokensTotal: 5, InputTokensUncached: 5, OutputTokens: 2, ReasoningTokens: 1}
+
+	total := AddUsage(nil, nil)
+	if total != nil {
+		t.Fatalf("AddUsage(nil, nil) = %+v", total)
+	}
+	total = AddUsage(total, first)
+	if total == first {
+		t.Fatal("total aliases the first usage")
+	}
+	total = AddUsage(total, nil)
+	total = AddUsage(total, second)
+
+	if total.InputTokensTotal != 15 || total.InputTokensCached != 4 || total.InputTokensUncached != 11 ||
+		total.OutputTokens != 5 || total.ReasoningTokens != 1 {
+		t.Errorf("total = %+v", *total)
+	}
+	if first.InputTokensTotal != 10 || second.InputTokensTotal != 5 {
+		t.Error("inputs were modified")
+	}
+}
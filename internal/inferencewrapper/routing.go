@@ -0,0 +1,134 @@
+package inferencewrapper
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/attachment"
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+)
+
+// ModelRouteResolver resolves the model preset a request is routed to. It is implemented by the model preset store.
+type ModelRouteResolver interface {
+	ResolveModelRoute(
+		ctx context.Context,
+		req *modelpresetSpec.ResolveModelRouteRequest,
+	) (*modelpresetSpec.ResolveModelRouteResponse, error)
+}
+
+// SetModelRouter sets the resolver of requests with a route selection. The model preset store is created after the
+// provider set, so it is wired in separately instead of as an option.
+func (ps *ProviderSetAPI) SetModelRouter(r ModelRouteResolver) {
+	ps.providersMu.Lock()
+	defer ps.providersMu.Unlock()
+	ps.router = r
+}
+
+// applyRoute resolves the route selection of body, if any. It returns the routed provider and a copy of body that
+// uses the routed preset's model param. Without a route selection, provider and body are returned unchanged.
+func (ps *ProviderSetAPI) applyRoute(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	body *spec.CompletionRequestBody,
+) (inferencegoSpec.ProviderName, *spec.CompletionRequestBody, *modelpresetSpec.RouteDecision, error) {
+	if body.Route == nil {
+		return provider, body, nil, nil
+	}
+	ps.providersMu.RLock()
+	router := ps.router
+	ps.providersMu.RUnlock()
+	if router == nil {
+		return "", nil, nil, errors.New("request has a route selection but no model router is configured")
+	}
+
+	resp, err := router.ResolveModelRoute(ctx, &modelpresetSpec.ResolveModelRouteRequest{
+		RouterID: body.Route.RouterID,
+		Body:     routeSignals(body),
+	})
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if resp == nil || resp.Body == nil {
+		return "", nil, nil, errors.New("model router returned no decision")
+	}
+	d := resp.Body
+
+	routed := *body
+	mp := d.ModelPreset.ModelParam()
+	routed.ModelParam = &mp
+	routed.ModelPresetID = d.Target.ModelPresetID
+	if routed.ReasoningReplay == "" {
+		routed.ReasoningReplay = d.ModelPreset.ReasoningReplay
+	}
+	return d.Target.ProviderName, &routed, d, nil
+}
+
+// modelRoute is the route record stored on the assistant turn.
+func modelRoute(d *modelpresetSpec.RouteDecision) *conversationSpec.ModelRoute {
+	if d == nil {
+		return nil
+	}
+	return &conversationSpec.ModelRoute{
+		RouterID:      string(d.RouterID),
+		ProviderName:  d.Target.ProviderName,
+		ModelPresetID: string(d.Target.ModelPresetID),
+		RuleName:      d.RuleName,
+		Explanation:   d.Explanation,
+	}
+}
+
+// routeSignals derives the routing signals of a request. Prompt tokens are estimated over history and current turn
+// like in previews; attachments are not hydrated yet, so only images are counted, with their flat estimate.
+func routeSignals(body *spec.CompletionRequestBody) *modelpresetSpec.RouteSignals {
+	sig := &modelpresetSpec.RouteSignals{
+		ToolsEnabled: len(body.ToolStoreChoices) > 0,
+	}
+	if body.Route != nil {
+		sig.CostTier = body.Route.CostTier
+	}
+
+	for i := range body.History {
+		sig.EstimatedPromptTokens += estimateMessageTokens(&body.History[i])
+	}
+	sig.EstimatedPromptTokens += estimateMessageTokens(&body.Current)
+
+	for _, att := range body.Current.Attachments {
+		if !slices.Contains(sig.AttachmentKinds, att.Kind) {
+			sig.AttachmentKinds = append(sig.AttachmentKinds, att.Kind)
+		}
+		if att.Kind == attachment.AttachmentImage {
+			sig.EstimatedPromptTokens += approxImageTokens
+		}
+	}
+
+	texts := make([]string, 0, 1)
+	for _, in := range body.Current.Inputs {
+		if in.Kind != inferencegoSpec.InputKindInputMessage || in.InputMessage == nil {
+			continue
+		}
+		for _, item := range in.InputMessage.Contents {
+			if item.Kind == inferencegoSpec.ContentItemKindText && item.TextItem != nil {
+				texts = append(texts, item.TextItem.Text)
+			}
+		}
+	}
+	sig.Text = strings.Join(texts, "\n")
+	return sig
+}
+
+func estimateMessageTokens(msg *conversationSpec.ConversationMessage) int {
+	inputs := append([]inferencegoSpec.InputUnion{}, msg.Inputs...)
+	for _, o := range msg.Outputs {
+		if in := outputToInput(o); in != nil {
+			inputs = append(inputs, *in)
+		}
+	}
+	_, total := estimateRequestTokens(&inferencegoSpec.FetchCompletionRequest{Inputs: inputs})
+	return total
+}
@@ -0,0 +1,93 @@
+package inferencewrapper
+
+import (
+	"context"
+	"testing"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/attachment"
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+)
+
+type fakeModelRouter struct {
+	got *modelpresetSpec.RouteSignals
+}
+
+func (f *fakeModelRouter) ResolveModelRoute(
+	_ context.Context,
+	req *modelpresetSpec.ResolveModelRouteRequest,
+) (*modelpresetSpec.ResolveModelRouteResponse, error) {
+	f.got = req.Body
+	maxOut := 2048
+	return &modelpresetSpec.ResolveModelRouteResponse{Body: &modelpresetSpec.RouteDecision{
+		RouterID: req.RouterID,
+		Target:   modelpresetSpec.RouteTarget{ProviderName: "vision-provider", ModelPresetID: "vision"},
+		RuleName: "images",
+		ModelPreset: modelpresetSpec.ModelPreset{
+			ID:              "vision",
+			Name:            "vision-model",
+			MaxOutputLength: &maxOut,
+			ReasoningReplay: modelpresetSpec.ReasoningReplayText,
+		},
+	}}, nil
+}
+
+func TestApplyRoute(t *testing.T) {
+	ps := &ProviderSetAPI{}
+	body := &spec.CompletionRequestBody{
+		ModelParam: &inferencegoSpec.ModelParam{Name: "default-model"},
+		Current: conversationSpec.ConversationMessage{
+			Role: inferencegoSpec.RoleUser,
+			Inputs: []inferencegoSpec.InputUnion{{
+				Kind: inferencegoSpec.InputKindInputMessage,
+				InputMessage: &inferencegoSpec.InputOutputContent{
+					Role: inferencegoSpec.RoleUser,
+					Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+						Kind:     inferencegoSpec.ContentItemKindText,
+						TextItem: &inferencegoSpec.ContentItemText{Text: "describe this chart"},
+					}},
+				},
+			}},
+			Attachments: []attachment.Attachment{
+				{Kind: attachment.AttachmentImage},
+				{Kind: attachment.AttachmentImage},
+			},
+		},
+	}
+
+	provider, routed, d, err := ps.applyRoute(t.Context(), "default", body)
+	if err != nil || provider != "default" || routed != body || d != nil {
+		t.Fatalf("unrouted request changed: %q, %v, %v", provider, d, err)
+	}
+
+	body.Route = &spec.RouteSelection{RouterID: "smart", CostTier: modelpresetSpec.CostTierLow}
+	if _, _, _, err := ps.applyRoute(t.Context(), "default", body); err == nil {
+		t.Fatal("expected error without a model router")
+	}
+
+	router := &fakeModelRouter{}
+	ps.SetModelRouter(router)
+	provider, routed, d, err = ps.applyRoute(t.Context(), "default", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider != "vision-provider" || routed.ModelParam.Name != "vision-model" ||
+		routed.ModelParam.MaxOutputLength != 2048 || routed.ReasoningReplay != modelpresetSpec.ReasoningReplayText {
+		t.Errorf("routed to %q with %+v, replay %q", provider, routed.ModelParam, routed.ReasoningReplay)
+	}
+	if body.ModelParam.Name != "default-model" {
+		t.Error("request body was modified")
+	}
+
+	sig := router.got
+	if sig.Text != "describe this chart" || sig.CostTier != modelpresetSpec.CostTierLow || sig.ToolsEnabled ||
+		len(sig.AttachmentKinds) != 1 || sig.EstimatedPromptTokens < 2*approxImageTokens {
+		t.Errorf("signals = %+v", sig)
+	}
+	if r := modelRoute(d); r.RouterID != "smart" || r.ModelPresetID != "vision" || r.RuleName != "images" {
+		t.Errorf("route = %+v", r)
+	}
+}
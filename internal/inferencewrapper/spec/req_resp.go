@@ -2,6 +2,7 @@ package spec
 
 import (
 	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
 	toolSpec "github.com/flexigpt/flexigpt-app/internal/tool/spec"
 	inferencegoSpec "github.com/flexigpt/inference-go/spec"
 )
@@ -12,6 +13,11 @@ type AddProviderRequestBody struct {
 	ChatCompletionPathPrefix string                          `json:"chatCompletionPathPrefix"`
 	APIKeyHeaderKey          string                          `json:"apiKeyHeaderKey"`
 	DefaultHeaders           map[string]string               `json:"defaultHeaders"`
+
+	// Replay is required when SDKType is ProviderSDKTypeReplay and ignored otherwise.
+	Replay *ReplayProviderConfig `json:"replay,omitempty"`
+
+	RateLimits *modelpresetSpec.ProviderRateLimits `json:"rateLimits,omitempty"`
 }
 
 type AddProviderRequest struct {
@@ -38,10 +44,66 @@ type SetProviderAPIKeyRequest struct {
 
 type SetProviderAPIKeyResponse struct{}
 
+type SetProviderRateLimitsRequestBody struct {
+	// RateLimits replaces the current limits. Nil removes all limits.
+	RateLimits *modelpresetSpec.ProviderRateLimits `json:"rateLimits,omitempty"`
+}
+
+type SetProviderRateLimitsRequest struct {
+	Provider inferencegoSpec.ProviderName `path:"provider" required:"true"`
+	Body     *SetProviderRateLimitsRequestBody
+}
+
+type SetProviderRateLimitsResponse struct{}
+
+type ListProviderQueueStatsRequest struct{}
+
+type ListProviderQueueStatsResponseBody struct {
+	Queues []ProviderQueueStats `json:"queues"`
+}
+
+type ListProviderQueueStatsResponse struct {
+	Body *ListProviderQueueStatsResponseBody
+}
+
+type SetTokenQuotaRequestBody struct {
+	Limits TokenQuotaLimits `json:"limits" required:"true"`
+}
+
+// SetTokenQuotaRequest sets the quota of a provider, or of one of its model presets when ModelPresetID is set.
+// Replacing the limits keeps the consumption.
+type SetTokenQuotaRequest struct {
+	Provider      inferencegoSpec.ProviderName  `path:"provider"       required:"true"`
+	ModelPresetID modelpresetSpec.ModelPresetID `query:"modelPresetID"`
+	Body          *SetTokenQuotaRequestBody
+}
+
+type SetTokenQuotaResponse struct{}
+
+type DeleteTokenQuotaRequest struct {
+	Provider      inferencegoSpec.ProviderName  `path:"provider"       required:"true"`
+	ModelPresetID modelpresetSpec.ModelPresetID `query:"modelPresetID"`
+}
+
+type DeleteTokenQuotaResponse struct{}
+
+type ListTokenQuotasRequest struct{}
+
+type ListTokenQuotasResponseBody struct {
+	Quotas []TokenQuota `json:"quotas"`
+}
+
+type ListTokenQuotasResponse struct {
+	Body *ListTokenQuotasResponseBody
+}
+
 type CompletionRequestBody struct {
 	// Model configuration for this *call*. If nil, the aggregator can fall
 	// back to the last non-nil ModelParam from History.
 	ModelParam *inferencegoSpec.ModelParam `json:"modelParam,omitempty"`
+	// ModelPresetID is the preset ModelParam was taken from. The model preset token quota is charged to the stored
+	// preset of the model; ModelPresetID only picks between presets that share a model.
+	ModelPresetID modelpresetSpec.ModelPresetID `json:"modelPresetID,omitempty"`
 
 	// Past turns of the conversation, already persisted.
 	History []conversationSpec.ConversationMessage `json:"history"`
@@ -61,21 +123,186 @@ type CompletionRequestBody struct {
 	// slice; it does NOT infer tools from History[i].ToolChoices or Current.ToolChoices.
 	// (Those are persisted for UI/analytics only.)
 	ToolStoreChoices []toolSpec.ToolStoreChoice `json:"toolStoreChoices,omitempty"`
+
+	// ResponseFormat, if set, asks for schema constrained output. The final text is validated against the schema
+	// and repaired with extra round-trips when needed.
+	ResponseFormat *ResponseFormat `json:"responseFormat,omitempty"`
+
+	// PromptCache marks stable request prefixes as cacheable. It is translated per provider.
+	PromptCache *PromptCacheHints `json:"promptCache,omitempty"`
+
+	// ReasoningReplay overrides the reasoning replay policy. Empty uses the policy of the stored model preset, or picks
+	// one from the provider SDK type.
+	ReasoningReplay modelpresetSpec.ReasoningReplayPolicy `json:"reasoningReplay,omitempty"`
+
+	// Recovery, if set and a recovery journal is configured, checkpoints streamed output so that it is saved into
+	// the conversation as an incomplete turn when the completion is cancelled, fails or the app exits mid-stream.
+	Recovery *CompletionRecoveryTarget `json:"recovery,omitempty"`
+
+	// Route, if set, lets a model router pick the provider and model preset of this call. The routed provider and
+	// the preset's model param replace the request's provider and ModelParam.
+	Route *RouteSelection `json:"route,omitempty"`
 }
 
 type CompletionRequest struct {
 	Provider inferencegoSpec.ProviderName `path:"provider" required:"true"`
-	Body     *CompletionRequestBody
+	// RequestID identifies the completion in the registry so it can be inspected and cancelled while in flight.
+	// A time-ordered ID is generated when empty; the response and stream events carry the ID used.
+	RequestID string `query:"requestID"`
+	Body      *CompletionRequestBody
 
 	OnStreamText     func(text string) error     `json:"-"`
 	OnStreamThinking func(thinking string) error `json:"-"`
+	// OnStreamEvent receives all events of the completion, including text and thinking deltas that are also sent to
+	// the callbacks above.
+	OnStreamEvent func(ev StreamEvent) error `json:"-"`
 }
 
 type CompletionResponseBody struct {
+	// RequestID is the registry ID of the completion, generated when the request had none.
+	RequestID string `json:"requestID"`
+	// Provider served the completion, after routing. Store it on the assistant turn.
+	Provider inferencegoSpec.ProviderName `json:"provider"`
+
 	InferenceResponse     *inferencegoSpec.FetchCompletionResponse `json:"inferenceResponse,omitempty"`
 	HydratedCurrentInputs []inferencegoSpec.InputUnion             `json:"hydratedCurrentInputs,omitempty"`
+
+	// StructuredOutput is set when the request had a ResponseFormat.
+	StructuredOutput *StructuredOutputResult `json:"structuredOutput,omitempty"`
+
+	// PromptCache is set when the request had prompt cache hints. Store it on the assistant turn.
+	PromptCache *conversationSpec.PromptCacheUsage `json:"promptCache,omitempty"`
+
+	// Citations are the sources cited in the response, normalized across providers. Store them on the assistant turn.
+	Citations []conversationSpec.Citation `json:"citations,omitempty"`
+
+	// Route is set when the request was routed. Store it on the assistant turn, with the routed model.
+	Route      *conversationSpec.ModelRoute `json:"route,omitempty"`
+	ModelParam *inferencegoSpec.ModelParam  `json:"modelParam,omitempty"`
 }
 
 type CompletionResponse struct {
 	Body *CompletionResponseBody
 }
+
+type PreviewCompletionRequest struct {
+	Provider inferencegoSpec.ProviderName `path:"provider" required:"true"`
+	// IncludeWireJSON additionally renders the provider specific HTTP request body.
+	IncludeWireJSON bool `query:"includeWireJSON"`
+	Body            *CompletionRequestBody
+}
+
+// PreviewPartKind identifies which section of the request a token estimate belongs to.
+type PreviewPartKind string
+
+const (
+	PreviewPartKindSystemPrompt PreviewPartKind = "systemPrompt"
+	PreviewPartKindInput        PreviewPartKind = "input"
+	PreviewPartKindTool         PreviewPartKind = "tool"
+)
+
+// PreviewPartTokenEstimate is a rough, tokenizer independent estimate for one part of the request.
+type PreviewPartTokenEstimate struct {
+	Part PreviewPartKind `json:"part"`
+	// Index into FetchCompletionRequest.Inputs (for input parts) or ToolChoices (for tool parts).
+	Index int `json:"index"`
+	// ItemIndex is the content item index inside a message input. -1 when the estimate covers the whole input.
+	ItemIndex       int    `json:"itemIndex"`
+	Kind            string `json:"kind"`
+	Label           string `json:"label,omitempty"`
+	EstimatedTokens int    `json:"estimatedTokens"`
+}
+
+// AttachmentHydrationError reports an attachment that was dropped while building the request.
+type AttachmentHydrationError struct {
+	Label string `json:"label"`
+	Kind  string `json:"kind"`
+	Error string `json:"error"`
+}
+
+type PreviewCompletionResponseBody struct {
+	// Request is the exact normalized request that FetchCompletion would send.
+	Request               *inferencegoSpec.FetchCompletionRequest `json:"request"`
+	HydratedCurrentInputs []inferencegoSpec.InputUnion            `json:"hydratedCurrentInputs,omitempty"`
+
+	PartTokenEstimates   []PreviewPartTokenEstimate `json:"partTokenEstimates"`
+	EstimatedInputTokens int                        `json:"estimatedInputTokens"`
+
+	AttachmentErrors []AttachmentHydrationError `json:"attachmentErrors,omitempty"`
+
+	// WireJSON is the provider specific request body, populated only when requested.
+	WireJSON      string `json:"wireJSON,omitempty"`
+	WireJSONError string `json:"wireJSONError,omitempty"`
+
+	// RouteDecision explains the routing of a request with a route selection.
+	RouteDecision *modelpresetSpec.RouteDecision `json:"routeDecision,omitempty"`
+}
+
+type PreviewCompletionResponse struct {
+	Body *PreviewCompletionResponseBody
+}
+
+type ListActiveCompletionsRequest struct{}
+
+type ListActiveCompletionsResponseBody struct {
+	Completions []ActiveCompletion `json:"completions"`
+}
+
+type ListActiveCompletionsResponse struct {
+	Body *ListActiveCompletionsResponseBody
+}
+
+type GetCompletionStatusRequest struct {
+	RequestID string `path:"requestID" required:"true"`
+}
+
+type GetCompletionStatusResponse struct {
+	Body *ActiveCompletion
+}
+
+type CancelCompletionRequest struct {
+	RequestID string `path:"requestID" required:"true"`
+}
+
+type CancelCompletionResponseBody struct {
+	// Found is false when no completion with the ID is in flight. The cancel is then remembered for a short while in
+	// case the completion is about to start.
+	Found bool `json:"found"`
+}
+
+type CancelCompletionResponse struct {
+	Body *CancelCompletionResponseBody
+}
+
+type CheckProviderRequestBody struct {
+	// CatalogKind overrides the models API inferred from the provider SDK type and origin.
+	CatalogKind ModelCatalogKind `json:"catalogKind,omitempty"`
+}
+
+type CheckProviderRequest struct {
+	Provider inferencegoSpec.ProviderName `path:"provider" required:"true"`
+	Body     *CheckProviderRequestBody
+}
+
+type CheckProviderResponseBody struct {
+	Provider    inferencegoSpec.ProviderName `json:"provider"`
+	CatalogKind ModelCatalogKind             `json:"catalogKind"`
+
+	// Reachable is true when the models endpoint answered with any HTTP status.
+	Reachable bool `json:"reachable"`
+	// Authenticated is true when the models endpoint accepted the credentials.
+	Authenticated bool   `json:"authenticated"`
+	StatusCode    int    `json:"statusCode,omitempty"`
+	Error         string `json:"error,omitempty"`
+	LatencyMs     int64  `json:"latencyMs"`
+
+	RemoteModels []RemoteModel `json:"remoteModels,omitempty"`
+	// StaleModelPresets are presets whose model is not offered by the provider anymore.
+	StaleModelPresets []StaleModelPreset `json:"staleModelPresets,omitempty"`
+	// ModelsWithoutPreset are remote models that no preset refers to.
+	ModelsWithoutPreset []RemoteModel `json:"modelsWithoutPreset,omitempty"`
+}
+
+type CheckProviderResponse struct {
+	Body *CheckProviderResponseBody
+}
@@ -0,0 +1,344 @@
+package spec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	modelpresetSpec "github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+)
+
+const (
+	// ProviderSDKTypeReplay is handled by the wrapper itself and never reaches inference-go.
+	// It records or replays completions from fixture files for deterministic offline tests.
+	ProviderSDKTypeReplay inferencegoSpec.ProviderSDKType = "providerSDKTypeFlexiGPTReplay"
+
+	ReplayFixtureSchemaVersion = "2025-07-01"
+	ReplayFixtureFileExtension = ".json"
+	// ReplayScriptFileName is an optional, hand written file inside the fixture directory whose steps are served in
+	// order for requests that have no recorded fixture.
+	ReplayScriptFileName = "script.json"
+)
+
+type ReplayMode string
+
+const (
+	ReplayModeRecord ReplayMode = "record"
+	ReplayModeReplay ReplayMode = "replay"
+)
+
+// ReplayProviderConfig configures a provider added with SDKType == ProviderSDKTypeReplay.
+type ReplayProviderConfig struct {
+	Mode       ReplayMode `json:"mode"`
+	FixtureDir string     `json:"fixtureDir"`
+	// UpstreamProvider is the already added provider that record mode forwards calls to.
+	UpstreamProvider inferencegoSpec.ProviderName `json:"upstreamProvider,omitempty"`
+}
+
+type ReplayStreamChunkKind string
+
+const (
+	ReplayStreamChunkKindText     ReplayStreamChunkKind = "text"
+	ReplayStreamChunkKindThinking ReplayStreamChunkKind = "thinking"
+)
+
+type ReplayStreamChunk struct {
+	Kind ReplayStreamChunkKind `json:"kind"`
+	Text string                `json:"text"`
+}
+
+// ReplayFixture is one recorded (or scripted) request/response pair.
+type ReplayFixture struct {
+	SchemaVersion string `json:"schemaVersion"`
+	// RequestHash identifies the request. Scripted steps may leave it empty.
+	RequestHash string                                  `json:"requestHash,omitempty"`
+	Request     *inferencegoSpec.FetchCompletionRequest `json:"request,omitempty"`
+
+	StreamChunks []ReplayStreamChunk                      `json:"streamChunks,omitempty"`
+	Response     *inferencegoSpec.FetchCompletionResponse `json:"response,omitempty"`
+	// Error, if set, is returned as the call error after the response and chunks are served.
+	Error string `json:"error,omitempty"`
+}
+
+// ReplayScript holds ordered fixtures served one per call, e.g. a tool call followed by the final answer.
+type ReplayScript struct {
+	SchemaVersion string          `json:"schemaVersion"`
+	Steps         []ReplayFixture `json:"steps"`
+}
+
+type ResponseFormatType string
+
+const (
+	ResponseFormatTypeJSONSchema ResponseFormatType = "jsonSchema"
+
+	// MaxStructuredOutputRepairAttempts caps ResponseFormat.MaxRepairAttempts.
+	MaxStructuredOutputRepairAttempts = 5
+)
+
+// ResponseFormat requests schema constrained output.
+//
+// It maps to the provider's native structured output feature where supported (OpenAI Responses and Chat Completions)
+// and falls back to system prompt instructions elsewhere.
+type ResponseFormat struct {
+	Type ResponseFormatType `json:"type"`
+	// Name of the schema, used by providers that require one. Defaults to "response".
+	Name   string          `json:"name,omitempty"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict,omitempty"`
+	// MaxRepairAttempts is the number of extra round-trips allowed to fix output that fails validation.
+	MaxRepairAttempts int `json:"maxRepairAttempts,omitempty"`
+}
+
+type StructuredOutputResult struct {
+	Valid bool `json:"valid"`
+	// JSON is the validated document extracted from the final text. Empty when the output is not JSON.
+	JSON             json.RawMessage `json:"json,omitempty"`
+	ValidationErrors []string        `json:"validationErrors,omitempty"`
+	RepairAttempts   int             `json:"repairAttempts"`
+	// NativeMode reports whether the provider's native structured output feature was used.
+	NativeMode bool `json:"nativeMode"`
+}
+
+// ProviderQueueStats describes the call queue of a rate limited provider.
+type ProviderQueueStats struct {
+	Provider   inferencegoSpec.ProviderName       `json:"provider"`
+	RateLimits modelpresetSpec.ProviderRateLimits `json:"rateLimits"`
+
+	InFlight   int `json:"inFlight"`
+	QueueDepth int `json:"queueDepth"`
+	// PausedUntil is set while the provider asked to retry later.
+	PausedUntil *time.Time `json:"pausedUntil,omitempty"`
+
+	AdmittedCount int64 `json:"admittedCount"`
+	LastWaitMs    int64 `json:"lastWaitMs"`
+	AvgWaitMs     int64 `json:"avgWaitMs"`
+	MaxWaitMs     int64 `json:"maxWaitMs"`
+}
+
+// TokenQuotaLimits cap the tokens used per UTC calendar day and month. Zero leaves a period unlimited.
+type TokenQuotaLimits struct {
+	DailyTokens   int64 `json:"dailyTokens,omitempty"   minimum:"0"`
+	MonthlyTokens int64 `json:"monthlyTokens,omitempty" minimum:"0"`
+}
+
+// TokenQuota is a quota of a provider, or of one model preset of a provider, with its consumption.
+type TokenQuota struct {
+	Provider inferencegoSpec.ProviderName `json:"provider"`
+	// ModelPresetID is empty for a quota on all calls to the provider.
+	ModelPresetID modelpresetSpec.ModelPresetID `json:"modelPresetID,omitempty"`
+	Limits        TokenQuotaLimits              `json:"limits"`
+
+	// Day ("2006-01-02") and Month ("2006-01") are the periods the used counters belong to. Counters of a past
+	// period are reset on the next check.
+	Day               string `json:"day"`
+	DailyUsedTokens   int64  `json:"dailyUsedTokens"`
+	Month             string `json:"month"`
+	MonthlyUsedTokens int64  `json:"monthlyUsedTokens"`
+
+	ModifiedAt time.Time `json:"modifiedAt"`
+}
+
+type TokenQuotaPeriod string
+
+const (
+	TokenQuotaPeriodDaily   TokenQuotaPeriod = "daily"
+	TokenQuotaPeriodMonthly TokenQuotaPeriod = "monthly"
+)
+
+var ErrTokenQuotaExceeded = errors.New("token quota exceeded")
+
+// TokenQuotaExceededError rejects a completion that would exceed a token quota. It matches ErrTokenQuotaExceeded.
+type TokenQuotaExceededError struct {
+	Provider      inferencegoSpec.ProviderName  `json:"provider"`
+	ModelPresetID modelpresetSpec.ModelPresetID `json:"modelPresetID,omitempty"`
+	Period        TokenQuotaPeriod              `json:"period"`
+	LimitTokens   int64                         `json:"limitTokens"`
+	// UsedTokens includes the estimates of completions in flight.
+	UsedTokens      int64     `json:"usedTokens"`
+	RequestedTokens int64     `json:"requestedTokens"`
+	ResetsAt        time.Time `json:"resetsAt"`
+}
+
+func (e *TokenQuotaExceededError) Error() string {
+	scope := string(e.Provider)
+	if e.ModelPresetID != "" {
+		scope += "/" + string(e.ModelPresetID)
+	}
+	return fmt.Sprintf("%s: %s quota of %s: %d of %d tokens used, request needs about %d, resets at %s",
+		ErrTokenQuotaExceeded, e.Period, scope, e.UsedTokens, e.LimitTokens, e.RequestedTokens,
+		e.ResetsAt.Format(time.RFC3339))
+}
+
+func (e *TokenQuotaExceededError) Unwrap() error { return ErrTokenQuotaExceeded }
+
+// GetStatus maps the error to 429 Too Many Requests in HTTP handlers.
+func (e *TokenQuotaExceededError) GetStatus() int { return http.StatusTooManyRequests }
+
+var ErrCompletionNotFound = errors.New("completion not found")
+
+type CompletionStatus string
+
+const (
+	// CompletionStatusPreparing covers request building: attachment and tool hydration.
+	CompletionStatusPreparing CompletionStatus = "preparing"
+	// CompletionStatusQueued means the call waits for the provider rate limiter.
+	CompletionStatusQueued     CompletionStatus = "queued"
+	CompletionStatusRunning    CompletionStatus = "running"
+	CompletionStatusCancelling CompletionStatus = "cancelling"
+)
+
+// ActiveCompletion describes an in-flight completion.
+type ActiveCompletion struct {
+	RequestID string                       `json:"requestID"`
+	Provider  inferencegoSpec.ProviderName `json:"provider"`
+	ModelName inferencegoSpec.ModelName    `json:"modelName,omitempty"`
+	Status    CompletionStatus             `json:"status"`
+	StartedAt time.Time                    `json:"startedAt"`
+	ElapsedMs int64                        `json:"elapsedMs"`
+}
+
+// ModelCatalogKind selects the wire format of a provider's models endpoint.
+type ModelCatalogKind string
+
+const (
+	// ModelCatalogKindOpenAI is the OpenAI compatible GET /models next to the completions path.
+	ModelCatalogKindOpenAI    ModelCatalogKind = "openai"
+	ModelCatalogKindAnthropic ModelCatalogKind = "anthropic"
+	// ModelCatalogKindGemini is the native Gemini API GET /v1beta/models.
+	ModelCatalogKindGemini ModelCatalogKind = "gemini"
+)
+
+type RemoteModel struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+type StaleModelPreset struct {
+	ModelPresetID modelpresetSpec.ModelPresetID `json:"modelPresetID"`
+	ModelName     modelpresetSpec.ModelName     `json:"modelName"`
+}
+
+// PromptCacheHints marks stable request prefixes as cacheable.
+//
+// Anthropic gets cache_control breakpoints on the last tool, the end of the history and, when only the system prompt
+// is marked, the first input. OpenAI caches prefixes automatically and gets a prompt_cache_key to improve hit rates.
+type PromptCacheHints struct {
+	SystemPrompt  bool `json:"systemPrompt,omitempty"`
+	Tools         bool `json:"tools,omitempty"`
+	HistoryPrefix bool `json:"historyPrefix,omitempty"`
+
+	// TTL of Anthropic cache entries, e.g. "5m" or "1h". Empty uses the provider default.
+	TTL string `json:"ttl,omitempty"`
+	// CacheKey is sent as the OpenAI prompt_cache_key. When empty, a key derived from the model, system prompt and
+	// tools is sent to api.openai.com only, as other OpenAI compatible servers may reject unknown parameters.
+	CacheKey string `json:"cacheKey,omitempty"`
+}
+
+// RouteSelection asks a model router to pick the model of a call.
+type RouteSelection struct {
+	RouterID modelpresetSpec.ModelRouterID `json:"routerID" required:"true"`
+	// CostTier is the cost preference matched by the router's cost tier conditions.
+	CostTier modelpresetSpec.CostTier `json:"costTier,omitempty"`
+}
+
+type StreamEventKind string
+
+const (
+	StreamEventKindTextDelta              StreamEventKind = "textDelta"
+	StreamEventKindThinkingDelta          StreamEventKind = "thinkingDelta"
+	StreamEventKindToolCallStart          StreamEventKind = "toolCallStart"
+	StreamEventKindToolCallArgumentsDelta StreamEventKind = "toolCallArgumentsDelta"
+	StreamEventKindToolCallEnd            StreamEventKind = "toolCallEnd"
+	StreamEventKindCitation               StreamEventKind = "citation"
+	// StreamEventKindUsage reports the usage of one provider round-trip; structured output repairs add more.
+	StreamEventKindUsage StreamEventKind = "usage"
+	StreamEventKindError StreamEventKind = "error"
+	// StreamEventKindStructuredOutputRepair starts a structured output repair round-trip. The deltas that follow
+	// replace the text streamed so far.
+	StreamEventKindStructuredOutputRepair StreamEventKind = "structuredOutputRepair"
+)
+
+// StreamEvent is one typed event of a completion. Exactly the payload matching Kind is set.
+//
+// Only text and thinking deltas arrive while the provider streams. Tool call, citation and usage events are not
+// streamed: they are synthesized from the final response of each provider round-trip once it returns, and tool call
+// arguments come as a single delta between start and end, never as live deltas. Such events have EndOfResponse set.
+// The error event is the last event of a completion that failed or was cancelled at any stage, including failures
+// before the provider is called (routing, request building, quotas).
+type StreamEvent struct {
+	Kind      StreamEventKind `json:"kind"`
+	RequestID string          `json:"requestID"`
+	// Seq numbers the events of a completion, starting at 1.
+	Seq int64 `json:"seq"`
+	// EndOfResponse is set on events derived from a complete provider response rather than streamed.
+	EndOfResponse bool `json:"endOfResponse,omitempty"`
+
+	// Text is set for text and thinking deltas.
+	Text     string                    `json:"text,omitempty"`
+	ToolCall *StreamToolCall           `json:"toolCall,omitempty"`
+	Citation *inferencegoSpec.Citation `json:"citation,omitempty"`
+	Usage    *inferencegoSpec.Usage    `json:"usage,omitempty"`
+	Error    *inferencegoSpec.Error    `json:"error,omitempty"`
+	// RepairAttempt numbers structured output repair events, starting at 1.
+	RepairAttempt int `json:"repairAttempt,omitempty"`
+}
+
+type StreamToolCall struct {
+	Type   inferencegoSpec.ToolType `json:"type"`
+	CallID string                   `json:"callID"`
+	Name   string                   `json:"name,omitempty"`
+
+	// ArgumentsDelta is set on argument delta events.
+	ArgumentsDelta string `json:"argumentsDelta,omitempty"`
+	// WebSearchItems describe what a web search call does (queries, opened pages). Set on start events.
+	WebSearchItems []inferencegoSpec.WebSearchToolCallItemUnion `json:"webSearchItems,omitempty"`
+	// ResultCount is the number of results of a finished web search.
+	ResultCount int `json:"resultCount,omitempty"`
+	// IsError is set on end events of web searches that failed.
+	IsError bool `json:"isError,omitempty"`
+}
+
+// CompletionRecoveryTarget names the conversation a completion belongs to, so that output streamed before a crash,
+// cancel or error can be saved into it as an incomplete assistant turn.
+type CompletionRecoveryTarget struct {
+	ConversationID    string `json:"conversationID"    required:"true"`
+	ConversationTitle string `json:"conversationTitle" required:"true"`
+	// AssistantMessageID is the ID of the recovered assistant turn. If the conversation already has a message with
+	// this ID (the app saved the turn itself), nothing is recovered. Generated when empty.
+	AssistantMessageID string `json:"assistantMessageID,omitempty"`
+}
+
+type RecoveryReason string
+
+const (
+	// RecoveryReasonInterrupted marks completions that were still streaming when the process exited.
+	RecoveryReasonInterrupted RecoveryReason = "interrupted"
+	RecoveryReasonCancelled   RecoveryReason = "cancelled"
+	RecoveryReasonFailed      RecoveryReason = "failed"
+)
+
+// RecoveredCompletion is the journal entry of a streaming completion. It is checkpointed while the completion
+// streams and removed once the completion succeeds or its partial output is saved to the conversation.
+type RecoveredCompletion struct {
+	RequestID string                       `json:"requestID"`
+	Provider  inferencegoSpec.ProviderName `json:"provider"`
+	ModelName inferencegoSpec.ModelName    `json:"modelName"`
+
+	Target CompletionRecoveryTarget `json:"target"`
+	// UserMessage is the turn that was being completed. It is added to the conversation when missing.
+	UserMessage conversationSpec.ConversationMessage `json:"userMessage"`
+
+	Text     string `json:"text,omitempty"`
+	Thinking string `json:"thinking,omitempty"`
+
+	// Reason is empty while the completion is streaming.
+	Reason RecoveryReason `json:"reason,omitempty"`
+	Error  string         `json:"error,omitempty"`
+
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
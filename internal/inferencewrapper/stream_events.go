@@ -0,0 +1,189 @@
+package inferencewrapper
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+// streamEmitter numbers the typed stream events of one completion and forwards them to the caller. A nil emitter
+// is valid and drops all events.
+type streamEmitter struct {
+	ctx       context.Context
+	requestID string
+	fn        func(spec.StreamEvent) error
+
+	mu  sync.Mutex
+	seq int64
+}
+
+func newStreamEmitter(ctx context.Context, requestID string, fn func(spec.StreamEvent) error) *streamEmitter {
+	if fn == nil {
+		return nil
+	}
+	return &streamEmitter{ctx: ctx, requestID: requestID, fn: fn}
+}
+
+// bind ties the emitter to the registered completion: its ID and its cancellable context. It is called before any
+// event is emitted.
+func (e *streamEmitter) bind(ctx context.Context, requestID string) {
+	if e == nil {
+		return
+	}
+	e.ctx = ctx
+	e.requestID = requestID
+}
+
+func (e *streamEmitter) id() string {
+	if e == nil {
+		return ""
+	}
+	return e.requestID
+}
+
+// emit forwards ev unless the completion was cancelled.
+func (e *streamEmitter) emit(ev spec.StreamEvent) error {
+	if e == nil {
+		return nil
+	}
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
+	return e.send(ev)
+}
+
+func (e *streamEmitter) send(ev spec.StreamEvent) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.seq++
+	ev.Seq = e.seq
+	ev.RequestID = e.requestID
+	return e.fn(ev)
+}
+
+// deltaCallback returns a text callback that calls legacy, if any, and emits a delta event of kind.
+func (e *streamEmitter) deltaCallback(kind spec.StreamEventKind, legacy func(string) error) func(string) error {
+	if e == nil {
+		return legacy
+	}
+	return func(s string) error {
+		if legacy != nil {
+			if err := legacy(s); err != nil {
+				return err
+			}
+		}
+		return e.emit(spec.StreamEvent{Kind: kind, Text: s})
+	}
+}
+
+// emitResponse emits the events of one provider round-trip that the stream handler does not deliver: tool calls and
+// web searches in output order, citations and usage. It is called as soon as the round-trip returns, so the events
+// of a response precede any structured output repair. All of them are marked EndOfResponse. Callback errors are
+// returned joined; the round-trip itself is already done.
+func (e *streamEmitter) emitResponse(resp *inferencegoSpec.FetchCompletionResponse) error {
+	if e == nil || resp == nil {
+		return nil
+	}
+	var errs []error
+	emit := func(ev spec.StreamEvent) {
+		ev.EndOfResponse = true
+		if err := e.emit(ev); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	searchOutputs := map[string]*inferencegoSpec.ToolOutput{}
+	for _, o := range resp.Outputs {
+		if o.Kind == inferencegoSpec.OutputKindWebSearchToolOutput && o.WebSearchToolOutput != nil {
+			searchOutputs[o.WebSearchToolOutput.CallID] = o.WebSearchToolOutput
+		}
+	}
+
+	for _, o := range resp.Outputs {
+		switch o.Kind {
+		case inferencegoSpec.OutputKindFunctionToolCall, inferencegoSpec.OutputKindCustomToolCall:
+			call := o.FunctionToolCall
+			if o.Kind == inferencegoSpec.OutputKindCustomToolCall {
+				call = o.CustomToolCall
+			}
+			if call == nil {
+				continue
+			}
+			emit(spec.StreamEvent{Kind: spec.StreamEventKindToolCallStart, ToolCall: streamToolCall(call)})
+			if call.Arguments != "" {
+				tc := streamToolCall(call)
+				tc.ArgumentsDelta = call.Arguments
+				emit(spec.StreamEvent{Kind: spec.StreamEventKindToolCallArgumentsDelta, ToolCall: tc})
+			}
+			emit(spec.StreamEvent{Kind: spec.StreamEventKindToolCallEnd, ToolCall: streamToolCall(call)})
+
+		case inferencegoSpec.OutputKindWebSearchToolCall:
+			call := o.WebSearchToolCall
+			if call == nil {
+				continue
+			}
+			start := streamToolCall(call)
+			start.WebSearchItems = call.WebSearchToolCallItems
+			emit(spec.StreamEvent{Kind: spec.StreamEventKindToolCallStart, ToolCall: start})
+			end := streamToolCall(call)
+			if out := searchOutputs[call.CallID]; out != nil {
+				end.IsError = out.IsError
+				for _, item := range out.WebSearchToolOutputItems {
+					switch item.Kind {
+					case inferencegoSpec.WebSearchToolOutputKindSearch:
+						end.ResultCount++
+					case inferencegoSpec.WebSearchToolOutputKindError:
+						end.IsError = true
+					}
+				}
+			}
+			emit(spec.StreamEvent{Kind: spec.StreamEventKindToolCallEnd, ToolCall: end})
+
+		case inferencegoSpec.OutputKindOutputMessage:
+			if o.OutputMessage == nil {
+				continue
+			}
+			for _, c := range o.OutputMessage.Contents {
+				if c.Kind != inferencegoSpec.ContentItemKindText || c.TextItem == nil {
+					continue
+				}
+				for i := range c.TextItem.Citations {
+					emit(spec.StreamEvent{Kind: spec.StreamEventKindCitation, Citation: &c.TextItem.Citations[i]})
+				}
+			}
+
+		default:
+		}
+	}
+
+	if resp.Usage != nil {
+		emit(spec.StreamEvent{Kind: spec.StreamEventKindUsage, Usage: resp.Usage})
+	}
+	return errors.Join(errs...)
+}
+
+// emitError emits the terminal error event of a completion, if it failed. Unlike other events it is delivered even
+// after the completion was cancelled, so that the caller learns why the stream ended.
+func (e *streamEmitter) emitError(resp *inferencegoSpec.FetchCompletionResponse, callErr error) error {
+	if e == nil {
+		return nil
+	}
+	var evErr *inferencegoSpec.Error
+	switch {
+	case resp != nil && resp.Error != nil:
+		evErr = resp.Error
+	case callErr != nil:
+		evErr = &inferencegoSpec.Error{Message: callErr.Error()}
+	default:
+		return nil
+	}
+	return e.send(spec.StreamEvent{Kind: spec.StreamEventKindError, Error: evErr, EndOfResponse: true})
+}
+
+func streamToolCall(call *inferencegoSpec.ToolCall) *spec.StreamToolCall {
+	return &spec.StreamToolCall{Type: call.Type, CallID: call.CallID, Name: call.Name}
+}
@@ -0,0 +1,226 @@
+package inferencewrapper
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	conversationSpec "github.com/flexigpt/flexigpt-app/internal/conversation/spec"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+func TestStreamEmitter(t *testing.T) {
+	var got []spec.StreamEvent
+	e := newStreamEmitter(t.Context(), "req-1", func(ev spec.StreamEvent) error {
+		got = append(got, ev)
+		return nil
+	})
+
+	var legacy strings.Builder
+	onText := e.deltaCallback(spec.StreamEventKindTextDelta, func(s string) error {
+		legacy.WriteString(s)
+		return nil
+	})
+	onThinking := e.deltaCallback(spec.StreamEventKindThinkingDelta, nil)
+	for _, fn := range []func() error{
+		func() error { return onThinking("hmm") },
+		func() error { return onText("Hel") },
+		func() error { return onText("lo") },
+	} {
+		if err := fn(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := &inferencegoSpec.FetchCompletionResponse{
+		Outputs: []inferencegoSpec.OutputUnion{
+			{
+				Kind: inferencegoSpec.OutputKindWebSearchToolCall,
+				WebSearchToolCall: &inferencegoSpec.ToolCall{
+					Type: inferencegoSpec.ToolTypeWebSearch, CallID: "ws1",
+					WebSearchToolCallItems: []inferencegoSpec.WebSearchToolCallItemUnion{{
+						Kind:       inferencegoSpec.WebSearchToolCallKindSearch,
+						SearchItem: &inferencegoSpec.WebSearchToolCallSearch{Query: "go"},
+					}},
+				},
+			},
+			{
+				Kind: inferencegoSpec.OutputKindWebSearchToolOutput,
+				WebSearchToolOutput: &inferencegoSpec.ToolOutput{
+					CallID: "ws1",
+					WebSearchToolOutputItems: []inferencegoSpec.WebSearchToolOutputItemUnion{
+						{Kind: inferencegoSpec.WebSearchToolOutputKindSearch},
+						{Kind: inferencegoSpec.WebSearchToolOutputKindSearch},
+					},
+				},
+			},
+			{
+				Kind: inferencegoSpec.OutputKindOutputMessage,
+				OutputMessage: &inferencegoSpec.InputOutputContent{
+					Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+						Kind: inferencegoSpec.ContentItemKindText,
+						TextItem: &inferencegoSpec.ContentItemText{
+							Text: "Hello",
+							Citations: []inferencegoSpec.Citation{{
+								Kind:        inferencegoSpec.CitationKindURL,
+								URLCitation: &inferencegoSpec.URLCitation{URL: "https://go.dev"},
+							}},
+						},
+					}},
+				},
+			},
+			{
+				Kind: inferencegoSpec.OutputKindFunctionToolCall,
+				FunctionToolCall: &inferencegoSpec.ToolCall{
+					Type: inferencegoSpec.ToolTypeFunction, CallID: "c1", Name: "lookup", Arguments: `{"q":1}`,
+				},
+			},
+		},
+		Usage: &inferencegoSpec.Usage{InputTokensTotal: 5, OutputTokens: 3},
+	}
+	if err := e.emitResponse(resp); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.emitError(resp, errors.New("stream broke")); err != nil {
+		t.Fatal(err)
+	}
+
+	wantKinds := []spec.StreamEventKind{
+		spec.StreamEventKindThinkingDelta,
+		spec.StreamEventKindTextDelta,
+		spec.StreamEventKindTextDelta,
+		spec.StreamEventKindToolCallStart,
+		spec.StreamEventKindToolCallEnd,
+		spec.StreamEventKindCitation,
+		spec.StreamEventKindToolCallStart,
+		spec.StreamEventKindToolCallArgumentsDelta,
+		spec.StreamEventKindToolCallEnd,
+		spec.StreamEventKindUsage,
+		spec.StreamEventKindError,
+	}
+	if len(got) != len(wantKinds) {
+		t.Fatalf("got %d events, want %d: %+v", len(got), len(wantKinds), got)
+	}
+	for i, ev := range got {
+		if ev.Kind != wantKinds[i] {
+			t.Errorf("event %d kind = %s, want %s", i, ev.Kind, wantKinds[i])
+		}
+		if ev.Seq != int64(i+1) || ev.RequestID != "req-1" {
+			t.Errorf("event %d seq = %d, requestID = %q", i, ev.Seq, ev.RequestID)
+		}
+		if ev.EndOfResponse != (i >= 3) {
+			t.Errorf("event %d endOfResponse = %v", i, ev.EndOfResponse)
+		}
+	}
+	if legacy.String() != "Hello" || got[1].Text != "Hel" {
+		t.Errorf("text deltas not forwarded: legacy %q, event %q", legacy.String(), got[1].Text)
+	}
+	if got[3].ToolCall.WebSearchItems == nil || got[4].ToolCall.ResultCount != 2 || got[4].ToolCall.IsError {
+		t.Errorf("web search events = %+v / %+v", got[3].ToolCall, got[4].ToolCall)
+	}
+	if got[7].ToolCall.ArgumentsDelta != `{"q":1}` || got[7].ToolCall.Name != "lookup" {
+		t.Errorf("arguments delta = %+v", got[7].ToolCall)
+	}
+	if got[10].Error == nil || got[10].Error.Message != "stream broke" {
+		t.Errorf("error event = %+v", got[10].Error)
+	}
+}
+
+func TestStreamEmitterStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	calls := 0
+	e := newStreamEmitter(ctx, "req-1", func(spec.StreamEvent) error {
+		calls++
+		return nil
+	})
+	onText := e.deltaCallback(spec.StreamEventKindTextDelta, nil)
+	if err := onText("a"); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := onText("b"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if calls != 1 {
+		t.Fatalf("calls = %d, want 1", calls)
+	}
+	if err := e.emitResponse(&inferencegoSpec.FetchCompletionResponse{
+		Usage: &inferencegoSpec.Usage{OutputTokens: 1},
+	}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("emitResponse err = %v, want context.Canceled", err)
+	}
+	if err := e.emitError(nil, context.Canceled); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("calls = %d, want the error event delivered after cancel", calls)
+	}
+	if err := e.emitError(&inferencegoSpec.FetchCompletionResponse{}, nil); err != nil || calls != 2 {
+		t.Fatalf("emitError without an error = %v, %d calls", err, calls)
+	}
+
+	var nilEmitter *streamEmitter
+	if nilEmitter.deltaCallback(spec.StreamEventKindTextDelta, nil) != nil {
+		t.Fatal("nil emitter without legacy callback should not stream")
+	}
+}
+
+func TestFetchCompletionErrorEventBeforeProviderCall(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	q := newTestQuotaLedger(t, t.TempDir(), &now)
+	if err := q.set("p", "", spec.TokenQuotaLimits{DailyTokens: 1}); err != nil {
+		t.Fatal(err)
+	}
+	ps := &ProviderSetAPI{logger: slog.Default(), completions: newCompletionRegistry(), quotas: q}
+
+	tests := []struct {
+		name     string
+		provider inferencegoSpec.ProviderName
+		wantErr  string
+	}{
+		{name: "MissingProvider", wantErr: "missing provider"},
+		{name: "QuotaExceeded", provider: "p", wantErr: spec.ErrTokenQuotaExceeded.Error()},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []spec.StreamEvent
+			_, err := ps.FetchCompletion(t.Context(), &spec.CompletionRequest{
+				Provider:  tc.provider,
+				RequestID: "req-" + tc.name,
+				Body: &spec.CompletionRequestBody{
+					ModelParam: &inferencegoSpec.ModelParam{Name: "m"},
+					Current: conversationSpec.ConversationMessage{
+						Role: inferencegoSpec.RoleUser,
+						Inputs: []inferencegoSpec.InputUnion{{
+							Kind: inferencegoSpec.InputKindInputMessage,
+							InputMessage: &inferencegoSpec.InputOutputContent{
+								Role: inferencegoSpec.RoleUser,
+								Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+									Kind:     inferencegoSpec.ContentItemKindText,
+									TextItem: &inferencegoSpec.ContentItemText{Text: "hello"},
+								}},
+							},
+						}},
+					},
+				},
+				OnStreamEvent: func(ev spec.StreamEvent) error {
+					got = append(got, ev)
+					return nil
+				},
+			})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tc.wantErr)
+			}
+			if len(got) != 1 || got[0].Kind != spec.StreamEventKindError || got[0].Seq != 1 ||
+				got[0].RequestID != "req-"+tc.name || got[0].Error == nil ||
+				!strings.Contains(got[0].Error.Message, tc.wantErr) {
+				t.Fatalf("events = %+v", got)
+			}
+		})
+	}
+}
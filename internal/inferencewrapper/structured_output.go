@@ -0,0 +1,246 @@
+package inferencewrapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/responseutil"
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+	"github.com/flexigpt/flexigpt-app/internal/jsonutil"
+)
+
+const (
+	defaultResponseFormatName = "response"
+	// anthropic-beta value prefix that enables native structured outputs on Anthropic.
+	anthropicStructuredOutputsBetaPrefix = "structured-outputs-"
+)
+
+// applyResponseFormat maps the response format onto the request. Providers with a native structured output feature get
+// it through additional parameters; everything else gets schema instructions appended to the system prompt.
+func (ps *ProviderSetAPI) applyResponseFormat(
+	provider inferencegoSpec.ProviderName,
+	infReq *inferencegoSpec.FetchCompletionRequest,
+	rf *spec.ResponseFormat,
+) error {
+	if rf.Type != spec.ResponseFormatTypeJSONSchema {
+		return fmt.Errorf("unsupported response format type %q", rf.Type)
+	}
+	if rf.MaxRepairAttempts < 0 || rf.MaxRepairAttempts > spec.MaxStructuredOutputRepairAttempts {
+		return fmt.Errorf("maxRepairAttempts must be between 0 and %d", spec.MaxStructuredOutputRepairAttempts)
+	}
+	if _, err := jsonutil.CompileJSONSchema(rf.Schema); err != nil {
+		return err
+	}
+	var schema any
+	if err := json.Unmarshal(rf.Schema, &schema); err != nil {
+		return fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	name := strings.TrimSpace(rf.Name)
+	if name == "" {
+		name = defaultResponseFormatName
+	}
+
+	var key string
+	var value map[string]any
+	switch ps.nativeResponseFormat(provider) {
+	case nativeResponseFormatOpenAIResponses:
+		key = "text"
+		value = map[string]any{
+			"format": map[string]any{
+				"type":   "json_schema",
+				"name":   name,
+				"schema": schema,
+				"strict": rf.Strict,
+			},
+		}
+	case nativeResponseFormatOpenAIChat:
+		key = "response_format"
+		value = map[string]any{
+			"type": "json_schema",
+			"json_schema": map[string]any{
+				"name":   name,
+				"schema": schema,
+				"strict": rf.Strict,
+			},
+		}
+	case nativeResponseFormatGemini:
+		// Gemini's OpenAI compatible endpoint maps response_format onto its response schema, which is always enforced
+		// and has no strict flag.
+		key = "response_format"
+		value = map[string]any{
+			"type": "json_schema",
+			"json_schema": map[string]any{
+				"name":   name,
+				"schema": schema,
+			},
+		}
+	case nativeResponseFormatAnthropic:
+		key = "output_format"
+		value = map[string]any{
+			"type":   "json_schema",
+			"schema": schema,
+		}
+	default:
+		infReq.ModelParam.SystemPrompt = strings.TrimSpace(
+			infReq.ModelParam.SystemPrompt + "\n\n" + structuredOutputInstructions(rf.Schema),
+		)
+		return nil
+	}
+
+	if err := setAdditionalParameter(&infReq.ModelParam, key, value); err != nil {
+		return fmt.Errorf("cannot add a response format: %w", err)
+	}
+	return nil
+}
+
+// nativeResponseFormat is the structured output API a provider is asked through.
+type nativeResponseFormat int
+
+const (
+	// nativeResponseFormatNone asks for the schema in the system prompt.
+	nativeResponseFormatNone nativeResponseFormat = iota
+	nativeResponseFormatOpenAIResponses
+	nativeResponseFormatOpenAIChat
+	nativeResponseFormatGemini
+	nativeResponseFormatAnthropic
+)
+
+// nativeResponseFormat returns the native structured output API of a provider. Anthropic has one only when the
+// provider sends the structured outputs beta header.
+func (ps *ProviderSetAPI) nativeResponseFormat(provider inferencegoSpec.ProviderName) nativeResponseFormat {
+	ps.providersMu.RLock()
+	cfg := ps.providers[provider]
+	ps.providersMu.RUnlock()
+
+	switch cfg.SDKType {
+	case inferencegoSpec.ProviderSDKTypeOpenAIResponses:
+		return nativeResponseFormatOpenAIResponses
+	case inferencegoSpec.ProviderSDKTypeOpenAIChatCompletions:
+		if inferModelCatalogKind(&cfg) == spec.ModelCatalogKindGemini {
+			return nativeResponseFormatGemini
+		}
+		return nativeResponseFormatOpenAIChat
+	case inferencegoSpec.ProviderSDKTypeAnthropic:
+		if hasAnthropicBeta(&cfg, anthropicStructuredOutputsBetaPrefix) {
+			return nativeResponseFormatAnthropic
+		}
+	default:
+	}
+	return nativeResponseFormatNone
+}
+
+// validateStructuredOutput validates the final text of resp against the schema. On failure it re-asks the model with
+// the validation errors, up to MaxRepairAttempts times. Usage is summed over all round-trips.
+//
+// Repair round-trips are streamed as typed events only, each after a structured output repair event; the legacy text
+// callbacks and the recovery journal keep the first response.
+func (ps *ProviderSetAPI) validateStructuredOutput(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	infReq *inferencegoSpec.FetchCompletionRequest,
+	rf *spec.ResponseFormat,
+	resp *inferencegoSpec.FetchCompletionResponse,
+	events *streamEmitter,
+) (*inferencegoSpec.FetchCompletionResponse, *spec.StructuredOutputResult, error) {
+	schema, err := jsonutil.CompileJSONSchema(rf.Schema)
+	if err != nil {
+		return resp, nil, err
+	}
+	result := &spec.StructuredOutputResult{
+		NativeMode: ps.nativeResponseFormat(provider) != nativeResponseFormatNone,
+	}
+	onText := events.deltaCallback(spec.StreamEventKindTextDelta, nil)
+	onThinking := events.deltaCallback(spec.StreamEventKindThinkingDelta, nil)
+
+	var usage *inferencegoSpec.Usage
+	cur, curReq := resp, infReq
+	for attempt := 0; ; attempt++ {
+		usage = responseutil.AddUsage(usage, cur.Usage)
+		result.RepairAttempts = attempt
+
+		doc := jsonutil.ExtractJSONDocument(responseutil.OutputText(cur))
+		verrs, derr := jsonutil.ValidateAgainstSchema(schema, []byte(doc))
+		if derr != nil {
+			verrs = []string{"output is not valid JSON: " + derr.Error()}
+		}
+		if len(verrs) == 0 {
+			result.Valid = true
+			result.JSON = json.RawMessage(doc)
+			result.ValidationErrors = nil
+			break
+		}
+		result.ValidationErrors = verrs
+		if attempt >= rf.MaxRepairAttempts {
+			break
+		}
+
+		repairReq := *curReq
+		repairReq.Inputs = slices.Clone(curReq.Inputs)
+		for _, o := range cur.Outputs {
+			if in := outputToInput(o); in != nil {
+				repairReq.Inputs = append(repairReq.Inputs, *in)
+			}
+		}
+		repairReq.Inputs = append(repairReq.Inputs, structuredOutputRepairInput(verrs))
+
+		repairEvent := spec.StreamEvent{Kind: spec.StreamEventKindStructuredOutputRepair, RepairAttempt: attempt + 1}
+		if err := events.emit(repairEvent); err != nil {
+			return cur, result, err
+		}
+		next, err := ps.fetch(ctx, provider, &repairReq, onText, onThinking)
+		if err != nil {
+			return cur, result, err
+		}
+		if next == nil {
+			return cur, result, errors.New("empty response while repairing structured output")
+		}
+		if err := events.emitResponse(next); err != nil {
+			return next, result, err
+		}
+		cur, curReq = next, &repairReq
+	}
+
+	if usage != nil {
+		cur.Usage = usage
+	}
+	return cur, result, nil
+}
+
+func (ps *ProviderSetAPI) providerSDKType(provider inferencegoSpec.ProviderName) inferencegoSpec.ProviderSDKType {
+	ps.providersMu.RLock()
+	defer ps.providersMu.RUnlock()
+	return ps.providers[provider].SDKType
+}
+
+func structuredOutputInstructions(schema json.RawMessage) string {
+	return "Respond only with a JSON document that conforms to the following JSON Schema. " +
+		"Do not wrap it in markdown code fences and do not add any other text.\n" +
+		"JSON Schema:\n" + string(schema)
+}
+
+func structuredOutputRepairInput(validationErrors []string) inferencegoSpec.InputUnion {
+	var sb strings.Builder
+	sb.WriteString("Your previous response did not conform to the required JSON Schema.\nValidation errors:\n")
+	for _, e := range validationErrors {
+		sb.WriteString("- ")
+		sb.WriteString(e)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("Return only the corrected JSON document, with no other text.")
+	return inferencegoSpec.InputUnion{
+		Kind: inferencegoSpec.InputKindInputMessage,
+		InputMessage: &inferencegoSpec.InputOutputContent{
+			Role: inferencegoSpec.RoleUser,
+			Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+				Kind:     inferencegoSpec.ContentItemKindText,
+				TextItem: &inferencegoSpec.ContentItemText{Text: sb.String()},
+			}},
+		},
+	}
+}
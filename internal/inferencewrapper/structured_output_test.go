@@ -0,0 +1,220 @@
+package inferencewrapper
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flexigpt/inference-go"
+	inferencegoSpec "github.com/flexigpt/inference-go/spec"
+
+	"github.com/flexigpt/flexigpt-app/internal/inferencewrapper/spec"
+)
+
+const testResponseSchema = `{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}`
+
+func textResponse(text string, usage *inferencegoSpec.Usage) *inferencegoSpec.FetchCompletionResponse {
+	return &inferencegoSpec.FetchCompletionResponse{
+		Outputs: []inferencegoSpec.OutputUnion{{
+			Kind: inferencegoSpec.OutputKindOutputMessage,
+			OutputMessage: &inferencegoSpec.InputOutputContent{
+				Role: inferencegoSpec.RoleAssistant,
+				Contents: []inferencegoSpec.InputOutputContentItemUnion{{
+					Kind:     inferencegoSpec.ContentItemKindText,
+					TextItem: &inferencegoSpec.ContentItemText{Text: text},
+				}},
+			},
+		}},
+		Usage: usage,
+	}
+}
+
+func TestApplyResponseFormat(t *testing.T) {
+	ps := &ProviderSetAPI{
+		logger: slog.Default(),
+		providers: map[inferencegoSpec.ProviderName]inference.AddProviderConfig{
+			"responses": {SDKType: inferencegoSpec.ProviderSDKTypeOpenAIResponses, Origin: "https://api.openai.com"},
+			"chat": {
+				SDKType: inferencegoSpec.ProviderSDKTypeOpenAIChatCompletions,
+				Origin:  "https://api.openai.com",
+			},
+			"gemini": {
+				SDKType: inferencegoSpec.ProviderSDKTypeOpenAIChatCompletions,
+				Origin:  "https://generativelanguage.googleapis.com",
+			},
+			"claude-native": {
+				SDKType:        inferencegoSpec.ProviderSDKTypeAnthropic,
+				DefaultHeaders: map[string]string{"Anthropic-Beta": "structured-outputs-2025-11-13"},
+			},
+			"claude": {SDKType: inferencegoSpec.ProviderSDKTypeAnthropic},
+		},
+	}
+	rf := &spec.ResponseFormat{
+		Type:   spec.ResponseFormatTypeJSONSchema,
+		Name:   "person",
+		Schema: json.RawMessage(testResponseSchema),
+		Strict: true,
+	}
+
+	tests := []struct {
+		provider inferencegoSpec.ProviderName
+		// wantParams is the expected additional parameters JSON, empty when the schema goes into the system prompt.
+		wantParams string
+	}{
+		{
+			provider: "responses",
+			wantParams: `{"temperature":0,"text":{"format":{"name":"person","schema":` + testResponseSchema +
+				`,"strict":true,"type":"json_schema"}}}`,
+		},
+		{
+			provider: "chat",
+			wantParams: `{"response_format":{"json_schema":{"name":"person","schema":` + testResponseSchema +
+				`,"strict":true},"type":"json_schema"},"temperature":0}`,
+		},
+		{
+			provider: "gemini",
+			wantParams: `{"response_format":{"json_schema":{"name":"person","schema":` + testResponseSchema +
+				`},"type":"json_schema"},"temperature":0}`,
+		},
+		{
+			provider: "claude-native",
+			wantParams: `{"output_format":{"schema":` + testResponseSchema +
+				`,"type":"json_schema"},"temperature":0}`,
+		},
+		{provider: "claude"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.provider), func(t *testing.T) {
+			params := `{"temperature":0}`
+			infReq := &inferencegoSpec.FetchCompletionRequest{ModelParam: inferencegoSpec.ModelParam{
+				Name:                        "m",
+				SystemPrompt:                "be brief",
+				AdditionalParametersRawJSON: &params,
+			}}
+			if err := ps.applyResponseFormat(tt.provider, infReq, rf); err != nil {
+				t.Fatal(err)
+			}
+			got := *infReq.ModelParam.AdditionalParametersRawJSON
+			if tt.wantParams == "" {
+				if got != params {
+					t.Errorf("additional parameters = %s, want them unchanged", got)
+				}
+				if !strings.HasPrefix(infReq.ModelParam.SystemPrompt, "be brief\n\n") ||
+					!strings.Contains(infReq.ModelParam.SystemPrompt, testResponseSchema) {
+					t.Errorf("system prompt = %q", infReq.ModelParam.SystemPrompt)
+				}
+				return
+			}
+			var gotParams, wantParams any
+			if err := json.Unmarshal([]byte(got), &gotParams); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.wantParams), &wantParams); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotParams, wantParams) {
+				t.Errorf("additional parameters = %s\nwant %s", got, tt.wantParams)
+			}
+			if infReq.ModelParam.SystemPrompt != "be brief" {
+				t.Errorf("system prompt = %q", infReq.ModelParam.SystemPrompt)
+			}
+			if params != `{"temperature":0}` {
+				t.Error("caller's additional parameters were modified")
+			}
+		})
+	}
+
+	for name, bad := range map[string]spec.ResponseFormat{
+		"type": {Type: "xml", Schema: json.RawMessage(testResponseSchema)},
+		"repairs": {
+			Type:              spec.ResponseFormatTypeJSONSchema,
+			Schema:            json.RawMessage(testResponseSchema),
+			MaxRepairAttempts: spec.MaxStructuredOutputRepairAttempts + 1,
+		},
+		"schema": {Type: spec.ResponseFormatTypeJSONSchema, Schema: json.RawMessage(`{"type":`)},
+	} {
+		infReq := &inferencegoSpec.FetchCompletionRequest{ModelParam: inferencegoSpec.ModelParam{Name: "m"}}
+		if err := ps.applyResponseFormat("chat", infReq, &bad); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestValidateStructuredOutput(t *testing.T) {
+	dir := t.TempDir()
+	script := spec.ReplayScript{
+		SchemaVersion: spec.ReplayFixtureSchemaVersion,
+		Steps: []spec.ReplayFixture{{
+			StreamChunks: []spec.ReplayStreamChunk{{Kind: spec.ReplayStreamChunkKindText, Text: `{"name":"ok"}`}},
+			Response:     textResponse("```json\n{\"name\":\"ok\"}\n```", &inferencegoSpec.Usage{OutputTokens: 4}),
+		}},
+	}
+	b, err := json.Marshal(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, spec.ReplayScriptFileName), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rp, err := newReplayProvider("scripted", &spec.ReplayProviderConfig{Mode: spec.ReplayModeReplay, FixtureDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := &ProviderSetAPI{
+		logger:          slog.Default(),
+		replayProviders: map[inferencegoSpec.ProviderName]*replayProvider{"scripted": rp},
+	}
+	rf := &spec.ResponseFormat{
+		Type:              spec.ResponseFormatTypeJSONSchema,
+		Schema:            json.RawMessage(testResponseSchema),
+		MaxRepairAttempts: 2,
+	}
+	infReq := &inferencegoSpec.FetchCompletionRequest{
+		ModelParam: inferencegoSpec.ModelParam{Name: "m", Stream: true},
+		Inputs:     []inferencegoSpec.InputUnion{structuredOutputRepairInput(nil)},
+	}
+	first := textResponse(`{"name":1}`, &inferencegoSpec.Usage{OutputTokens: 3})
+
+	t.Run("no_repairs", func(t *testing.T) {
+		noRepair := *rf
+		noRepair.MaxRepairAttempts = 0
+		resp, result, err := ps.validateStructuredOutput(t.Context(), "scripted", infReq, &noRepair, first, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != first || result.Valid || result.RepairAttempts != 0 || len(result.ValidationErrors) == 0 {
+			t.Errorf("result = %+v", result)
+		}
+	})
+
+	t.Run("repaired", func(t *testing.T) {
+		var events []spec.StreamEvent
+		emitter := newStreamEmitter(t.Context(), "req-1", func(ev spec.StreamEvent) error {
+			events = append(events, ev)
+			return nil
+		})
+		resp, result, err := ps.validateStructuredOutput(t.Context(), "scripted", infReq, rf, first, emitter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Valid || result.RepairAttempts != 1 || result.NativeMode || string(result.JSON) != `{"name":"ok"}` {
+			t.Errorf("result = %+v", result)
+		}
+		if resp.Usage == nil || resp.Usage.OutputTokens != 7 {
+			t.Errorf("usage = %+v, want output tokens summed to 7", resp.Usage)
+		}
+		if len(events) != 3 || events[0].Kind != spec.StreamEventKindStructuredOutputRepair ||
+			events[0].RepairAttempt != 1 || events[1].Kind != spec.StreamEventKindTextDelta ||
+			events[1].Text != `{"name":"ok"}` || events[2].Kind != spec.StreamEventKindUsage ||
+			!events[2].EndOfResponse || events[2].Usage.OutputTokens != 4 {
+			t.Errorf("events = %+v", events)
+		}
+		if len(infReq.Inputs) != 1 {
+			t.Errorf("request inputs were modified: %d", len(infReq.Inputs))
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package jsonutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// CompileJSONSchema parses a JSON Schema document into a schema usable with ValidateAgainstSchema.
+// Only self contained schemas are supported; "$ref" to external or "$defs" documents is not resolved.
+func CompileJSONSchema(raw json.RawMessage) (*huma.Schema, error) {
+	if isBlankJSON(raw) {
+		return nil, errors.New("empty JSON schema")
+	}
+	var s huma.Schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	s.PrecomputeMessages()
+	return &s, nil
+}
+
+// ValidateAgainstSchema validates a JSON document against a compiled schema.
+// It returns the list of validation errors (empty when valid) or an error if data is not JSON at all.
+func ValidateAgainstSchema(s *huma.Schema, data []byte) ([]string, error) {
+	if s == nil {
+		return nil, errors.New("nil schema")
+	}
+	var v any
+	if err := decodeBytes(data, &v, false, true); err != nil {
+		return nil, err
+	}
+	registry := huma.NewMapRegistry("#/components/schemas/", huma.DefaultSchemaNamer)
+	res := huma.ValidateResult{}
+	huma.Validate(registry, s, huma.NewPathBuffer(make([]byte, 0, 128), 0), huma.ModeReadFromServer, v, &res)
+
+	out := make([]string, 0, len(res.Errors))
+	for _, e := range res.Errors {
+		out = append(out, e.Error())
+	}
+	return out, nil
+}
+
+// ExtractJSONDocument returns the JSON document embedded in model output text.
+// It strips surrounding whitespace and a single markdown code fence, if present.
+func ExtractJSONDocument(text string) string {
+	s := strings.TrimSpace(text)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	// Drop the optional language tag on the fence line.
+	if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+		s = s[idx+1:]
+	}
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, "```")
+	return strings.TrimSpace(s)
+}
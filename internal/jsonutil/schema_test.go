@@ -0,0 +1,78 @@
+package jsonutil
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateAgainstSchema(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"count": {"type": "integer", "minimum": 1},
+			"tags": {"type": "array", "items": {"type": "string", "enum": ["a", "b"]}}
+		},
+		"required": ["name", "count"],
+		"additionalProperties": false
+	}`)
+	s, err := CompileJSONSchema(schema)
+	if err != nil {
+		t.Fatalf("CompileJSONSchema: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		data       string
+		wantErrs   int
+		wantDecode bool
+	}{
+		{name: "valid", data: `{"name":"x","count":2,"tags":["a"]}`},
+		{name: "missing_required", data: `{"name":"x"}`, wantErrs: 1},
+		{name: "below_minimum", data: `{"name":"x","count":0}`, wantErrs: 1},
+		{name: "bad_enum_and_extra_prop", data: `{"name":"x","count":1,"tags":["z"],"extra":1}`, wantErrs: 2},
+		{name: "not_json", data: `name: x`, wantDecode: true},
+		{name: "trailing_data", data: `{"name":"x","count":1} {}`, wantDecode: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, err := ValidateAgainstSchema(s, []byte(tt.data))
+			if tt.wantDecode {
+				if err == nil {
+					t.Fatal("expected decode error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(errs) != tt.wantErrs {
+				t.Fatalf("got %d validation errors %v, want %d", len(errs), errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestCompileJSONSchemaInvalid(t *testing.T) {
+	for _, raw := range []string{``, `   `, `{"type":`} {
+		if _, err := CompileJSONSchema(json.RawMessage(raw)); err == nil {
+			t.Fatalf("expected error for schema %q", raw)
+		}
+	}
+}
+
+func TestExtractJSONDocument(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: `  {"a":1} `, want: `{"a":1}`},
+		{in: "```json\n{\"a\":1}\n```", want: `{"a":1}`},
+		{in: "```\n[1,2]\n```\n", want: `[1,2]`},
+	}
+	for _, tt := range tests {
+		if got := ExtractJSONDocument(tt.in); got != tt.want {
+			t.Fatalf("ExtractJSONDocument(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
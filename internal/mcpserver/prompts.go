@@ -0,0 +1,175 @@
+package mcpserver
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/flexigpt/flexigpt-app/internal/prompt/spec"
+	promptStore "github.com/flexigpt/flexigpt-app/internal/prompt/store"
+)
+
+type mcpPromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+type mcpPromptDef struct {
+	Name        string              `json:"name"`
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Arguments   []mcpPromptArgument `json:"arguments,omitempty"`
+}
+
+type mcpPromptMessage struct {
+	Role    string      `json:"role"`
+	Content mcpTextItem `json:"content"`
+}
+
+type mcpTextItem struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// exposedPrompt is a prompt template offered under an MCP name.
+type exposedPrompt struct {
+	name string
+	tpl  spec.PromptTemplate
+}
+
+func (s *Server) listPrompts(ctx context.Context) (any, error) {
+	prompts, err := s.exposedPrompts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defs := make([]mcpPromptDef, 0, len(prompts))
+	for _, p := range prompts {
+		defs = append(defs, mcpPromptDef{
+			Name:        p.name,
+			Title:       p.tpl.DisplayName,
+			Description: p.tpl.Description,
+			Arguments:   promptArguments(p.tpl.Variables),
+		})
+	}
+	return map[string]any{"prompts": defs}, nil
+}
+
+func (s *Server) getPrompt(ctx context.Context, params json.RawMessage) (any, error) {
+	var p struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.Name == "" {
+		return nil, invalidParams("prompts/get needs a prompt name")
+	}
+	prompts, err := s.exposedPrompts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idx := slices.IndexFunc(prompts, func(e exposedPrompt) bool { return e.name == p.Name })
+	if idx < 0 {
+		return nil, invalidParams("unknown prompt: " + p.Name)
+	}
+	tpl := prompts[idx].tpl
+
+	vars, err := promptStore.ResolveVariables(tpl.Variables, p.Arguments)
+	if err != nil {
+		return nil, invalidParams(err.Error())
+	}
+	msgs := make([]mcpPromptMessage, 0, len(tpl.Blocks))
+	for _, b := range tpl.Blocks {
+		// MCP prompts only have user and assistant messages; system and developer blocks are sent as user messages.
+		role := "user"
+		if b.Role == spec.Assistant {
+			role = "assistant"
+		}
+		msgs = append(msgs, mcpPromptMessage{
+			Role:    role,
+			Content: mcpTextItem{Type: "text", Text: promptStore.FillPlaceholders(b.Content, vars)},
+		})
+	}
+	return map[string]any{
+		"description": tpl.Description,
+		"messages":    msgs,
+	}, nil
+}
+
+// exposedPrompts returns the enabled prompt templates, named <bundleSlug>_<templateSlug>. Only the most recently
+// modified version of a template is offered. The templates come with the listing, so each page is one store call.
+func (s *Server) exposedPrompts(ctx context.Context) ([]exposedPrompt, error) {
+	type entry struct {
+		item spec.PromptTemplateListItem
+		tpl  spec.PromptTemplate
+	}
+	latest := map[string]entry{}
+	token := ""
+	for range maxStorePages {
+		resp, err := s.prompts.ListPromptTemplates(ctx, &spec.ListPromptTemplatesRequest{PageToken: token})
+		if err != nil {
+			return nil, err
+		}
+		for _, it := range resp.Body.PromptTemplateListItems {
+			tpl := it.TemplateDefinition
+			if !tpl.IsEnabled {
+				continue
+			}
+			name := itemName(it.BundleSlug, it.TemplateSlug)
+			prev, ok := latest[name]
+			if ok && prev.item.BundleID != it.BundleID {
+				s.logger.Warn("mcp server: prompt name is taken by another bundle",
+					"name", name, "bundleID", it.BundleID, "other", prev.item.BundleID)
+				continue
+			}
+			if !ok || tpl.ModifiedAt.After(prev.tpl.ModifiedAt) {
+				latest[name] = entry{item: it, tpl: tpl}
+			}
+		}
+		if resp.Body.NextPageToken == nil || *resp.Body.NextPageToken == "" {
+			break
+		}
+		token = *resp.Body.NextPageToken
+	}
+
+	out := make([]exposedPrompt, 0, len(latest))
+	for name, e := range latest {
+		out = append(out, exposedPrompt{name: name, tpl: e.tpl})
+	}
+	slices.SortFunc(out, func(a, b exposedPrompt) int { return cmp.Compare(a.name, b.name) })
+	return out, nil
+}
+
+// promptArguments maps the user variables of a template into prompt arguments. Static variables are filled by the
+// server. Variables with a default are optional.
+func promptArguments(vars []spec.PromptVariable) []mcpPromptArgument {
+	args := make([]mcpPromptArgument, 0, len(vars))
+	for _, v := range vars {
+		if v.Source == spec.SourceStatic {
+			continue
+		}
+		desc := v.Description
+		switch v.Type {
+		case spec.VarEnum:
+			desc = joinDesc(desc, "One of: "+strings.Join(v.EnumValues, ", ")+".")
+		case spec.VarNumber, spec.VarBoolean, spec.VarDate:
+			desc = joinDesc(desc, fmt.Sprintf("A %s.", v.Type))
+		case spec.VarString:
+		}
+		args = append(args, mcpPromptArgument{
+			Name:        v.Name,
+			Description: desc,
+			Required:    v.Required && v.Default == "",
+		})
+	}
+	return args
+}
+
+func joinDesc(desc, more string) string {
+	if desc == "" {
+		return more
+	}
+	return strings.TrimRight(desc, ". ") + ". " + more
+}
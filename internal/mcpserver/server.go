@@ -0,0 +1,230 @@
+// Package mcpserver serves the enabled tools of the tool store and the enabled prompt templates of the prompt store
+// to Model Context Protocol clients, over stdio or streamable HTTP. Tools are invoked through the tool store, so they
+// behave as they do in the app.
+package mcpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/mcpclient"
+
+	promptSpec "github.com/flexigpt/flexigpt-app/internal/prompt/spec"
+	toolSpec "github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+const (
+	serverName = "flexigpt"
+	jsonRPCVer = "2.0"
+
+	// Separates bundle and item slugs in MCP tool and prompt names. Slugs never contain it.
+	nameSep = "_"
+)
+
+// Protocol revisions the server can speak; the first one is preferred.
+var supportedProtocolVersions = []string{mcpclient.ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// ToolStore lists and invokes tools. Implemented by the tool store.
+type ToolStore interface {
+	ListTools(ctx context.Context, req *toolSpec.ListToolsRequest) (*toolSpec.ListToolsResponse, error)
+	InvokeTool(ctx context.Context, req *toolSpec.InvokeToolRequest) (*toolSpec.InvokeToolResponse, error)
+}
+
+// PromptTemplateStore lists prompt templates. Implemented by the prompt template store.
+type PromptTemplateStore interface {
+	ListPromptTemplates(
+		ctx context.Context,
+		req *promptSpec.ListPromptTemplatesRequest,
+	) (*promptSpec.ListPromptTemplatesResponse, error)
+}
+
+type rpcMessage struct {
+	JSONRPC string              `json:"jsonrpc"`
+	ID      *json.RawMessage    `json:"id,omitempty"`
+	Method  string              `json:"method,omitempty"`
+	Params  json.RawMessage     `json:"params,omitempty"`
+	Result  any                 `json:"result,omitempty"`
+	Error   *mcpclient.RPCError `json:"error,omitempty"`
+}
+
+// Server answers MCP requests. Safe for concurrent use; it holds no state besides its stores.
+type Server struct {
+	tools   ToolStore
+	prompts PromptTemplateStore
+	version string
+	logger  *slog.Logger
+}
+
+type Option func(*Server)
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithVersion sets the server version reported on initialize.
+func WithVersion(version string) Option {
+	return func(s *Server) {
+		s.version = version
+	}
+}
+
+// NewServer returns a server for the given stores. Either store may be nil, in which case the server does not offer
+// the corresponding capability.
+func NewServer(tools ToolStore, prompts PromptTemplateStore, opts ...Option) (*Server, error) {
+	if tools == nil && prompts == nil {
+		return nil, errors.New("mcp server needs a tool store or a prompt template store")
+	}
+	s := &Server{
+		tools:   tools,
+		prompts: prompts,
+		version: "1.0.0",
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	if s.logger == nil {
+		s.logger = slog.Default()
+	}
+	return s, nil
+}
+
+// handle processes one JSON-RPC message or batch and returns the reply, or nil when there is nothing to send back.
+func (s *Server) handle(ctx context.Context, raw []byte) []byte {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(raw, &batch); err != nil || len(batch) == 0 {
+			return marshalReply(errorReply(nil, codeParseError, "invalid batch"))
+		}
+		replies := make([]*rpcMessage, 0, len(batch))
+		for _, m := range batch {
+			if r := s.handleMessage(ctx, m); r != nil {
+				replies = append(replies, r)
+			}
+		}
+		if len(replies) == 0 {
+			return nil
+		}
+		b, _ := json.Marshal(replies)
+		return b
+	}
+	if r := s.handleMessage(ctx, raw); r != nil {
+		return marshalReply(r)
+	}
+	return nil
+}
+
+func (s *Server) handleMessage(ctx context.Context, raw []byte) *rpcMessage {
+	var msg rpcMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return errorReply(nil, codeParseError, "parse error")
+	}
+	if msg.Method == "" {
+		// Responses to requests we never send.
+		return nil
+	}
+	if msg.ID == nil {
+		// Notifications: initialized and cancelled need no action here.
+		return nil
+	}
+	if msg.JSONRPC != jsonRPCVer {
+		return errorReply(msg.ID, codeInvalidRequest, "jsonrpc must be 2.0")
+	}
+
+	result, err := s.dispatch(ctx, msg.Method, msg.Params)
+	if err != nil {
+		var rpcErr *mcpclient.RPCError
+		if errors.As(err, &rpcErr) {
+			return &rpcMessage{JSONRPC: jsonRPCVer, ID: msg.ID, Error: rpcErr}
+		}
+		s.logger.Error("mcp request failed", "method", msg.Method, "err", err)
+		return errorReply(msg.ID, codeInternalError, err.Error())
+	}
+	return &rpcMessage{JSONRPC: jsonRPCVer, ID: msg.ID, Result: result}
+}
+
+func (s *Server) dispatch(ctx context.Context, method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "initialize":
+		return s.initialize(params)
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		if s.tools != nil {
+			return s.listTools(ctx)
+		}
+	case "tools/call":
+		if s.tools != nil {
+			return s.callTool(ctx, params)
+		}
+	case "prompts/list":
+		if s.prompts != nil {
+			return s.listPrompts(ctx)
+		}
+	case "prompts/get":
+		if s.prompts != nil {
+			return s.getPrompt(ctx, params)
+		}
+	}
+	return nil, &mcpclient.RPCError{Code: codeMethodNotFound, Message: "method not found: " + method}
+}
+
+func (s *Server) initialize(params json.RawMessage) (any, error) {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, invalidParams("invalid initialize params")
+	}
+	version := supportedProtocolVersions[0]
+	if slices.Contains(supportedProtocolVersions, p.ProtocolVersion) {
+		version = p.ProtocolVersion
+	}
+	caps := map[string]any{}
+	if s.tools != nil {
+		caps["tools"] = map[string]any{"listChanged": false}
+	}
+	if s.prompts != nil {
+		caps["prompts"] = map[string]any{"listChanged": false}
+	}
+	return map[string]any{
+		"protocolVersion": version,
+		"capabilities":    caps,
+		"serverInfo":      map[string]any{"name": serverName, "version": s.version},
+	}, nil
+}
+
+func invalidParams(msg string) error {
+	return &mcpclient.RPCError{Code: codeInvalidParams, Message: msg}
+}
+
+func errorReply(id *json.RawMessage, code int, msg string) *rpcMessage {
+	if id == nil {
+		// Errors that cannot be tied to a request carry a null id.
+		null := json.RawMessage("null")
+		id = &null
+	}
+	return &rpcMessage{JSONRPC: jsonRPCVer, ID: id, Error: &mcpclient.RPCError{Code: code, Message: msg}}
+}
+
+func marshalReply(r *rpcMessage) []byte {
+	b, _ := json.Marshal(r)
+	return b
+}
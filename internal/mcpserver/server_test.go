@@ -0,0 +1,301 @@
+package mcpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
+	"github.com/flexigpt/flexigpt-app/internal/tool/mcpclient"
+
+	promptSpec "github.com/flexigpt/flexigpt-app/internal/prompt/spec"
+	toolSpec "github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+type fakeToolStore struct {
+	items   []toolSpec.ToolListItem
+	invoked []toolSpec.InvokeToolRequest
+}
+
+func (f *fakeToolStore) ListTools(
+	ctx context.Context, req *toolSpec.ListToolsRequest,
+) (*toolSpec.ListToolsResponse, error) {
+	// Serve one item per page to exercise paging.
+	i := 0
+	if req.PageToken != "" {
+		i = int(req.PageToken[0] - '0')
+	}
+	body := &toolSpec.ListToolsResponseBody{ToolListItems: f.items[i : i+1]}
+	if i+1 < len(f.items) {
+		next := string(rune('0' + i + 1))
+		body.NextPageToken = &next
+	}
+	return &toolSpec.ListToolsResponse{Body: body}, nil
+}
+
+func (f *fakeToolStore) InvokeTool(
+	ctx context.Context, req *toolSpec.InvokeToolRequest,
+) (*toolSpec.InvokeToolResponse, error) {
+	f.invoked = append(f.invoked, *req)
+	if req.ToolSlug == "fail" {
+		return &toolSpec.InvokeToolResponse{Body: &toolSpec.InvokeToolResponseBody{
+			IsError: true, ErrorMessage: "boom",
+		}}, nil
+	}
+	return &toolSpec.InvokeToolResponse{Body: &toolSpec.InvokeToolResponseBody{
+		Outputs: []toolSpec.ToolStoreOutputUnion{{
+			Kind:     toolSpec.ToolStoreOutputKindText,
+			TextItem: &toolSpec.ToolStoreOutputText{Text: "echo " + string(req.Body.Args)},
+		}},
+	}}, nil
+}
+
+type fakePromptStore struct {
+	templates []promptSpec.PromptTemplate
+}
+
+func (f *fakePromptStore) ListPromptTemplates(
+	ctx context.Context, req *promptSpec.ListPromptTemplatesRequest,
+) (*promptSpec.ListPromptTemplatesResponse, error) {
+	items := make([]promptSpec.PromptTemplateListItem, 0, len(f.templates))
+	for _, t := range f.templates {
+		items = append(items, promptSpec.PromptTemplateListItem{
+			BundleID: "b1", BundleSlug: "writing", TemplateSlug: t.Slug, TemplateVersion: t.Version,
+			TemplateDefinition: t,
+		})
+	}
+	return &promptSpec.ListPromptTemplatesResponse{
+		Body: &promptSpec.ListPromptTemplatesResponseBody{PromptTemplateListItems: items},
+	}, nil
+}
+
+func toolItem(
+	bundleSlug bundleitemutils.BundleSlug,
+	slug bundleitemutils.ItemSlug,
+	version bundleitemutils.ItemVersion,
+	modified time.Time,
+	llmCallable bool,
+) toolSpec.ToolListItem {
+	return toolSpec.ToolListItem{
+		BundleID:    bundleitemutils.BundleID("id-" + bundleSlug),
+		BundleSlug:  bundleSlug,
+		ToolSlug:    slug,
+		ToolVersion: version,
+		ToolDefinition: toolSpec.Tool{
+			Slug:        slug,
+			Version:     version,
+			DisplayName: string(slug),
+			IsEnabled:   true,
+			LLMCallable: llmCallable,
+			ArgSchema:   toolSpec.JSONSchema(`{"type":"object"}`),
+			Type:        toolSpec.ToolTypeHTTP,
+			ModifiedAt:  modified,
+		},
+	}
+}
+
+func newTestServer(t *testing.T) (*Server, *fakeToolStore) {
+	t.Helper()
+	now := time.Now()
+	tools := &fakeToolStore{items: []toolSpec.ToolListItem{
+		toolItem("web", "fetch", "v1", now.Add(-time.Hour), true),
+		toolItem("web", "fetch", "v2", now, true),
+		toolItem("web", "fail", "v1", now, true),
+		toolItem("web", "private", "v1", now, false),
+	}}
+	prompts := &fakePromptStore{templates: []promptSpec.PromptTemplate{{
+		Slug:        "summarize",
+		Version:     "v1",
+		IsEnabled:   true,
+		DisplayName: "Summarize",
+		ModifiedAt:  now,
+		Blocks: []promptSpec.MessageBlock{
+			{ID: "1", Role: promptSpec.System, Content: "Write in {{tone}} tone for {{audience}}."},
+			{ID: "2", Role: promptSpec.User, Content: "Summarize: {{text}}"},
+		},
+		Variables: []promptSpec.PromptVariable{
+			{Name: "text", Type: promptSpec.VarString, Required: true, Source: promptSpec.SourceUser},
+			{
+				Name: "tone", Type: promptSpec.VarEnum, Source: promptSpec.SourceUser,
+				EnumValues: []string{"formal", "casual"}, Default: "formal", Required: true,
+			},
+			{Name: "audience", Type: promptSpec.VarString, Source: promptSpec.SourceStatic, StaticVal: "engineers"},
+		},
+	}}}
+	s, err := NewServer(tools, prompts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, tools
+}
+
+func TestServerToolsOverHTTP(t *testing.T) {
+	s, tools := newTestServer(t)
+	srv := httptest.NewServer(s.HTTPHandler())
+	defer srv.Close()
+
+	m := mcpclient.NewManager(mcpclient.WithHTTPClient(srv.Client()))
+	defer m.Close()
+	cfg := &toolSpec.MCPServerConfig{Transport: toolSpec.MCPTransportStreamableHTTP, URL: srv.URL}
+
+	listed, err := m.Tools(t.Context(), "self", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 || listed[0].Name != "web_fail" || listed[1].Name != "web_fetch" {
+		t.Fatalf("tools = %+v", listed)
+	}
+
+	res, err := m.CallTool(t.Context(), "self", cfg, "web_fetch", json.RawMessage(`{"url":"x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.IsError || len(res.Content) != 1 || res.Content[0].Text != `echo {"url":"x"}` {
+		t.Errorf("result = %+v", res)
+	}
+	if got := tools.invoked[0]; got.BundleID != "id-web" || got.ToolSlug != "fetch" || got.Version != "v2" {
+		t.Errorf("invoked = %+v", got)
+	}
+
+	res, err = m.CallTool(t.Context(), "self", cfg, "web_fail", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError || mcpclient.ErrorText(res) != "boom" {
+		t.Errorf("fail result = %+v", res)
+	}
+
+	var rpcErr *mcpclient.RPCError
+	if _, err := m.CallTool(t.Context(), "self", cfg, "web_private", nil); !errors.As(err, &rpcErr) ||
+		rpcErr.Code != codeInvalidParams {
+		t.Errorf("expected unknown tool error, got %v", err)
+	}
+}
+
+func TestServerHTTPSessions(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.HTTPHandler()
+
+	post := func(sid, origin, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+		if sid != "" {
+			req.Header.Set(headerSessionID, sid)
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ping := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	if rec := post("", "", ping); rec.Code != http.StatusBadRequest {
+		t.Errorf("ping without session: %d", rec.Code)
+	}
+	if rec := post("", "https://evil.example", ping); rec.Code != http.StatusForbidden {
+		t.Errorf("foreign origin: %d", rec.Code)
+	}
+
+	rec := post("", "http://localhost:3000", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	sid := rec.Header().Get(headerSessionID)
+	if rec.Code != http.StatusOK || sid == "" {
+		t.Fatalf("initialize: %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := post(sid, "", `{"jsonrpc":"2.0","method":"notifications/initialized"}`); rec.Code != http.StatusAccepted {
+		t.Errorf("notification: %d", rec.Code)
+	}
+	if rec := post(sid, "", ping); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"result":{}`) {
+		t.Errorf("ping: %d %s", rec.Code, rec.Body.String())
+	}
+
+	del := httptest.NewRequest(http.MethodDelete, "/mcp", nil)
+	del.Header.Set(headerSessionID, sid)
+	h.ServeHTTP(httptest.NewRecorder(), del)
+	if rec := post(sid, "", ping); rec.Code != http.StatusNotFound {
+		t.Errorf("ping after delete: %d", rec.Code)
+	}
+}
+
+func TestServerPromptsOverStdio(t *testing.T) {
+	s, _ := newTestServer(t)
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"prompts/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"prompts/get","params":{"name":"writing_summarize","arguments":{"text":"T"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"prompts/get","params":{"name":"writing_summarize","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"prompts/get",` +
+			`"params":{"name":"writing_summarize","arguments":{"text":"T","tone":"angry"}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"resources/list"}`,
+		`not json`,
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	if err := s.ServeStdio(t.Context(), strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	replies := map[string]map[string]any{}
+	for line := range strings.SplitSeq(strings.TrimSpace(out.String()), "\n") {
+		var r map[string]any
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("bad reply %q: %v", line, err)
+		}
+		id, _ := json.Marshal(r["id"])
+		replies[string(id)] = r
+	}
+	if len(replies) != 7 {
+		t.Fatalf("replies = %v", replies)
+	}
+
+	init := replies["1"]["result"].(map[string]any)
+	if init["protocolVersion"] != "2025-03-26" {
+		t.Errorf("initialize = %v", init)
+	}
+
+	var list struct {
+		Prompts []mcpPromptDef `json:"prompts"`
+	}
+	remarshal(t, replies["2"]["result"], &list)
+	if len(list.Prompts) != 1 || list.Prompts[0].Name != "writing_summarize" ||
+		len(list.Prompts[0].Arguments) != 2 ||
+		!list.Prompts[0].Arguments[0].Required || list.Prompts[0].Arguments[1].Required {
+		t.Errorf("prompts = %+v", list.Prompts)
+	}
+
+	var got struct {
+		Messages []mcpPromptMessage `json:"messages"`
+	}
+	remarshal(t, replies["3"]["result"], &got)
+	if len(got.Messages) != 2 ||
+		got.Messages[0].Role != "user" || got.Messages[0].Content.Text != "Write in formal tone for engineers." ||
+		got.Messages[1].Content.Text != "Summarize: T" {
+		t.Errorf("messages = %+v", got.Messages)
+	}
+
+	for id, code := range map[string]float64{
+		"4": codeInvalidParams, "5": codeInvalidParams, "6": codeMethodNotFound, "null": codeParseError,
+	} {
+		e, _ := replies[id]["error"].(map[string]any)
+		if e == nil || e["code"] != code {
+			t.Errorf("reply %s = %v, want error %v", id, replies[id], code)
+		}
+	}
+}
+
+func remarshal(t *testing.T, in, out any) {
+	t.Helper()
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,168 @@
+package mcpserver
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
+	"github.com/flexigpt/flexigpt-app/internal/tool/mcpclient"
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+// Bounds the pages read from the tool store for one listing.
+const maxStorePages = 1000
+
+type mcpToolDef struct {
+	Name        string          `json:"name"`
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// exposedTool is a tool store tool offered under an MCP name.
+type exposedTool struct {
+	name string
+	item spec.ToolListItem
+}
+
+func (s *Server) listTools(ctx context.Context) (any, error) {
+	tools, err := s.exposedTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defs := make([]mcpToolDef, 0, len(tools))
+	for _, t := range tools {
+		def := t.item.ToolDefinition
+		defs = append(defs, mcpToolDef{
+			Name:        t.name,
+			Title:       def.DisplayName,
+			Description: def.Description,
+			InputSchema: json.RawMessage(def.ArgSchema),
+		})
+	}
+	return map[string]any{"tools": defs}, nil
+}
+
+// callTool invokes a tool through the tool store. Failures of the tool are reported in the result so that the model
+// can see them; only unknown tools are protocol errors.
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (any, error) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.Name == "" {
+		return nil, invalidParams("tools/call needs a tool name")
+	}
+	tools, err := s.exposedTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idx := slices.IndexFunc(tools, func(t exposedTool) bool { return t.name == p.Name })
+	if idx < 0 {
+		return nil, invalidParams("unknown tool: " + p.Name)
+	}
+	item := tools[idx].item
+
+	args := "{}"
+	if len(p.Arguments) > 0 && string(p.Arguments) != "null" {
+		args = string(p.Arguments)
+	}
+	resp, err := s.tools.InvokeTool(ctx, &spec.InvokeToolRequest{
+		BundleID: item.BundleID,
+		ToolSlug: item.ToolSlug,
+		Version:  item.ToolVersion,
+		Body:     &spec.InvokeToolRequestBody{Args: spec.JSONRawString(args)},
+	})
+	if err != nil {
+		return toolErrorResult(err.Error()), nil
+	}
+	content := toolContent(resp.Body.Outputs)
+	if resp.Body.IsError {
+		if resp.Body.ErrorMessage != "" {
+			content = append(content, mcpclient.Content{Type: "text", Text: resp.Body.ErrorMessage})
+		}
+		return mcpclient.CallToolResult{Content: content, IsError: true}, nil
+	}
+	return mcpclient.CallToolResult{Content: content}, nil
+}
+
+// exposedTools returns the enabled tools that models may call and that the tool store can invoke, named
+// <bundleSlug>_<toolSlug>. Only the most recently modified version of a tool is offered.
+func (s *Server) exposedTools(ctx context.Context) ([]exposedTool, error) {
+	latest := map[string]spec.ToolListItem{}
+	token := ""
+	for range maxStorePages {
+		resp, err := s.tools.ListTools(ctx, &spec.ListToolsRequest{PageToken: token})
+		if err != nil {
+			return nil, err
+		}
+		for _, it := range resp.Body.ToolListItems {
+			def := it.ToolDefinition
+			if !def.IsEnabled || !def.LLMCallable || def.Type == spec.ToolTypeSDK {
+				continue
+			}
+			name := itemName(it.BundleSlug, it.ToolSlug)
+			prev, ok := latest[name]
+			if ok && prev.BundleID != it.BundleID {
+				s.logger.Warn("mcp server: tool name is taken by another bundle",
+					"name", name, "bundleID", it.BundleID, "other", prev.BundleID)
+				continue
+			}
+			if !ok || def.ModifiedAt.After(prev.ToolDefinition.ModifiedAt) {
+				latest[name] = it
+			}
+		}
+		if resp.Body.NextPageToken == nil || *resp.Body.NextPageToken == "" {
+			break
+		}
+		token = *resp.Body.NextPageToken
+	}
+
+	out := make([]exposedTool, 0, len(latest))
+	for name, it := range latest {
+		out = append(out, exposedTool{name: name, item: it})
+	}
+	slices.SortFunc(out, func(a, b exposedTool) int { return cmp.Compare(a.name, b.name) })
+	return out, nil
+}
+
+// toolContent maps tool store outputs into MCP content. Files become embedded resources.
+func toolContent(outputs []spec.ToolStoreOutputUnion) []mcpclient.Content {
+	content := make([]mcpclient.Content, 0, len(outputs))
+	for _, o := range outputs {
+		switch {
+		case o.Kind == spec.ToolStoreOutputKindText && o.TextItem != nil && o.TextItem.Text != "":
+			content = append(content, mcpclient.Content{Type: "text", Text: o.TextItem.Text})
+		case o.Kind == spec.ToolStoreOutputKindImage && o.ImageItem != nil:
+			content = append(content, mcpclient.Content{
+				Type:     "image",
+				Data:     o.ImageItem.ImageData,
+				MIMEType: o.ImageItem.ImageMIME,
+			})
+		case o.Kind == spec.ToolStoreOutputKindFile && o.FileItem != nil:
+			content = append(content, mcpclient.Content{
+				Type: "resource",
+				Resource: &mcpclient.ResourceContents{
+					URI:      "file:///" + strings.TrimLeft(o.FileItem.FileName, "/"),
+					MIMEType: o.FileItem.FileMIME,
+					Blob:     o.FileItem.FileData,
+				},
+			})
+		}
+	}
+	return content
+}
+
+func toolErrorResult(msg string) mcpclient.CallToolResult {
+	return mcpclient.CallToolResult{
+		Content: []mcpclient.Content{{Type: "text", Text: msg}},
+		IsError: true,
+	}
+}
+
+func itemName(bundle bundleitemutils.BundleSlug, item bundleitemutils.ItemSlug) string {
+	return string(bundle) + nameSep + string(item)
+}
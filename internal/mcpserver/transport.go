@@ -0,0 +1,211 @@
+package mcpserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+const (
+	headerSessionID = "Mcp-Session-Id"
+
+	// Bounds a single message on either transport.
+	maxMessageBytes = 16 << 20
+)
+
+// ServeStdio reads newline-delimited messages from r and writes the replies to w until r is exhausted or ctx is
+// done. Requests are handled concurrently, so a slow tool call does not hold up pings.
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		writeMu sync.Mutex
+		werr    error
+	)
+	write := func(reply []byte) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if werr != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", reply); err != nil {
+			werr = err
+			cancel()
+		}
+	}
+
+	lines := make(chan []byte)
+	scanErr := make(chan error, 1)
+	go func() {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), maxMessageBytes)
+		for sc.Scan() {
+			line := append([]byte(nil), sc.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		scanErr <- sc.Err()
+		close(lines)
+	}()
+
+	var err error
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break loop
+		case line, ok := <-lines:
+			if !ok {
+				err = <-scanErr
+				break loop
+			}
+			if len(line) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if reply := s.handle(ctx, line); reply != nil {
+					write(reply)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	if werr != nil {
+		return werr
+	}
+	return err
+}
+
+// HTTPHandler returns a handler for the streamable HTTP transport. Every POST is answered with JSON; the server never
+// opens SSE streams and so rejects GET. Sessions start on initialize and end on DELETE.
+func (s *Server) HTTPHandler() http.Handler {
+	return &httpTransport{s: s, sessions: map[string]struct{}{}}
+}
+
+type httpTransport struct {
+	s *Server
+
+	mu       sync.Mutex
+	sessions map[string]struct{}
+}
+
+func (h *httpTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Guard against DNS rebinding: browsers may only reach the server from local pages.
+	if !allowedOrigin(r.Header.Get("Origin")) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	sid := r.Header.Get(headerSessionID)
+
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		if !h.endSession(sid) {
+			http.NotFound(w, r)
+		}
+		return
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageBytes))
+	if err != nil {
+		http.Error(w, "cannot read request", http.StatusBadRequest)
+		return
+	}
+	if isInitialize(body) {
+		sid, err = h.startSession()
+		if err != nil {
+			http.Error(w, "cannot start session", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(headerSessionID, sid)
+	} else if !h.hasSession(sid) {
+		if sid == "" {
+			http.Error(w, "missing "+headerSessionID+" header", http.StatusBadRequest)
+		} else {
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	reply := h.s.handle(r.Context(), body)
+	if reply == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(reply)
+}
+
+func (h *httpTransport) startSession() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	sid := hex.EncodeToString(b)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sessions[sid] = struct{}{}
+	return sid, nil
+}
+
+func (h *httpTransport) hasSession(sid string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.sessions[sid]
+	return ok
+}
+
+func (h *httpTransport) endSession(sid string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.sessions[sid]; !ok {
+		return false
+	}
+	delete(h.sessions, sid)
+	return true
+}
+
+func isInitialize(body []byte) bool {
+	var msg rpcMessage
+	return json.Unmarshal(body, &msg) == nil && msg.Method == "initialize"
+}
+
+// allowedOrigin accepts requests without an Origin header, which are not made by browsers, and requests from
+// loopback origins.
+func allowedOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -29,6 +29,7 @@ type PutProviderPresetRequestBody struct {
 	ChatCompletionPathPrefix string                          `json:"chatCompletionPathPrefix"  required:"true"`
 	APIKeyHeaderKey          string                          `json:"apiKeyHeaderKey,omitempty"`
 	DefaultHeaders           map[string]string               `json:"defaultHeaders,omitempty"`
+	RateLimits               *ProviderRateLimits             `json:"rateLimits,omitempty"`
 }
 type PutProviderPresetRequest struct {
 	ProviderName inferencegoSpec.ProviderName `path:"providerName" required:"true"`
@@ -38,8 +39,9 @@ type PutProviderPresetRequest struct {
 type PutProviderPresetResponse struct{}
 
 type PatchProviderPresetRequestBody struct {
-	IsEnabled            *bool          `json:"isEnabled,omitempty"`
-	DefaultModelPresetID *ModelPresetID `json:"defaultModelPresetID,omitempty"`
+	IsEnabled            *bool               `json:"isEnabled,omitempty"`
+	DefaultModelPresetID *ModelPresetID      `json:"defaultModelPresetID,omitempty"`
+	RateLimits           *ProviderRateLimits `json:"rateLimits,omitempty"`
 }
 
 type PatchProviderPresetRequest struct {
@@ -68,6 +70,7 @@ type PutModelPresetRequestBody struct {
 	SystemPrompt                *string                         `json:"systemPrompt,omitempty"`
 	Timeout                     *int                            `json:"timeout,omitempty"`
 	AdditionalParametersRawJSON *string                         `json:"additionalParametersRawJSON,omitempty"`
+	ReasoningReplay             ReasoningReplayPolicy           `json:"reasoningReplay,omitempty"`
 }
 
 type PutModelPresetRequest struct {
@@ -114,3 +117,42 @@ type ListProviderPresetsResponseBody struct {
 type ListProviderPresetsResponse struct {
 	Body *ListProviderPresetsResponseBody
 }
+
+type PutModelRouterRequestBody struct {
+	DisplayName string      `json:"displayName" required:"true"`
+	IsEnabled   bool        `json:"isEnabled"   required:"true"`
+	Rules       []RouteRule `json:"rules"`
+	Fallback    RouteTarget `json:"fallback"    required:"true"`
+}
+
+type PutModelRouterRequest struct {
+	RouterID ModelRouterID `path:"routerID" required:"true"`
+	Body     *PutModelRouterRequestBody
+}
+
+type PutModelRouterResponse struct{}
+
+type DeleteModelRouterRequest struct {
+	RouterID ModelRouterID `path:"routerID" required:"true"`
+}
+
+type DeleteModelRouterResponse struct{}
+
+type ListModelRoutersRequest struct{}
+
+type ListModelRoutersResponseBody struct {
+	ModelRouters []ModelRouter `json:"modelRouters"`
+}
+
+type ListModelRoutersResponse struct {
+	Body *ListModelRoutersResponseBody
+}
+
+type ResolveModelRouteRequest struct {
+	RouterID ModelRouterID `path:"routerID" required:"true"`
+	Body     *RouteSignals
+}
+
+type ResolveModelRouteResponse struct {
+	Body *RouteDecision
+}
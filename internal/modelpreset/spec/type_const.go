@@ -4,6 +4,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/flexigpt/flexigpt-app/internal/attachment"
 	inferencegoSpec "github.com/flexigpt/inference-go/spec"
 )
 
@@ -46,6 +47,8 @@ var (
 	ErrNoModelPresets   = errors.New("provider has no model presets")
 	ErrInvalidTimestamp = errors.New("zero timestamp")
 	ErrBuiltInReadOnly  = errors.New("built-in resource is read-only")
+
+	ErrModelRouterNotFound = errors.New("model router not found")
 )
 
 type (
@@ -55,6 +58,20 @@ type (
 	ModelPresetID    string
 
 	ProviderDisplayName string
+
+	ModelRouterID string
+)
+
+// ReasoningReplayPolicy decides how reasoning outputs of earlier turns are sent back with the conversation history.
+// Empty picks a policy from the provider SDK type.
+type ReasoningReplayPolicy string
+
+const (
+	// ReasoningReplaySameModel keeps reasoning produced by the provider and model being called and drops the rest.
+	ReasoningReplaySameModel ReasoningReplayPolicy = "sameModel"
+	ReasoningReplayDrop      ReasoningReplayPolicy = "drop"
+	// ReasoningReplayText replays the readable thinking and summaries as plain assistant text.
+	ReasoningReplayText ReasoningReplayPolicy = "text"
 )
 
 // ModelPreset is the entire "model + default knobs" bundle the user can save.
@@ -75,12 +92,39 @@ type ModelPreset struct {
 	SystemPrompt                *string                         `json:"systemPrompt,omitempty"`
 	Timeout                     *int                            `json:"timeout,omitempty"`
 	AdditionalParametersRawJSON *string                         `json:"additionalParametersRawJSON,omitempty"`
+	ReasoningReplay             ReasoningReplayPolicy           `json:"reasoningReplay,omitempty"`
 
 	CreatedAt  time.Time `json:"createdAt"`
 	ModifiedAt time.Time `json:"modifiedAt"`
 	IsBuiltIn  bool      `json:"isBuiltIn"`
 }
 
+// ModelParam returns the inference model param configured by the preset.
+func (mp *ModelPreset) ModelParam() inferencegoSpec.ModelParam {
+	p := inferencegoSpec.ModelParam{
+		Name:                        inferencegoSpec.ModelName(mp.Name),
+		Temperature:                 mp.Temperature,
+		Reasoning:                   mp.Reasoning,
+		AdditionalParametersRawJSON: mp.AdditionalParametersRawJSON,
+	}
+	if mp.Stream != nil {
+		p.Stream = *mp.Stream
+	}
+	if mp.MaxPromptLength != nil {
+		p.MaxPromptLength = *mp.MaxPromptLength
+	}
+	if mp.MaxOutputLength != nil {
+		p.MaxOutputLength = *mp.MaxOutputLength
+	}
+	if mp.SystemPrompt != nil {
+		p.SystemPrompt = *mp.SystemPrompt
+	}
+	if mp.Timeout != nil {
+		p.Timeout = *mp.Timeout
+	}
+	return p
+}
+
 type ProviderPreset struct {
 	SchemaVersion string                          `json:"schemaVersion" required:"true"`
 	Name          inferencegoSpec.ProviderName    `json:"name"          required:"true"`
@@ -97,12 +141,104 @@ type ProviderPreset struct {
 	APIKeyHeaderKey          string            `json:"apiKeyHeaderKey"          required:"true"`
 	DefaultHeaders           map[string]string `json:"defaultHeaders"`
 
+	// RateLimits throttles calls to the provider. Nil means no client side limits.
+	RateLimits *ProviderRateLimits `json:"rateLimits,omitempty"`
+
 	DefaultModelPresetID ModelPresetID                 `json:"defaultModelPresetID"`
 	ModelPresets         map[ModelPresetID]ModelPreset `json:"modelPresets"`
 }
 
+// ProviderRateLimits are client side limits applied to all calls to a provider.
+// A zero value disables the corresponding limit.
+type ProviderRateLimits struct {
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty" minimum:"0"`
+	TokensPerMinute   int `json:"tokensPerMinute,omitempty"   minimum:"0"`
+	MaxConcurrency    int `json:"maxConcurrency,omitempty"    minimum:"0"`
+}
+
 type PresetsSchema struct {
 	SchemaVersion   string                                          `json:"schemaVersion"`
 	DefaultProvider inferencegoSpec.ProviderName                    `json:"defaultProvider"`
 	ProviderPresets map[inferencegoSpec.ProviderName]ProviderPreset `json:"providerPresets"`
+	ModelRouters    map[ModelRouterID]ModelRouter                   `json:"modelRouters,omitempty"`
+}
+
+// CostTier is an explicit cost preference a request can carry for routing.
+type CostTier string
+
+const (
+	CostTierLow      CostTier = "low"
+	CostTierStandard CostTier = "standard"
+	CostTierHigh     CostTier = "high"
+)
+
+// RouteTarget is the model preset a route resolves to.
+type RouteTarget struct {
+	ProviderName  inferencegoSpec.ProviderName `json:"providerName"  required:"true"`
+	ModelPresetID ModelPresetID                `json:"modelPresetID" required:"true"`
+}
+
+// RouteCondition matches a request when all of its set fields match.
+type RouteCondition struct {
+	// AttachmentKinds matches when the current turn has an attachment of any of these kinds.
+	AttachmentKinds []attachment.AttachmentKind `json:"attachmentKinds,omitempty"`
+	// MinPromptTokens and MaxPromptTokens bound the estimated prompt tokens, inclusive. Zero leaves a bound unset.
+	MinPromptTokens int `json:"minPromptTokens,omitempty" minimum:"0"`
+	MaxPromptTokens int `json:"maxPromptTokens,omitempty" minimum:"0"`
+	// ToolsEnabled matches on whether the request enables any tools.
+	ToolsEnabled *bool `json:"toolsEnabled,omitempty"`
+	// Keywords matches when the current user text contains any of them, ignoring case.
+	Keywords []string `json:"keywords,omitempty"`
+	// CostTiers matches when the request asks for one of these tiers.
+	CostTiers []CostTier `json:"costTiers,omitempty"`
+}
+
+type RouteRule struct {
+	Name   string         `json:"name"   required:"true"`
+	When   RouteCondition `json:"when"`
+	Target RouteTarget    `json:"target" required:"true"`
+}
+
+// ModelRouter is a "smart default" model that routes each request to a concrete model preset. Rules are evaluated
+// in order and the first match wins; Fallback is used when no rule matches.
+type ModelRouter struct {
+	SchemaVersion string        `json:"schemaVersion" required:"true"`
+	ID            ModelRouterID `json:"id"            required:"true"`
+	DisplayName   string        `json:"displayName"   required:"true"`
+	IsEnabled     bool          `json:"isEnabled"     required:"true"`
+	Rules         []RouteRule   `json:"rules"`
+	Fallback      RouteTarget   `json:"fallback"      required:"true"`
+
+	CreatedAt  time.Time `json:"createdAt"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+}
+
+// RouteSignals describe the request being routed.
+type RouteSignals struct {
+	AttachmentKinds       []attachment.AttachmentKind `json:"attachmentKinds,omitempty"`
+	EstimatedPromptTokens int                         `json:"estimatedPromptTokens"      minimum:"0"`
+	ToolsEnabled          bool                        `json:"toolsEnabled"`
+	// Text is the user text of the current turn.
+	Text     string   `json:"text,omitempty"`
+	CostTier CostTier `json:"costTier,omitempty"`
+}
+
+// RuleEvaluation explains how one rule was evaluated.
+type RuleEvaluation struct {
+	RuleName string `json:"ruleName"`
+	Matched  bool   `json:"matched"`
+	// Reasons has one entry per condition of the rule, in field order.
+	Reasons []string `json:"reasons"`
+}
+
+// RouteDecision is the outcome of routing a request.
+type RouteDecision struct {
+	RouterID ModelRouterID `json:"routerID"`
+	Target   RouteTarget   `json:"target"`
+	// RuleName is the matched rule. It is empty when the fallback was used.
+	RuleName    string `json:"ruleName,omitempty"`
+	Explanation string `json:"explanation"`
+	// Evaluations lists the rules evaluated before the decision, in order.
+	Evaluations []RuleEvaluation `json:"evaluations"`
+	ModelPreset ModelPreset      `json:"modelPreset"`
 }
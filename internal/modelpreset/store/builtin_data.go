@@ -33,6 +33,11 @@ type builtInProviderDefaultModelIDKey inferencegoSpec.ProviderName
 func (builtInProviderDefaultModelIDKey) Group() overlay.GroupID { return "providerDefaultModelIDs" }
 func (k builtInProviderDefaultModelIDKey) ID() overlay.KeyID    { return overlay.KeyID(k) }
 
+type builtInProviderRateLimitsKey inferencegoSpec.ProviderName
+
+func (builtInProviderRateLimitsKey) Group() overlay.GroupID { return "providerRateLimits" }
+func (k builtInProviderRateLimitsKey) ID() overlay.KeyID    { return overlay.KeyID(k) }
+
 // BuiltInPresets loads built-in preset assets and maintains an overlay store.
 type BuiltInPresets struct {
 	// Immutable original data.
@@ -54,6 +59,7 @@ type BuiltInPresets struct {
 	providerOverlayFlags               *overlay.TypedGroup[builtInProviderKey, bool]
 	modelOverlayFlags                  *overlay.TypedGroup[builtInModelKey, bool]
 	providerDefaultModelIDOverlayFlags *overlay.TypedGroup[builtInProviderDefaultModelIDKey, spec.ModelPresetID]
+	providerRateLimitsOverlayFlags     *overlay.TypedGroup[builtInProviderRateLimitsKey, spec.ProviderRateLimits]
 
 	rebuilder *builtin.AsyncRebuilder
 }
@@ -90,6 +96,7 @@ func NewBuiltInPresets(
 		overlay.WithKeyType[builtInProviderKey](),
 		overlay.WithKeyType[builtInModelKey](),
 		overlay.WithKeyType[builtInProviderDefaultModelIDKey](),
+		overlay.WithKeyType[builtInProviderRateLimitsKey](),
 	)
 	if err != nil {
 		return nil, err
@@ -110,6 +117,12 @@ func NewBuiltInPresets(
 		return nil, err
 	}
 
+	providerRateLimitsOverlayFlags, err := overlay.NewTypedGroup[
+		builtInProviderRateLimitsKey, spec.ProviderRateLimits](ctx, store)
+	if err != nil {
+		return nil, err
+	}
+
 	b := &BuiltInPresets{
 		presetsFS:                          builtin.BuiltInModelPresetsFS,
 		presetsDir:                         builtin.BuiltInModelPresetsRootDir,
@@ -118,6 +131,7 @@ func NewBuiltInPresets(
 		providerOverlayFlags:               providerOverlayFlags,
 		modelOverlayFlags:                  modelOverlayFlags,
 		providerDefaultModelIDOverlayFlags: providerDefaultModelIDOverlayFlags,
+		providerRateLimitsOverlayFlags:     providerRateLimitsOverlayFlags,
 	}
 	for _, o := range opts {
 		o(b)
@@ -287,6 +301,33 @@ func (b *BuiltInPresets) SetDefaultModelPreset(
 	return pp, nil
 }
 
+// SetProviderRateLimits overrides the rate limits of a built-in provider.
+func (b *BuiltInPresets) SetProviderRateLimits(
+	ctx context.Context,
+	provider inferencegoSpec.ProviderName,
+	limits spec.ProviderRateLimits,
+) (spec.ProviderPreset, error) {
+	if _, ok := b.providers[provider]; !ok {
+		return spec.ProviderPreset{}, spec.ErrProviderNotFound
+	}
+
+	flag, err := b.providerRateLimitsOverlayFlags.SetFlag(
+		ctx, builtInProviderRateLimitsKey(provider), limits)
+	if err != nil {
+		return spec.ProviderPreset{}, err
+	}
+
+	b.mu.Lock()
+	pp := b.viewProv[provider]
+	pp.RateLimits = &limits
+	pp.ModifiedAt = flag.ModifiedAt
+	b.viewProv[provider] = pp
+	b.mu.Unlock()
+
+	b.rebuilder.Trigger()
+	return pp, nil
+}
+
 func (b *BuiltInPresets) loadFromFS(ctx context.Context) error {
 	subFS, err := resolvePresetsFS(b.presetsFS, b.presetsDir)
 	if err != nil {
@@ -373,6 +414,17 @@ func (b *BuiltInPresets) rebuildSnapshot(ctx context.Context) error {
 			p.ModifiedAt = flag.ModifiedAt
 		}
 
+		if flag, ok, err := b.providerRateLimitsOverlayFlags.GetFlag(
+			ctx, builtInProviderRateLimitsKey(pname)); err != nil {
+			return err
+		} else if ok {
+			rl := flag.Value
+			p.RateLimits = &rl
+			if flag.ModifiedAt.After(p.ModifiedAt) {
+				p.ModifiedAt = flag.ModifiedAt
+			}
+		}
+
 		if flag, ok, err := b.providerOverlayFlags.GetFlag(ctx, builtInProviderKey(pname)); err != nil {
 			return err
 		} else if ok {
@@ -556,6 +556,41 @@ func TestSetDefaultModelPreset(t *testing.T) {
 	}
 }
 
+func TestSetProviderRateLimits(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+	bi, err := NewBuiltInPresets(ctx, dir, 0)
+	if err != nil {
+		t.Fatalf("NewBuiltInPresets: %v", err)
+	}
+
+	if _, err := bi.SetProviderRateLimits(ctx, "ghost", spec.ProviderRateLimits{}); err == nil {
+		t.Fatal("expected error for nonexistent provider")
+	}
+
+	prov, _, _ := bi.ListBuiltInPresets(ctx)
+	pn, _ := anyProvider(prov)
+	want := spec.ProviderRateLimits{RequestsPerMinute: 60, TokensPerMinute: 90000, MaxConcurrency: 2}
+	if _, err := bi.SetProviderRateLimits(ctx, pn, want); err != nil {
+		t.Fatalf("SetProviderRateLimits: %v", err)
+	}
+
+	prov, _, _ = bi.ListBuiltInPresets(ctx)
+	if got := prov[pn].RateLimits; got == nil || *got != want {
+		t.Fatalf("snapshot rateLimits = %v, want %v", got, want)
+	}
+
+	// A fresh instance over the same overlay must see the persisted limits.
+	bi2, err := NewBuiltInPresets(ctx, dir, 0)
+	if err != nil {
+		t.Fatalf("NewBuiltInPresets (reopen): %v", err)
+	}
+	prov, _, _ = bi2.ListBuiltInPresets(ctx)
+	if got := prov[pn].RateLimits; got == nil || *got != want {
+		t.Fatalf("rateLimits after reopen = %v, want %v", got, want)
+	}
+}
+
 func TestRebuildSnapshot_DefaultModelPreset(t *testing.T) {
 	ctx := t.Context()
 	dir := t.TempDir()
@@ -11,6 +11,7 @@ const (
 	tag           = "ModelPresetStore"
 	topPathPrefix = "/modelpresets"
 	pathPrefix    = topPathPrefix + "/providers"
+	routerPrefix  = topPathPrefix + "/routers"
 )
 
 // InitModelPresetStoreHandlers registers all endpoints related to settings.
@@ -87,4 +88,37 @@ func InitModelPresetStoreHandlers(api huma.API, modelPresetStoreAPI *ModelPreset
 		Description: "List the entire presets object from the store",
 		Tags:        []string{tag},
 	}, modelPresetStoreAPI.ListProviderPresets)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "put-model-router",
+		Method:      http.MethodPut,
+		Path:        routerPrefix + "/{routerID}",
+		Summary:     "Add or replace a model router",
+		Tags:        []string{tag},
+	}, modelPresetStoreAPI.PutModelRouter)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-model-router",
+		Method:      http.MethodDelete,
+		Path:        routerPrefix + "/{routerID}",
+		Summary:     "Delete a model router",
+		Tags:        []string{tag},
+	}, modelPresetStoreAPI.DeleteModelRouter)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-model-routers",
+		Method:      http.MethodGet,
+		Path:        routerPrefix,
+		Summary:     "List all model routers",
+		Tags:        []string{tag},
+	}, modelPresetStoreAPI.ListModelRouters)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "resolve-model-route",
+		Method:      http.MethodPost,
+		Path:        routerPrefix + "/{routerID}/resolve",
+		Summary:     "Dry run a model router",
+		Description: "Resolve the model preset a request with the given signals would be routed to, and explain why",
+		Tags:        []string{tag},
+	}, modelPresetStoreAPI.ResolveModelRoute)
 }
@@ -0,0 +1,279 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+)
+
+// PutModelRouter creates or replaces a model router. All targets must be existing model presets.
+func (s *ModelPresetStore) PutModelRouter(
+	ctx context.Context, req *spec.PutModelRouterRequest,
+) (*spec.PutModelRouterResponse, error) {
+	if req == nil || req.Body == nil || req.RouterID == "" {
+		return nil, fmt.Errorf("%w: routerID and body required", spec.ErrInvalidDir)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.readAllUserPresets(false)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	mr := spec.ModelRouter{
+		SchemaVersion: spec.SchemaVersion,
+		ID:            req.RouterID,
+		DisplayName:   req.Body.DisplayName,
+		IsEnabled:     req.Body.IsEnabled,
+		Rules:         req.Body.Rules,
+		Fallback:      req.Body.Fallback,
+		CreatedAt:     now,
+		ModifiedAt:    now,
+	}
+	if existing, ok := all.ModelRouters[req.RouterID]; ok {
+		mr.CreatedAt = existing.CreatedAt
+	}
+	if err := validateModelRouter(&mr); err != nil {
+		return nil, err
+	}
+	targets := []spec.RouteTarget{mr.Fallback}
+	for _, r := range mr.Rules {
+		targets = append(targets, r.Target)
+	}
+	for _, t := range targets {
+		if _, err := s.getModelPreset(ctx, all, t); err != nil {
+			return nil, err
+		}
+	}
+
+	if all.ModelRouters == nil {
+		all.ModelRouters = map[spec.ModelRouterID]spec.ModelRouter{}
+	}
+	all.ModelRouters[req.RouterID] = mr
+	if err := s.writeAllUserPresets(all); err != nil {
+		return nil, err
+	}
+	slog.Info("putModelRouter", "routerID", req.RouterID, "rules", len(mr.Rules))
+	return &spec.PutModelRouterResponse{}, nil
+}
+
+// DeleteModelRouter removes a model router.
+func (s *ModelPresetStore) DeleteModelRouter(
+	ctx context.Context, req *spec.DeleteModelRouterRequest,
+) (*spec.DeleteModelRouterResponse, error) {
+	if req == nil || req.RouterID == "" {
+		return nil, fmt.Errorf("%w: routerID required", spec.ErrInvalidDir)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.readAllUserPresets(false)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := all.ModelRouters[req.RouterID]; !ok {
+		return nil, fmt.Errorf("%w: %s", spec.ErrModelRouterNotFound, req.RouterID)
+	}
+	delete(all.ModelRouters, req.RouterID)
+	if err := s.writeAllUserPresets(all); err != nil {
+		return nil, err
+	}
+	slog.Info("deleteModelRouter", "routerID", req.RouterID)
+	return &spec.DeleteModelRouterResponse{}, nil
+}
+
+// ListModelRouters returns all model routers sorted by ID.
+func (s *ModelPresetStore) ListModelRouters(
+	ctx context.Context, req *spec.ListModelRoutersRequest,
+) (*spec.ListModelRoutersResponse, error) {
+	s.mu.RLock()
+	all, err := s.readAllUserPresets(false)
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	routers := make([]spec.ModelRouter, 0, len(all.ModelRouters))
+	for _, mr := range all.ModelRouters {
+		routers = append(routers, mr)
+	}
+	sort.Slice(routers, func(i, j int) bool { return routers[i].ID < routers[j].ID })
+	return &spec.ListModelRoutersResponse{
+		Body: &spec.ListModelRoutersResponseBody{ModelRouters: routers},
+	}, nil
+}
+
+// ResolveModelRoute routes a request described by its signals to a model preset and explains the decision. It does
+// not send anything, so it doubles as the dry run of a route.
+//
+// A matching rule whose target is missing or disabled is skipped. The fallback must be available.
+func (s *ModelPresetStore) ResolveModelRoute(
+	ctx context.Context, req *spec.ResolveModelRouteRequest,
+) (*spec.ResolveModelRouteResponse, error) {
+	if req == nil || req.Body == nil || req.RouterID == "" {
+		return nil, fmt.Errorf("%w: routerID and signals required", spec.ErrInvalidDir)
+	}
+
+	s.mu.RLock()
+	all, err := s.readAllUserPresets(false)
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	mr, ok := all.ModelRouters[req.RouterID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", spec.ErrModelRouterNotFound, req.RouterID)
+	}
+	if !mr.IsEnabled {
+		return nil, fmt.Errorf("model router %s is disabled", req.RouterID)
+	}
+
+	d := &spec.RouteDecision{RouterID: mr.ID, Evaluations: make([]spec.RuleEvaluation, 0, len(mr.Rules))}
+	for _, rule := range mr.Rules {
+		ev := evaluateRouteRule(rule, req.Body)
+		if ev.Matched {
+			mp, err := s.getEnabledModelPreset(ctx, all, rule.Target)
+			if err != nil {
+				ev.Matched = false
+				ev.Reasons = append(ev.Reasons, "target unavailable: "+err.Error())
+			} else {
+				d.Evaluations = append(d.Evaluations, ev)
+				d.Target = rule.Target
+				d.RuleName = rule.Name
+				d.ModelPreset = mp
+				d.Explanation = fmt.Sprintf("rule %q matched: %s", rule.Name, strings.Join(ev.Reasons, "; "))
+				return &spec.ResolveModelRouteResponse{Body: d}, nil
+			}
+		}
+		d.Evaluations = append(d.Evaluations, ev)
+	}
+
+	mp, err := s.getEnabledModelPreset(ctx, all, mr.Fallback)
+	if err != nil {
+		return nil, fmt.Errorf("fallback of model router %s: %w", mr.ID, err)
+	}
+	d.Target = mr.Fallback
+	d.ModelPreset = mp
+	d.Explanation = "no rule matched, using the fallback"
+	if len(mr.Rules) == 0 {
+		d.Explanation = "router has no rules, using the fallback"
+	}
+	return &spec.ResolveModelRouteResponse{Body: d}, nil
+}
+
+// evaluateRouteRule checks every set condition of a rule, so that the evaluation explains all of them.
+func evaluateRouteRule(rule spec.RouteRule, sig *spec.RouteSignals) spec.RuleEvaluation {
+	ev := spec.RuleEvaluation{RuleName: rule.Name, Matched: true, Reasons: []string{}}
+	check := func(ok bool, reason string) {
+		if !ok {
+			ev.Matched = false
+			reason = "not " + reason
+		}
+		ev.Reasons = append(ev.Reasons, reason)
+	}
+	w := rule.When
+
+	if len(w.AttachmentKinds) > 0 {
+		found := ""
+		for _, k := range sig.AttachmentKinds {
+			if slices.Contains(w.AttachmentKinds, k) {
+				found = string(k)
+				break
+			}
+		}
+		if found != "" {
+			check(true, fmt.Sprintf("has a %s attachment", found))
+		} else {
+			check(false, fmt.Sprintf("has an attachment of kind %v", w.AttachmentKinds))
+		}
+	}
+	if w.MinPromptTokens > 0 {
+		check(sig.EstimatedPromptTokens >= w.MinPromptTokens,
+			fmt.Sprintf("estimated prompt tokens %d >= %d", sig.EstimatedPromptTokens, w.MinPromptTokens))
+	}
+	if w.MaxPromptTokens > 0 {
+		check(sig.EstimatedPromptTokens <= w.MaxPromptTokens,
+			fmt.Sprintf("estimated prompt tokens %d <= %d", sig.EstimatedPromptTokens, w.MaxPromptTokens))
+	}
+	if w.ToolsEnabled != nil {
+		if *w.ToolsEnabled {
+			check(sig.ToolsEnabled, "tools enabled")
+		} else {
+			check(!sig.ToolsEnabled, "tools disabled")
+		}
+	}
+	if len(w.Keywords) > 0 {
+		text := strings.ToLower(sig.Text)
+		found := ""
+		for _, kw := range w.Keywords {
+			if kw != "" && strings.Contains(text, strings.ToLower(kw)) {
+				found = kw
+				break
+			}
+		}
+		if found != "" {
+			check(true, fmt.Sprintf("text contains %q", found))
+		} else {
+			check(false, fmt.Sprintf("text contains any of %q", w.Keywords))
+		}
+	}
+	if len(w.CostTiers) > 0 {
+		check(slices.Contains(w.CostTiers, sig.CostTier),
+			fmt.Sprintf("cost tier %q in %v", sig.CostTier, w.CostTiers))
+	}
+	if len(ev.Reasons) == 0 {
+		ev.Reasons = append(ev.Reasons, "rule has no conditions")
+	}
+	return ev
+}
+
+// getModelPreset looks a target up in the built-in presets, then in the user presets of all.
+func (s *ModelPresetStore) getModelPreset(
+	ctx context.Context,
+	all spec.PresetsSchema,
+	t spec.RouteTarget,
+) (spec.ModelPreset, error) {
+	if _, err := s.builtinData.GetBuiltInProvider(ctx, t.ProviderName); err == nil {
+		return s.builtinData.GetBuiltInModelPreset(ctx, t.ProviderName, t.ModelPresetID)
+	}
+	pp, ok := all.ProviderPresets[t.ProviderName]
+	if !ok {
+		return spec.ModelPreset{}, fmt.Errorf("%w: %s", spec.ErrProviderNotFound, t.ProviderName)
+	}
+	mp, ok := pp.ModelPresets[t.ModelPresetID]
+	if !ok {
+		return spec.ModelPreset{}, fmt.Errorf("%w: %s/%s", spec.ErrModelPresetNotFound, t.ProviderName, t.ModelPresetID)
+	}
+	return mp, nil
+}
+
+func (s *ModelPresetStore) getEnabledModelPreset(
+	ctx context.Context,
+	all spec.PresetsSchema,
+	t spec.RouteTarget,
+) (spec.ModelPreset, error) {
+	providerEnabled := false
+	if pp, err := s.builtinData.GetBuiltInProvider(ctx, t.ProviderName); err == nil {
+		providerEnabled = pp.IsEnabled
+	} else if pp, ok := all.ProviderPresets[t.ProviderName]; ok {
+		providerEnabled = pp.IsEnabled
+	}
+	mp, err := s.getModelPreset(ctx, all, t)
+	if err != nil {
+		return mp, err
+	}
+	if !providerEnabled || !mp.IsEnabled {
+		return spec.ModelPreset{}, errors.New("model preset " + string(t.ProviderName) + "/" +
+			string(t.ModelPresetID) + " is disabled")
+	}
+	return mp, nil
+}
@@ -0,0 +1,130 @@
+package store_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/flexigpt/flexigpt-app/internal/attachment"
+	"github.com/flexigpt/flexigpt-app/internal/modelpreset/spec"
+)
+
+func TestModelRouter(t *testing.T) {
+	ctx := t.Context()
+	s := newTestStore(t)
+	createProvider(t, s, "routed", true)
+	createModelPreset(t, s, "routed", "fast", true, "")
+	createModelPreset(t, s, "routed", "vision", true, "")
+	createModelPreset(t, s, "routed", "big", true, "")
+	createModelPreset(t, s, "routed", "off", false, "")
+
+	target := func(id string) spec.RouteTarget {
+		return spec.RouteTarget{ProviderName: "routed", ModelPresetID: spec.ModelPresetID(id)}
+	}
+	body := &spec.PutModelRouterRequestBody{
+		DisplayName: "Smart",
+		IsEnabled:   true,
+		Rules: []spec.RouteRule{
+			{
+				Name:   "disabled-target",
+				When:   spec.RouteCondition{Keywords: []string{"legacy"}},
+				Target: target("off"),
+			},
+			{
+				Name:   "images",
+				When:   spec.RouteCondition{AttachmentKinds: []attachment.AttachmentKind{attachment.AttachmentImage}},
+				Target: target("vision"),
+			},
+			{
+				Name:   "long-cheap",
+				When:   spec.RouteCondition{MinPromptTokens: 1000, CostTiers: []spec.CostTier{spec.CostTierLow}},
+				Target: target("big"),
+			},
+		},
+		Fallback: target("fast"),
+	}
+	if _, err := s.PutModelRouter(ctx, &spec.PutModelRouterRequest{RouterID: "smart", Body: body}); err != nil {
+		t.Fatalf("put router: %v", err)
+	}
+
+	bad := *body
+	bad.Fallback = target("missing")
+	if _, err := s.PutModelRouter(ctx, &spec.PutModelRouterRequest{RouterID: "bad", Body: &bad}); !errors.Is(
+		err, spec.ErrModelPresetNotFound,
+	) {
+		t.Errorf("put router with missing target: err = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		signals  spec.RouteSignals
+		wantRule string
+		wantID   spec.ModelPresetID
+	}{
+		{
+			name:    "Fallback",
+			signals: spec.RouteSignals{EstimatedPromptTokens: 10},
+			wantID:  "fast",
+		},
+		{
+			name: "FirstMatchWins",
+			signals: spec.RouteSignals{
+				AttachmentKinds:       []attachment.AttachmentKind{attachment.AttachmentImage},
+				EstimatedPromptTokens: 5000,
+				CostTier:              spec.CostTierLow,
+			},
+			wantRule: "images",
+			wantID:   "vision",
+		},
+		{
+			name:     "AllConditionsMustMatch",
+			signals:  spec.RouteSignals{EstimatedPromptTokens: 5000, CostTier: spec.CostTierLow},
+			wantRule: "long-cheap",
+			wantID:   "big",
+		},
+		{
+			name:    "DisabledTargetSkipped",
+			signals: spec.RouteSignals{Text: "port this LEGACY code"},
+			wantID:  "fast",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := s.ResolveModelRoute(ctx, &spec.ResolveModelRouteRequest{RouterID: "smart", Body: &tc.signals})
+			if err != nil {
+				t.Fatalf("resolve: %v", err)
+			}
+			d := resp.Body
+			if d.RuleName != tc.wantRule || d.Target.ModelPresetID != tc.wantID || d.ModelPreset.ID != tc.wantID {
+				t.Errorf("decision = rule %q, target %+v, preset %q", d.RuleName, d.Target, d.ModelPreset.ID)
+			}
+			if d.Explanation == "" || len(d.Evaluations) == 0 {
+				t.Errorf("decision is not explained: %+v", d)
+			}
+		})
+	}
+
+	resp, err := s.ResolveModelRoute(ctx, &spec.ResolveModelRouteRequest{
+		RouterID: "smart",
+		Body:     &spec.RouteSignals{Text: "legacy"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := resp.Body.Evaluations[0]; ev.Matched || !strings.Contains(strings.Join(ev.Reasons, ";"), "disabled") {
+		t.Errorf("disabled target evaluation = %+v", ev)
+	}
+
+	list, err := s.ListModelRouters(ctx, &spec.ListModelRoutersRequest{})
+	if err != nil || len(list.Body.ModelRouters) != 1 {
+		t.Fatalf("list routers = %+v, %v", list, err)
+	}
+	if _, err := s.DeleteModelRouter(ctx, &spec.DeleteModelRouterRequest{RouterID: "smart"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ResolveModelRoute(ctx, &spec.ResolveModelRouteRequest{
+		RouterID: "smart", Body: &spec.RouteSignals{},
+	}); !errors.Is(err, spec.ErrModelRouterNotFound) {
+		t.Errorf("resolve deleted router: err = %v", err)
+	}
+}
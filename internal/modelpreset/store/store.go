@@ -180,6 +180,7 @@ func (s *ModelPresetStore) PutProviderPreset(
 		ChatCompletionPathPrefix: req.Body.ChatCompletionPathPrefix,
 		APIKeyHeaderKey:          req.Body.APIKeyHeaderKey,
 		DefaultHeaders:           req.Body.DefaultHeaders,
+		RateLimits:               req.Body.RateLimits,
 		ModelPresets:             map[spec.ModelPresetID]spec.ModelPreset{},
 	}
 
@@ -211,17 +212,18 @@ func (s *ModelPresetStore) PutProviderPreset(
 // PatchProviderPreset updates a provider preset.
 // It can (independently or simultaneously)
 //   - enable / disable the provider (body.isEnabled)
-//   - change the provider-level default model-preset (body.defaultModelPresetID).
+//   - change the provider-level default model-preset (body.defaultModelPresetID)
+//   - replace the provider rate limits (body.rateLimits).
 //
-// At least one of the two fields must be supplied.
+// At least one of the fields must be supplied.
 func (s *ModelPresetStore) PatchProviderPreset(
 	ctx context.Context, req *spec.PatchProviderPresetRequest,
 ) (*spec.PatchProviderPresetResponse, error) {
 	if req == nil || req.Body == nil || req.ProviderName == "" {
 		return nil, fmt.Errorf("%w: providerName required", spec.ErrInvalidDir)
 	}
-	if req.Body.IsEnabled == nil && req.Body.DefaultModelPresetID == nil {
-		return nil, fmt.Errorf("%w: either isEnabled or defaultModelPresetID must be supplied",
+	if req.Body.IsEnabled == nil && req.Body.DefaultModelPresetID == nil && req.Body.RateLimits == nil {
+		return nil, fmt.Errorf("%w: one of isEnabled, defaultModelPresetID or rateLimits must be supplied",
 			spec.ErrInvalidDir)
 	}
 	if req.Body.DefaultModelPresetID != nil {
@@ -229,6 +231,9 @@ func (s *ModelPresetStore) PatchProviderPreset(
 			return nil, err
 		}
 	}
+	if err := validateRateLimits(req.Body.RateLimits); err != nil {
+		return nil, err
+	}
 
 	if _, err := s.builtinData.GetBuiltInProvider(ctx, req.ProviderName); err == nil {
 
@@ -256,6 +261,17 @@ func (s *ModelPresetStore) PatchProviderPreset(
 				"defaultModelPresetID", *req.Body.DefaultModelPresetID)
 		}
 
+		if req.Body.RateLimits != nil {
+			if _, err := s.builtinData.SetProviderRateLimits(
+				ctx, req.ProviderName, *req.Body.RateLimits,
+			); err != nil {
+				return nil, err
+			}
+			slog.Info("patchProviderPreset.builtin",
+				"provider", req.ProviderName,
+				"rateLimits", *req.Body.RateLimits)
+		}
+
 		return &spec.PatchProviderPresetResponse{}, nil
 	}
 
@@ -292,6 +308,14 @@ func (s *ModelPresetStore) PatchProviderPreset(
 		changed = true
 	}
 
+	// Rate limits.
+	if req.Body.RateLimits != nil &&
+		(pp.RateLimits == nil || *pp.RateLimits != *req.Body.RateLimits) {
+		rl := *req.Body.RateLimits
+		pp.RateLimits = &rl
+		changed = true
+	}
+
 	if !changed {
 		// Nothing to do - silently succeed.
 		return &spec.PatchProviderPresetResponse{}, nil
@@ -497,6 +521,7 @@ func (s *ModelPresetStore) PutModelPreset(
 		SystemPrompt:                req.Body.SystemPrompt,
 		Timeout:                     req.Body.Timeout,
 		AdditionalParametersRawJSON: req.Body.AdditionalParametersRawJSON,
+		ReasoningReplay:             req.Body.ReasoningReplay,
 		CreatedAt:                   now,
 		ModifiedAt:                  now,
 		IsBuiltIn:                   false,
@@ -319,6 +319,22 @@ func TestPutModelPreset(t *testing.T) {
 			},
 			expectError: spec.ErrProviderNotFound,
 		},
+		{
+			name: "InvalidReasoningReplay",
+			req: &spec.PutModelPresetRequest{
+				ProviderName:  "provM",
+				ModelPresetID: "m1",
+				Body: &spec.PutModelPresetRequestBody{
+					Name:            "model-one",
+					DisplayName:     "Model-1",
+					Slug:            "m1",
+					IsEnabled:       true,
+					Temperature:     &temp,
+					ReasoningReplay: "sometimes",
+				},
+			},
+			expectError: errors.New("invalid reasoningReplay"),
+		},
 		{
 			name: "HappyPath",
 			req: &spec.PutModelPresetRequest{
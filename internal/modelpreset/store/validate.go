@@ -35,6 +35,9 @@ func validateProviderPreset(pp *spec.ProviderPreset) error {
 	if strings.TrimSpace(pp.ChatCompletionPathPrefix) == "" {
 		return fmt.Errorf("provider %q: chatCompletionPathPrefix is empty", pp.Name)
 	}
+	if err := validateRateLimits(pp.RateLimits); err != nil {
+		return fmt.Errorf("provider %q: %w", pp.Name, err)
+	}
 	// Per-model validation and duplicate ID detection.
 	seenModel := map[spec.ModelPresetID]string{}
 	for mid, mp := range pp.ModelPresets {
@@ -94,6 +97,69 @@ func validateModelPreset(mp *spec.ModelPreset) error {
 			return fmt.Errorf("invalid reasoning: %w", err)
 		}
 	}
+	switch mp.ReasoningReplay {
+	case "", spec.ReasoningReplaySameModel, spec.ReasoningReplayDrop, spec.ReasoningReplayText:
+	default:
+		return fmt.Errorf("invalid reasoningReplay %q", mp.ReasoningReplay)
+	}
+	return nil
+}
+
+// validateModelRouter performs structural validation for a model router. Targets are checked by the caller.
+func validateModelRouter(mr *spec.ModelRouter) error {
+	if err := bundleitemutils.ValidateTag(string(mr.ID)); err != nil {
+		return fmt.Errorf("model router %q: %w", mr.ID, err)
+	}
+	if strings.TrimSpace(mr.DisplayName) == "" {
+		return fmt.Errorf("model router %q: displayName is empty", mr.ID)
+	}
+	if err := validateRouteTarget(mr.Fallback); err != nil {
+		return fmt.Errorf("model router %q, fallback: %w", mr.ID, err)
+	}
+	seen := map[string]bool{}
+	for i, r := range mr.Rules {
+		if strings.TrimSpace(r.Name) == "" {
+			return fmt.Errorf("model router %q: rule %d has no name", mr.ID, i)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("model router %q: duplicate rule %q", mr.ID, r.Name)
+		}
+		seen[r.Name] = true
+		if err := validateRouteTarget(r.Target); err != nil {
+			return fmt.Errorf("model router %q, rule %q: %w", mr.ID, r.Name, err)
+		}
+		w := r.When
+		if w.MinPromptTokens < 0 || w.MaxPromptTokens < 0 {
+			return fmt.Errorf("model router %q, rule %q: prompt token bounds must not be negative", mr.ID, r.Name)
+		}
+		if w.MaxPromptTokens > 0 && w.MinPromptTokens > w.MaxPromptTokens {
+			return fmt.Errorf("model router %q, rule %q: minPromptTokens exceeds maxPromptTokens", mr.ID, r.Name)
+		}
+		for _, ct := range w.CostTiers {
+			switch ct {
+			case spec.CostTierLow, spec.CostTierStandard, spec.CostTierHigh:
+			default:
+				return fmt.Errorf("model router %q, rule %q: invalid cost tier %q", mr.ID, r.Name, ct)
+			}
+		}
+	}
+	return nil
+}
+
+func validateRouteTarget(t spec.RouteTarget) error {
+	if err := validateProviderName(t.ProviderName); err != nil {
+		return fmt.Errorf("provider: %w", err)
+	}
+	return validateModelPresetID(t.ModelPresetID)
+}
+
+func validateRateLimits(rl *spec.ProviderRateLimits) error {
+	if rl == nil {
+		return nil
+	}
+	if rl.RequestsPerMinute < 0 || rl.TokensPerMinute < 0 || rl.MaxConcurrency < 0 {
+		return errors.New("rateLimits must not be negative")
+	}
 	return nil
 }
 
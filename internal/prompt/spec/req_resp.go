@@ -121,11 +121,12 @@ type ListPromptTemplatesRequest struct {
 }
 
 type PromptTemplateListItem struct {
-	BundleID        bundleitemutils.BundleID    `json:"bundleID"`
-	BundleSlug      bundleitemutils.BundleSlug  `json:"bundleSlug"`
-	TemplateSlug    bundleitemutils.ItemSlug    `json:"templateSlug"`
-	TemplateVersion bundleitemutils.ItemVersion `json:"templateVersion"`
-	IsBuiltIn       bool                        `json:"isBuiltIn"`
+	BundleID           bundleitemutils.BundleID    `json:"bundleID"`
+	BundleSlug         bundleitemutils.BundleSlug  `json:"bundleSlug"`
+	TemplateSlug       bundleitemutils.ItemSlug    `json:"templateSlug"`
+	TemplateVersion    bundleitemutils.ItemVersion `json:"templateVersion"`
+	IsBuiltIn          bool                        `json:"isBuiltIn"`
+	TemplateDefinition PromptTemplate              `json:"templateDefinition"`
 }
 
 type ListPromptTemplatesResponseBody struct {
@@ -871,11 +871,12 @@ func (s *PromptTemplateStore) ListPromptTemplates(
 				pt := biTpls[bid][templateID]
 				if addAllowed(bid, &pt) {
 					out = append(out, spec.PromptTemplateListItem{
-						BundleID:        bid,
-						BundleSlug:      bslug,
-						TemplateSlug:    pt.Slug,
-						TemplateVersion: pt.Version,
-						IsBuiltIn:       true,
+						BundleID:           bid,
+						BundleSlug:         bslug,
+						TemplateSlug:       pt.Slug,
+						TemplateVersion:    pt.Version,
+						IsBuiltIn:          true,
+						TemplateDefinition: pt,
 					})
 				}
 			}
@@ -922,11 +923,12 @@ func (s *PromptTemplateStore) ListPromptTemplates(
 			}
 
 			out = append(out, spec.PromptTemplateListItem{
-				BundleID:        bdi.ID,
-				BundleSlug:      bdi.Slug,
-				TemplateSlug:    pt.Slug,
-				TemplateVersion: pt.Version,
-				IsBuiltIn:       false,
+				BundleID:           bdi.ID,
+				BundleSlug:         bdi.Slug,
+				TemplateSlug:       pt.Slug,
+				TemplateVersion:    pt.Version,
+				IsBuiltIn:          false,
+				TemplateDefinition: pt,
 			})
 		}
 
@@ -1022,11 +1024,12 @@ func (s *PromptTemplateStore) SearchPromptTemplates(
 			}
 
 			items = append(items, spec.PromptTemplateListItem{
-				BundleID:        bdi.ID,
-				BundleSlug:      bdi.Slug,
-				TemplateSlug:    finf.Slug,
-				TemplateVersion: finf.Version,
-				IsBuiltIn:       true,
+				BundleID:           bdi.ID,
+				BundleSlug:         bdi.Slug,
+				TemplateSlug:       finf.Slug,
+				TemplateVersion:    finf.Version,
+				IsBuiltIn:          true,
+				TemplateDefinition: pt,
 			})
 			if len(items) >= pageSize {
 				break
@@ -1072,11 +1075,12 @@ func (s *PromptTemplateStore) SearchPromptTemplates(
 		}
 
 		items = append(items, spec.PromptTemplateListItem{
-			BundleID:        bid,
-			BundleSlug:      bslug,
-			TemplateSlug:    tslug,
-			TemplateVersion: tver,
-			IsBuiltIn:       false,
+			BundleID:           bid,
+			BundleSlug:         bslug,
+			TemplateSlug:       tslug,
+			TemplateVersion:    tver,
+			IsBuiltIn:          false,
+			TemplateDefinition: pt,
 		})
 
 		// Stop when we have enough results.
@@ -398,6 +398,11 @@ func TestTemplateListFiltering(t *testing.T) {
 				t.Fatalf("expected %d items, got %d",
 					tc.expect, len(resp.Body.PromptTemplateListItems))
 			}
+			for _, it := range resp.Body.PromptTemplateListItems {
+				if def := it.TemplateDefinition; def.Slug != it.TemplateSlug || len(def.Blocks) == 0 {
+					t.Errorf("item %s carries template %+v", it.TemplateSlug, def)
+				}
+			}
 		})
 	}
 }
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
@@ -15,6 +17,66 @@ var (
 	placeholderRE = regexp.MustCompile(`\{\{([a-zA-Z_][a-zA-Z0-9_-]*)\}\}`)
 )
 
+// FillPlaceholders replaces the {{name}} placeholders of a message block with the values in vars. Placeholders
+// without a value are left as is.
+func FillPlaceholders(text string, vars map[string]string) string {
+	return placeholderRE.ReplaceAllStringFunc(text, func(m string) string {
+		name := placeholderRE.FindStringSubmatch(m)[1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// ResolveVariables resolves the values of the variables of a template from the given values. Static variables get
+// their static value, and missing or empty values their default. A required variable without a value, or a value
+// that does not match the variable type, is an error.
+func ResolveVariables(vars []spec.PromptVariable, values map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(vars))
+	for _, v := range vars {
+		if v.Source == spec.SourceStatic {
+			out[v.Name] = v.StaticVal
+			continue
+		}
+		val, ok := values[v.Name]
+		if !ok || val == "" {
+			val = v.Default
+		}
+		if val == "" {
+			if v.Required {
+				return nil, fmt.Errorf("missing required variable %q", v.Name)
+			}
+			out[v.Name] = ""
+			continue
+		}
+		if err := checkVarValue(v, val); err != nil {
+			return nil, err
+		}
+		out[v.Name] = val
+	}
+	return out, nil
+}
+
+func checkVarValue(v spec.PromptVariable, val string) error {
+	switch v.Type {
+	case spec.VarEnum:
+		if !slices.Contains(v.EnumValues, val) {
+			return fmt.Errorf("variable %q must be one of %s", v.Name, strings.Join(v.EnumValues, ", "))
+		}
+	case spec.VarNumber:
+		if _, err := strconv.ParseFloat(val, 64); err != nil {
+			return fmt.Errorf("variable %q must be a number", v.Name)
+		}
+	case spec.VarBoolean:
+		if _, err := strconv.ParseBool(val); err != nil {
+			return fmt.Errorf("variable %q must be a boolean", v.Name)
+		}
+	case spec.VarString, spec.VarDate:
+	}
+	return nil
+}
+
 // validateTemplate performs a structural and referential integrity check.
 func validateTemplate(tpl *spec.PromptTemplate) error {
 	if tpl == nil {
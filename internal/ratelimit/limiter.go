@@ -0,0 +1,284 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultWindow is the sliding window over which request and token rates are measured.
+const DefaultWindow = time.Minute
+
+// Config holds the limits of a Limiter. A zero value disables the corresponding limit.
+type Config struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+	MaxConcurrency    int
+}
+
+// Stats is a point in time snapshot of a Limiter.
+type Stats struct {
+	InFlight    int
+	QueueDepth  int
+	PausedUntil time.Time
+
+	Admitted  int64
+	TotalWait time.Duration
+	MaxWait   time.Duration
+	LastWait  time.Duration
+}
+
+type Option func(*Limiter)
+
+// WithWindow overrides the rate window. Limits are still expressed per window, so this is mostly useful in tests.
+func WithWindow(d time.Duration) Option {
+	return func(l *Limiter) {
+		if d > 0 {
+			l.window = d
+		}
+	}
+}
+
+// Limiter admits calls in FIFO order while keeping a sliding window request rate, token rate and concurrency below
+// the configured limits. Waiting callers give up when their context is done.
+type Limiter struct {
+	mu     sync.Mutex
+	cfg    Config
+	window time.Duration
+
+	inFlight    int
+	queue       []*waiter
+	admitted    []*admission
+	pausedUntil time.Time
+	// Closed and replaced whenever state changes so that waiters re-evaluate.
+	changed chan struct{}
+
+	stats Stats
+}
+
+type waiter struct {
+	tokens   int
+	enqueued time.Time
+}
+
+type admission struct {
+	at     time.Time
+	tokens int
+}
+
+// Ticket represents an admitted call. Release must be called once the call is done.
+type Ticket struct {
+	l    *Limiter
+	a    *admission
+	once sync.Once
+}
+
+func NewLimiter(cfg Config, opts ...Option) *Limiter {
+	l := &Limiter{
+		cfg:     cfg,
+		window:  DefaultWindow,
+		changed: make(chan struct{}),
+	}
+	for _, o := range opts {
+		if o != nil {
+			o(l)
+		}
+	}
+	return l
+}
+
+// SetConfig replaces the limits. Queued callers are re-evaluated against the new limits.
+func (l *Limiter) SetConfig(cfg Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	l.notifyLocked()
+}
+
+func (l *Limiter) Config() Config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cfg
+}
+
+// PauseFor stops admitting new calls for d, e.g. after a provider asked to retry after some time. An existing longer
+// pause is kept.
+func (l *Limiter) PauseFor(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+		l.notifyLocked()
+	}
+}
+
+// Acquire waits until a call estimated to use tokens tokens may proceed. Calls are admitted strictly in arrival
+// order. A call estimated above the token limit is admitted once the window is otherwise empty.
+func (l *Limiter) Acquire(ctx context.Context, tokens int) (*Ticket, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if tokens < 0 {
+		tokens = 0
+	}
+
+	l.mu.Lock()
+	w := &waiter{tokens: tokens, enqueued: time.Now()}
+	l.queue = append(l.queue, w)
+
+	for {
+		var retryIn time.Duration
+		if l.queue[0] == w {
+			now := time.Now()
+			wait, ok := l.admitWaitLocked(now, tokens)
+			if ok {
+				t := l.admitLocked(now, w)
+				l.mu.Unlock()
+				return t, nil
+			}
+			retryIn = wait
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		var (
+			timer  *time.Timer
+			timerC <-chan time.Time
+		)
+		if retryIn > 0 {
+			timer = time.NewTimer(retryIn)
+			timerC = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			l.mu.Lock()
+			l.removeLocked(w)
+			l.notifyLocked()
+			l.mu.Unlock()
+			return nil, ctx.Err()
+		case <-changed:
+		case <-timerC:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		l.mu.Lock()
+	}
+}
+
+// Release marks the call as done. If usedTokens is positive it replaces the estimate given to Acquire.
+func (t *Ticket) Release(usedTokens int) {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		l := t.l
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.inFlight--
+		if usedTokens > 0 {
+			t.a.tokens = usedTokens
+		}
+		l.notifyLocked()
+	})
+}
+
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.stats
+	s.InFlight = l.inFlight
+	s.QueueDepth = len(l.queue)
+	if l.pausedUntil.After(time.Now()) {
+		s.PausedUntil = l.pausedUntil
+	}
+	return s
+}
+
+// admitWaitLocked reports whether a call may be admitted now, and if not, how long until it may be. A zero wait with
+// ok false means the call can only proceed after a release.
+func (l *Limiter) admitWaitLocked(now time.Time, tokens int) (wait time.Duration, ok bool) {
+	l.pruneLocked(now)
+
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now), false
+	}
+	if l.cfg.MaxConcurrency > 0 && l.inFlight >= l.cfg.MaxConcurrency {
+		return 0, false
+	}
+	if rpm := l.cfg.RequestsPerMinute; rpm > 0 && len(l.admitted) >= rpm {
+		return l.expiresIn(now, l.admitted[len(l.admitted)-rpm]), false
+	}
+	if tpm := l.cfg.TokensPerMinute; tpm > 0 {
+		used := 0
+		for _, a := range l.admitted {
+			used += a.tokens
+		}
+		if used > 0 && used+tokens > tpm {
+			for _, a := range l.admitted {
+				used -= a.tokens
+				if used == 0 || used+tokens <= tpm {
+					return l.expiresIn(now, a), false
+				}
+			}
+		}
+	}
+	return 0, true
+}
+
+func (l *Limiter) admitLocked(now time.Time, w *waiter) *Ticket {
+	l.queue = l.queue[1:]
+	l.inFlight++
+	a := &admission{at: now, tokens: w.tokens}
+	l.admitted = append(l.admitted, a)
+
+	wait := now.Sub(w.enqueued)
+	l.stats.Admitted++
+	l.stats.TotalWait += wait
+	l.stats.LastWait = wait
+	if wait > l.stats.MaxWait {
+		l.stats.MaxWait = wait
+	}
+	// The next caller in line may be admissible right away.
+	l.notifyLocked()
+	return &Ticket{l: l, a: a}
+}
+
+func (l *Limiter) removeLocked(w *waiter) {
+	for i, q := range l.queue {
+		if q == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (l *Limiter) pruneLocked(now time.Time) {
+	i := 0
+	for i < len(l.admitted) && !now.Before(l.admitted[i].at.Add(l.window)) {
+		i++
+	}
+	if i > 0 {
+		l.admitted = append(l.admitted[:0], l.admitted[i:]...)
+	}
+}
+
+func (l *Limiter) expiresIn(now time.Time, a *admission) time.Duration {
+	d := a.at.Add(l.window).Sub(now)
+	if d <= 0 {
+		// Already expired; re-check immediately.
+		return time.Nanosecond
+	}
+	return d
+}
+
+func (l *Limiter) notifyLocked() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
@@ -0,0 +1,252 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiterMaxConcurrency(t *testing.T) {
+	l := NewLimiter(Config{MaxConcurrency: 1})
+	ctx := t.Context()
+
+	t1, err := l.Acquire(ctx, 0)
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	done := make(chan *Ticket)
+	go func() {
+		t2, err := l.Acquire(ctx, 0)
+		if err != nil {
+			t.Errorf("second acquire: %v", err)
+		}
+		done <- t2
+	}()
+
+	waitFor(t, func() bool { return l.Stats().QueueDepth == 1 })
+	select {
+	case <-done:
+		t.Fatal("second call admitted above max concurrency")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	t1.Release(0)
+	t2 := <-done
+	if s := l.Stats(); s.InFlight != 1 || s.QueueDepth != 0 || s.Admitted != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	t2.Release(0)
+	if s := l.Stats(); s.InFlight != 0 {
+		t.Fatalf("in flight after release = %d", s.InFlight)
+	}
+}
+
+func TestLimiterRequestsPerWindow(t *testing.T) {
+	window := 80 * time.Millisecond
+	l := NewLimiter(Config{RequestsPerMinute: 2}, WithWindow(window))
+	ctx := t.Context()
+
+	start := time.Now()
+	for range 3 {
+		tk, err := l.Acquire(ctx, 0)
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		tk.Release(0)
+	}
+	if elapsed := time.Since(start); elapsed < window {
+		t.Fatalf("third call admitted after %v, want at least %v", elapsed, window)
+	}
+	if s := l.Stats(); s.MaxWait <= 0 {
+		t.Fatalf("expected a recorded wait, got %+v", s)
+	}
+}
+
+func TestLimiterTokensPerWindow(t *testing.T) {
+	window := 80 * time.Millisecond
+	l := NewLimiter(Config{TokensPerMinute: 100}, WithWindow(window))
+	ctx := t.Context()
+
+	// Over-sized calls are admitted into an empty window.
+	tk, err := l.Acquire(ctx, 150)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	// Actual usage replaces the estimate.
+	tk.Release(40)
+
+	start := time.Now()
+	tk, err = l.Acquire(ctx, 50)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	tk.Release(0)
+	if elapsed := time.Since(start); elapsed > window/2 {
+		t.Fatalf("call within token budget waited %v", elapsed)
+	}
+
+	start = time.Now()
+	tk, err = l.Acquire(ctx, 50)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	tk.Release(0)
+	if elapsed := time.Since(start); elapsed < window/2 {
+		t.Fatalf("call over token budget admitted after %v", elapsed)
+	}
+}
+
+func TestLimiterFIFOAndCancel(t *testing.T) {
+	l := NewLimiter(Config{MaxConcurrency: 1})
+	ctx := t.Context()
+
+	first, err := l.Acquire(ctx, 0)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := l.Acquire(cancelCtx, 0)
+		cancelled <- err
+	}()
+	waitFor(t, func() bool { return l.Stats().QueueDepth == 1 })
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i := range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tk, err := l.Acquire(ctx, 0)
+			if err != nil {
+				t.Errorf("acquire %d: %v", i, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			tk.Release(0)
+		}()
+		waitFor(t, func() bool { return l.Stats().QueueDepth == i+2 })
+	}
+
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled acquire returned %v", err)
+	}
+	first.Release(0)
+	wg.Wait()
+
+	if fmt.Sprint(order) != "[0 1 2]" {
+		t.Fatalf("admission order %v, want FIFO", order)
+	}
+}
+
+func TestLimiterPauseFor(t *testing.T) {
+	l := NewLimiter(Config{})
+	l.PauseFor(60 * time.Millisecond)
+	if s := l.Stats(); s.PausedUntil.IsZero() {
+		t.Fatal("expected pausedUntil to be set")
+	}
+	start := time.Now()
+	tk, err := l.Acquire(t.Context(), 0)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	tk.Release(0)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("acquire during pause returned after %v", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+		wantOK  bool
+	}{
+		{name: "none"},
+		{name: "seconds", headers: map[string]string{"Retry-After": "3"}, want: 3 * time.Second, wantOK: true},
+		{name: "millis_preferred", headers: map[string]string{"Retry-After": "3", "retry-after-ms": "250"}, want: 250 * time.Millisecond, wantOK: true},
+		{name: "http_date", headers: map[string]string{"Retry-After": now.Add(10 * time.Second).Format(http.TimeFormat)}, want: 10 * time.Second, wantOK: true},
+		{name: "past_date", headers: map[string]string{"Retry-After": now.Add(-time.Second).Format(http.TimeFormat)}},
+		{name: "clamped", headers: map[string]string{"Retry-After": "86400"}, want: MaxRetryAfter, wantOK: true},
+		{name: "garbage", headers: map[string]string{"Retry-After": "soon"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			got, ok := ParseRetryAfter(h, now)
+			if ok != tt.wantOK || got != tt.want {
+				t.Fatalf("got (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+type sdkLikeError struct {
+	StatusCode int
+	Response   *http.Response
+}
+
+func (e *sdkLikeError) Error() string { return fmt.Sprintf("status %d", e.StatusCode) }
+
+type retryAfterError time.Duration
+
+func (e retryAfterError) Error() string             { return "rate limited" }
+func (e retryAfterError) RetryAfter() time.Duration { return time.Duration(e) }
+
+func TestRetryAfterFromError(t *testing.T) {
+	h := http.Header{}
+	h.Set("Retry-After", "2")
+	sdkErr := &sdkLikeError{StatusCode: http.StatusTooManyRequests, Response: &http.Response{Header: h}}
+
+	tests := []struct {
+		name   string
+		err    error
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "nil"},
+		{name: "plain", err: errors.New("boom")},
+		{name: "sdk_response", err: sdkErr, want: 2 * time.Second, wantOK: true},
+		{name: "wrapped", err: fmt.Errorf("fetch: %w", sdkErr), want: 2 * time.Second, wantOK: true},
+		{name: "joined", err: errors.Join(errors.New("a"), sdkErr), want: 2 * time.Second, wantOK: true},
+		{name: "method", err: retryAfterError(time.Second), want: time.Second, wantOK: true},
+		{name: "nil_response", err: &sdkLikeError{StatusCode: http.StatusTooManyRequests}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := RetryAfterFromError(tt.err)
+			if ok != tt.wantOK || got != tt.want {
+				t.Fatalf("got (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxRetryAfter caps pauses requested by providers so that a bogus header cannot stall a queue indefinitely.
+const MaxRetryAfter = 5 * time.Minute
+
+// ParseRetryAfter reads the retry delay from response headers. It understands retry-after-ms and Retry-After in both
+// its delay-seconds and HTTP-date forms.
+func ParseRetryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	if h == nil {
+		return 0, false
+	}
+	if v := strings.TrimSpace(h.Get("Retry-After-Ms")); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return clampRetryAfter(time.Duration(ms * float64(time.Millisecond))), true
+		}
+	}
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		if secs <= 0 {
+			return 0, false
+		}
+		return clampRetryAfter(time.Duration(secs * float64(time.Second))), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return clampRetryAfter(d), true
+		}
+	}
+	return 0, false
+}
+
+// RetryAfterFromError looks through the error chain for a provider requested retry delay. Errors may expose it through
+// a RetryAfter() time.Duration method, or, like the errors of the provider SDKs, carry the raw *http.Response in a
+// Response field.
+func RetryAfterFromError(err error) (time.Duration, bool) {
+	var found time.Duration
+	ok := walkErrors(err, func(e error) bool {
+		if ra, isRA := e.(interface{ RetryAfter() time.Duration }); isRA {
+			if d := ra.RetryAfter(); d > 0 {
+				found = clampRetryAfter(d)
+				return true
+			}
+		}
+		if resp := responseField(e); resp != nil {
+			if d, hasDelay := ParseRetryAfter(resp.Header, time.Now()); hasDelay {
+				found = d
+				return true
+			}
+		}
+		return false
+	})
+	return found, ok
+}
+
+// walkErrors visits err and everything it wraps, depth first, until visit returns true.
+func walkErrors(err error, visit func(error) bool) bool {
+	if err == nil {
+		return false
+	}
+	if visit(err) {
+		return true
+	}
+	switch u := err.(type) { //nolint:errorlint // Unwrapping by hand to visit every branch.
+	case interface{ Unwrap() []error }:
+		for _, e := range u.Unwrap() {
+			if walkErrors(e, visit) {
+				return true
+			}
+		}
+	default:
+		return walkErrors(errors.Unwrap(err), visit)
+	}
+	return false
+}
+
+var httpResponsePtrType = reflect.TypeFor[*http.Response]()
+
+func responseField(e error) *http.Response {
+	v := reflect.ValueOf(e)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	f := v.FieldByName("Response")
+	if !f.IsValid() || f.Type() != httpResponsePtrType || f.IsNil() {
+		return nil
+	}
+	// Exported field check keeps us from reading unexported state.
+	sf, _ := v.Type().FieldByName("Response")
+	if !sf.IsExported() {
+		return nil
+	}
+	resp, _ := f.Interface().(*http.Response)
+	return resp
+}
+
+func clampRetryAfter(d time.Duration) time.Duration {
+	return min(d, MaxRetryAfter)
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/flexigpt/flexigpt-app/internal/setting/spec"
 	"github.com/ppipada/mapstore-go"
@@ -25,11 +26,21 @@ const (
 	keyringUserName    = "user"
 )
 
-func NewSettingStore(baseDir string) (*SettingStore, error) {
+// NewSecretEncoderDecoder returns the keyring backed encoder/decoder that encrypts the secrets of the settings, for
+// other stores that persist secrets.
+func NewSecretEncoderDecoder() (*keyringencdec.EncryptedStringValueEncoderDecoder, error) {
 	encoderDecoder, err := keyringencdec.NewEncryptedStringValueEncoderDecoder(keyringServiceName, keyringUserName)
 	if err != nil {
 		return nil, fmt.Errorf("could not get keyring encoder/decoder: %w", err)
 	}
+	return encoderDecoder, nil
+}
+
+func NewSettingStore(baseDir string) (*SettingStore, error) {
+	encoderDecoder, err := NewSecretEncoderDecoder()
+	if err != nil {
+		return nil, err
+	}
 	st := &SettingStore{
 		encEncrypt: encoderDecoder,
 	}
@@ -273,6 +284,26 @@ func (s *SettingStore) GetAuthKey(
 	}, nil
 }
 
+// ResolveSecret returns the decrypted secret of the auth key referenced as "<type>/<keyName>". Empty keys are
+// reported as not found.
+func (s *SettingStore) ResolveSecret(ctx context.Context, ref string) (string, error) {
+	typ, name, ok := strings.Cut(ref, "/")
+	if !ok || typ == "" || name == "" {
+		return "", fmt.Errorf("%w: secret reference %q must be <type>/<keyName>", spec.ErrInvalidArgument, ref)
+	}
+	resp, err := s.GetAuthKey(ctx, &spec.GetAuthKeyRequest{
+		Type:    spec.AuthKeyType(typ),
+		KeyName: spec.AuthKeyName(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	if !resp.Body.NonEmpty {
+		return "", fmt.Errorf("%w: %s is empty", spec.ErrAuthKeyNotFound, ref)
+	}
+	return resp.Body.Secret, nil
+}
+
 // GetSettings returns the current settings without secrets.
 func (s *SettingStore) GetSettings(
 	_ context.Context,
@@ -0,0 +1,71 @@
+package execrunner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideWorkDir - a path of an exec tool resolves outside its working directory.
+var ErrOutsideWorkDir = errors.New("path is outside the working directory")
+
+// jailRoot resolves the working directory of a tool, symlinks included. It must be an existing directory.
+func jailRoot(dir string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("workDir: %w", err)
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return "", fmt.Errorf("workDir: %w", err)
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("workDir %q is not a directory", dir)
+	}
+	return root, nil
+}
+
+// jailPath resolves p against root and checks that it stays inside root once symlinks are followed. p need not exist.
+func jailPath(root, p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	p = filepath.Clean(p)
+
+	// Follow the symlinks of the longest existing prefix; the part that does not exist yet has none.
+	resolved, rest := p, ""
+	for {
+		r, err := filepath.EvalSymlinks(resolved)
+		if err == nil {
+			resolved = filepath.Join(r, rest)
+			break
+		}
+		parent := filepath.Dir(resolved)
+		if !errors.Is(err, fs.ErrNotExist) || parent == resolved {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(resolved), rest)
+		resolved = parent
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q", ErrOutsideWorkDir, p)
+	}
+	return resolved, nil
+}
+
+// resolveCommand returns the program to start: a name is looked up in PATH, a relative path must stay in root.
+func resolveCommand(root, command string) (string, error) {
+	if filepath.IsAbs(command) || filepath.Base(command) == command {
+		return command, nil
+	}
+	p, err := jailPath(root, command)
+	if err != nil {
+		return "", fmt.Errorf("command: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,27 @@
+package execrunner
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup starts the command in a new process group, without a console window.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+		HideWindow:    true,
+	}
+}
+
+// killProcessGroup kills the process and its descendants. Windows tracks process trees rather than groups, which
+// taskkill /T ends.
+func killProcessGroup(p *os.Process) error {
+	kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid))
+	kill.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	if err := kill.Run(); err != nil {
+		return p.Kill()
+	}
+	return nil
+}
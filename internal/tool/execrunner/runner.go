@@ -0,0 +1,348 @@
+// Package execrunner runs exec tools: a local command per call, with the JSON args on stdin or in templated argv,
+// limited by a timeout, output caps, a working-directory jail and an environment allowlist.
+package execrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/jsonutil"
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+	"github.com/flexigpt/flexigpt-app/internal/tool/toolutil"
+)
+
+const (
+	// maxStderrBytes caps the stderr kept for the metadata of a call.
+	maxStderrBytes = 64 << 10
+	// killWaitDelay bounds the wait for the output pipes once the process has exited or its group was killed.
+	killWaitDelay = 2 * time.Second
+)
+
+var (
+	argTokenRe = regexp.MustCompile(`\$\{([a-zA-Z0-9_-]+)\}`)
+	argNameRe  = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// ExecToolRunner executes an ExecToolImpl. Safe for concurrent use.
+type ExecToolRunner struct {
+	impl spec.ExecToolImpl
+
+	overrideTimeoutMs int
+}
+
+// ExecOption - Functional options for ExecToolRunner.
+type ExecOption func(*ExecToolRunner)
+
+// WithExecTimeoutMs sets an invocation timeout override (milliseconds).
+func WithExecTimeoutMs(ms int) ExecOption {
+	return func(r *ExecToolRunner) {
+		if ms > 0 {
+			r.overrideTimeoutMs = ms
+		}
+	}
+}
+
+func NewExecToolRunner(impl spec.ExecToolImpl, opts ...ExecOption) (*ExecToolRunner, error) {
+	if err := ValidateExecImpl(&impl); err != nil {
+		return nil, err
+	}
+	r := &ExecToolRunner{impl: impl}
+	for _, o := range opts {
+		o(r)
+	}
+	return r, nil
+}
+
+// Run starts the command, waits for it and maps its stdout into outputs. The exit code and stderr are always in the
+// metadata; an exit code outside the success set is an error.
+func (r *ExecToolRunner) Run(
+	ctx context.Context,
+	inArgs json.RawMessage,
+) (outputs []spec.ToolStoreOutputUnion, metaData map[string]any, err error) {
+	root, err := jailRoot(r.impl.WorkDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Decode args into map for templating. Non-object args will simply result in no substitutions.
+	args, _ := jsonutil.DecodeJSONRaw[map[string]any](inArgs)
+	stdin := []byte(inArgs)
+	if len(r.impl.PathArgs) > 0 && args != nil {
+		for _, name := range r.impl.PathArgs {
+			v, ok := args[name]
+			if !ok || v == nil {
+				continue
+			}
+			p, ok := v.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("argument %q: path must be a string", name)
+			}
+			if args[name], err = jailPath(root, p); err != nil {
+				return nil, nil, fmt.Errorf("argument %q: %w", name, err)
+			}
+		}
+		if stdin, err = json.Marshal(args); err != nil {
+			return nil, nil, err
+		}
+	}
+	command, err := resolveCommand(root, r.impl.Command)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timeoutMs := spec.DefaultExecTimeoutMs
+	if r.impl.TimeoutMs > 0 {
+		timeoutMs = r.impl.TimeoutMs
+	}
+	if r.overrideTimeoutMs > 0 {
+		timeoutMs = r.overrideTimeoutMs
+	}
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+
+	maxOutput := spec.DefaultExecMaxOutputBytes
+	if r.impl.MaxOutputBytes > 0 {
+		maxOutput = r.impl.MaxOutputBytes
+	}
+	stdout := &cappedBuffer{max: maxOutput}
+	stderr := &cappedBuffer{max: maxStderrBytes}
+
+	argv, err := expandArgs(r.impl.Args, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd := exec.CommandContext( //nolint:gosec // The command is configured by the user.
+		runCtx, command, argv...,
+	)
+	cmd.Dir = root
+	cmd.Env = execEnv(r.impl.EnvAllowlist, r.impl.Env)
+	if r.impl.ArgsMode != spec.ExecArgsModeArgv {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Children of the command are killed along with it.
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd.Process) }
+	cmd.WaitDelay = killWaitDelay
+
+	start := time.Now()
+	runErr := cmd.Run()
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	metaData = map[string]any{
+		"type":       "exec",
+		"command":    r.impl.Command,
+		"exitCode":   exitCode,
+		"stderr":     stderr.String(),
+		"durationMs": time.Since(start).Milliseconds(),
+	}
+	if stdout.truncated() {
+		metaData["stdoutTruncated"] = true
+	}
+	if stderr.truncated() {
+		metaData["stderrTruncated"] = true
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return nil, metaData, ctx.Err()
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		metaData["timedOut"] = true
+		return nil, metaData, fmt.Errorf("%s timed out after %d ms", r.impl.Command, timeoutMs)
+	case runErr != nil && !errors.As(runErr, &exitErr) && !errors.Is(runErr, exec.ErrWaitDelay):
+		return nil, metaData, fmt.Errorf("run %s: %w", r.impl.Command, runErr)
+	}
+
+	successCodes := r.impl.SuccessExitCodes
+	if len(successCodes) == 0 {
+		successCodes = []int{0}
+	}
+	if !slices.Contains(successCodes, exitCode) {
+		err = fmt.Errorf("%s exited with code %d", r.impl.Command, exitCode)
+		if line := lastLine(stderr.String()); line != "" {
+			err = fmt.Errorf("%w: %s", err, line)
+		}
+		return nil, metaData, err
+	}
+
+	outputs, err = stdoutOutputs(r.impl.OutputEncoding, stdout)
+	return outputs, metaData, err
+}
+
+// stdoutOutputs maps the stdout of a successful call into a text output. JSON is compacted.
+func stdoutOutputs(encoding string, stdout *cappedBuffer) ([]spec.ToolStoreOutputUnion, error) {
+	data := stdout.Bytes()
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	if encoding == spec.JSONEncoding {
+		if stdout.truncated() {
+			return nil, fmt.Errorf("stdout exceeds maxOutputBytes (%d bytes)", stdout.max)
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, data); err != nil {
+			return nil, fmt.Errorf("stdout is not valid JSON: %w", err)
+		}
+		return []spec.ToolStoreOutputUnion{toolutil.TextOutput(buf.String())}, nil
+	}
+
+	text := strings.ToValidUTF8(string(data), "�")
+	if stdout.truncated() {
+		// The cap may have split a rune; let the model know it did not see everything.
+		text = strings.TrimSuffix(text, "�") +
+			fmt.Sprintf("\n\n[truncated: showing %d of %d bytes]", len(data), stdout.total)
+	}
+	return []spec.ToolStoreOutputUnion{toolutil.TextOutput(text)}, nil
+}
+
+// expandArgs replaces ${var} tokens of the argv templates with args. An element that is a single token is left out
+// when the value is not set and spread when it is an array. Before a literal "--" element, a value may not start an
+// element with '-', so arguments cannot turn into options of the command.
+func expandArgs(tmpls []string, args map[string]any) ([]string, error) {
+	out := make([]string, 0, len(tmpls))
+	optionsEnded := false
+	add := func(t, arg string) error {
+		if !optionsEnded && strings.HasPrefix(arg, "-") && !strings.HasPrefix(t, "-") {
+			return fmt.Errorf("argument value %q may not start with '-'", arg)
+		}
+		out = append(out, arg)
+		return nil
+	}
+	for _, t := range tmpls {
+		if m := argTokenRe.FindStringSubmatch(t); m != nil && m[0] == t {
+			switch v := args[m[1]].(type) {
+			case nil:
+				continue
+			case []any:
+				for _, e := range v {
+					if err := add(t, toolutil.TemplateValue(e)); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+		}
+		arg := argTokenRe.ReplaceAllStringFunc(t, func(tok string) string {
+			return toolutil.TemplateValue(args[tok[2:len(tok)-1]])
+		})
+		if err := add(t, arg); err != nil {
+			return nil, err
+		}
+		if t == "--" {
+			optionsEnded = true
+		}
+	}
+	return out, nil
+}
+
+// execEnv builds the environment of the process: the allowed variables of the app environment, then env.
+func execEnv(allowlist []string, env map[string]string) []string {
+	if len(allowlist) == 0 {
+		allowlist = spec.DefaultExecEnvAllowlist
+	}
+	out := make([]string, 0, len(allowlist)+len(env))
+	for _, name := range allowlist {
+		if _, ok := env[name]; ok {
+			continue
+		}
+		if v, ok := os.LookupEnv(name); ok {
+			out = append(out, name+"="+v)
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		out = append(out, k+"="+env[k])
+	}
+	return out
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = strings.TrimSpace(s[i+1:])
+	}
+	return s
+}
+
+// cappedBuffer keeps the first max bytes written to it and counts the rest, so a chatty process never blocks on a
+// full pipe.
+type cappedBuffer struct {
+	buf   bytes.Buffer
+	max   int
+	total int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.total += len(p)
+	if room := b.max - b.buf.Len(); room > 0 {
+		_, _ = b.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
+
+func (b *cappedBuffer) truncated() bool {
+	return b.total > b.buf.Len()
+}
+
+// ValidateExecImpl checks an exec tool. Paths are resolved against the file system only when the tool runs.
+func ValidateExecImpl(impl *spec.ExecToolImpl) error {
+	if impl == nil {
+		return errors.New("execImpl is nil")
+	}
+	command := strings.TrimSpace(impl.Command)
+	if command == "" {
+		return errors.New("command is required")
+	}
+	if !filepath.IsAbs(command) && filepath.Base(command) != command && !filepath.IsLocal(command) {
+		return fmt.Errorf("command %q is outside the working directory", command)
+	}
+	if !filepath.IsAbs(impl.WorkDir) {
+		return fmt.Errorf("workDir must be an absolute path: %q", impl.WorkDir)
+	}
+	switch impl.ArgsMode {
+	case "", spec.ExecArgsModeStdin, spec.ExecArgsModeArgv:
+	default:
+		return fmt.Errorf("invalid argsMode: %q", impl.ArgsMode)
+	}
+	switch impl.OutputEncoding {
+	case "", spec.TextEncoding, spec.JSONEncoding:
+	default:
+		return fmt.Errorf("invalid outputEncoding: %q", impl.OutputEncoding)
+	}
+	for _, name := range impl.PathArgs {
+		if !argNameRe.MatchString(name) {
+			return fmt.Errorf("invalid pathArgs entry: %q", name)
+		}
+	}
+	for _, name := range slices.Concat(slices.Collect(maps.Keys(impl.Env)), impl.EnvAllowlist) {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("invalid environment variable name: %q", name)
+		}
+	}
+	if impl.TimeoutMs < 0 || impl.MaxOutputBytes < 0 {
+		return errors.New("timeoutMs and maxOutputBytes must not be negative")
+	}
+	return nil
+}
@@ -177,14 +177,31 @@ func extractFTS(fullPath string, m map[string]any) ftsDoc {
 			}
 		case string(spec.ToolTypeHTTP):
 			if hi, ok := m["httpImpl"].(map[string]any); ok {
-				if req, ok := hi["request"].(map[string]any); ok {
+				reqs := []any{hi["request"]}
+				if steps, ok := hi["steps"].([]any); ok && len(steps) > 0 {
+					reqs = reqs[:0]
+					for _, st := range steps {
+						if sm, ok := st.(map[string]any); ok {
+							reqs = append(reqs, sm["request"])
+						}
+					}
+				}
+				var metas []string
+				for _, r := range reqs {
+					req, ok := r.(map[string]any)
+					if !ok {
+						continue
+					}
+					meta := ""
 					if meth, ok := req["method"].(string); ok {
-						doc.ImplMeta += meth + " "
+						meta += meth + " "
 					}
 					if urlT, ok := req["urlTemplate"].(string); ok {
-						doc.ImplMeta += urlT
+						meta += urlT
 					}
+					metas = append(metas, meta)
 				}
+				doc.ImplMeta = strings.Join(metas, " ")
 			}
 		case string(spec.ToolTypeSDK):
 			if gi, ok := m["sdkImpl"].(map[string]any); ok {
@@ -192,6 +209,12 @@ func extractFTS(fullPath string, m map[string]any) ftsDoc {
 					doc.ImplMeta = fn
 				}
 			}
+		case string(spec.ToolTypeExec):
+			if ei, ok := m["execImpl"].(map[string]any); ok {
+				if cmd, ok := ei["command"].(string); ok {
+					doc.ImplMeta = cmd
+				}
+			}
 		}
 	}
 
@@ -0,0 +1,334 @@
+package httprunner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+const maxRedirects = 10
+
+// Shared address space (carrier-grade NAT); not covered by netip.Addr.IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// DestinationError reports a request to a destination the network policy does not allow. It matches
+// spec.ErrHTTPDestinationDenied.
+type DestinationError struct {
+	Host   string
+	IP     string
+	Reason string
+}
+
+func (e *DestinationError) Error() string {
+	if e.IP != "" {
+		return fmt.Sprintf("%s: %s (%s): %s", spec.ErrHTTPDestinationDenied, e.Host, e.IP, e.Reason)
+	}
+	return fmt.Sprintf("%s: %s: %s", spec.ErrHTTPDestinationDenied, e.Host, e.Reason)
+}
+
+func (e *DestinationError) Is(target error) bool {
+	return target == spec.ErrHTTPDestinationDenied
+}
+
+// netGuard enforces the network policy of one tool: the host of every request and redirect hop is checked against
+// the allowed hosts, and every address dialed is checked against the denied ranges after DNS resolution, so a name
+// that rebinds to another address is caught.
+//
+// Hosts the tool author named, either in urlTemplate or in an allowed hosts list, are trusted and may be local or
+// private. Any other host comes from call arguments and must be public.
+type netGuard struct {
+	toolHosts   []string
+	globalHosts []string
+	staticHost  string
+	tokenHost   string
+	denied      []netip.Prefix
+
+	// Proxies dialed on behalf of requests; their addresses are not checked.
+	proxyMu sync.Mutex
+	proxies map[string]bool
+}
+
+func newNetGuard(req *spec.HTTPRequest, global *spec.HTTPNetworkPolicy) (*netGuard, error) {
+	g := &netGuard{staticHost: staticTemplateHost(req.URLTemplate)}
+	if req.Auth != nil && req.Auth.OAuth2 != nil {
+		g.tokenHost = staticTemplateHost(req.Auth.OAuth2.TokenURL)
+	}
+	deniedCIDRs := spec.DefaultHTTPDeniedCIDRs
+	if global != nil {
+		g.globalHosts = normalizeHosts(global.AllowedHosts)
+		if global.DeniedCIDRs != nil {
+			deniedCIDRs = global.DeniedCIDRs
+		}
+	}
+	if req.NetworkPolicy != nil {
+		g.toolHosts = normalizeHosts(req.NetworkPolicy.AllowedHosts)
+		deniedCIDRs = append(append([]string(nil), deniedCIDRs...), req.NetworkPolicy.DeniedCIDRs...)
+	}
+	for _, c := range deniedCIDRs {
+		p, err := netip.ParsePrefix(strings.TrimSpace(c))
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied CIDR %q: %w", c, err)
+		}
+		g.denied = append(g.denied, p.Masked())
+	}
+	return g, nil
+}
+
+// checkURL checks the scheme and host of a request URL. IP literals are also checked against the denied ranges here;
+// host names sent through a proxy are resolved and checked when the proxy is selected.
+func (g *netGuard) checkURL(u *url.URL) error {
+	host := strings.ToLower(u.Hostname())
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &DestinationError{Host: host, Reason: fmt.Sprintf("scheme %q is not http or https", u.Scheme)}
+	}
+	if host == "" {
+		return &DestinationError{Host: u.String(), Reason: "URL has no host"}
+	}
+	switch {
+	case len(g.toolHosts) > 0:
+		if !matchHost(g.toolHosts, host) {
+			return &DestinationError{Host: host, Reason: "host is not in the allowed hosts of the tool"}
+		}
+	case g.staticHost != "":
+		if host != g.staticHost {
+			return &DestinationError{Host: host, Reason: "host differs from the host of the tool URL"}
+		}
+	}
+	if len(g.globalHosts) > 0 && !matchHost(g.globalHosts, host) {
+		return &DestinationError{Host: host, Reason: "host is not in the globally allowed hosts"}
+	}
+	if ip, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return g.checkIP(host, ip)
+	}
+	return nil
+}
+
+func (g *netGuard) checkIP(host string, ip netip.Addr) error {
+	ip = ip.Unmap()
+	for _, p := range g.denied {
+		if p.Contains(ip) {
+			return &DestinationError{Host: host, IP: ip.String(), Reason: "address is in denied range " + p.String()}
+		}
+	}
+	if g.trusted(host) {
+		return nil
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsLinkLocalMulticast() || sharedAddressSpace.Contains(ip) {
+		return &DestinationError{
+			Host:   host,
+			IP:     ip.String(),
+			Reason: "templated hosts must be public; add the host to the allowed hosts to reach it",
+		}
+	}
+	return nil
+}
+
+func (g *netGuard) trusted(host string) bool {
+	host = strings.ToLower(host)
+	return host == g.staticHost || (host != "" && host == g.tokenHost) ||
+		matchHost(g.toolHosts, host) || matchHost(g.globalHosts, host)
+}
+
+// checkTokenURL checks the OAuth2 token endpoint. It is set by the tool author, so only the global allowed hosts and
+// the denied ranges apply.
+func (g *netGuard) checkTokenURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid oauth2 tokenURL: %w", err)
+	}
+	host := strings.ToLower(u.Hostname())
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &DestinationError{Host: host, Reason: fmt.Sprintf("scheme %q is not http or https", u.Scheme)}
+	}
+	if len(g.globalHosts) > 0 && !matchHost(g.globalHosts, host) {
+		return &DestinationError{Host: host, Reason: "token host is not in the globally allowed hosts"}
+	}
+	if ip, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return g.checkIP(host, ip)
+	}
+	return nil
+}
+
+func (g *netGuard) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return g.checkURL(req.URL)
+}
+
+// proxy selects the proxy from the environment and remembers its address. As the proxy dials the destination, the
+// host of a proxied request is resolved and its addresses are checked here instead of in dialContext.
+func (g *netGuard) proxy(req *http.Request) (*url.URL, error) {
+	u, err := http.ProxyFromEnvironment(req)
+	if err != nil || u == nil {
+		return u, err
+	}
+	if err := g.checkProxiedHost(req.Context(), req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+	g.proxyMu.Lock()
+	if g.proxies == nil {
+		g.proxies = map[string]bool{}
+	}
+	g.proxies[canonicalAddr(u)] = true
+	g.proxyMu.Unlock()
+	return u, nil
+}
+
+// checkProxiedHost checks the addresses a host name resolves to against the denied ranges. A trusted host that does
+// not resolve locally is left to the proxy, while templated hosts must resolve so that they can be checked. IP
+// literals are checked by checkURL.
+func (g *netGuard) checkProxiedHost(ctx context.Context, host string) error {
+	host = strings.ToLower(host)
+	if _, err := netip.ParseAddr(host); err == nil {
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		if g.trusted(host) {
+			return nil
+		}
+		return &DestinationError{
+			Host:   host,
+			Reason: "templated host sent through a proxy does not resolve: " + err.Error(),
+		}
+	}
+	for _, ip := range ips {
+		if err := g.checkIP(host, ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *netGuard) isProxy(addr string) bool {
+	g.proxyMu.Lock()
+	defer g.proxyMu.Unlock()
+	return g.proxies[addr]
+}
+
+// dialContext dials addr and checks the resolved address before connecting.
+func (g *netGuard) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if g.isProxy(addr) {
+		return d.DialContext(ctx, network, addr)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	d.Control = func(_, address string, _ syscall.RawConn) error {
+		ap, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		return g.checkIP(host, ap.Addr())
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+func (g *netGuard) transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = g.proxy
+	t.DialContext = g.dialContext
+	return t
+}
+
+// staticTemplateHost returns the lower-cased host of a URL template whose scheme and authority contain no
+// placeholders, or "" otherwise.
+func staticTemplateHost(tmpl string) string {
+	scheme, rest, ok := strings.Cut(strings.TrimSpace(tmpl), "://")
+	if !ok || strings.Contains(scheme, "${") {
+		return ""
+	}
+	authority := rest
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		authority = rest[:i]
+	}
+	if authority == "" || strings.Contains(authority, "${") {
+		return ""
+	}
+	u, err := url.Parse(scheme + "://" + authority)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func normalizeHosts(hosts []string) []string {
+	out := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			out = append(out, strings.Trim(h, "[]"))
+		}
+	}
+	return out
+}
+
+// matchHost reports whether host equals an entry, or is a subdomain of a "*.domain" entry.
+func matchHost(patterns []string, host string) bool {
+	host = strings.Trim(strings.ToLower(host), "[]")
+	for _, p := range patterns {
+		if suffix, ok := strings.CutPrefix(p, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == p {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateHTTPNetworkPolicy checks that allowed hosts are host names or "*.domain" patterns and that denied CIDRs
+// parse.
+func ValidateHTTPNetworkPolicy(p *spec.HTTPNetworkPolicy) error {
+	for i, h := range p.AllowedHosts {
+		h = strings.TrimSpace(h)
+		if h == "" || h == "*" || strings.ContainsAny(h, "/:@?# ") && !isIPv6Literal(h) {
+			return fmt.Errorf("allowedHosts[%d]: %q is not a host name", i, h)
+		}
+		if strings.Contains(strings.TrimPrefix(h, "*."), "*") {
+			return fmt.Errorf("allowedHosts[%d]: %q may only start with *.", i, h)
+		}
+	}
+	for i, c := range p.DeniedCIDRs {
+		if _, err := netip.ParsePrefix(strings.TrimSpace(c)); err != nil {
+			return fmt.Errorf("deniedCIDRs[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func isIPv6Literal(h string) bool {
+	ip, err := netip.ParseAddr(strings.Trim(h, "[]"))
+	return err == nil && ip.Is6()
+}
+
+// canonicalAddr returns host:port of u, with the default port of its scheme.
+func canonicalAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "socks5", "socks5h":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
@@ -0,0 +1,429 @@
+package httprunner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+	"github.com/ppipada/mapstore-go"
+	"github.com/ppipada/mapstore-go/jsonencdec"
+)
+
+const (
+	authTypeOAuth2ClientCredentials = "oauth2clientcredentials"
+	authTypeOAuth2RefreshToken      = "oauth2refreshtoken"
+
+	// Tokens expiring within this window are refreshed before use.
+	oauth2ExpiryDelta = time.Minute
+
+	maxTokenResponseBytes = 1 << 20
+
+	// oauth2InvalidGrant is the error code of a token endpoint that rejects a refresh token or credentials.
+	oauth2InvalidGrant = "invalid_grant"
+)
+
+// oauth2Error is a token endpoint response without an access token. Only the error fields are kept; the body may
+// echo credentials.
+type oauth2Error struct {
+	status      int
+	code        string
+	description string
+}
+
+func (e *oauth2Error) Error() string {
+	msg := fmt.Sprintf("oauth2 token endpoint returned status %d", e.status)
+	if e.code != "" {
+		msg += ": " + e.code
+		if e.description != "" {
+			msg += " (" + e.description + ")"
+		}
+	} else if e.status == http.StatusOK {
+		msg += " without access_token"
+	}
+	return msg
+}
+
+func isInvalidGrant(err error) bool {
+	var oe *oauth2Error
+	return errors.As(err, &oe) && oe.code == oauth2InvalidGrant
+}
+
+func isOAuth2Auth(a *spec.HTTPAuth) bool {
+	if a == nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(a.Type)) {
+	case authTypeOAuth2ClientCredentials, authTypeOAuth2RefreshToken:
+		return true
+	default:
+		return false
+	}
+}
+
+// oauth2Token is an acquired token. It is cached in memory and, encrypted, on disk.
+type oauth2Token struct {
+	AccessToken  string    `json:"accessToken"`
+	TokenType    string    `json:"tokenType,omitempty"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	Expiry       time.Time `json:"expiry,omitzero"`
+}
+
+// valid reports whether the access token can be used at now, i.e. it does not expire within oauth2ExpiryDelta. A
+// token without expiry is valid until the API rejects it.
+func (t *oauth2Token) valid(now time.Time) bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || now.Add(oauth2ExpiryDelta).Before(t.Expiry))
+}
+
+// authorization returns the Authorization header value.
+func (t *oauth2Token) authorization() string {
+	typ := t.TokenType
+	if typ == "" || strings.EqualFold(typ, "bearer") {
+		typ = "Bearer"
+	}
+	return typ + " " + t.AccessToken
+}
+
+// OAuth2TokenCache caches OAuth2 tokens across invocations, keyed by token endpoint, client, scopes and grant. Safe
+// for concurrent use; concurrent requests for the same key share one token request.
+type OAuth2TokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]*oauth2Token
+	locks  map[string]*sync.Mutex
+
+	// Optional on-disk copy; every token is stored as one encrypted value under tokens/<key>.
+	file *mapstore.MapFileStore
+}
+
+// OAuth2CacheOption - Functional options for OAuth2TokenCache.
+type OAuth2CacheOption func(*oauth2CacheConfig)
+
+type oauth2CacheConfig struct {
+	filePath string
+	encoder  mapstore.IOEncoderDecoder
+}
+
+// WithOAuth2CacheFile persists tokens to path, encrypted with encoder. Without it tokens are only kept in memory.
+func WithOAuth2CacheFile(path string, encoder mapstore.IOEncoderDecoder) OAuth2CacheOption {
+	return func(c *oauth2CacheConfig) {
+		c.filePath = path
+		c.encoder = encoder
+	}
+}
+
+func NewOAuth2TokenCache(opts ...OAuth2CacheOption) (*OAuth2TokenCache, error) {
+	var cfg oauth2CacheConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	c := &OAuth2TokenCache{
+		tokens: map[string]*oauth2Token{},
+		locks:  map[string]*sync.Mutex{},
+	}
+	if cfg.filePath == "" {
+		return c, nil
+	}
+	if cfg.encoder == nil {
+		return nil, errors.New("oauth2 token cache file needs an encoder")
+	}
+	fs, err := mapstore.NewMapFileStore(
+		cfg.filePath,
+		map[string]any{"tokens": map[string]any{}},
+		jsonencdec.JSONEncoderDecoder{},
+		mapstore.WithCreateIfNotExists(true),
+		mapstore.WithFileAutoFlush(true),
+		mapstore.WithValueEncDecGetter(func(path []string) mapstore.IOEncoderDecoder {
+			if len(path) == 2 && path[0] == "tokens" {
+				return cfg.encoder
+			}
+			return nil
+		}),
+		mapstore.WithFileLogger(slog.Default()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token cache: %w", err)
+	}
+	c.file = fs
+	return c, nil
+}
+
+// Close releases the on-disk cache.
+func (c *OAuth2TokenCache) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
+func (c *OAuth2TokenCache) keyLock(key string) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		c.locks[key] = l
+	}
+	return l
+}
+
+func (c *OAuth2TokenCache) load(key string) *oauth2Token {
+	c.mu.Lock()
+	t, ok := c.tokens[key]
+	c.mu.Unlock()
+	if ok || c.file == nil {
+		return t
+	}
+	raw, err := c.file.GetKey([]string{"tokens", key})
+	if err != nil {
+		return nil
+	}
+	s, _ := raw.(string)
+	var dt oauth2Token
+	if err := json.Unmarshal([]byte(s), &dt); err != nil {
+		slog.Warn("ignoring unreadable cached oauth2 token", "error", err)
+		return nil
+	}
+	c.mu.Lock()
+	c.tokens[key] = &dt
+	c.mu.Unlock()
+	return &dt
+}
+
+// drop removes the token of key, so the next request does not use its refresh token again.
+func (c *OAuth2TokenCache) drop(key string) {
+	c.mu.Lock()
+	delete(c.tokens, key)
+	c.mu.Unlock()
+	if c.file == nil {
+		return
+	}
+	if err := c.file.DeleteKey([]string{"tokens", key}); err != nil {
+		slog.Warn("could not drop cached oauth2 token", "error", err)
+	}
+}
+
+func (c *OAuth2TokenCache) store(key string, t *oauth2Token) {
+	c.mu.Lock()
+	c.tokens[key] = t
+	c.mu.Unlock()
+	if c.file == nil {
+		return
+	}
+	b, err := json.Marshal(t)
+	if err == nil {
+		err = c.file.SetKey([]string{"tokens", key}, string(b))
+	}
+	if err != nil {
+		// The in-memory copy is still used.
+		slog.Warn("could not persist oauth2 token", "error", err)
+	}
+}
+
+// token returns a valid token for key. A cached token is used unless it expires soon or force is set; otherwise a
+// new one is requested with fetch, which receives the cached refresh token, if any. A token endpoint that answers
+// invalid_grant drops the cached token.
+func (c *OAuth2TokenCache) token(
+	key string,
+	force bool,
+	fetch func(refreshToken string) (*oauth2Token, error),
+) (*oauth2Token, error) {
+	l := c.keyLock(key)
+	l.Lock()
+	defer l.Unlock()
+
+	cached := c.load(key)
+	if !force && cached.valid(time.Now()) {
+		return cached, nil
+	}
+	refresh := ""
+	if cached != nil {
+		refresh = cached.RefreshToken
+	}
+	t, err := fetch(refresh)
+	if err != nil {
+		if cached != nil && isInvalidGrant(err) {
+			c.drop(key)
+		}
+		return nil, err
+	}
+	c.store(key, t)
+	return t, nil
+}
+
+// oauth2Client is the resolved client configuration of one invocation.
+type oauth2Client struct {
+	grant        string // authTypeOAuth2*
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	refreshToken string
+	scopes       []string
+	clientAuth   string
+}
+
+func newOAuth2Client(a *spec.HTTPAuth, vars templateVars) (*oauth2Client, error) {
+	o := a.OAuth2
+	c := &oauth2Client{
+		grant:      strings.ToLower(strings.TrimSpace(a.Type)),
+		tokenURL:   strings.TrimSpace(o.TokenURL),
+		scopes:     o.Scopes,
+		clientAuth: strings.ToLower(strings.TrimSpace(o.ClientAuth)),
+	}
+	for _, f := range []struct {
+		name string
+		tmpl string
+		dst  *string
+	}{
+		{"clientIDTemplate", o.ClientIDTemplate, &c.clientID},
+		{"clientSecretTemplate", o.ClientSecretTemplate, &c.clientSecret},
+		{"refreshTokenTemplate", o.RefreshTokenTemplate, &c.refreshToken},
+	} {
+		v, err := expandTemplate(f.tmpl, vars)
+		if err != nil {
+			return nil, fmt.Errorf("oauth2 %s expansion: %w", f.name, err)
+		}
+		*f.dst = v
+	}
+	if c.grant == authTypeOAuth2RefreshToken && c.refreshToken == "" {
+		return nil, errors.New("oauth2 refreshTokenTemplate expanded to an empty refresh token")
+	}
+	return c, nil
+}
+
+// cacheKey identifies the tokens of this client. Secrets only enter it hashed.
+func (c *oauth2Client) cacheKey() string {
+	h := sha256.New()
+	for _, p := range []string{
+		c.grant, c.tokenURL, c.clientID, c.clientSecret, c.refreshToken, strings.Join(c.scopes, " "), c.clientAuth,
+	} {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fetch requests a token. A refresh token rotated into the cache is tried first; when that fails the configured grant
+// is used: client_credentials, or refresh_token with the configured refresh token.
+func (c *oauth2Client) fetch(ctx context.Context, hc *http.Client, cachedRefresh string) (*oauth2Token, error) {
+	configured := ""
+	if c.grant == authTypeOAuth2RefreshToken {
+		configured = c.refreshToken
+	}
+	if cachedRefresh == "" || cachedRefresh == configured {
+		return c.request(ctx, hc, configured)
+	}
+	t, err := c.request(ctx, hc, cachedRefresh)
+	if err == nil || ctx.Err() != nil {
+		return t, err
+	}
+	slog.Debug("oauth2 refresh with the cached token failed, using the configured grant", "error", err)
+	t, ferr := c.request(ctx, hc, configured)
+	if ferr != nil {
+		return nil, fmt.Errorf("%w (refresh with the cached token: %w)", ferr, err)
+	}
+	return t, nil
+}
+
+// request sends one token request: the refresh_token grant with refresh, or client_credentials without it.
+func (c *oauth2Client) request(ctx context.Context, hc *http.Client, refresh string) (*oauth2Token, error) {
+	form := url.Values{}
+	if refresh != "" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", refresh)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+	if c.clientAuth == "body" {
+		form.Set("client_id", c.clientID)
+		if c.clientSecret != "" {
+			form.Set("client_secret", c.clientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.clientAuth != "body" && c.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTokenResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token response: %w", err)
+	}
+
+	var tr struct {
+		AccessToken  string      `json:"access_token"`
+		TokenType    string      `json:"token_type"`
+		RefreshToken string      `json:"refresh_token"`
+		ExpiresIn    json.Number `json:"expires_in"`
+		Error        string      `json:"error"`
+		ErrorDesc    string      `json:"error_description"`
+	}
+	_ = json.Unmarshal(data, &tr)
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		return nil, &oauth2Error{status: resp.StatusCode, code: tr.Error, description: tr.ErrorDesc}
+	}
+
+	t := &oauth2Token{
+		AccessToken:  tr.AccessToken,
+		TokenType:    tr.TokenType,
+		RefreshToken: tr.RefreshToken,
+	}
+	// Servers may omit the refresh token when it is not rotated.
+	if t.RefreshToken == "" {
+		t.RefreshToken = refresh
+	}
+	if secs, err := tr.ExpiresIn.Int64(); err == nil && secs > 0 {
+		t.Expiry = time.Now().Add(time.Duration(secs) * time.Second)
+	}
+	return t, nil
+}
+
+func validateOAuth2(a *spec.HTTPAuth) error {
+	o := a.OAuth2
+	if o == nil {
+		return fmt.Errorf("auth type %s needs oauth2 settings", a.Type)
+	}
+	u, err := url.Parse(strings.TrimSpace(o.TokenURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("oauth2 tokenURL %q must be an absolute http(s) URL", o.TokenURL)
+	}
+	if strings.Contains(o.TokenURL, "${") {
+		return errors.New("oauth2 tokenURL cannot contain placeholders")
+	}
+	switch strings.ToLower(strings.TrimSpace(o.ClientAuth)) {
+	case "", "basic", "body":
+	default:
+		return fmt.Errorf("invalid oauth2 clientAuth: %s", o.ClientAuth)
+	}
+	if strings.EqualFold(strings.TrimSpace(a.Type), authTypeOAuth2RefreshToken) {
+		if strings.TrimSpace(o.RefreshTokenTemplate) == "" {
+			return errors.New("oauth2RefreshToken needs oauth2.refreshTokenTemplate")
+		}
+	} else if strings.TrimSpace(o.ClientIDTemplate) == "" {
+		return errors.New("oauth2ClientCredentials needs oauth2.clientIDTemplate")
+	}
+	return nil
+}
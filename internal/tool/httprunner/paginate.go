@@ -0,0 +1,245 @@
+package httprunner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+	"github.com/flexigpt/flexigpt-app/internal/tool/toolutil"
+)
+
+// fetchPages requests the pages that follow first, whose response is res, and replaces the body of res with the
+// items of all pages as one JSON array. Pages beyond the page or byte limit are left out and flagged on res.
+func (r *HTTPToolRunner) fetchPages(
+	ctx context.Context,
+	s *stepRunner,
+	client *http.Client,
+	first *http.Request,
+	firstResp *pageResponse,
+	oauth *oauth2Client,
+	timeoutMs int,
+	res *stepResult,
+) error {
+	p := s.Request.Pagination
+	maxPages := p.MaxPages
+	if maxPages <= 0 {
+		maxPages = spec.DefaultHTTPPaginationMaxPages
+	}
+	maxBytes := p.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = spec.DefaultHTTPPaginationMaxBytes
+	}
+	page := startPage(p)
+	if p.Type == spec.HTTPPaginationPage {
+		// The first request carries the page param, also when the query template set it.
+		v := first.URL.Query().Get(p.PageParam)
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("pagination: %s=%q of the first page is not a page number", p.PageParam, v)
+		}
+		page = n
+	}
+
+	prev := firstResp
+	total := len(prev.data)
+	items, body, err := pageItems(p, prev.data)
+	if err != nil {
+		return fmt.Errorf("pagination: page 1: %w", err)
+	}
+	lastCount := len(items)
+	for {
+		next, err := nextPageURL(p, first.URL, prev, body, lastCount, page+1)
+		if err != nil {
+			return fmt.Errorf("pagination: page %d: %w", res.pages, err)
+		}
+		if next == nil {
+			break
+		}
+		if res.pages >= maxPages {
+			res.pagesTruncated = true
+			break
+		}
+		if err := s.guard.checkURL(next); err != nil {
+			return err
+		}
+		req, err := cloneRequest(ctx, first)
+		if err != nil {
+			return err
+		}
+		req.URL = next
+		req.Host = ""
+
+		pr, retries, err := r.doRequest(ctx, s, client, req, oauth, timeoutMs)
+		res.retries += retries
+		if err != nil {
+			return fmt.Errorf("pagination: page %d: %w", res.pages+1, err)
+		}
+		if !isSuccessStatus(pr.status, s.Response.SuccessCodes) {
+			return fmt.Errorf("pagination: page %d: http status %d not in success set", res.pages+1, pr.status)
+		}
+		if total+len(pr.data) > maxBytes {
+			res.pagesTruncated = true
+			break
+		}
+		total += len(pr.data)
+		pageItems, pageBody, err := pageItems(p, pr.data)
+		if err != nil {
+			return fmt.Errorf("pagination: page %d: %w", res.pages+1, err)
+		}
+		items = append(items, pageItems...)
+		res.pages++
+		page++
+		prev, body, lastCount = pr, pageBody, len(pageItems)
+	}
+
+	merged, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("pagination: %w", err)
+	}
+	res.data = merged
+	res.contentType = "application/json"
+	return nil
+}
+
+// pageItems decodes a page and returns the array of items at the items path along with the decoded body.
+func pageItems(p *spec.HTTPPagination, data []byte) ([]any, any, error) {
+	body, err := decodeJSONBody(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	segs, err := parsePath(p.ItemsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, ok := selectPath(body, segs)
+	if !ok || v == nil {
+		// A page without the items field has no items.
+		return nil, body, nil
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("items at %q are not a JSON array", p.ItemsPath)
+	}
+	return items, body, nil
+}
+
+// nextPageURL returns the URL of the page after prev, or nil when prev was the last page.
+func nextPageURL(
+	p *spec.HTTPPagination,
+	first *url.URL,
+	prev *pageResponse,
+	body any,
+	count int,
+	page int,
+) (*url.URL, error) {
+	switch p.Type {
+	case spec.HTTPPaginationLinkHeader:
+		next := linkNext(prev.header.Values("Link"))
+		if next == "" {
+			return nil, nil
+		}
+		ref, err := url.Parse(next)
+		if err != nil {
+			return nil, fmt.Errorf("invalid next link: %w", err)
+		}
+		return first.ResolveReference(ref), nil
+
+	case spec.HTTPPaginationCursor:
+		segs, err := parsePath(p.CursorPath)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := selectPath(body, segs)
+		if !ok {
+			return nil, nil
+		}
+		cursor := toolutil.TemplateValue(v)
+		if cursor == "" {
+			return nil, nil
+		}
+		return withQuery(first, p.CursorParam, cursor), nil
+
+	case spec.HTTPPaginationPage:
+		if count == 0 {
+			return nil, nil
+		}
+		return withQuery(first, p.PageParam, strconv.Itoa(page)), nil
+	}
+	return nil, fmt.Errorf("unknown pagination type %q", p.Type)
+}
+
+// linkNext returns the target of the rel="next" entry of Link headers (RFC 8288).
+func linkNext(values []string) string {
+	for _, v := range values {
+		for link := range strings.SplitSeq(v, ",") {
+			target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+			target = strings.TrimSpace(target)
+			if !ok || !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for param := range strings.SplitSeq(params, ";") {
+				k, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(strings.TrimSpace(k), "rel") {
+					continue
+				}
+				for rel := range strings.FieldsSeq(strings.Trim(strings.TrimSpace(val), `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// startPage is the number of the first page of page pagination.
+func startPage(p *spec.HTTPPagination) int {
+	if p.StartPage == nil {
+		return 1
+	}
+	return *p.StartPage
+}
+
+func withQuery(u *url.URL, key, value string) *url.URL {
+	next := *u
+	q := next.Query()
+	q.Set(key, value)
+	next.RawQuery = q.Encode()
+	return &next
+}
+
+func validatePagination(p *spec.HTTPPagination) error {
+	switch p.Type {
+	case spec.HTTPPaginationLinkHeader:
+	case spec.HTTPPaginationCursor:
+		if strings.TrimSpace(p.CursorPath) == "" || strings.TrimSpace(p.CursorParam) == "" {
+			return errors.New("cursor pagination needs cursorPath and cursorParam")
+		}
+		if _, err := parsePath(p.CursorPath); err != nil {
+			return fmt.Errorf("cursorPath: %w", err)
+		}
+	case spec.HTTPPaginationPage:
+		if strings.TrimSpace(p.PageParam) == "" {
+			return errors.New("page pagination needs pageParam")
+		}
+		if p.StartPage != nil && *p.StartPage < 0 {
+			return errors.New("startPage must not be negative")
+		}
+	default:
+		return fmt.Errorf("invalid type: %q", p.Type)
+	}
+	if _, err := parsePath(p.ItemsPath); err != nil {
+		return fmt.Errorf("itemsPath: %w", err)
+	}
+	if p.MaxPages < 0 || p.MaxBytes < 0 {
+		return errors.New("maxPages and maxBytes must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package httprunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+// pageResponse is a response read in full.
+type pageResponse struct {
+	status int
+	header http.Header
+	data   []byte
+}
+
+// doRequest sends httpReq and reads the response. A 401 with OAuth2 auth gets one resend with a new token; retryable
+// statuses and transport errors are resent per the retry policy of the step. It returns the number of resends.
+func (r *HTTPToolRunner) doRequest(
+	ctx context.Context,
+	s *stepRunner,
+	client *http.Client,
+	httpReq *http.Request,
+	oauth *oauth2Client,
+	timeoutMs int,
+) (*pageResponse, int, error) {
+	policy := s.Request.Retry
+	maxAttempts := 1
+	if policy != nil {
+		maxAttempts = policy.MaxAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = spec.DefaultHTTPRetryMaxAttempts
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		req := httpReq
+		if attempt > 1 {
+			var err error
+			if req, err = cloneRequest(ctx, httpReq); err != nil {
+				return nil, attempt - 1, err
+			}
+		}
+		pr, err := r.doOnce(ctx, s, client, req, oauth, timeoutMs)
+		if attempt >= maxAttempts || !isRetryable(policy, req, pr, err) {
+			return pr, attempt - 1, err
+		}
+		wait, ok := retryDelay(policy, attempt, pr)
+		if !ok {
+			return pr, attempt - 1, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, attempt - 1, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (r *HTTPToolRunner) doOnce(
+	ctx context.Context,
+	s *stepRunner,
+	client *http.Client,
+	httpReq *http.Request,
+	oauth *oauth2Client,
+	timeoutMs int,
+) (*pageResponse, error) {
+	httpResp, err := client.Do(httpReq)
+	if err == nil && httpResp.StatusCode == http.StatusUnauthorized && oauth != nil {
+		// The token may have been revoked before its expiry: get a new one and retry once.
+		httpResp.Body.Close()
+		httpResp, err = r.retryWithNewToken(ctx, s, client, httpReq, oauth, timeoutMs)
+	}
+	if err != nil {
+		// Policy violations on a redirect or dial are reported as such, not as transport failures.
+		var destErr *DestinationError
+		if errors.As(err, &destErr) {
+			return nil, destErr
+		}
+		return nil, fmt.Errorf("http.Do: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	return &pageResponse{status: httpResp.StatusCode, header: httpResp.Header, data: data}, nil
+}
+
+// isRetryable reports whether a request that got pr or err may be resent under policy. Policy violations and
+// cancellations are final, and transport errors are only retried for requests that are safe to repeat.
+func isRetryable(policy *spec.HTTPRetryPolicy, req *http.Request, pr *pageResponse, err error) bool {
+	if policy == nil {
+		return false
+	}
+	if err != nil {
+		var destErr *DestinationError
+		if errors.As(err, &destErr) || errors.Is(err, context.Canceled) {
+			return false
+		}
+		return policy.RetryNonIdempotent || isIdempotent(req)
+	}
+	codes := policy.StatusCodes
+	if len(codes) == 0 {
+		codes = spec.DefaultHTTPRetryStatusCodes
+	}
+	return slices.Contains(codes, pr.status)
+}
+
+// isIdempotent reports whether repeating req has the effect of sending it once: its method is idempotent (RFC 9110)
+// or it carries an idempotency key, as net/http assumes for its own retries.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// retryDelay is the wait before the resend that follows attempt: the Retry-After of the response if it has one,
+// else the base delay doubled per attempt, capped at the max delay. A Retry-After beyond the max delay is not waited
+// for.
+func retryDelay(policy *spec.HTTPRetryPolicy, attempt int, pr *pageResponse) (time.Duration, bool) {
+	base := time.Duration(policy.BaseDelayMs) * time.Millisecond
+	if base <= 0 {
+		base = spec.DefaultHTTPRetryBaseDelayMs * time.Millisecond
+	}
+	maxDelay := time.Duration(policy.MaxDelayMs) * time.Millisecond
+	if maxDelay <= 0 {
+		maxDelay = spec.DefaultHTTPRetryMaxDelayMs * time.Millisecond
+	}
+	if pr != nil {
+		if d, ok := parseRetryAfter(pr.header.Get("Retry-After"), time.Now()); ok {
+			return d, d <= maxDelay
+		}
+	}
+	d := base << min(attempt-1, 30)
+	if d <= 0 || d > maxDelay {
+		d = maxDelay
+	}
+	return d, true
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	return max(t.Sub(now), 0), true
+}
+
+// cloneRequest copies httpReq with a fresh body for resending.
+func cloneRequest(ctx context.Context, httpReq *http.Request) (*http.Request, error) {
+	req := httpReq.Clone(ctx)
+	if httpReq.GetBody != nil {
+		body, err := httpReq.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	return req, nil
+}
+
+func validateRetry(p *spec.HTTPRetryPolicy) error {
+	if p.MaxAttempts < 0 || p.BaseDelayMs < 0 || p.MaxDelayMs < 0 {
+		return errors.New("maxAttempts, baseDelayMs and maxDelayMs must not be negative")
+	}
+	for _, c := range p.StatusCodes {
+		if c < 100 || c > 599 {
+			return fmt.Errorf("invalid status code: %d", c)
+		}
+	}
+	return nil
+}
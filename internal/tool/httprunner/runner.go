@@ -21,6 +21,7 @@ import (
 
 	"github.com/flexigpt/flexigpt-app/internal/jsonutil"
 	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+	"github.com/flexigpt/flexigpt-app/internal/tool/toolutil"
 )
 
 // HTTPToolRunner executes an HTTPToolImpl. Safe for concurrent use.
@@ -30,12 +31,42 @@ type HTTPToolRunner struct {
 	overrideTimeoutMs int
 	extraHeaders      map[string]string
 	secrets           map[string]string
+	networkPolicy     *spec.HTTPNetworkPolicy
+	secretResolver    SecretResolver
+	tokenCache        *OAuth2TokenCache
+
+	// Requests sent in order; a single-request tool is one unnamed step.
+	steps      []*stepRunner
+	outputStep int
+}
+
+// stepRunner holds the network policy and connections of one step.
+type stepRunner struct {
+	spec.HTTPStep
+
+	guard     *netGuard
+	transport *http.Transport
 
 	// HTTP Clients keyed by effective timeout (ms). Each client is safe for concurrent use.
 	clientsMu sync.RWMutex
 	clients   map[int]*http.Client
 }
 
+// stepResult is the response of one step.
+type stepResult struct {
+	url         *url.URL
+	status      int
+	contentType string
+	data        []byte
+	duration    time.Duration
+	success     bool
+	attempts    int
+	retries     int
+	pages       int
+	// Pages were left out of data for the page or byte limit.
+	pagesTruncated bool
+}
+
 // HTTPOption - Functional options for HTTPToolRunner.
 type HTTPOption func(*HTTPToolRunner)
 
@@ -74,17 +105,67 @@ func WithHTTPSecrets(s map[string]string) HTTPOption {
 	}
 }
 
+// WithHTTPSecretResolver resolves ${secret:<type>/<name>} references in templates.
+func WithHTTPSecretResolver(sr SecretResolver) HTTPOption {
+	return func(r *HTTPToolRunner) {
+		r.secretResolver = sr
+	}
+}
+
+// WithHTTPOAuth2TokenCache shares OAuth2 tokens across runners. Without it a runner keeps its tokens in memory.
+func WithHTTPOAuth2TokenCache(c *OAuth2TokenCache) HTTPOption {
+	return func(r *HTTPToolRunner) {
+		r.tokenCache = c
+	}
+}
+
+// WithHTTPNetworkPolicy sets the global network policy, applied on top of the policy of the tool.
+func WithHTTPNetworkPolicy(p spec.HTTPNetworkPolicy) HTTPOption {
+	return func(r *HTTPToolRunner) {
+		r.networkPolicy = &p
+	}
+}
+
 func NewHTTPToolRunner(impl spec.HTTPToolImpl, opts ...HTTPOption) (*HTTPToolRunner, error) {
 	if err := ValidateHTTPImpl(&impl); err != nil {
 		return nil, err
 	}
-	r := &HTTPToolRunner{
-		impl:    impl,
-		clients: make(map[int]*http.Client),
-	}
+	r := &HTTPToolRunner{impl: impl}
 	for _, o := range opts {
 		o(r)
 	}
+
+	steps := r.impl.Steps
+	if len(steps) == 0 {
+		steps = []spec.HTTPStep{{Request: r.impl.Request, Response: r.impl.Response}}
+	}
+	needsTokens := false
+	for i, st := range steps {
+		guard, err := newNetGuard(&st.Request, r.networkPolicy)
+		if err != nil {
+			return nil, err
+		}
+		r.steps = append(r.steps, &stepRunner{
+			HTTPStep:  st,
+			guard:     guard,
+			transport: guard.transport(),
+			clients:   make(map[int]*http.Client),
+		})
+		if st.Name != "" && st.Name == r.impl.OutputStep {
+			r.outputStep = i
+		}
+		needsTokens = needsTokens || isOAuth2Auth(st.Request.Auth)
+	}
+	if r.impl.OutputStep == "" {
+		r.outputStep = len(r.steps) - 1
+	}
+	if r.tokenCache == nil && needsTokens {
+		c, err := NewOAuth2TokenCache()
+		if err != nil {
+			return nil, err
+		}
+		r.tokenCache = c
+	}
 	return r, nil
 }
 
@@ -92,8 +173,131 @@ func (r *HTTPToolRunner) Run(
 	ctx context.Context,
 	inArgs json.RawMessage,
 ) (outputs []spec.ToolStoreOutputUnion, metaData map[string]any, err error) {
-	req := r.impl.Request
-	resp := r.impl.Response
+	defer func() {
+		for _, s := range r.steps {
+			s.transport.CloseIdleConnections()
+		}
+	}()
+
+	secrets, err := r.resolveSecrets(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Resolved secrets must not leak through metadata or errors.
+	redact := newRedactor(secrets)
+	defer func() {
+		err = redact.error(err)
+	}()
+
+	// Decode args into map for templating. Non-object args will simply result in no substitutions.
+	args, _ := jsonutil.DecodeJSONRaw[map[string]any](inArgs)
+	vars := templateVars{args: args, secrets: secrets, steps: map[string]string{}, failedSteps: map[string]bool{}}
+
+	var (
+		out      *stepResult
+		stepMeta []map[string]any
+	)
+	for i, s := range r.steps {
+		res, err := r.runStep(ctx, s, vars)
+		if res != nil && len(r.steps) > 1 {
+			stepMeta = append(stepMeta, map[string]any{
+				"name":       s.Name,
+				"url":        redact.string(res.url.String()),
+				"status":     res.status,
+				"durationMs": res.duration.Milliseconds(),
+				"attempts":   res.attempts,
+				"retries":    res.retries,
+			})
+		}
+		if i == r.outputStep {
+			out = res
+		}
+		if err != nil {
+			if len(r.steps) > 1 {
+				err = fmt.Errorf("step %s: %w", s.Name, err)
+			}
+			return nil, stepsMetaData(out, stepMeta, redact), err
+		}
+		if !res.success {
+			vars.failedSteps[s.Name] = true
+		}
+		if res.success && len(s.Extract) > 0 {
+			if err := extractStepVars(s.Name, s.Extract, res.data, vars.steps); err != nil {
+				return nil, stepsMetaData(out, stepMeta, redact), fmt.Errorf("step %s: %w", s.Name, err)
+			}
+		}
+	}
+
+	metaData = stepsMetaData(out, stepMeta, redact)
+	outputs, err = stepOutputs(r.steps[r.outputStep].Response, out, metaData)
+	return outputs, metaData, err
+}
+
+// stepsMetaData describes the output step and, for multi-step tools, every step that got a response.
+func stepsMetaData(out *stepResult, steps []map[string]any, redact redactor) map[string]any {
+	if out == nil && len(steps) == 0 {
+		return nil
+	}
+	metaData := map[string]any{"type": "http"}
+	if out != nil {
+		metaData["url"] = redact.string(out.url.String())
+		metaData["status"] = out.status
+		metaData["durationMs"] = out.duration.Milliseconds()
+		metaData["contentType"] = out.contentType
+		if out.retries > 0 {
+			metaData["retries"] = out.retries
+		}
+		if out.pages > 0 {
+			metaData["pages"] = out.pages
+		}
+		if out.pagesTruncated {
+			metaData["pagesTruncated"] = true
+		}
+	}
+	if len(steps) > 0 {
+		metaData["steps"] = steps
+	}
+	return metaData
+}
+
+// runStep sends the request of a step, repeating it while its poll condition is not met.
+func (r *HTTPToolRunner) runStep(ctx context.Context, s *stepRunner, vars templateVars) (*stepResult, error) {
+	if s.Poll == nil {
+		return r.sendStep(ctx, s, vars)
+	}
+	interval := time.Duration(s.Poll.IntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = spec.DefaultHTTPPollIntervalMs * time.Millisecond
+	}
+	maxAttempts := s.Poll.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = spec.DefaultHTTPPollMaxAttempts
+	}
+	for attempt := 1; ; attempt++ {
+		res, err := r.sendStep(ctx, s, vars)
+		if err != nil || !res.success {
+			return res, err
+		}
+		res.attempts = attempt
+		done, err := pollDone(s.Poll, res.data)
+		if err != nil || done {
+			return res, err
+		}
+		if attempt >= maxAttempts {
+			return res, fmt.Errorf("poll: %s not in %v after %d attempts", s.Poll.Until, s.Poll.Values, attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return res, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// sendStep sends the request of a step once. A status outside the success set is an error unless the error mode of
+// the step is "empty".
+func (r *HTTPToolRunner) sendStep(ctx context.Context, s *stepRunner, vars templateVars) (*stepResult, error) {
+	req := s.Request
 	timeoutMs := req.TimeoutMs
 	if timeoutMs <= 0 {
 		timeoutMs = spec.DefaultHTTPTimeoutMs
@@ -102,49 +306,47 @@ func (r *HTTPToolRunner) Run(
 		timeoutMs = r.overrideTimeoutMs
 	}
 
-	client := r.client(timeoutMs)
+	client := s.client(timeoutMs)
 	method := strings.ToUpper(strings.TrimSpace(req.Method))
 	if method == "" {
 		method = http.MethodGet
 	}
 
-	secret := ""
-	if r.secrets != nil {
-		secret = r.secrets["SECRET"]
-	}
-
-	// Decode args into map for templating. Non-object args will simply result in no substitutions.
-	args, _ := jsonutil.DecodeJSONRaw[map[string]any](inArgs)
-
 	// Build URL with templating.
-	uStr, err := expandTemplate(req.URLTemplate, args, secret)
+	uStr, err := expandTemplate(req.URLTemplate, vars)
 	if err != nil {
-		return nil, nil, fmt.Errorf("urlTemplate expansion failed: %w", err)
+		return nil, fmt.Errorf("urlTemplate expansion failed: %w", err)
 	}
 	u, err := url.Parse(uStr)
 	if err != nil {
-		return nil, nil, fmt.Errorf("invalid URL after expansion: %w", err)
+		return nil, fmt.Errorf("invalid URL after expansion: %w", err)
 	}
 
 	// Apply query params.
 	q := u.Query()
 	for k, v := range req.Query {
-		expanded, err := expandTemplate(v, args, secret)
+		expanded, err := expandTemplate(v, vars)
 		if err != nil {
-			return nil, nil, fmt.Errorf("query[%s] expansion failed: %w", k, err)
+			return nil, fmt.Errorf("query[%s] expansion failed: %w", k, err)
 		}
 		if expanded != "" {
 			q.Set(k, expanded)
 		}
 	}
+	if p := req.Pagination; p != nil && p.Type == spec.HTTPPaginationPage && q.Get(p.PageParam) == "" {
+		q.Set(p.PageParam, strconv.Itoa(startPage(p)))
+	}
 	u.RawQuery = q.Encode()
+	if err := s.guard.checkURL(u); err != nil {
+		return nil, err
+	}
 
 	// Headers.
 	headers := make(http.Header)
 	for k, v := range req.Headers {
-		expanded, err := expandTemplate(v, args, secret)
+		expanded, err := expandTemplate(v, vars)
 		if err != nil {
-			return nil, nil, fmt.Errorf("header[%s] expansion failed: %w", k, err)
+			return nil, fmt.Errorf("header[%s] expansion failed: %w", k, err)
 		}
 		if expanded != "" {
 			headers.Set(k, expanded)
@@ -152,27 +354,39 @@ func (r *HTTPToolRunner) Run(
 	}
 
 	// Auth.
-	if req.Auth != nil {
-		if err := applyAuth(headers, u, req.Auth, args, secret); err != nil {
-			return nil, nil, fmt.Errorf("auth apply failed: %w", err)
+	var oauth *oauth2Client
+	if isOAuth2Auth(req.Auth) {
+		if oauth, err = newOAuth2Client(req.Auth, vars); err != nil {
+			return nil, err
+		}
+		tok, err := r.oauth2Token(ctx, s, oauth, timeoutMs, false)
+		if err != nil {
+			return nil, err
+		}
+		headers.Set("Authorization", tok.authorization())
+	} else if req.Auth != nil {
+		if err := applyAuth(headers, u, req.Auth, vars); err != nil {
+			return nil, fmt.Errorf("auth apply failed: %w", err)
 		}
 	}
 
 	// Body (JSON only).
 	var body io.Reader
 	if strings.TrimSpace(req.Body) != "" && methodAllowsBody(method) {
-		expanded, err := expandTemplate(req.Body, args, secret)
+		expandedBytes, err := expandBodyTemplate(req.Body, req.BodyFromArg, vars)
 		if err != nil {
-			return nil, nil, fmt.Errorf("body expansion failed: %w", err)
+			return nil, fmt.Errorf("body expansion failed: %w", err)
 		}
-		expandedBytes := []byte(expanded)
-		if !json.Valid(expandedBytes) {
-			return nil, nil, errors.New("request body must be valid JSON after templating")
-		}
-		body = bytes.NewReader(expandedBytes)
-		// Force JSON content-type if not set.
-		if headers.Get("Content-Type") == "" {
-			headers.Set("Content-Type", "application/json; charset=utf-8")
+		// A whole-body argument that was not given sends no body.
+		if expandedBytes != nil {
+			if !json.Valid(expandedBytes) {
+				return nil, errors.New("request body must be valid JSON after templating")
+			}
+			body = bytes.NewReader(expandedBytes)
+			// Force JSON content-type if not set.
+			if headers.Get("Content-Type") == "" {
+				headers.Set("Content-Type", "application/json; charset=utf-8")
+			}
 		}
 	}
 
@@ -189,123 +403,170 @@ func (r *HTTPToolRunner) Run(
 	// Build request.
 	httpReq, err := http.NewRequestWithContext(ctx, method, u.String(), body)
 	if err != nil {
-		return nil, nil, fmt.Errorf("http.NewRequest: %w", err)
+		return nil, fmt.Errorf("http.NewRequest: %w", err)
 	}
 	httpReq.Header = headers
 
 	start := time.Now()
-	httpResp, err := client.Do(httpReq)
-	dur := time.Since(start)
+	pr, retries, err := r.doRequest(ctx, s, client, httpReq, oauth, timeoutMs)
 	if err != nil {
-		return nil, nil, fmt.Errorf("http.Do: %w", err)
+		return nil, err
 	}
-	defer httpResp.Body.Close()
 
-	isSuccess := isSuccessStatus(httpResp.StatusCode, resp.SuccessCodes)
-	errorMode := resp.ErrorMode
-	if errorMode == "" {
-		errorMode = spec.DefaultHTTPErrorMode
+	res := &stepResult{
+		url:         u,
+		status:      pr.status,
+		contentType: pr.header.Get("Content-Type"),
+		data:        pr.data,
+		success:     isSuccessStatus(pr.status, s.Response.SuccessCodes),
+		attempts:    1,
+		retries:     retries,
 	}
-
-	data, readErr := io.ReadAll(httpResp.Body)
-	if readErr != nil {
-		return nil, nil, fmt.Errorf("read response: %w", readErr)
+	if req.Pagination != nil && res.success && len(pr.data) > 0 {
+		res.pages = 1
+		err = r.fetchPages(ctx, s, client, httpReq, pr, oauth, timeoutMs, res)
 	}
-
-	metaData = map[string]any{
-		"type":        "http",
-		"url":         u.String(),
-		"status":      httpResp.StatusCode,
-		"durationMs":  dur.Milliseconds(),
-		"contentType": httpResp.Header.Get("Content-Type"),
+	res.duration = time.Since(start)
+	if err != nil {
+		return res, err
 	}
 
-	if !isSuccess {
-		if strings.EqualFold(errorMode, "empty") {
-			return nil, metaData, nil
-		}
-		return nil, metaData, fmt.Errorf("http status %d not in success set", httpResp.StatusCode)
+	errorMode := s.Response.ErrorMode
+	if errorMode == "" {
+		errorMode = spec.DefaultHTTPErrorMode
 	}
-
-	if len(data) == 0 {
-		// No body -> no outputs, just metadata.
-		return nil, metaData, nil
+	if !res.success && !strings.EqualFold(errorMode, "empty") {
+		return res, fmt.Errorf("http status %d not in success set", pr.status)
 	}
+	return res, nil
+}
 
-	ctHeader := httpResp.Header.Get("Content-Type")
-	ctNorm := normalizeContentType(ctHeader)
+// stepOutputs maps the response of the output step into tool outputs.
+func stepOutputs(
+	resp spec.HTTPResponse,
+	res *stepResult,
+	metaData map[string]any,
+) ([]spec.ToolStoreOutputUnion, error) {
+	if res == nil || !res.success || len(res.data) == 0 {
+		// Suppressed error or no body -> no outputs, just metadata.
+		return nil, nil
+	}
 
+	ctNorm := normalizeContentType(res.contentType)
 	mode := resp.BodyOutputMode
 	if mode == "" {
 		mode = spec.HTTPBodyOutputModeAuto
 	}
 
 	// If the server claims JSON, ensure the body is valid JSON.
-	if isJSONContentType(ctNorm) && !json.Valid(data) {
-		return nil, metaData, errors.New("response body is not valid JSON")
+	if isJSONContentType(ctNorm) && !json.Valid(res.data) {
+		return nil, errors.New("response body is not valid JSON")
+	}
+
+	var outputs []spec.ToolStoreOutputUnion
+	if hasJSONShaping(resp.Transform) {
+		text, err := transformJSON(resp.Transform, res.data)
+		if err != nil {
+			return nil, fmt.Errorf("response transform failed: %w", err)
+		}
+		outputs = []spec.ToolStoreOutputUnion{toolutil.TextOutput(text)}
+	} else {
+		outputs = bodyOutputs(mode, res.url, ctNorm, res.data)
+	}
+	if resp.Transform != nil && resp.Transform.MaxBytes > 0 {
+		capTextOutputs(outputs, resp.Transform.MaxBytes, metaData)
 	}
+	return outputs, nil
+}
 
+// oauth2Token returns a cached or newly acquired token of c. A rotated refresh token that the endpoint rejects is
+// dropped in favour of the configured grant.
+func (r *HTTPToolRunner) oauth2Token(
+	ctx context.Context,
+	s *stepRunner,
+	c *oauth2Client,
+	timeoutMs int,
+	force bool,
+) (*oauth2Token, error) {
+	hc := &http.Client{
+		Timeout:   time.Duration(timeoutMs) * time.Millisecond,
+		Transport: s.transport,
+		// Token endpoints answer directly; a redirect is reported as the status it came with.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	if err := s.guard.checkTokenURL(c.tokenURL); err != nil {
+		return nil, err
+	}
+	return r.tokenCache.token(c.cacheKey(), force, func(refresh string) (*oauth2Token, error) {
+		return c.fetch(ctx, hc, refresh)
+	})
+}
+
+func (r *HTTPToolRunner) retryWithNewToken(
+	ctx context.Context,
+	s *stepRunner,
+	client *http.Client,
+	httpReq *http.Request,
+	c *oauth2Client,
+	timeoutMs int,
+) (*http.Response, error) {
+	tok, err := r.oauth2Token(ctx, s, c, timeoutMs, true)
+	if err != nil {
+		return nil, err
+	}
+	retry, err := cloneRequest(ctx, httpReq)
+	if err != nil {
+		return nil, err
+	}
+	retry.Header.Set("Authorization", tok.authorization())
+	return client.Do(retry)
+}
+
+// bodyOutputs maps a response body into a single output block according to mode.
+func bodyOutputs(
+	mode spec.HTTPBodyOutputMode,
+	u *url.URL,
+	ctNorm string,
+	data []byte,
+) []spec.ToolStoreOutputUnion {
 	switch mode {
 	case spec.HTTPBodyOutputModeText:
-		return []spec.ToolStoreOutputUnion{
-			{
-				Kind: spec.ToolStoreOutputKindText,
-				TextItem: &spec.ToolStoreOutputText{
-					Text: string(data),
-				},
-			},
-		}, metaData, nil
-
+		return []spec.ToolStoreOutputUnion{toolutil.TextOutput(string(data))}
 	case spec.HTTPBodyOutputModeFile:
-		return []spec.ToolStoreOutputUnion{
-			makeFileOutput(u, ctNorm, data),
-		}, metaData, nil
-
+		return []spec.ToolStoreOutputUnion{makeFileOutput(u, ctNorm, data)}
 	case spec.HTTPBodyOutputModeImage:
-		return []spec.ToolStoreOutputUnion{
-			makeImageOutput(u, ctNorm, data),
-		}, metaData, nil
-
+		return []spec.ToolStoreOutputUnion{makeImageOutput(u, ctNorm, data)}
 	default:
 		switch {
 		case isImageContentType(ctNorm):
-			return []spec.ToolStoreOutputUnion{
-				makeImageOutput(u, ctNorm, data),
-			}, metaData, nil
+			return []spec.ToolStoreOutputUnion{makeImageOutput(u, ctNorm, data)}
 		case isTextContentType(ctNorm) || ctNorm == "":
-			return []spec.ToolStoreOutputUnion{
-				{
-					Kind: spec.ToolStoreOutputKindText,
-					TextItem: &spec.ToolStoreOutputText{
-						Text: string(data),
-					},
-				},
-			}, metaData, nil
+			return []spec.ToolStoreOutputUnion{toolutil.TextOutput(string(data))}
 		default:
-			return []spec.ToolStoreOutputUnion{
-				makeFileOutput(u, ctNorm, data),
-			}, metaData, nil
+			return []spec.ToolStoreOutputUnion{makeFileOutput(u, ctNorm, data)}
 		}
 	}
 }
 
-func (r *HTTPToolRunner) client(timeoutMs int) *http.Client {
-	r.clientsMu.RLock()
-	if c, ok := r.clients[timeoutMs]; ok {
-		r.clientsMu.RUnlock()
+func (s *stepRunner) client(timeoutMs int) *http.Client {
+	s.clientsMu.RLock()
+	if c, ok := s.clients[timeoutMs]; ok {
+		s.clientsMu.RUnlock()
 		return c
 	}
-	r.clientsMu.RUnlock()
+	s.clientsMu.RUnlock()
 
-	r.clientsMu.Lock()
-	defer r.clientsMu.Unlock()
-	if c, ok := r.clients[timeoutMs]; ok {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	if c, ok := s.clients[timeoutMs]; ok {
 		return c
 	}
 	c := &http.Client{
-		Timeout: time.Duration(timeoutMs) * time.Millisecond,
+		Timeout:       time.Duration(timeoutMs) * time.Millisecond,
+		Transport:     s.transport,
+		CheckRedirect: s.guard.checkRedirect,
 	}
-	r.clients[timeoutMs] = c
+	s.clients[timeoutMs] = c
 	return c
 }
 
@@ -332,13 +593,12 @@ func applyAuth(
 	h http.Header,
 	u *url.URL,
 	a *spec.HTTPAuth,
-	args map[string]any,
-	secret string,
+	vars templateVars,
 ) error {
 	if a == nil {
 		return nil
 	}
-	val, err := expandTemplate(a.ValueTemplate, args, secret)
+	val, err := expandTemplate(a.ValueTemplate, vars)
 	if err != nil {
 		return fmt.Errorf("auth valueTemplate expansion: %w", err)
 	}
@@ -369,72 +629,95 @@ func applyAuth(
 	return nil
 }
 
+// templateTokenRe matches ${...} placeholders: an args path, a secret reference or a step reference.
+var templateTokenRe = regexp.MustCompile(
+	`\$\{([a-zA-Z0-9_.\[\]-]+|secret:[a-zA-Z0-9_.-]+/[a-zA-Z0-9_.-]+|step:[a-zA-Z0-9_-]+\.[a-zA-Z0-9_-]+)\}`,
+)
+
+// templateVars are the values ${...} placeholders expand to.
+type templateVars struct {
+	args    map[string]any
+	secrets map[string]string
+	// Values extracted from earlier steps, keyed by "<step>.<var>".
+	steps map[string]string
+	// Earlier steps whose status was outside their success codes.
+	failedSteps map[string]bool
+}
+
 // expandTemplate replaces ${path} tokens with values resolved from args (dot-path with [idx]).
-// ${SECRET} is replaced with the provided secret if present.
-func expandTemplate(s string, args map[string]any, secret string) (string, error) {
+// ${SECRET} and ${secret:<type>/<name>} are replaced with the resolved secrets if present, ${step:<name>.<var>} with
+// a value extracted from an earlier step; a step value that is not available is a *StepVarError.
+func expandTemplate(s string, vars templateVars) (string, error) {
 	if s == "" {
 		return "", nil
 	}
-	re := regexp.MustCompile(`\$\{([a-zA-Z0-9_.\[\]-]+)\}`)
-	out := re.ReplaceAllStringFunc(s, func(m string) string {
+	var stepErr error
+	out := templateTokenRe.ReplaceAllStringFunc(s, func(m string) string {
 		name := strings.TrimSuffix(strings.TrimPrefix(m, "${"), "}")
-		if name == "SECRET" {
-			return secret
+		// Secret and step names are never resolved from args.
+		switch {
+		case name == "SECRET" || strings.HasPrefix(name, secretRefPrefix):
+			return vars.secrets[name]
+		case strings.HasPrefix(name, stepRefPrefix):
+			ref := strings.TrimPrefix(name, stepRefPrefix)
+			v, ok := vars.steps[ref]
+			if !ok && stepErr == nil {
+				step, varName, _ := strings.Cut(ref, ".")
+				stepErr = &StepVarError{Step: step, Var: varName, Failed: vars.failedSteps[step]}
+			}
+			return v
 		}
-		v, ok := resolvePath(args, name)
+		v, ok := resolvePath(vars.args, name)
 		if !ok || v == nil {
 			return ""
 		}
 		return fmt.Sprintf("%v", v)
 	})
+	if stepErr != nil {
+		return "", stepErr
+	}
 	return out, nil
 }
 
-// resolvePath resolves dot/array-index path into args (e.g. user.name, items[0].id).
-func resolvePath(root any, inPath string) (any, bool) {
-	cur := root
-	remain := inPath
-	for remain != "" {
-		var seg string
-		if i := strings.IndexAny(remain, ".["); i >= 0 {
-			seg = remain[:i]
-			remain = remain[i:]
-		} else {
-			seg = remain
-			remain = ""
+// expandBodyTemplate expands a request body template. With fromArg, the body is a single ${path} placeholder of args
+// and is replaced with the JSON encoding of the value; nil means the value is not set.
+func expandBodyTemplate(s string, fromArg bool, vars templateVars) ([]byte, error) {
+	if fromArg {
+		path, ok := bodyArgPath(s)
+		if !ok {
+			return nil, errors.New("bodyFromArg needs a body that is a single ${arg} placeholder")
 		}
-		if seg != "" {
-			m, ok := cur.(map[string]any)
-			if !ok {
-				return nil, false
-			}
-			var ok2 bool
-			cur, ok2 = m[seg]
-			if !ok2 {
-				return nil, false
-			}
-		}
-		for strings.HasPrefix(remain, "[") {
-			end := strings.Index(remain, "]")
-			if end <= 1 {
-				return nil, false
-			}
-			idxStr := remain[1:end]
-			remain = remain[end+1:]
-			idx, err := strconv.Atoi(idxStr)
-			if err != nil || idx < 0 {
-				return nil, false
-			}
-			arr, ok := toSlice(cur)
-			if !ok || idx >= len(arr) {
-				return nil, false
-			}
-			cur = arr[idx]
-			remain = strings.TrimPrefix(remain, ".")
+		v, ok := resolvePath(vars.args, path)
+		if !ok || v == nil {
+			return nil, nil
 		}
-		remain = strings.TrimPrefix(remain, ".")
+		return json.Marshal(v)
 	}
-	return cur, true
+	expanded, err := expandTemplate(s, vars)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(expanded), nil
+}
+
+// bodyArgPath returns the args path of a body that consists of a single ${path} placeholder of args.
+func bodyArgPath(body string) (string, bool) {
+	t := strings.TrimSpace(body)
+	m := templateTokenRe.FindStringSubmatch(t)
+	if m == nil || m[0] != t ||
+		m[1] == "SECRET" || strings.HasPrefix(m[1], secretRefPrefix) || strings.HasPrefix(m[1], stepRefPrefix) {
+		return "", false
+	}
+	return m[1], true
+}
+
+// resolvePath resolves dot/array-index path into args (e.g. user.name, items[0].id).
+func resolvePath(root any, inPath string) (any, bool) {
+	segs, err := parsePath(inPath)
+	if err != nil {
+		return nil, false
+	}
+	return selectPath(root, segs)
 }
 
 func toSlice(v any) ([]any, bool) {
@@ -456,12 +739,31 @@ func ValidateHTTPImpl(impl *spec.HTTPToolImpl) error {
 	if impl == nil {
 		return errors.New("httpImpl is nil")
 	}
+	if len(impl.Steps) > 0 {
+		return validateSteps(impl)
+	}
 	if strings.TrimSpace(impl.Request.URLTemplate) == "" {
 		return errors.New("httpImpl.request.urlTemplate is empty")
 	}
+	if impl.OutputStep != "" {
+		return errors.New("httpImpl.outputStep needs steps")
+	}
+	if len(templateRefs(&impl.Request, stepRefPrefix)) > 0 {
+		return errors.New("httpImpl.request references steps, but the tool has none")
+	}
+	if err := validateRequest(&impl.Request); err != nil {
+		return err
+	}
+	return validateResponse(&impl.Response)
+}
+
+func validateRequest(req *spec.HTTPRequest) error {
+	if strings.TrimSpace(req.URLTemplate) == "" {
+		return errors.New("request.urlTemplate is empty")
+	}
 	// Enforce method sanity if set.
-	if impl.Request.Method != "" {
-		m := strings.ToUpper(strings.TrimSpace(impl.Request.Method))
+	if req.Method != "" {
+		m := strings.ToUpper(strings.TrimSpace(req.Method))
 		switch m {
 		case http.MethodGet,
 			http.MethodPost,
@@ -475,26 +777,60 @@ func ValidateHTTPImpl(impl *spec.HTTPToolImpl) error {
 			return fmt.Errorf("unsupported http method: %s", m)
 		}
 	}
+	if isOAuth2Auth(req.Auth) {
+		if err := validateOAuth2(req.Auth); err != nil {
+			return fmt.Errorf("invalid auth: %w", err)
+		}
+	}
+	if req.BodyFromArg {
+		if _, ok := bodyArgPath(req.Body); !ok {
+			return errors.New("request.bodyFromArg needs a body that is a single ${arg} placeholder")
+		}
+	}
+	if req.NetworkPolicy != nil {
+		if err := ValidateHTTPNetworkPolicy(req.NetworkPolicy); err != nil {
+			return fmt.Errorf("invalid networkPolicy: %w", err)
+		}
+	}
+	if req.Retry != nil {
+		if err := validateRetry(req.Retry); err != nil {
+			return fmt.Errorf("invalid retry: %w", err)
+		}
+	}
+	if req.Pagination != nil {
+		if err := validatePagination(req.Pagination); err != nil {
+			return fmt.Errorf("invalid pagination: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateResponse(resp *spec.HTTPResponse) error {
 	// SuccessCodes sanity.
-	for _, c := range impl.Response.SuccessCodes {
+	for _, c := range resp.SuccessCodes {
 		if c < 100 || c > 599 {
 			return fmt.Errorf("invalid success code: %d", c)
 		}
 	}
-	if impl.Response.ErrorMode != "" {
-		em := strings.ToLower(impl.Response.ErrorMode)
+	if resp.ErrorMode != "" {
+		em := strings.ToLower(resp.ErrorMode)
 		if em != "fail" && em != "empty" {
-			return fmt.Errorf("invalid errorMode: %s", impl.Response.ErrorMode)
+			return fmt.Errorf("invalid errorMode: %s", resp.ErrorMode)
 		}
 	}
-	switch impl.Response.BodyOutputMode {
+	switch resp.BodyOutputMode {
 	case "", spec.HTTPBodyOutputModeAuto,
 		spec.HTTPBodyOutputModeText,
 		spec.HTTPBodyOutputModeFile,
 		spec.HTTPBodyOutputModeImage:
 		// Ok.
 	default:
-		return fmt.Errorf("invalid bodyOutputMode: %s", impl.Response.BodyOutputMode)
+		return fmt.Errorf("invalid bodyOutputMode: %s", resp.BodyOutputMode)
+	}
+	if resp.Transform != nil {
+		if err := validateTransform(resp.Transform, resp.BodyOutputMode); err != nil {
+			return fmt.Errorf("invalid transform: %w", err)
+		}
 	}
 	return nil
 }
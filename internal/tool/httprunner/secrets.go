@@ -0,0 +1,136 @@
+package httprunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+// secretRefPrefix starts a named secret placeholder: ${secret:<type>/<name>}.
+const secretRefPrefix = "secret:"
+
+const redactedSecret = "***"
+
+// SecretResolver returns the value of a named secret reference ("<type>/<name>"), e.g. from the settings store.
+type SecretResolver interface {
+	ResolveSecret(ctx context.Context, ref string) (string, error)
+}
+
+// templateRefs returns the distinct references with the given prefix ("secret:" or "step:") in the templates of req,
+// without the prefix.
+func templateRefs(req *spec.HTTPRequest, prefix string) []string {
+	templates := []string{req.URLTemplate, req.Body}
+	for _, v := range req.Query {
+		templates = append(templates, v)
+	}
+	for _, v := range req.Headers {
+		templates = append(templates, v)
+	}
+	if req.Auth != nil {
+		templates = append(templates, req.Auth.ValueTemplate)
+		if o := req.Auth.OAuth2; o != nil {
+			templates = append(templates, o.ClientIDTemplate, o.ClientSecretTemplate, o.RefreshTokenTemplate)
+		}
+	}
+	var refs []string
+	for _, t := range templates {
+		for _, m := range templateTokenRe.FindAllStringSubmatch(t, -1) {
+			if ref, ok := strings.CutPrefix(m[1], prefix); ok && !slices.Contains(refs, ref) {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	slices.Sort(refs)
+	return refs
+}
+
+// resolveSecrets builds the secret values for templating: ${SECRET} from the invocation secrets and every named
+// reference of the request from the resolver.
+func (r *HTTPToolRunner) resolveSecrets(ctx context.Context) (map[string]string, error) {
+	secrets := map[string]string{}
+	if s, ok := r.secrets["SECRET"]; ok {
+		secrets["SECRET"] = s
+	}
+	var refs []string
+	for _, st := range r.steps {
+		for _, ref := range templateRefs(&st.Request, secretRefPrefix) {
+			if !slices.Contains(refs, ref) {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	if len(refs) > 0 && r.secretResolver == nil {
+		return nil, errors.New("tool references secrets but no secret store is configured")
+	}
+	for _, ref := range refs {
+		v, err := r.secretResolver.ResolveSecret(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("resolve secret %q: %w", ref, err)
+		}
+		secrets[secretRefPrefix+ref] = v
+	}
+	return secrets, nil
+}
+
+// redactor replaces secret values in text that leaves the runner, i.e. metadata and error messages.
+type redactor struct {
+	r *strings.Replacer
+}
+
+func newRedactor(secrets map[string]string) redactor {
+	var values []string
+	for _, v := range secrets {
+		if v == "" {
+			continue
+		}
+		// Secrets also appear escaped in URLs.
+		for _, form := range []string{v, url.QueryEscape(v), url.PathEscape(v)} {
+			if !slices.Contains(values, form) {
+				values = append(values, form)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return redactor{}
+	}
+	// Longest first, so a secret containing another is replaced whole.
+	slices.SortFunc(values, func(a, b string) int { return len(b) - len(a) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, redactedSecret)
+	}
+	return redactor{r: strings.NewReplacer(pairs...)}
+}
+
+func (d redactor) string(s string) string {
+	if d.r == nil {
+		return s
+	}
+	return d.r.Replace(s)
+}
+
+// error redacts the message of err and keeps it in the chain for errors.Is/As.
+func (d redactor) error(err error) error {
+	if d.r == nil || err == nil {
+		return err
+	}
+	msg := d.r.Replace(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
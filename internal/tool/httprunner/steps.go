@@ -0,0 +1,165 @@
+package httprunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+	"github.com/flexigpt/flexigpt-app/internal/tool/toolutil"
+)
+
+// stepRefPrefix starts a placeholder for a value extracted from an earlier step: ${step:<name>.<var>}.
+const stepRefPrefix = "step:"
+
+// Step and extracted variable names.
+var stepNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// StepVarError reports a ${step:<name>.<var>} placeholder whose value is not available when a later step runs,
+// because the step did not succeed or did not extract the variable. It matches spec.ErrHTTPStepVarMissing.
+type StepVarError struct {
+	Step   string
+	Var    string
+	Failed bool
+}
+
+func (e *StepVarError) Error() string {
+	if e.Failed {
+		return fmt.Sprintf("%s: %s.%s: step %s did not succeed", spec.ErrHTTPStepVarMissing, e.Step, e.Var, e.Step)
+	}
+	return fmt.Sprintf("%s: %s.%s: not extracted", spec.ErrHTTPStepVarMissing, e.Step, e.Var)
+}
+
+func (e *StepVarError) Is(target error) bool {
+	return target == spec.ErrHTTPStepVarMissing
+}
+
+// decodeJSONBody decodes a response body, keeping numbers as written.
+func decodeJSONBody(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var body any
+	if err := dec.Decode(&body); err != nil {
+		return nil, fmt.Errorf("response body is not JSON: %w", err)
+	}
+	return body, nil
+}
+
+// extractStepVars stores the values that the extract paths of a step select from its JSON response under
+// "<step>.<var>".
+func extractStepVars(step string, extract map[string]string, data []byte, into map[string]string) error {
+	body, err := decodeJSONBody(data)
+	if err != nil {
+		return fmt.Errorf("extract: %w", err)
+	}
+	for name, p := range extract {
+		segs, err := parsePath(p)
+		if err != nil {
+			return fmt.Errorf("extract %s: %w", name, err)
+		}
+		v, ok := selectPath(body, segs)
+		if !ok {
+			return fmt.Errorf("extract %s: %q matched nothing in the response", name, p)
+		}
+		into[step+"."+name] = toolutil.TemplateValue(v)
+	}
+	return nil
+}
+
+// pollDone reports whether the value at the until path of a poll is one of its values.
+func pollDone(p *spec.HTTPPoll, data []byte) (bool, error) {
+	body, err := decodeJSONBody(data)
+	if err != nil {
+		return false, fmt.Errorf("poll: %w", err)
+	}
+	segs, err := parsePath(p.Until)
+	if err != nil {
+		return false, fmt.Errorf("poll: %w", err)
+	}
+	v, ok := selectPath(body, segs)
+	if !ok {
+		return false, nil
+	}
+	return slices.Contains(p.Values, toolutil.TemplateValue(v)), nil
+}
+
+// validateSteps checks a multi-step tool: unique step names, valid requests and responses, and that every
+// ${step:<name>.<var>} refers to a variable extracted by an earlier step.
+func validateSteps(impl *spec.HTTPToolImpl) error {
+	if strings.TrimSpace(impl.Request.URLTemplate) != "" || !isZeroResponse(&impl.Response) {
+		return errors.New("httpImpl.request and httpImpl.response must be empty when steps are set")
+	}
+	extracted := make(map[string]map[string]bool, len(impl.Steps))
+	for i, st := range impl.Steps {
+		if !stepNameRe.MatchString(st.Name) {
+			return fmt.Errorf("steps[%d]: name %q may only contain letters, digits, '_' and '-'", i, st.Name)
+		}
+		if _, dup := extracted[st.Name]; dup {
+			return fmt.Errorf("steps[%d]: duplicate step name %q", i, st.Name)
+		}
+		if err := validateRequest(&st.Request); err != nil {
+			return fmt.Errorf("steps[%d] %s: %w", i, st.Name, err)
+		}
+		if err := validateResponse(&st.Response); err != nil {
+			return fmt.Errorf("steps[%d] %s: %w", i, st.Name, err)
+		}
+		for _, ref := range templateRefs(&st.Request, stepRefPrefix) {
+			name, v, _ := strings.Cut(ref, ".")
+			vars, ok := extracted[name]
+			if !ok {
+				return fmt.Errorf("steps[%d] %s: references step %q, which does not run before it", i, st.Name, name)
+			}
+			if !vars[v] {
+				return fmt.Errorf("steps[%d] %s: references %q, which step %q does not extract", i, st.Name, v, name)
+			}
+		}
+
+		vars := make(map[string]bool, len(st.Extract))
+		for v, p := range st.Extract {
+			if !stepNameRe.MatchString(v) {
+				return fmt.Errorf("steps[%d] %s: extract name %q may only contain letters, digits, '_' and '-'",
+					i, st.Name, v)
+			}
+			if _, err := parsePath(p); err != nil {
+				return fmt.Errorf("steps[%d] %s: extract %s: %w", i, st.Name, v, err)
+			}
+			vars[v] = true
+		}
+		if st.Poll != nil {
+			if err := validatePoll(st.Poll); err != nil {
+				return fmt.Errorf("steps[%d] %s: %w", i, st.Name, err)
+			}
+		}
+		extracted[st.Name] = vars
+	}
+	if impl.OutputStep != "" {
+		if _, ok := extracted[impl.OutputStep]; !ok {
+			return fmt.Errorf("outputStep %q is not a step", impl.OutputStep)
+		}
+	}
+	return nil
+}
+
+func validatePoll(p *spec.HTTPPoll) error {
+	if strings.TrimSpace(p.Until) == "" {
+		return errors.New("poll.until is empty")
+	}
+	if _, err := parsePath(p.Until); err != nil {
+		return fmt.Errorf("poll.until: %w", err)
+	}
+	if len(p.Values) == 0 {
+		return errors.New("poll.values is empty")
+	}
+	if p.IntervalMs < 0 || p.MaxAttempts < 0 {
+		return errors.New("poll.intervalMs and poll.maxAttempts must not be negative")
+	}
+	return nil
+}
+
+func isZeroResponse(r *spec.HTTPResponse) bool {
+	return len(r.SuccessCodes) == 0 && r.ErrorMode == "" && r.BodyOutputMode == "" && r.Transform == nil
+}
@@ -0,0 +1,269 @@
+package httprunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+// pathSeg is one step of a selection path: an object key, an array index (negative counts from the end) or a
+// wildcard over all elements.
+type pathSeg struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parsePath parses a dot-path (a.b[0].c) or a JSONPath ($.a.b[0]['c'], with [*] wildcards). "" and "$" select the
+// root.
+func parsePath(p string) ([]pathSeg, error) {
+	p = strings.TrimSpace(p)
+	if strings.HasPrefix(p, "$..") {
+		return nil, fmt.Errorf("recursive descent is not supported in path %q", p)
+	}
+	if strings.HasPrefix(p, "$") {
+		p = strings.TrimPrefix(p[1:], ".")
+	}
+	var segs []pathSeg
+	for i := 0; i < len(p); {
+		switch p[i] {
+		case '.':
+			i++
+			if i == len(p) || p[i] == '.' || p[i] == '[' {
+				return nil, fmt.Errorf("empty segment in path %q", p)
+			}
+		case '[':
+			end := strings.IndexByte(p[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in path %q", p)
+			}
+			inner := p[i+1 : i+end]
+			i += end + 1
+			switch {
+			case inner == "*":
+				segs = append(segs, pathSeg{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segs = append(segs, pathSeg{key: inner[1 : len(inner)-1]})
+			default:
+				idx, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index [%s] in path %q", inner, p)
+				}
+				segs = append(segs, pathSeg{index: idx, isIndex: true})
+			}
+		default:
+			j := i
+			for j < len(p) && p[j] != '.' && p[j] != '[' {
+				j++
+			}
+			if key := p[i:j]; key == "*" {
+				segs = append(segs, pathSeg{wildcard: true})
+			} else {
+				segs = append(segs, pathSeg{key: key})
+			}
+			i = j
+		}
+	}
+	return segs, nil
+}
+
+// selectPath walks segs from root. A wildcard applies the rest of the path to every element of an array (or every
+// value of an object, by key order) and collects the matches into an array.
+func selectPath(root any, segs []pathSeg) (any, bool) {
+	cur := root
+	for i, seg := range segs {
+		switch {
+		case seg.wildcard:
+			var elems []any
+			switch x := cur.(type) {
+			case map[string]any:
+				keys := make([]string, 0, len(x))
+				for k := range x {
+					keys = append(keys, k)
+				}
+				slices.Sort(keys)
+				for _, k := range keys {
+					elems = append(elems, x[k])
+				}
+			default:
+				arr, ok := toSlice(cur)
+				if !ok {
+					return nil, false
+				}
+				elems = arr
+			}
+			out := make([]any, 0, len(elems))
+			for _, e := range elems {
+				if v, ok := selectPath(e, segs[i+1:]); ok {
+					out = append(out, v)
+				}
+			}
+			return out, true
+		case seg.isIndex:
+			arr, ok := toSlice(cur)
+			if !ok {
+				return nil, false
+			}
+			idx := seg.index
+			if idx < 0 {
+				idx += len(arr)
+			}
+			if idx < 0 || idx >= len(arr) {
+				return nil, false
+			}
+			cur = arr[idx]
+		default:
+			m, ok := cur.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = m[seg.key]; !ok {
+				return nil, false
+			}
+		}
+	}
+	return cur, true
+}
+
+func hasJSONShaping(t *spec.HTTPOutputTransform) bool {
+	return t != nil && (t.Select != "" || len(t.Fields) > 0 || t.Template != "")
+}
+
+func validateTransform(t *spec.HTTPOutputTransform, mode spec.HTTPBodyOutputMode) error {
+	if t.MaxBytes < 0 {
+		return errors.New("maxBytes must not be negative")
+	}
+	if hasJSONShaping(t) && (mode == spec.HTTPBodyOutputModeFile || mode == spec.HTTPBodyOutputModeImage) {
+		return fmt.Errorf("select, fields and template produce text and cannot be used with bodyOutputMode %q", mode)
+	}
+	if _, err := parsePath(t.Select); err != nil {
+		return fmt.Errorf("select: %w", err)
+	}
+	for i, f := range t.Fields {
+		if strings.TrimSpace(f) == "" {
+			return fmt.Errorf("fields[%d] is empty", i)
+		}
+		if _, err := parsePath(f); err != nil {
+			return fmt.Errorf("fields[%d]: %w", i, err)
+		}
+	}
+	if t.Template != "" {
+		if _, err := parseOutputTemplate(t.Template); err != nil {
+			return fmt.Errorf("template: %w", err)
+		}
+	}
+	return nil
+}
+
+// transformJSON applies the selection, projection and template of t to a JSON body and returns the resulting text.
+// Without a template, strings are returned as is and other values as compact JSON.
+func transformJSON(t *spec.HTTPOutputTransform, data []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Keep numbers as written, e.g. large IDs.
+	dec.UseNumber()
+	var body any
+	if err := dec.Decode(&body); err != nil {
+		return "", fmt.Errorf("response body is not JSON: %w", err)
+	}
+
+	cur := body
+	if t.Select != "" {
+		segs, err := parsePath(t.Select)
+		if err != nil {
+			return "", err
+		}
+		v, ok := selectPath(body, segs)
+		if !ok {
+			return "", fmt.Errorf("select %q matched nothing in the response", t.Select)
+		}
+		cur = v
+	}
+	if len(t.Fields) > 0 {
+		fields := make([][]pathSeg, len(t.Fields))
+		for i, f := range t.Fields {
+			segs, err := parsePath(f)
+			if err != nil {
+				return "", err
+			}
+			fields[i] = segs
+		}
+		cur = projectFields(cur, t.Fields, fields)
+	}
+
+	if t.Template != "" {
+		tpl, err := parseOutputTemplate(t.Template)
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		if err := tpl.Execute(&sb, cur); err != nil {
+			return "", fmt.Errorf("template: %w", err)
+		}
+		return sb.String(), nil
+	}
+	if s, ok := cur.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// projectFields keeps the given paths of every object in v, descending into arrays. Missing paths are left out.
+func projectFields(v any, names []string, fields [][]pathSeg) any {
+	switch x := v.(type) {
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			out[i] = projectFields(e, names, fields)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(fields))
+		for i, segs := range fields {
+			if fv, ok := selectPath(x, segs); ok {
+				out[names[i]] = fv
+			}
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func parseOutputTemplate(text string) (*template.Template, error) {
+	return template.New("output").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+// capTextOutputs truncates text outputs longer than maxBytes at a rune boundary and appends a notice, so the model
+// knows it did not see everything.
+func capTextOutputs(outputs []spec.ToolStoreOutputUnion, maxBytes int, metaData map[string]any) {
+	for _, o := range outputs {
+		if o.TextItem == nil || len(o.TextItem.Text) <= maxBytes {
+			continue
+		}
+		text := o.TextItem.Text
+		cut := maxBytes
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		o.TextItem.Text = text[:cut] + fmt.Sprintf("\n\n[truncated: showing %d of %d bytes]", cut, len(text))
+		metaData["truncated"] = true
+	}
+}
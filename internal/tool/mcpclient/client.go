@@ -0,0 +1,403 @@
+// Package mcpclient is a Model Context Protocol client for the tools of MCP servers reached over stdio or streamable
+// HTTP. It implements the parts of the protocol the tool store needs: initialization, tools/list, tools/call and ping.
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// ProtocolVersion is the MCP revision requested on initialize. Servers may answer with an older one.
+	ProtocolVersion = "2025-06-18"
+
+	clientName    = "flexigpt"
+	clientVersion = "1.0.0"
+	jsonRPCVer    = "2.0"
+
+	// Tool listings are paginated; this bounds misbehaving servers.
+	maxListPages = 100
+)
+
+var (
+	ErrClosed = errors.New("mcp connection closed")
+
+	errMethodNotFound = &RPCError{Code: -32601, Message: "method not found"}
+)
+
+// RPCError is a JSON-RPC error returned by a server.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+type rpcMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *RPCError        `json:"error,omitempty"`
+}
+
+// transport carries JSON-RPC messages to a server. Messages from the server are passed to the handler given when the
+// transport was opened.
+type transport interface {
+	send(ctx context.Context, msg []byte) error
+	// done is closed when the connection is lost; err then tells why.
+	done() <-chan struct{}
+	err() error
+	close() error
+}
+
+// Tool is a tool listed by a server.
+type Tool struct {
+	Name        string          `json:"name"`
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+// ResourceContents is an embedded resource; exactly one of Text and Blob (base64) is set.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MIMEType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// Content is an item of a tool result. Type is one of text, image, audio, resource and resource_link.
+type Content struct {
+	Type string `json:"type"`
+
+	Text string `json:"text,omitempty"`
+
+	// Image and audio (base64).
+	Data     string `json:"data,omitempty"`
+	MIMEType string `json:"mimeType,omitempty"`
+
+	Resource *ResourceContents `json:"resource,omitempty"`
+
+	// Resource links.
+	URI  string `json:"uri,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// CallToolResult is the result of tools/call.
+type CallToolResult struct {
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
+
+// ServerInfo is what a server reported on initialize.
+type ServerInfo struct {
+	Name            string
+	Version         string
+	ProtocolVersion string
+}
+
+// Client is a connection to one MCP server. Safe for concurrent use.
+type Client struct {
+	t      transport
+	logger *slog.Logger
+	info   ServerInfo
+
+	nextID       atomic.Int64
+	mu           sync.Mutex
+	pending      map[int64]chan *rpcMessage
+	toolsChanged func()
+}
+
+// connect initializes the protocol over a transport opened by open, which gets the handler of incoming messages.
+func connect(
+	ctx context.Context,
+	logger *slog.Logger,
+	open func(handle func([]byte)) (transport, error),
+) (*Client, error) {
+	c := &Client{logger: logger, pending: map[int64]chan *rpcMessage{}}
+	t, err := open(c.handle)
+	if err != nil {
+		return nil, err
+	}
+	c.t = t
+	go func() {
+		<-t.done()
+		c.failPending()
+	}()
+
+	if err := c.initialize(ctx); err != nil {
+		_ = t.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	var res struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": clientName, "version": clientVersion},
+	}, &res)
+	if err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+	c.info = ServerInfo{
+		Name:            res.ServerInfo.Name,
+		Version:         res.ServerInfo.Version,
+		ProtocolVersion: res.ProtocolVersion,
+	}
+	if ht, ok := c.t.(*httpTransport); ok {
+		ht.setProtocolVersion(res.ProtocolVersion)
+	}
+	return c.notify(ctx, "notifications/initialized", nil)
+}
+
+// Info returns what the server reported on initialize.
+func (c *Client) Info() ServerInfo {
+	return c.info
+}
+
+// Done is closed when the connection is lost.
+func (c *Client) Done() <-chan struct{} {
+	return c.t.done()
+}
+
+// Err tells why the connection was lost.
+func (c *Client) Err() error {
+	return c.t.err()
+}
+
+// Close ends the connection, stopping the server process of stdio servers.
+func (c *Client) Close() error {
+	return c.t.close()
+}
+
+// onToolsChanged sets the function called when the server reports that its tool list changed.
+func (c *Client) onToolsChanged(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.toolsChanged = fn
+}
+
+// ListTools returns all tools of the server, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for range maxListPages {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var res struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor,omitempty"`
+		}
+		if err := c.call(ctx, "tools/list", params, &res); err != nil {
+			return nil, fmt.Errorf("tools/list: %w", err)
+		}
+		tools = append(tools, res.Tools...)
+		if res.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = res.NextCursor
+	}
+	return nil, fmt.Errorf("tools/list exceeded %d pages", maxListPages)
+}
+
+// CallTool calls a tool. A tool that failed is reported through CallToolResult.IsError, not as an error.
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage) (*CallToolResult, error) {
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	var res CallToolResult
+	if err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &res); err != nil {
+		return nil, fmt.Errorf("tools/call %s: %w", name, err)
+	}
+	return &res, nil
+}
+
+// Ping checks that the server responds.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.call(ctx, "ping", nil, nil)
+}
+
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	id := c.nextID.Add(1)
+	rawID := json.RawMessage(fmt.Sprint(id))
+	msg := rpcMessage{JSONRPC: jsonRPCVer, ID: &rawID, Method: method}
+	if params != nil {
+		p, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = p
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan *rpcMessage, 1)
+	c.mu.Lock()
+	if c.pending == nil {
+		c.mu.Unlock()
+		return c.closedErr()
+	}
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		if c.pending != nil {
+			delete(c.pending, id)
+		}
+		c.mu.Unlock()
+	}()
+
+	if err := c.t.send(ctx, b); err != nil {
+		return err
+	}
+	var resp *rpcMessage
+	select {
+	case <-ctx.Done():
+		c.cancelRequest(id, ctx.Err())
+		return ctx.Err()
+	case resp = <-ch:
+	case <-c.t.done():
+		// A response read just before the connection was lost is still delivered.
+		select {
+		case resp = <-ch:
+		default:
+		}
+	}
+	if resp == nil {
+		return c.closedErr()
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("invalid %s result: %w", method, err)
+	}
+	return nil
+}
+
+func (c *Client) notify(ctx context.Context, method string, params any) error {
+	msg := rpcMessage{JSONRPC: jsonRPCVer, Method: method}
+	if params != nil {
+		p, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = p
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.t.send(ctx, b)
+}
+
+// cancelRequest tells the server that a request is no longer awaited. It is best effort.
+func (c *Client) cancelRequest(id int64, reason error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	_ = c.notify(ctx, "notifications/cancelled", map[string]any{"requestId": id, "reason": reason.Error()})
+}
+
+// handle dispatches a message (or a batch of messages) from the server.
+func (c *Client) handle(raw []byte) {
+	var batch []rpcMessage
+	if err := json.Unmarshal(raw, &batch); err != nil {
+		var msg rpcMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			c.logger.Debug("mcp: dropping invalid message", "error", err)
+			return
+		}
+		batch = []rpcMessage{msg}
+	}
+	for i := range batch {
+		msg := &batch[i]
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			go c.answer(msg)
+		case msg.Method == "notifications/tools/list_changed":
+			c.mu.Lock()
+			fn := c.toolsChanged
+			c.mu.Unlock()
+			if fn != nil {
+				go fn()
+			}
+		case msg.Method != "":
+			// Other notifications such as logging are not acted upon.
+			c.logger.Debug("mcp: notification", "method", msg.Method)
+		case msg.ID != nil:
+			var id int64
+			if err := json.Unmarshal(*msg.ID, &id); err != nil {
+				continue
+			}
+			c.mu.Lock()
+			ch := c.pending[id]
+			c.mu.Unlock()
+			if ch != nil {
+				select {
+				case ch <- msg:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// answer responds to a request from the server. Only ping is supported, as the client declares no capabilities.
+func (c *Client) answer(req *rpcMessage) {
+	resp := rpcMessage{JSONRPC: jsonRPCVer, ID: req.ID}
+	if req.Method == "ping" {
+		resp.Result = json.RawMessage("{}")
+	} else {
+		resp.Error = errMethodNotFound
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if err := c.t.send(ctx, b); err != nil {
+		c.logger.Debug("mcp: answer server request", "method", req.Method, "error", err)
+	}
+}
+
+// failPending refuses new requests once the connection is lost. Requests in flight notice through done.
+func (c *Client) failPending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = nil
+}
+
+func (c *Client) closedErr() error {
+	if err := c.t.err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrClosed, err)
+	}
+	return ErrClosed
+}
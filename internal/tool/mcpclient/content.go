@@ -0,0 +1,92 @@
+package mcpclient
+
+import (
+	"path"
+	"strings"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+	"github.com/flexigpt/flexigpt-app/internal/tool/toolutil"
+)
+
+// Outputs maps the content of a tool result into tool store outputs. Text resources become text, binary resources
+// become images or files depending on their MIME type, and resource links are described as text. Structured content
+// is used as text when the server sent no content.
+func Outputs(res *CallToolResult) []spec.ToolStoreOutputUnion {
+	if res == nil {
+		return nil
+	}
+	out := make([]spec.ToolStoreOutputUnion, 0, len(res.Content))
+	for _, c := range res.Content {
+		switch c.Type {
+		case "text":
+			out = append(out, toolutil.TextOutput(c.Text))
+		case "image":
+			out = append(out, imageOutput("image", c.MIMEType, c.Data))
+		case "audio":
+			out = append(out, fileOutput("audio", c.MIMEType, c.Data))
+		case "resource":
+			if c.Resource == nil {
+				continue
+			}
+			r := c.Resource
+			name := path.Base(r.URI)
+			switch {
+			case r.Blob != "" && strings.HasPrefix(r.MIMEType, "image/"):
+				out = append(out, imageOutput(name, r.MIMEType, r.Blob))
+			case r.Blob != "":
+				out = append(out, fileOutput(name, r.MIMEType, r.Blob))
+			default:
+				out = append(out, toolutil.TextOutput(r.Text))
+			}
+		case "resource_link":
+			desc := c.URI
+			if c.Name != "" {
+				desc = c.Name + ": " + c.URI
+			}
+			out = append(out, toolutil.TextOutput("Resource link: "+desc))
+		default:
+			// Unknown content types of newer protocol revisions are dropped.
+		}
+	}
+	if len(out) == 0 && len(res.StructuredContent) > 0 {
+		out = append(out, toolutil.TextOutput(string(res.StructuredContent)))
+	}
+	return out
+}
+
+// ErrorText returns the text content of a failed tool result.
+func ErrorText(res *CallToolResult) string {
+	var parts []string
+	for _, c := range res.Content {
+		if c.Type == "text" && c.Text != "" {
+			parts = append(parts, c.Text)
+		}
+	}
+	if len(parts) == 0 {
+		return "mcp tool reported an error"
+	}
+	return strings.Join(parts, "\n")
+}
+
+func imageOutput(name, mimeType, data string) spec.ToolStoreOutputUnion {
+	return spec.ToolStoreOutputUnion{
+		Kind: spec.ToolStoreOutputKindImage,
+		ImageItem: &spec.ToolStoreOutputImage{
+			Detail:    spec.ImageDetailAuto,
+			ImageName: name,
+			ImageMIME: mimeType,
+			ImageData: data,
+		},
+	}
+}
+
+func fileOutput(name, mimeType, data string) spec.ToolStoreOutputUnion {
+	return spec.ToolStoreOutputUnion{
+		Kind: spec.ToolStoreOutputKindFile,
+		FileItem: &spec.ToolStoreOutputFile{
+			FileName: name,
+			FileMIME: mimeType,
+			FileData: data,
+		},
+	}
+}
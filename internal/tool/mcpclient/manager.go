@@ -0,0 +1,498 @@
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+const (
+	defaultHealthInterval = 30 * time.Second
+	startTimeout          = 30 * time.Second
+	pingTimeout           = 10 * time.Second
+	listTimeout           = 10 * time.Second
+
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+)
+
+// Manager owns the connections to configured MCP servers, keyed by an ID chosen by the caller. Servers are started
+// on first use and started again on the next use after they exit or fail a health check, with an exponential backoff
+// after failed starts. A changed configuration restarts the server. The tools of a running server are listed again
+// when it reports that they changed. Safe for concurrent use.
+type Manager struct {
+	logger         *slog.Logger
+	httpClient     *http.Client
+	healthInterval time.Duration
+
+	mu      sync.Mutex
+	servers map[string]*server
+
+	// ctx ends on Close; it bounds background starts and tool refreshes.
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+type server struct {
+	// startMu serializes starts and tool refreshes; the other fields are guarded by Manager.mu.
+	startMu sync.Mutex
+
+	cfgKey    string
+	client    *Client
+	tools     []Tool
+	startedAt time.Time
+	starts    int
+	failures  int
+	lastErr   string
+	nextRetry time.Time
+	// starting is closed when the running background start ends.
+	starting chan struct{}
+}
+
+// ManagerOption configures a Manager.
+type ManagerOption func(*Manager)
+
+// WithLogger sets the logger, default slog.Default().
+func WithLogger(l *slog.Logger) ManagerOption {
+	return func(m *Manager) {
+		m.logger = l
+	}
+}
+
+// WithHTTPClient sets the client of streamable HTTP servers, default http.DefaultClient.
+func WithHTTPClient(c *http.Client) ManagerOption {
+	return func(m *Manager) {
+		m.httpClient = c
+	}
+}
+
+// WithHealthInterval sets how often running servers are pinged, default 30s.
+func WithHealthInterval(d time.Duration) ManagerOption {
+	return func(m *Manager) {
+		if d > 0 {
+			m.healthInterval = d
+		}
+	}
+}
+
+// NewManager creates a manager and starts its health checks. Close stops them together with all servers.
+func NewManager(opts ...ManagerOption) *Manager {
+	m := &Manager{
+		logger:         slog.Default(),
+		healthInterval: defaultHealthInterval,
+		servers:        map[string]*server{},
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	m.ctx, m.stop = context.WithCancel(context.Background())
+	m.wg.Go(func() { m.healthLoop(m.ctx) })
+	return m
+}
+
+// Tools returns the tools the server listed when it was started.
+func (m *Manager) Tools(ctx context.Context, id string, cfg *spec.MCPServerConfig) ([]Tool, error) {
+	_, tools, err := m.client(ctx, id, cfg)
+	return tools, err
+}
+
+// StartedTools returns the tools of the given servers, keyed like servers, without waiting for slow starts. Servers
+// that are not running are started in the background, and their tools are included if they start within wait. Servers
+// that are still starting or failed to start are left out.
+func (m *Manager) StartedTools(
+	ctx context.Context,
+	servers map[string]*spec.MCPServerConfig,
+	wait time.Duration,
+) map[string][]Tool {
+	var pending []<-chan struct{}
+	for id, cfg := range servers {
+		if _, ok := m.runningTools(id, cfg); !ok {
+			pending = append(pending, m.startAsync(id, cfg))
+		}
+	}
+	if len(pending) > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+	waitLoop:
+		for _, done := range pending {
+			select {
+			case <-done:
+			case <-timer.C:
+				break waitLoop
+			case <-ctx.Done():
+				break waitLoop
+			}
+		}
+	}
+
+	out := make(map[string][]Tool, len(servers))
+	for id, cfg := range servers {
+		if tools, ok := m.runningTools(id, cfg); ok {
+			out[id] = tools
+		}
+	}
+	return out
+}
+
+// CallTool calls a tool of the server. Calls are not retried when the server is lost meanwhile, as tools may have
+// side effects.
+func (m *Manager) CallTool(
+	ctx context.Context,
+	id string,
+	cfg *spec.MCPServerConfig,
+	name string,
+	args json.RawMessage,
+) (*CallToolResult, error) {
+	c, _, err := m.client(ctx, id, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return c.CallTool(ctx, name, args)
+}
+
+// Restart stops the server and starts it again right away, also when it waits for a retry after failures.
+func (m *Manager) Restart(ctx context.Context, id string, cfg *spec.MCPServerConfig) error {
+	m.Stop(id)
+	m.mu.Lock()
+	if s := m.servers[id]; s != nil {
+		s.nextRetry = time.Time{}
+		s.failures = 0
+	}
+	m.mu.Unlock()
+	_, _, err := m.client(ctx, id, cfg)
+	return err
+}
+
+// Stop stops the server if it is running. It is started again on its next use.
+func (m *Manager) Stop(id string) {
+	m.mu.Lock()
+	s := m.servers[id]
+	var c *Client
+	if s != nil {
+		c, s.client = s.client, nil
+	}
+	m.mu.Unlock()
+	if c != nil {
+		_ = c.Close()
+		m.logger.Info("mcp server stopped", "id", id)
+	}
+}
+
+// Forget stops the server and drops its state, e.g. when its configuration was deleted.
+func (m *Manager) Forget(id string) {
+	m.Stop(id)
+	m.mu.Lock()
+	delete(m.servers, id)
+	m.mu.Unlock()
+}
+
+// Status returns the runtime state of a server. Unknown servers are reported as stopped.
+func (m *Manager) Status(id string) spec.MCPServerStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := spec.MCPServerStatus{State: spec.MCPServerStateStopped}
+	s := m.servers[id]
+	if s == nil {
+		return st
+	}
+	st.LastError = s.lastErr
+	if s.starts > 1 {
+		st.Restarts = s.starts - 1
+	}
+	if s.client != nil && !isDone(s.client) {
+		info := s.client.Info()
+		startedAt := s.startedAt
+		st.State = spec.MCPServerStateRunning
+		st.ServerName = info.Name
+		st.ServerVersion = info.Version
+		st.ProtocolVersion = info.ProtocolVersion
+		st.ToolCount = len(s.tools)
+		st.StartedAt = &startedAt
+		return st
+	}
+	if s.failures > 0 {
+		st.State = spec.MCPServerStateFailed
+		if !s.nextRetry.IsZero() {
+			next := s.nextRetry
+			st.NextRetryAt = &next
+		}
+	}
+	return st
+}
+
+// Close stops the health checks and all servers.
+func (m *Manager) Close() {
+	m.stop()
+	m.wg.Wait()
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.servers))
+	for id := range m.servers {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+	for _, id := range ids {
+		m.Stop(id)
+	}
+}
+
+// runningTools returns the tools of the server if it runs with the configuration cfg.
+func (m *Manager) runningTools(id string, cfg *spec.MCPServerConfig) ([]Tool, bool) {
+	key, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.servers[id]
+	if s == nil || s.client == nil || isDone(s.client) || s.cfgKey != string(key) {
+		return nil, false
+	}
+	return s.tools, true
+}
+
+// startAsync starts the server in the background unless a background start of it is running already. The returned
+// channel is closed when the start ends.
+func (m *Manager) startAsync(id string, cfg *spec.MCPServerConfig) <-chan struct{} {
+	m.mu.Lock()
+	s := m.servers[id]
+	if s == nil {
+		s = &server{}
+		m.servers[id] = s
+	}
+	if s.starting != nil {
+		done := s.starting
+		m.mu.Unlock()
+		return done
+	}
+	done := make(chan struct{})
+	if m.ctx.Err() != nil {
+		// Closed.
+		m.mu.Unlock()
+		close(done)
+		return done
+	}
+	s.starting = done
+	m.mu.Unlock()
+
+	m.wg.Go(func() {
+		defer func() {
+			m.mu.Lock()
+			s.starting = nil
+			m.mu.Unlock()
+			close(done)
+		}()
+		if _, _, err := m.client(m.ctx, id, cfg); err != nil {
+			m.logger.Debug("mcp server background start failed", "id", id, "error", err)
+		}
+	})
+	return done
+}
+
+// client returns a running client of the server and its tools, starting it when needed.
+func (m *Manager) client(ctx context.Context, id string, cfg *spec.MCPServerConfig) (*Client, []Tool, error) {
+	if cfg == nil {
+		return nil, nil, errors.New("mcp server config is nil")
+	}
+	key, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.Lock()
+	s := m.servers[id]
+	if s == nil {
+		s = &server{}
+		m.servers[id] = s
+	}
+	m.mu.Unlock()
+
+	s.startMu.Lock()
+	defer s.startMu.Unlock()
+
+	m.mu.Lock()
+	old := s.client
+	switch {
+	case old != nil && s.cfgKey != string(key):
+		// Reconfigured: stop the old server and start fresh.
+		s.client = nil
+		s.failures, s.nextRetry = 0, time.Time{}
+	case old != nil && isDone(old):
+		s.client = nil
+		if err := old.Err(); err != nil {
+			s.lastErr = err.Error()
+		}
+		old = nil
+	case old != nil:
+		tools := s.tools
+		m.mu.Unlock()
+		return old, tools, nil
+	default:
+		if s.cfgKey != string(key) {
+			s.failures, s.nextRetry = 0, time.Time{}
+		}
+	}
+	s.cfgKey = string(key)
+	if wait := time.Until(s.nextRetry); wait > 0 {
+		lastErr := s.lastErr
+		m.mu.Unlock()
+		return nil, nil, fmt.Errorf("mcp server %s failed, retrying in %s: %s", id, wait.Round(time.Second), lastErr)
+	}
+	m.mu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+
+	c, tools, err := m.start(ctx, id, cfg)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.servers[id] != s {
+		// Forgotten while starting.
+		if c != nil {
+			go c.Close()
+		}
+		return nil, nil, fmt.Errorf("mcp server %s was removed", id)
+	}
+	s.starts++
+	if err != nil {
+		s.failures++
+		s.lastErr = err.Error()
+		s.nextRetry = time.Now().Add(restartBackoff(s.failures))
+		m.logger.Warn("mcp server start failed", "id", id, "failures", s.failures, "error", err)
+		return nil, nil, err
+	}
+	s.client = c
+	s.tools = tools
+	s.startedAt = time.Now().UTC()
+	s.failures = 0
+	s.nextRetry = time.Time{}
+	info := c.Info()
+	m.logger.Info("mcp server started", "id", id, "server", info.Name, "version", info.Version, "tools", len(tools))
+	return c, tools, nil
+}
+
+func (m *Manager) start(ctx context.Context, id string, cfg *spec.MCPServerConfig) (*Client, []Tool, error) {
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+
+	var open func(handle func([]byte)) (transport, error)
+	switch cfg.Transport {
+	case spec.MCPTransportStdio:
+		open = func(handle func([]byte)) (transport, error) { return openStdio(cfg, m.logger, handle) }
+	case spec.MCPTransportStreamableHTTP:
+		open = func(handle func([]byte)) (transport, error) { return openHTTP(cfg, m.httpClient, handle) }
+	default:
+		return nil, nil, fmt.Errorf("unsupported mcp transport %q", cfg.Transport)
+	}
+	c, err := connect(ctx, m.logger, open)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.onToolsChanged(func() { m.refreshTools(id, c) })
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		_ = c.Close()
+		return nil, nil, err
+	}
+	return c, tools, nil
+}
+
+// refreshTools lists the tools of the server again after it reported a change. It waits for a running start of the
+// server, so that a change reported while starting is not lost, and does nothing once c is no longer its client.
+func (m *Manager) refreshTools(id string, c *Client) {
+	m.mu.Lock()
+	s := m.servers[id]
+	m.mu.Unlock()
+	if s == nil {
+		return
+	}
+	s.startMu.Lock()
+	defer s.startMu.Unlock()
+
+	m.mu.Lock()
+	current := s.client == c
+	m.mu.Unlock()
+	if !current {
+		return
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, listTimeout)
+	defer cancel()
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		m.logger.Warn("mcp server tool refresh failed", "id", id, "error", err)
+		return
+	}
+	m.mu.Lock()
+	if s.client == c {
+		s.tools = tools
+	}
+	m.mu.Unlock()
+	m.logger.Info("mcp server tools changed", "id", id, "tools", len(tools))
+}
+
+// healthLoop pings running servers. A server that does not answer is stopped, so that its next use starts it again.
+func (m *Manager) healthLoop(ctx context.Context) {
+	tick := time.NewTicker(m.healthInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		m.mu.Lock()
+		running := map[string]*Client{}
+		for id, s := range m.servers {
+			if s.client != nil && !isDone(s.client) {
+				running[id] = s.client
+			}
+		}
+		m.mu.Unlock()
+
+		for id, c := range running {
+			pctx, cancel := context.WithTimeout(ctx, pingTimeout)
+			err := c.Ping(pctx)
+			cancel()
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+			m.mu.Lock()
+			s := m.servers[id]
+			stale := s != nil && s.client == c
+			if stale {
+				s.client = nil
+				s.lastErr = "health check failed: " + err.Error()
+			}
+			m.mu.Unlock()
+			if stale {
+				m.logger.Warn("mcp server failed health check, stopping", "id", id, "error", err)
+				_ = c.Close()
+			}
+		}
+	}
+}
+
+func restartBackoff(failures int) time.Duration {
+	d := minRestartBackoff
+	for i := 1; i < failures && d < maxRestartBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRestartBackoff)
+}
+
+func isDone(c *Client) bool {
+	select {
+	case <-c.Done():
+		return true
+	default:
+		return false
+	}
+}
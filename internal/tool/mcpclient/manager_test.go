@@ -0,0 +1,201 @@
+package mcpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+func stdioStubConfig(t *testing.T) *spec.MCPServerConfig {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &spec.MCPServerConfig{
+		Transport: spec.MCPTransportStdio,
+		Command:   exe,
+		Args:      []string{"-test.run=^$"},
+		Env:       map[string]string{stubServerEnv: "1"},
+	}
+}
+
+func checkEchoTools(t *testing.T, m *Manager, id string, cfg *spec.MCPServerConfig) {
+	t.Helper()
+	tools, err := m.Tools(t.Context(), id, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools) != 3 || tools[0].Name != "echo_text" || tools[2].Name != "exit" {
+		t.Fatalf("tools = %+v", tools)
+	}
+
+	res, err := m.CallTool(t.Context(), id, cfg, "echo_text", json.RawMessage(`{"text":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := Outputs(res)
+	if len(out) != 3 ||
+		out[0].Kind != spec.ToolStoreOutputKindText || out[0].TextItem.Text != "hi" ||
+		out[1].Kind != spec.ToolStoreOutputKindImage || out[1].ImageItem.ImageMIME != "image/png" ||
+		out[2].Kind != spec.ToolStoreOutputKindText || out[2].TextItem.Text != "notes" {
+		t.Errorf("outputs = %+v", out)
+	}
+
+	res, err = m.CallTool(t.Context(), id, cfg, "fail", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError || ErrorText(res) != "boom" {
+		t.Errorf("fail result = %+v", res)
+	}
+
+	var rpcErr *RPCError
+	if _, err := m.CallTool(t.Context(), id, cfg, "missing", nil); !errors.As(err, &rpcErr) {
+		t.Errorf("expected rpc error, got %v", err)
+	}
+}
+
+func TestManagerStdio(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	cfg := stdioStubConfig(t)
+
+	checkEchoTools(t, m, "stub", cfg)
+	st := m.Status("stub")
+	if st.State != spec.MCPServerStateRunning || st.ServerName != "stub" || st.ToolCount != 3 || st.Restarts != 0 {
+		t.Fatalf("status = %+v", st)
+	}
+
+	// A crashed server is started again on its next use.
+	if _, err := m.CallTool(t.Context(), "stub", cfg, "exit", nil); err == nil {
+		t.Fatal("expected the call to fail with the server")
+	}
+	if st := m.Status("stub"); st.State == spec.MCPServerStateRunning {
+		t.Fatalf("status after crash = %+v", st)
+	}
+	checkEchoTools(t, m, "stub", cfg)
+	if st := m.Status("stub"); st.Restarts != 1 || st.LastError == "" {
+		t.Errorf("status after restart = %+v", st)
+	}
+
+	m.Stop("stub")
+	if st := m.Status("stub"); st.State != spec.MCPServerStateStopped {
+		t.Errorf("status after stop = %+v", st)
+	}
+}
+
+func TestManagerStartFailureBackoff(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	cfg := &spec.MCPServerConfig{Transport: spec.MCPTransportStdio, Command: "/nonexistent/mcp-server"}
+
+	if _, err := m.Tools(t.Context(), "bad", cfg); err == nil {
+		t.Fatal("expected start failure")
+	}
+	st := m.Status("bad")
+	if st.State != spec.MCPServerStateFailed || st.NextRetryAt == nil {
+		t.Fatalf("status = %+v", st)
+	}
+	// Within the backoff the start is not attempted again.
+	if _, err := m.Tools(t.Context(), "bad", cfg); err == nil || m.Status("bad").Restarts != 0 {
+		t.Fatalf("expected backoff error without a new start, got %v", err)
+	}
+	// A changed configuration is started right away.
+	checkEchoTools(t, m, "bad", stdioStubConfig(t))
+}
+
+func TestManagerStreamableHTTP(t *testing.T) {
+	for _, sse := range []bool{false, true} {
+		stub := &httpStub{sse: sse}
+		srv := httptest.NewServer(stub)
+		m := NewManager(WithHTTPClient(srv.Client()), WithHealthInterval(20*time.Millisecond))
+		cfg := &spec.MCPServerConfig{Transport: spec.MCPTransportStreamableHTTP, URL: srv.URL}
+
+		checkEchoTools(t, m, "http", cfg)
+
+		// An expired session fails the health check and the server is connected again on its next use.
+		stub.endSessions()
+		deadline := time.Now().Add(5 * time.Second)
+		for m.Status("http").State == spec.MCPServerStateRunning && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if st := m.Status("http"); st.State == spec.MCPServerStateRunning {
+			t.Fatalf("sse=%v: expected the lost session to be noticed, status = %+v", sse, st)
+		}
+		checkEchoTools(t, m, "http", cfg)
+
+		m.Close()
+		srv.Close()
+	}
+}
+
+func TestManagerToolsChanged(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	cfg := stdioStubConfig(t)
+
+	checkEchoTools(t, m, "stub", cfg)
+	if _, err := m.CallTool(t.Context(), "stub", cfg, "grow", nil); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Status("stub").ToolCount != 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	tools, err := m.Tools(t.Context(), "stub", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools) != 4 || tools[3].Name != "grown" {
+		t.Fatalf("tools after list_changed = %+v", tools)
+	}
+	if st := m.Status("stub"); st.Restarts != 0 {
+		t.Errorf("expected the tools to be refreshed without a restart, status = %+v", st)
+	}
+}
+
+func TestManagerStartedTools(t *testing.T) {
+	release := make(chan struct{})
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	stub := &httpStub{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		stub.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	m := NewManager(WithHTTPClient(srv.Client()))
+	defer m.Close()
+	defer unblock()
+
+	servers := map[string]*spec.MCPServerConfig{
+		"stub": stdioStubConfig(t),
+		"slow": {Transport: spec.MCPTransportStreamableHTTP, URL: srv.URL},
+	}
+	start := time.Now()
+	got := m.StartedTools(t.Context(), servers, time.Second)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("StartedTools waited %s for a slow server", elapsed)
+	}
+	if len(got) != 1 || len(got["stub"]) != 3 {
+		t.Fatalf("tools while a server is starting = %+v", got)
+	}
+
+	// The slow server keeps starting in the background and is listed once it runs.
+	unblock()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(got) != 2 && time.Now().Before(deadline) {
+		got = m.StartedTools(t.Context(), servers, 100*time.Millisecond)
+	}
+	if len(got["slow"]) != 3 {
+		t.Fatalf("tools after the slow server started = %+v", got)
+	}
+}
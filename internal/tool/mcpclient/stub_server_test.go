@@ -0,0 +1,176 @@
+package mcpclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// The test binary doubles as a stdio stub server when this variable is set.
+const stubServerEnv = "MCPCLIENT_STUB_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(stubServerEnv) != "" {
+		serveStdioStub(os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// stubGrown is set once the grow tool was called.
+var stubGrown atomic.Bool
+
+// stubReply answers one JSON-RPC message of the stub server; it returns nil for notifications. Tools:
+//   - echo: returns its "text" argument, an image and a text resource.
+//   - fail: reports a tool error.
+//   - exit: ends the stub server process.
+//   - grow: adds a "grown" tool and sends tools/list_changed in a batch with its reply.
+func stubReply(raw []byte) []byte {
+	var msg rpcMessage
+	if err := json.Unmarshal(raw, &msg); err != nil || msg.ID == nil {
+		return nil
+	}
+	var result any
+	switch msg.Method {
+	case "initialize":
+		result = map[string]any{
+			"protocolVersion": ProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "stub", "version": "0.1.0"},
+		}
+	case "ping":
+		result = map[string]any{}
+	case "tools/list":
+		var p struct {
+			Cursor string `json:"cursor"`
+		}
+		_ = json.Unmarshal(msg.Params, &p)
+		if p.Cursor == "" {
+			result = map[string]any{
+				"tools": []map[string]any{{
+					"name":        "echo_text",
+					"description": "Echo a text.",
+					"inputSchema": map[string]any{
+						"type":       "object",
+						"properties": map[string]any{"text": map[string]any{"type": "string"}},
+					},
+				}},
+				"nextCursor": "2",
+			}
+		} else {
+			tools := []map[string]any{
+				{"name": "fail", "inputSchema": map[string]any{"type": "object"}},
+				{"name": "exit", "inputSchema": map[string]any{"type": "object"}},
+			}
+			if stubGrown.Load() {
+				tools = append(tools, map[string]any{"name": "grown", "inputSchema": map[string]any{"type": "object"}})
+			}
+			result = map[string]any{"tools": tools}
+		}
+	case "tools/call":
+		var p struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				Text string `json:"text"`
+			} `json:"arguments"`
+		}
+		_ = json.Unmarshal(msg.Params, &p)
+		switch p.Name {
+		case "echo_text":
+			result = map[string]any{"content": []map[string]any{
+				{"type": "text", "text": p.Arguments.Text},
+				{"type": "image", "data": "aW1n", "mimeType": "image/png"},
+				{"type": "resource", "resource": map[string]any{"uri": "file:///notes.txt", "text": "notes"}},
+			}}
+		case "fail":
+			result = map[string]any{"content": []map[string]any{{"type": "text", "text": "boom"}}, "isError": true}
+		case "exit":
+			os.Exit(3)
+		case "grow":
+			stubGrown.Store(true)
+			b, _ := json.Marshal([]any{
+				rpcMessage{JSONRPC: jsonRPCVer, Method: "notifications/tools/list_changed"},
+				rpcMessage{JSONRPC: jsonRPCVer, ID: msg.ID, Result: json.RawMessage(`{"content":[]}`)},
+			})
+			return b
+		default:
+			b, _ := json.Marshal(rpcMessage{JSONRPC: jsonRPCVer, ID: msg.ID, Error: &RPCError{
+				Code: -32602, Message: "unknown tool " + p.Name,
+			}})
+			return b
+		}
+	default:
+		b, _ := json.Marshal(rpcMessage{JSONRPC: jsonRPCVer, ID: msg.ID, Error: errMethodNotFound})
+		return b
+	}
+	res, _ := json.Marshal(result)
+	b, _ := json.Marshal(rpcMessage{JSONRPC: jsonRPCVer, ID: msg.ID, Result: res})
+	return b
+}
+
+func serveStdioStub(r io.Reader, w io.Writer) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if reply := stubReply(sc.Bytes()); reply != nil {
+			fmt.Fprintf(w, "%s\n", reply)
+		}
+	}
+}
+
+// httpStub is a streamable HTTP stub server. Replies are sent as SSE when sse is set.
+type httpStub struct {
+	sse bool
+
+	mu       sync.Mutex
+	sessions map[string]bool
+	next     int
+}
+
+func (h *httpStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sessions == nil {
+		h.sessions = map[string]bool{}
+	}
+	sid := r.Header.Get(headerSessionID)
+	if r.Method == http.MethodDelete {
+		delete(h.sessions, sid)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var msg rpcMessage
+	_ = json.Unmarshal(body, &msg)
+	if msg.Method == "initialize" {
+		h.next++
+		sid = fmt.Sprintf("s%d", h.next)
+		h.sessions[sid] = true
+		w.Header().Set(headerSessionID, sid)
+	} else if !h.sessions[sid] {
+		http.NotFound(w, r)
+		return
+	}
+	reply := stubReply(body)
+	if reply == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if h.sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", reply)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(reply)
+}
+
+func (h *httpStub) endSessions() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sessions = map[string]bool{}
+}
@@ -0,0 +1,198 @@
+package mcpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+const (
+	headerSessionID       = "Mcp-Session-Id"
+	headerProtocolVersion = "Mcp-Protocol-Version"
+
+	httpMaxBody    = 64 << 20
+	httpMaxErrBody = 512
+)
+
+// httpTransport implements the streamable HTTP transport. Every message is POSTed; responses arrive as a JSON body or
+// as an SSE stream on the same request. The optional GET stream for server initiated messages is not opened, as the
+// client declares no capabilities servers would use it for.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	handle  func([]byte)
+
+	mu              sync.Mutex
+	sessionID       string
+	protocolVersion string
+
+	doneCh    chan struct{}
+	closeOnce sync.Once
+	lostErr   error
+}
+
+func openHTTP(cfg *spec.MCPServerConfig, client *http.Client, handle func([]byte)) (transport, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpTransport{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  client,
+		handle:  handle,
+		doneCh:  make(chan struct{}),
+	}, nil
+}
+
+func (t *httpTransport) setProtocolVersion(v string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.protocolVersion = v
+}
+
+func (t *httpTransport) send(ctx context.Context, msg []byte) error {
+	select {
+	case <-t.doneCh:
+		return ErrClosed
+	default:
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if id := resp.Header.Get(headerSessionID); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	if resp.StatusCode == http.StatusNotFound && req.Header.Get(headerSessionID) != "" {
+		// The server ended the session; the connection has to be initialized again.
+		t.lose(errors.New("mcp session expired"))
+		return ErrClosed
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, httpMaxErrBody))
+		return fmt.Errorf("mcp server returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		return nil
+	}
+
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch ct {
+	case "text/event-stream":
+		return readSSE(resp.Body, t.handle)
+	case "application/json":
+		b, err := io.ReadAll(io.LimitReader(resp.Body, httpMaxBody))
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			t.handle(b)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unexpected mcp response content type %q", ct)
+	}
+}
+
+func (t *httpTransport) setHeaders(req *http.Request) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessionID != "" {
+		req.Header.Set(headerSessionID, t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set(headerProtocolVersion, t.protocolVersion)
+	}
+}
+
+// readSSE passes the data of every event of an SSE stream to handle until the stream ends.
+func readSSE(r io.Reader, handle func([]byte)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), httpMaxBody)
+	var data []byte
+	flush := func() {
+		if len(data) > 0 {
+			handle(data)
+			data = nil
+		}
+	}
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if v, ok := strings.CutPrefix(line, "data:"); ok {
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(v, " ")...)
+		}
+	}
+	flush()
+	return sc.Err()
+}
+
+func (t *httpTransport) done() <-chan struct{} {
+	return t.doneCh
+}
+
+func (t *httpTransport) err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lostErr
+}
+
+func (t *httpTransport) lose(err error) {
+	t.closeOnce.Do(func() {
+		t.mu.Lock()
+		t.lostErr = err
+		t.mu.Unlock()
+		close(t.doneCh)
+	})
+}
+
+// close ends the session on the server, if there is one. It is best effort.
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, http.NoBody); err == nil {
+			t.setHeaders(req)
+			if resp, err := t.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	t.lose(nil)
+	return nil
+}
@@ -0,0 +1,150 @@
+package mcpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+// stdioStopGrace is how long a server may take to exit after its stdin is closed before it is killed.
+const stdioStopGrace = 2 * time.Second
+
+// stdioTransport runs a server process and exchanges newline delimited JSON-RPC messages over its stdin and stdout.
+type stdioTransport struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	wmu sync.Mutex
+
+	doneCh    chan struct{}
+	errMu     sync.Mutex
+	exitErr   error
+	closeOnce sync.Once
+	stopping  bool
+}
+
+func openStdio(cfg *spec.MCPServerConfig, logger *slog.Logger, handle func([]byte)) (transport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...) //nolint:gosec // The command is configured by the user.
+	cmd.Dir = cfg.WorkDir
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start mcp server %q: %w", cfg.Command, err)
+	}
+	t := &stdioTransport{cmd: cmd, stdin: stdin, doneCh: make(chan struct{})}
+	logger = logger.With("mcpCommand", cfg.Command, "pid", cmd.Process.Pid)
+
+	// Stderr is the server's log. Its last line usually explains an unexpected exit.
+	var lastStderr string
+	var stderrWG sync.WaitGroup
+	stderrWG.Go(func() {
+		sc := bufio.NewScanner(stderr)
+		sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+		for sc.Scan() {
+			if line := sc.Text(); line != "" {
+				lastStderr = line
+				logger.Debug("mcp server stderr", "line", line)
+			}
+		}
+	})
+
+	go func() {
+		r := bufio.NewReader(stdout)
+		for {
+			line, err := r.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				handle(line)
+			}
+			if err != nil {
+				break
+			}
+		}
+		stderrWG.Wait()
+		waitErr := cmd.Wait()
+
+		t.errMu.Lock()
+		if !t.stopping {
+			t.exitErr = errors.New("mcp server exited")
+			if waitErr != nil {
+				t.exitErr = fmt.Errorf("mcp server exited: %w", waitErr)
+			}
+			if lastStderr != "" {
+				t.exitErr = fmt.Errorf("%w: %s", t.exitErr, lastStderr)
+			}
+			logger.Warn("mcp server exited", "error", t.exitErr)
+		}
+		t.errMu.Unlock()
+		close(t.doneCh)
+	}()
+	return t, nil
+}
+
+func (t *stdioTransport) send(ctx context.Context, msg []byte) error {
+	select {
+	case <-t.doneCh:
+		return ErrClosed
+	default:
+	}
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	_, err := t.stdin.Write(append(msg, '\n'))
+	return err
+}
+
+func (t *stdioTransport) done() <-chan struct{} {
+	return t.doneCh
+}
+
+func (t *stdioTransport) err() error {
+	t.errMu.Lock()
+	defer t.errMu.Unlock()
+	return t.exitErr
+}
+
+// close asks the server to exit by closing its stdin and kills it if it does not.
+func (t *stdioTransport) close() error {
+	t.closeOnce.Do(func() {
+		t.errMu.Lock()
+		t.stopping = true
+		t.errMu.Unlock()
+
+		// Not under wmu: a write blocked on a stuck server must not block closing it.
+		_ = t.stdin.Close()
+		select {
+		case <-t.doneCh:
+			return
+		case <-time.After(stdioStopGrace):
+		}
+		_ = t.cmd.Process.Kill()
+		// Children of the server that inherited stdout can keep it open; do not wait for them forever.
+		select {
+		case <-t.doneCh:
+		case <-time.After(stdioStopGrace):
+		}
+	})
+	return nil
+}
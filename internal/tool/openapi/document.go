@@ -0,0 +1,231 @@
+// Package openapi reads OpenAPI 3.x documents (JSON or YAML) and maps their operations into HTTP tools: argument
+// schemas from parameters and request bodies, URL, query and header templates, and auth from security schemes.
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is the part of an OpenAPI 3.x document the importer uses. Local $refs are resolved when it is parsed.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Paths      map[string]PathItem   `json:"paths,omitempty"`
+	Components Components            `json:"components"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+
+	// Warnings collects what was left out while resolving the document, e.g. external $refs.
+	Warnings []string `json:"-"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL       string                    `json:"url"`
+	Variables map[string]ServerVariable `json:"variables,omitempty"`
+}
+
+type ServerVariable struct {
+	Default string `json:"default"`
+}
+
+// PathItem holds the operations of a path by lower-case HTTP method.
+type PathItem struct {
+	Parameters []Parameter `json:"parameters,omitempty"`
+	Servers    []Server    `json:"servers,omitempty"`
+
+	Get     *Operation `json:"get,omitempty"`
+	Put     *Operation `json:"put,omitempty"`
+	Post    *Operation `json:"post,omitempty"`
+	Delete  *Operation `json:"delete,omitempty"`
+	Options *Operation `json:"options,omitempty"`
+	Head    *Operation `json:"head,omitempty"`
+	Patch   *Operation `json:"patch,omitempty"`
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId,omitempty"`
+	Summary     string       `json:"summary,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
+	Parameters  []Parameter  `json:"parameters,omitempty"`
+	RequestBody *RequestBody `json:"requestBody,omitempty"`
+	Servers     []Server     `json:"servers,omitempty"`
+	Deprecated  bool         `json:"deprecated,omitempty"`
+	// Nil inherits the security of the document; empty means no auth.
+	Security *[]SecurityRequirement `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"` // "path" | "query" | "header" | "cookie"
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema map[string]any `json:"schema,omitempty"`
+}
+
+type Components struct {
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string      `json:"type"`             // "apiKey" | "http" | "oauth2" | "openIdConnect" | "mutualTLS"
+	Name   string      `json:"name,omitempty"`   // apiKey
+	In     string      `json:"in,omitempty"`     // apiKey: "header" | "query" | "cookie"
+	Scheme string      `json:"scheme,omitempty"` // http: "bearer" | "basic" | ...
+	Flows  *OAuthFlows `json:"flows,omitempty"`  // oauth2
+}
+
+type OAuthFlows struct {
+	ClientCredentials *OAuthFlow `json:"clientCredentials,omitempty"`
+}
+
+type OAuthFlow struct {
+	TokenURL string            `json:"tokenUrl"`
+	Scopes   map[string]string `json:"scopes,omitempty"`
+}
+
+// SecurityRequirement maps scheme names to the scopes an operation needs.
+type SecurityRequirement map[string][]string
+
+// maxRefDepth bounds how deeply $refs are expanded inside each other.
+const maxRefDepth = 32
+
+// Parse parses an OpenAPI 3.x document given as JSON or YAML and resolves its local $refs.
+func Parse(data []byte) (*Document, error) {
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse openapi document: %w", err)
+	}
+	root, ok := normalizeYAML(raw).(map[string]any)
+	if !ok {
+		return nil, errors.New("openapi document is not an object")
+	}
+	v, _ := root["openapi"].(string)
+	if !strings.HasPrefix(v, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q, want 3.x", v)
+	}
+
+	r := &refResolver{root: root}
+	resolved := r.resolve(root, nil)
+	b, err := json.Marshal(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("encode openapi document: %w", err)
+	}
+	var doc Document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("decode openapi document: %w", err)
+	}
+	doc.Warnings = r.warnings
+	return &doc, nil
+}
+
+// normalizeYAML turns the maps decoded by yaml into map[string]any, so the tree encodes as JSON.
+func normalizeYAML(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		for k, e := range x {
+			x[k] = normalizeYAML(e)
+		}
+		return x
+	case map[any]any:
+		m := make(map[string]any, len(x))
+		for k, e := range x {
+			m[fmt.Sprint(k)] = normalizeYAML(e)
+		}
+		return m
+	case []any:
+		for i, e := range x {
+			x[i] = normalizeYAML(e)
+		}
+		return x
+	default:
+		return v
+	}
+}
+
+// refResolver replaces {"$ref": "#/..."} objects with copies of their targets.
+type refResolver struct {
+	root     map[string]any
+	warnings []string
+}
+
+// resolve returns v with its $refs expanded. stack holds the refs being expanded, to cut off cycles.
+func (r *refResolver) resolve(v any, stack []string) any {
+	switch x := v.(type) {
+	case map[string]any:
+		if ref, ok := x["$ref"].(string); ok {
+			return r.resolveRef(ref, stack)
+		}
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			out[k] = r.resolve(e, stack)
+		}
+		return out
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			out[i] = r.resolve(e, stack)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func (r *refResolver) resolveRef(ref string, stack []string) any {
+	if !strings.HasPrefix(ref, "#/") {
+		r.warn(fmt.Sprintf("external $ref %q is not supported and was left out", ref))
+		return map[string]any{}
+	}
+	if slices.Contains(stack, ref) {
+		// A recursive schema: the nested occurrence accepts any value.
+		return map[string]any{}
+	}
+	if len(stack) >= maxRefDepth {
+		r.warn(fmt.Sprintf("$ref %q is nested too deeply and was left out", ref))
+		return map[string]any{}
+	}
+	var cur any = r.root
+	for tok := range strings.SplitSeq(strings.TrimPrefix(ref, "#/"), "/") {
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+		m, ok := cur.(map[string]any)
+		if !ok {
+			cur = nil
+			break
+		}
+		cur = m[tok]
+	}
+	if cur == nil {
+		r.warn(fmt.Sprintf("$ref %q does not resolve and was left out", ref))
+		return map[string]any{}
+	}
+	return r.resolve(cur, append(stack, ref))
+}
+
+func (r *refResolver) warn(w string) {
+	if !slices.Contains(r.warnings, w) {
+		r.warnings = append(r.warnings, w)
+	}
+}
@@ -0,0 +1,390 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+// Tag is set on every generated tool.
+const Tag = "openapi"
+
+// bodyArg is the argument carrying the JSON request body.
+const bodyArg = "body"
+
+// undeclaredPathParamRe matches a {param} of a path that no parameter replaced with a ${arg} placeholder.
+var undeclaredPathParamRe = regexp.MustCompile(`(?:^|[^$])(\{[^{}]*\})`)
+
+// Options - how operations are mapped into tools.
+type Options struct {
+	// OperationIDs selects the operations to map. Empty: all of them.
+	OperationIDs []string
+	// BaseURL replaces the servers of the document.
+	BaseURL string
+	// SecretRef ("<type>/<name>") of the settings store that holds the credential of the security schemes.
+	// Empty: ${SECRET}, given at invocation time.
+	SecretRef string
+	// OAuth2ClientID is the client of oauth2 client-credentials schemes, which are skipped without it.
+	OAuth2ClientID string
+}
+
+// Tool - an HTTP tool generated from an operation.
+type Tool struct {
+	OperationID string
+	Slug        bundleitemutils.ItemSlug
+	DisplayName string
+	Description string
+	Tags        []string
+	ArgSchema   json.RawMessage
+	HTTPImpl    spec.HTTPToolImpl
+}
+
+type operationRef struct {
+	path   string
+	method string
+	item   *PathItem
+	op     *Operation
+}
+
+// Tools maps the selected operations of doc into HTTP tools, ordered by path and method. Warnings tell what could not
+// be mapped, e.g. cookie parameters or unsupported security schemes.
+func Tools(doc *Document, opts Options) (tools []Tool, warnings []string, err error) {
+	ops := operations(doc)
+	if len(opts.OperationIDs) > 0 {
+		byID := make(map[string]operationRef, len(ops))
+		for _, o := range ops {
+			byID[operationID(o)] = o
+		}
+		selected := make([]operationRef, 0, len(opts.OperationIDs))
+		for _, id := range opts.OperationIDs {
+			o, ok := byID[id]
+			if !ok {
+				return nil, nil, fmt.Errorf("operation %q is not in the document", id)
+			}
+			selected = append(selected, o)
+		}
+		ops = selected
+	}
+	if len(ops) == 0 {
+		return nil, nil, errors.New("openapi document has no operations")
+	}
+
+	warnings = slices.Clone(doc.Warnings)
+	seen := map[bundleitemutils.ItemSlug]string{}
+	for _, o := range ops {
+		id := operationID(o)
+		t, ws, err := operationTool(doc, o, opts)
+		for _, w := range ws {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", id, w))
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("operation %s: %w", id, err)
+		}
+		if prev, dup := seen[t.Slug]; dup {
+			return nil, nil, fmt.Errorf("operations %s and %s map to the same tool slug %q", prev, id, t.Slug)
+		}
+		seen[t.Slug] = id
+		tools = append(tools, t)
+	}
+	return tools, warnings, nil
+}
+
+// operations lists the operations of doc by path, then by method in the order of PathItem.
+func operations(doc *Document) []operationRef {
+	paths := slices.Sorted(maps.Keys(doc.Paths))
+	var ops []operationRef
+	for _, p := range paths {
+		item := doc.Paths[p]
+		for _, m := range []struct {
+			method string
+			op     *Operation
+		}{
+			{http.MethodGet, item.Get},
+			{http.MethodPut, item.Put},
+			{http.MethodPost, item.Post},
+			{http.MethodDelete, item.Delete},
+			{http.MethodOptions, item.Options},
+			{http.MethodHead, item.Head},
+			{http.MethodPatch, item.Patch},
+		} {
+			if m.op != nil {
+				ops = append(ops, operationRef{path: p, method: m.method, item: &item, op: m.op})
+			}
+		}
+	}
+	return ops
+}
+
+// operationID is the operationId of o, or "<method><path>" (e.g. "get/pets/{id}") for operations without one.
+func operationID(o operationRef) string {
+	if id := strings.TrimSpace(o.op.OperationID); id != "" {
+		return id
+	}
+	return strings.ToLower(o.method) + o.path
+}
+
+func operationTool(doc *Document, o operationRef, opts Options) (Tool, []string, error) {
+	var warnings []string
+	id := operationID(o)
+	slug := toolSlug(id)
+	if err := bundleitemutils.ValidateItemSlug(slug); err != nil {
+		return Tool{}, nil, fmt.Errorf("slug %q: %w", slug, err)
+	}
+
+	base, err := serverURL(doc, o, opts.BaseURL)
+	if err != nil {
+		return Tool{}, nil, err
+	}
+	req := spec.HTTPRequest{Method: o.method, URLTemplate: base + o.path}
+
+	props := map[string]any{}
+	var required []string
+	addArg := func(in, name string, schema map[string]any, description string, isRequired bool) string {
+		arg := argName(name)
+		if _, taken := props[arg]; taken {
+			// The same name in another location, e.g. a header and a query parameter.
+			arg = argName(in + "_" + name)
+		}
+		s := maps.Clone(schema)
+		if s == nil {
+			s = map[string]any{"type": "string"}
+		}
+		if _, ok := s["description"]; !ok && description != "" {
+			s["description"] = description
+		}
+		props[arg] = s
+		if isRequired {
+			required = append(required, arg)
+		}
+		return arg
+	}
+
+	for _, p := range mergeParameters(o.item.Parameters, o.op.Parameters) {
+		switch p.In {
+		case "path":
+			arg := addArg(p.In, p.Name, p.Schema, p.Description, true)
+			req.URLTemplate = strings.ReplaceAll(req.URLTemplate, "{"+p.Name+"}", "${"+arg+"}")
+		case "query":
+			if req.Query == nil {
+				req.Query = map[string]string{}
+			}
+			req.Query[p.Name] = "${" + addArg(p.In, p.Name, p.Schema, p.Description, p.Required) + "}"
+		case "header":
+			if req.Headers == nil {
+				req.Headers = map[string]string{}
+			}
+			req.Headers[p.Name] = "${" + addArg(p.In, p.Name, p.Schema, p.Description, p.Required) + "}"
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s parameter %q is not supported and was left out", p.In, p.Name))
+		}
+	}
+	if m := undeclaredPathParamRe.FindStringSubmatch(req.URLTemplate); m != nil {
+		return Tool{}, nil, fmt.Errorf("path parameter %s is not declared", m[1])
+	}
+
+	if rb := o.op.RequestBody; rb != nil && len(rb.Content) > 0 {
+		schema, ok := jsonBodySchema(rb.Content)
+		if !ok {
+			return Tool{}, nil, fmt.Errorf("request body has no JSON media type (%s)",
+				strings.Join(slices.Sorted(maps.Keys(rb.Content)), ", "))
+		}
+		if _, taken := props[bodyArg]; taken {
+			return Tool{}, nil, fmt.Errorf("a parameter is named %q, which carries the request body", bodyArg)
+		}
+		addArg("", bodyArg, schema, rb.Description, rb.Required)
+		req.Body = "${" + bodyArg + "}"
+		req.BodyFromArg = true
+	}
+
+	auth, ws := securityAuth(doc, o.op, opts)
+	warnings = append(warnings, ws...)
+	req.Auth = auth
+
+	argSchema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		argSchema["required"] = required
+	}
+	rawSchema, err := json.Marshal(argSchema)
+	if err != nil {
+		return Tool{}, nil, fmt.Errorf("argSchema: %w", err)
+	}
+
+	displayName := strings.TrimSpace(o.op.Summary)
+	if displayName == "" {
+		displayName = id
+	}
+	description := strings.TrimSpace(o.op.Description)
+	if description == "" {
+		description = strings.TrimSpace(o.op.Summary)
+	}
+	tags := []string{Tag}
+	for _, tg := range o.op.Tags {
+		if tg = tagName(tg); bundleitemutils.ValidateTag(tg) == nil && !slices.Contains(tags, tg) {
+			tags = append(tags, tg)
+		}
+	}
+
+	return Tool{
+		OperationID: id,
+		Slug:        slug,
+		DisplayName: displayName,
+		Description: description,
+		Tags:        tags,
+		ArgSchema:   rawSchema,
+		HTTPImpl:    spec.HTTPToolImpl{Request: req},
+	}, warnings, nil
+}
+
+// mergeParameters returns the parameters of a path item overridden by those of its operation with the same name and
+// location.
+func mergeParameters(item, op []Parameter) []Parameter {
+	out := slices.Clone(item)
+	for _, p := range op {
+		i := slices.IndexFunc(out, func(e Parameter) bool { return e.Name == p.Name && e.In == p.In })
+		if i >= 0 {
+			out[i] = p
+		} else {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// jsonBodySchema returns the schema of the JSON media type of a request body.
+func jsonBodySchema(content map[string]MediaType) (map[string]any, bool) {
+	for _, ct := range slices.Sorted(maps.Keys(content)) {
+		base := strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
+		if base == "application/json" || strings.HasSuffix(base, "+json") {
+			return content[ct].Schema, true
+		}
+	}
+	return nil, false
+}
+
+// serverURL returns the base URL of an operation: baseURL if given, else the first server of the operation, its
+// path item or the document, with its variables set to their defaults.
+func serverURL(doc *Document, o operationRef, baseURL string) (string, error) {
+	raw := strings.TrimSpace(baseURL)
+	if raw == "" {
+		for _, servers := range [][]Server{o.op.Servers, o.item.Servers, doc.Servers} {
+			if len(servers) > 0 {
+				raw = servers[0].URL
+				for name, v := range servers[0].Variables {
+					raw = strings.ReplaceAll(raw, "{"+name+"}", v.Default)
+				}
+				break
+			}
+		}
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("server URL %q is not an absolute http(s) URL; set a base URL", raw)
+	}
+	return strings.TrimSuffix(raw, "/"), nil
+}
+
+// securityAuth maps the first security requirement of op whose schemes can be mapped. Requirements that combine
+// several schemes are skipped, as a tool has a single auth.
+func securityAuth(doc *Document, op *Operation, opts Options) (*spec.HTTPAuth, []string) {
+	reqs := doc.Security
+	if op.Security != nil {
+		reqs = *op.Security
+	}
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	secret := "${SECRET}"
+	if opts.SecretRef != "" {
+		secret = "${secret:" + opts.SecretRef + "}"
+	}
+	var skipped []string
+	for _, r := range reqs {
+		if len(r) == 0 {
+			// Auth is optional.
+			return nil, nil
+		}
+		if len(r) > 1 {
+			skipped = append(skipped, strings.Join(slices.Sorted(maps.Keys(r)), "+"))
+			continue
+		}
+		for name, scopes := range r {
+			if auth := schemeAuth(doc.Components.SecuritySchemes[name], scopes, secret, opts); auth != nil {
+				return auth, nil
+			}
+			skipped = append(skipped, name)
+		}
+	}
+	return nil, []string{fmt.Sprintf("security schemes %s are not supported; the tool has no auth",
+		strings.Join(skipped, ", "))}
+}
+
+func schemeAuth(s SecurityScheme, scopes []string, secret string, opts Options) *spec.HTTPAuth {
+	switch strings.ToLower(s.Type) {
+	case "apikey":
+		if (s.In != "header" && s.In != "query") || s.Name == "" {
+			return nil
+		}
+		return &spec.HTTPAuth{Type: "apiKey", In: s.In, Name: s.Name, ValueTemplate: secret}
+	case "http":
+		switch strings.ToLower(s.Scheme) {
+		case "bearer":
+			return &spec.HTTPAuth{Type: "bearer", ValueTemplate: secret}
+		case "basic":
+			// The secret holds "user:pass".
+			return &spec.HTTPAuth{Type: "basic", ValueTemplate: secret}
+		}
+	case "oauth2":
+		if s.Flows == nil || s.Flows.ClientCredentials == nil || opts.OAuth2ClientID == "" {
+			return nil
+		}
+		return &spec.HTTPAuth{
+			Type: "oauth2ClientCredentials",
+			OAuth2: &spec.HTTPOAuth2{
+				TokenURL:             s.Flows.ClientCredentials.TokenURL,
+				ClientIDTemplate:     opts.OAuth2ClientID,
+				ClientSecretTemplate: secret,
+				Scopes:               scopes,
+			},
+		}
+	}
+	return nil
+}
+
+// toolSlug maps an operation ID to a slug by replacing runes slugs do not allow with dashes.
+func toolSlug(id string) bundleitemutils.ItemSlug {
+	slug := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			return r
+		}
+		return '-'
+	}, id)
+	return bundleitemutils.ItemSlug(strings.Trim(slug, "-"))
+}
+
+// argName maps a parameter name to an argument name usable in ${...} templates.
+func argName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func tagName(tag string) string {
+	t := argName(strings.TrimSpace(tag))
+	if t != "" && (t[0] == '-' || unicode.IsDigit(rune(t[0]))) {
+		t = "_" + t
+	}
+	return t
+}
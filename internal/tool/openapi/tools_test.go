@@ -0,0 +1,240 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+const petstoreYAML = `
+openapi: 3.0.3
+info:
+  title: Pet Store
+  version: 1.0.0
+servers:
+  - url: https://{region}.pets.example.com/v1
+    variables:
+      region:
+        default: eu
+security:
+  - apiKey: []
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      summary: List pets
+      tags: [pets]
+      parameters:
+        - name: limit
+          in: query
+          description: Page size
+          schema: {type: integer}
+        - name: session
+          in: cookie
+          schema: {type: string}
+    post:
+      operationId: createPet
+      summary: Create a pet
+      description: Adds a pet to the store.
+      security:
+        - bearer: []
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/Pet'}
+  /pets/{petId}:
+    parameters:
+      - name: petId
+        in: path
+        required: true
+        schema: {type: string}
+    get:
+      summary: Get a pet
+      security: []
+      parameters:
+        - name: X-Trace.ID
+          in: header
+          schema: {type: string}
+components:
+  securitySchemes:
+    apiKey: {type: apiKey, in: header, name: X-API-Key}
+    bearer: {type: http, scheme: bearer}
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name: {type: string}
+        parent: {$ref: '#/components/schemas/Pet'}
+`
+
+func TestTools(t *testing.T) {
+	t.Parallel()
+
+	doc, err := Parse([]byte(petstoreYAML))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		opts         Options
+		wantErr      string
+		wantSlugs    []string
+		wantWarnings []string
+		check        func(t *testing.T, tools []Tool)
+	}{
+		{
+			name:      "all_operations_by_path_and_method",
+			wantSlugs: []string{"listPets", "createPet", "get-pets--petId"},
+			wantWarnings: []string{
+				`listPets: cookie parameter "session" is not supported and was left out`,
+			},
+			check: func(t *testing.T, tools []Tool) {
+				t.Helper()
+				list, create, get := tools[0], tools[1], tools[2]
+
+				wantList := spec.HTTPRequest{
+					Method:      "GET",
+					URLTemplate: "https://eu.pets.example.com/v1/pets",
+					Query:       map[string]string{"limit": "${limit}"},
+					Auth: &spec.HTTPAuth{
+						Type:          "apiKey",
+						In:            "header",
+						Name:          "X-API-Key",
+						ValueTemplate: "${SECRET}",
+					},
+				}
+				if !reflect.DeepEqual(list.HTTPImpl.Request, wantList) {
+					t.Fatalf("listPets request = %+v, want %+v", list.HTTPImpl.Request, wantList)
+				}
+				if list.DisplayName != "List pets" || list.Description != "List pets" {
+					t.Fatalf("listPets displayName/description = %q/%q", list.DisplayName, list.Description)
+				}
+				if !reflect.DeepEqual(list.Tags, []string{Tag, "pets"}) {
+					t.Fatalf("listPets tags = %v", list.Tags)
+				}
+				assertJSON(t, list.ArgSchema, `{"type":"object","properties":{
+					"limit":{"type":"integer","description":"Page size"}}}`)
+
+				if create.HTTPImpl.Request.Body != "${body}" || create.HTTPImpl.Request.Auth.Type != "bearer" {
+					t.Fatalf("createPet request = %+v", create.HTTPImpl.Request)
+				}
+				if create.Description != "Adds a pet to the store." {
+					t.Fatalf("createPet description = %q", create.Description)
+				}
+				assertJSON(t, create.ArgSchema, `{"type":"object","required":["body"],"properties":{"body":{
+					"type":"object","required":["name"],
+					"properties":{"name":{"type":"string"},"parent":{}}}}}`)
+
+				if get.HTTPImpl.Request.URLTemplate != "https://eu.pets.example.com/v1/pets/${petId}" ||
+					get.HTTPImpl.Request.Headers["X-Trace.ID"] != "${X-Trace_ID}" ||
+					get.HTTPImpl.Request.Auth != nil {
+					t.Fatalf("get pet request = %+v", get.HTTPImpl.Request)
+				}
+				assertJSON(t, get.ArgSchema, `{"type":"object","required":["petId"],"properties":{
+					"petId":{"type":"string"},"X-Trace_ID":{"type":"string"}}}`)
+			},
+		},
+		{
+			name: "selected_operations_with_base_url_and_secret_ref",
+			opts: Options{
+				OperationIDs: []string{"createPet"},
+				BaseURL:      "http://localhost:8080/",
+				SecretRef:    "authKey/pets",
+			},
+			wantSlugs: []string{"createPet"},
+			check: func(t *testing.T, tools []Tool) {
+				t.Helper()
+				req := tools[0].HTTPImpl.Request
+				if req.URLTemplate != "http://localhost:8080/pets" ||
+					req.Auth.ValueTemplate != "${secret:authKey/pets}" {
+					t.Fatalf("createPet request = %+v", req)
+				}
+			},
+		},
+		{
+			name:    "unknown_operation",
+			opts:    Options{OperationIDs: []string{"deletePet"}},
+			wantErr: `operation "deletePet" is not in the document`,
+		},
+		{
+			name:    "relative_server_needs_base_url",
+			opts:    Options{BaseURL: "/v1"},
+			wantErr: "is not an absolute http(s) URL",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tools, warnings, err := Tools(doc, tc.opts)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Tools: %v", err)
+			}
+			var slugs []string
+			for _, tl := range tools {
+				slugs = append(slugs, string(tl.Slug))
+			}
+			if !reflect.DeepEqual(slugs, tc.wantSlugs) {
+				t.Fatalf("slugs = %v, want %v", slugs, tc.wantSlugs)
+			}
+			if !reflect.DeepEqual(warnings, tc.wantWarnings) {
+				t.Fatalf("warnings = %q, want %q", warnings, tc.wantWarnings)
+			}
+			if tc.check != nil {
+				tc.check(t, tools)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{name: "json_document", doc: `{"openapi":"3.1.0","info":{"title":"t","version":"1"},"paths":{}}`},
+		{name: "swagger_2", doc: `{"swagger":"2.0"}`, wantErr: `unsupported openapi version ""`},
+		{name: "not_an_object", doc: `[1]`, wantErr: "not an object"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse([]byte(tc.doc))
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func assertJSON(t *testing.T, got json.RawMessage, want string) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("unmarshal %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("unmarshal want: %v", err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Fatalf("json = %s, want %s", got, want)
+	}
+}
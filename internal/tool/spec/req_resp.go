@@ -9,6 +9,7 @@ type PutToolBundleRequestBody struct {
 	DisplayName string                     `json:"displayName"           required:"true"`
 	IsEnabled   bool                       `json:"isEnabled"             required:"true"`
 	Description string                     `json:"description,omitempty"`
+	MCPServer   *MCPServerConfig           `json:"mcpServer,omitempty"`
 }
 
 type PutToolBundleRequest struct {
@@ -71,7 +72,8 @@ type PutToolRequestBody struct {
 	ArgSchema JSONRawString `json:"argSchema" required:"true"`
 
 	Type     ToolImplType  `json:"type"               required:"true"`
-	HTTPImpl *HTTPToolImpl `json:"httpImpl,omitempty" required:"true"`
+	HTTPImpl *HTTPToolImpl `json:"httpImpl,omitempty"`
+	ExecImpl *ExecToolImpl `json:"execImpl,omitempty"`
 }
 
 type PutToolRequest struct {
@@ -119,6 +121,7 @@ type ToolPageToken struct {
 	BundleIDs           []bundleitemutils.BundleID `json:"ids,omitempty"`
 	Tags                []string                   `json:"tags,omitempty"`
 	BuiltInDone         bool                       `json:"bd,omitempty"` // Built-ins already emitted?
+	MCPDone             bool                       `json:"md,omitempty"` // MCP server tools already emitted?
 	DirTok              string                     `json:"dt,omitempty"` // Directory-store cursor.
 }
 
@@ -180,6 +183,18 @@ type InvokeGoOptions struct {
 	TimeoutMs int `json:"timeoutMs,omitempty"`
 }
 
+// InvokeMCPOptions contains options specific to MCP tool invocations.
+type InvokeMCPOptions struct {
+	// Overrides the server-level call timeout (in milliseconds). Optional.
+	TimeoutMs int `json:"timeoutMs,omitempty"`
+}
+
+// InvokeExecOptions contains options specific to exec tool invocations.
+type InvokeExecOptions struct {
+	// Overrides the tool-level timeout (in milliseconds). Optional.
+	TimeoutMs int `json:"timeoutMs,omitempty"`
+}
+
 // InvokeToolRequestBody is the body for invoking a tool.
 type InvokeToolRequestBody struct {
 	// Arguments passed to the tool. Must be JSON-serializable.
@@ -187,6 +202,8 @@ type InvokeToolRequestBody struct {
 	// Tool-type-specific options (only one of these is used depending on the tool type).
 	HTTPOptions *InvokeHTTPOptions `json:"httpOptions,omitempty"`
 	GoOptions   *InvokeGoOptions   `json:"goOptions,omitempty"`
+	MCPOptions  *InvokeMCPOptions  `json:"mcpOptions,omitempty"`
+	ExecOptions *InvokeExecOptions `json:"execOptions,omitempty"`
 }
 
 type InvokeToolRequest struct {
@@ -212,8 +229,69 @@ type InvokeToolResponseBody struct {
 	// ErrorMessage contains the error message returned by the tool, if any.
 	// This is set when IsError is true.
 	ErrorMessage string `json:"errorMessage,omitzero"`
+	// ErrorCode classifies errors the caller may want to handle, e.g. a denied HTTP destination.
+	ErrorCode ToolErrorCode `json:"errorCode,omitzero"`
 }
 
 type InvokeToolResponse struct {
 	Body *InvokeToolResponseBody
 }
+
+type GetMCPServerStatusRequest struct {
+	BundleID bundleitemutils.BundleID `path:"bundleID" required:"true"`
+}
+
+type GetMCPServerStatusResponse struct {
+	Body *MCPServerStatus
+}
+
+type RestartMCPServerRequest struct {
+	BundleID bundleitemutils.BundleID `path:"bundleID" required:"true"`
+}
+
+type RestartMCPServerResponse struct {
+	Body *MCPServerStatus
+}
+
+type ImportOpenAPIBundleRequestBody struct {
+	// Content of an OpenAPI 3.x document, JSON or YAML. Required unless FilePath is set.
+	Document string `json:"document,omitempty"`
+	// FilePath is a local OpenAPI document. Only the desktop app reads it, passing the content as Document; the store
+	// never reads files and rejects requests that still carry it.
+	FilePath string `json:"filePath,omitempty"`
+	// Slug and display name of the bundle when it is created. Default: from the title of the document.
+	Slug        bundleitemutils.BundleSlug `json:"slug,omitempty"`
+	DisplayName string                     `json:"displayName,omitempty"`
+	// Operations to import, by operationId. Empty: all.
+	OperationIDs []string `json:"operationIDs,omitempty"`
+	// Replaces the servers of the document.
+	BaseURL string `json:"baseURL,omitempty"`
+	// Settings store secret ("<type>/<name>") used by the security schemes. Default: ${SECRET}.
+	SecretRef string `json:"secretRef,omitempty"`
+	// Client ID for oauth2 client-credentials schemes.
+	OAuth2ClientID string `json:"oauth2ClientID,omitempty"`
+}
+
+type ImportOpenAPIBundleRequest struct {
+	BundleID bundleitemutils.BundleID `path:"bundleID" required:"true"`
+	Body     *ImportOpenAPIBundleRequestBody
+}
+
+// ImportedTool is the tool version an operation maps to. Created is false when the latest version of the tool already
+// matched the operation.
+type ImportedTool struct {
+	OperationID string                      `json:"operationID"`
+	ToolSlug    bundleitemutils.ItemSlug    `json:"toolSlug"`
+	ToolVersion bundleitemutils.ItemVersion `json:"toolVersion"`
+	Created     bool                        `json:"created"`
+}
+
+type ImportOpenAPIBundleResponseBody struct {
+	Tools []ImportedTool `json:"tools"`
+	// What could not be mapped, e.g. cookie parameters or unsupported security schemes.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type ImportOpenAPIBundleResponse struct {
+	Body *ImportOpenAPIBundleResponseBody
+}
@@ -12,6 +12,7 @@ const (
 	ToolBundlesMetaFileName      = "tools.bundles.json"
 	ToolDBFileName               = "tools.fts.sqlite"
 	ToolBuiltInOverlayDBFileName = "toolsbuiltin.overlay.sqlite"
+	ToolOAuth2TokensFileName     = "tools.oauth2tokens.json"
 
 	DefaultHTTPTimeoutMs = 10_000
 	JSONEncoding         = "json"
@@ -19,6 +20,19 @@ const (
 	DefaultHTTPEncoding  = JSONEncoding
 	DefaultHTTPErrorMode = "fail"
 
+	DefaultHTTPPollIntervalMs  = 1000
+	DefaultHTTPPollMaxAttempts = 10
+
+	DefaultHTTPRetryMaxAttempts = 3
+	DefaultHTTPRetryBaseDelayMs = 500
+	DefaultHTTPRetryMaxDelayMs  = 30_000
+
+	DefaultHTTPPaginationMaxPages = 10
+	DefaultHTTPPaginationMaxBytes = 5 << 20
+
+	DefaultExecTimeoutMs      = 30_000
+	DefaultExecMaxOutputBytes = 1 << 20
+
 	// SchemaVersion  - Current on-disk schema version.
 	SchemaVersion = "2025-07-01"
 )
@@ -40,6 +54,42 @@ var (
 
 	ErrFTSDisabled  = errors.New("FTS is disabled")
 	ErrToolDisabled = errors.New("tool is disabled")
+
+	ErrNotMCPBundle     = errors.New("bundle is not an MCP server bundle")
+	ErrMCPToolsReadOnly = errors.New("tools of an MCP server bundle are discovered from the server")
+
+	ErrHTTPDestinationDenied = errors.New("http destination is not allowed")
+	ErrHTTPStepVarMissing    = errors.New("http step variable is not available")
+)
+
+// DefaultHTTPDeniedCIDRs are never reached by HTTP tools unless the global network policy replaces them: link-local
+// ranges and the other addresses of cloud metadata services.
+var DefaultHTTPDeniedCIDRs = []string{
+	"169.254.0.0/16",
+	"fe80::/10",
+	"fd00:ec2::254/128",
+	"100.100.100.200/32",
+}
+
+// DefaultExecEnvAllowlist are the variables of the app environment that exec tools inherit when they do not list
+// their own.
+var DefaultExecEnvAllowlist = []string{"PATH", "HOME", "LANG", "TMPDIR", "TEMP", "TMP", "SystemRoot"}
+
+// DefaultHTTPRetryStatusCodes are retried when a retry policy does not list its own.
+var DefaultHTTPRetryStatusCodes = []int{429, 502, 503, 504}
+
+// HTTPNetworkPolicy - where HTTP tools may send requests.
+// AllowedHosts entries are host names or IPs, "*.example.com" also matches subdomains.
+type HTTPNetworkPolicy struct {
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+	DeniedCIDRs  []string `json:"deniedCIDRs,omitempty"`
+}
+
+type ToolErrorCode string
+
+const (
+	// ToolErrorCodeDestinationDenied - an HTTP tool tried to reach a destination its network policy does not allow.
+	ToolErrorCodeDestinationDenied ToolErrorCode = "destinationDenied"
 )
 
 type (
@@ -52,6 +102,8 @@ const (
 	ToolTypeGo   ToolImplType = "go"
 	ToolTypeHTTP ToolImplType = "http"
 	ToolTypeSDK  ToolImplType = "sdk"
+	ToolTypeMCP  ToolImplType = "mcp"
+	ToolTypeExec ToolImplType = "exec"
 )
 
 // GoToolImpl - Register-by-name pattern for Go tools.
@@ -69,11 +121,26 @@ type SDKToolImpl struct {
 }
 
 // HTTPAuth - Simple auth descriptor (can be extended later).
+// Types: "apiKey", "bearer", "basic", "oauth2ClientCredentials", "oauth2RefreshToken".
 type HTTPAuth struct {
 	Type          string `json:"type"`
-	In            string `json:"in,omitempty"`   // "header" | "query"  (apiKey only)
-	Name          string `json:"name,omitempty"` // header/query key
-	ValueTemplate string `json:"valueTemplate"`  // may contain ${SECRET}
+	In            string `json:"in,omitempty"`            // "header" | "query"  (apiKey only)
+	Name          string `json:"name,omitempty"`          // header/query key
+	ValueTemplate string `json:"valueTemplate,omitempty"` // may contain ${SECRET}
+
+	OAuth2 *HTTPOAuth2 `json:"oauth2,omitempty"` // oauth2 types only
+}
+
+// HTTPOAuth2 - token endpoint and client of the OAuth2 auth types. Templates may reference secrets; the acquired
+// tokens are cached until shortly before they expire.
+type HTTPOAuth2 struct {
+	TokenURL             string   `json:"tokenURL"`
+	ClientIDTemplate     string   `json:"clientIDTemplate,omitempty"`
+	ClientSecretTemplate string   `json:"clientSecretTemplate,omitempty"`
+	RefreshTokenTemplate string   `json:"refreshTokenTemplate,omitempty"` // oauth2RefreshToken only
+	Scopes               []string `json:"scopes,omitempty"`
+	// How the client authenticates to the token endpoint: "basic" (default) or "body".
+	ClientAuth string `json:"clientAuth,omitempty"`
 }
 type HTTPRequest struct {
 	Method      string            `json:"method,omitempty"`    // default "GET"
@@ -83,6 +150,57 @@ type HTTPRequest struct {
 	Body        string            `json:"body,omitempty"`      // raw or template
 	Auth        *HTTPAuth         `json:"auth,omitempty"`      // see below
 	TimeoutMs   int               `json:"timeoutMs,omitempty"` // default 10 000
+
+	// Body is a single ${arg} placeholder whose value is sent JSON encoded, so that objects and arrays pass through
+	// whole; no body is sent when the argument is not given. Set by tools imported from OpenAPI documents.
+	BodyFromArg bool `json:"bodyFromArg,omitempty"`
+
+	// Per-tool network policy, applied on top of the global one. Without allowed hosts, a host written in
+	// urlTemplate is the only one allowed; a templated host may be any public host.
+	NetworkPolicy *HTTPNetworkPolicy `json:"networkPolicy,omitempty"`
+
+	Retry      *HTTPRetryPolicy `json:"retry,omitempty"`
+	Pagination *HTTPPagination  `json:"pagination,omitempty"`
+}
+
+// HTTPRetryPolicy - resend a request that got a retryable status or a transport error. Attempts are spaced by
+// BaseDelayMs doubled per attempt, or by the Retry-After of the response; a Retry-After beyond MaxDelayMs ends the
+// retries. After a transport error the server may have acted on the request, so only idempotent methods, or requests
+// with an Idempotency-Key header, are resent unless RetryNonIdempotent is set.
+type HTTPRetryPolicy struct {
+	MaxAttempts        int   `json:"maxAttempts,omitempty"` // including the first; default 3
+	StatusCodes        []int `json:"statusCodes,omitempty"` // default: DefaultHTTPRetryStatusCodes
+	BaseDelayMs        int   `json:"baseDelayMs,omitempty"` // default 500
+	MaxDelayMs         int   `json:"maxDelayMs,omitempty"`  // default 30 000
+	RetryNonIdempotent bool  `json:"retryNonIdempotent,omitempty"`
+}
+
+// HTTPPaginationType - how the next page of a response is requested.
+// "linkHeader": follow the rel="next" URL of the Link header.
+// "cursor": send the value at CursorPath of the body as the CursorParam query parameter, until it is empty.
+// "page": count PageParam up from its value in the query, or else from StartPage, until a page has no items.
+type HTTPPaginationType string
+
+const (
+	HTTPPaginationLinkHeader HTTPPaginationType = "linkHeader"
+	HTTPPaginationCursor     HTTPPaginationType = "cursor"
+	HTTPPaginationPage       HTTPPaginationType = "page"
+)
+
+// HTTPPagination - fetch the following pages of a JSON response and merge their items into one JSON array, which
+// then takes the place of the response body.
+type HTTPPagination struct {
+	Type HTTPPaginationType `json:"type"`
+	// Path to the array of items in each page. Empty: the page is the array.
+	ItemsPath string `json:"itemsPath,omitempty"`
+
+	CursorPath  string `json:"cursorPath,omitempty"`  // cursor only
+	CursorParam string `json:"cursorParam,omitempty"` // cursor only
+	PageParam   string `json:"pageParam,omitempty"`   // page only
+	StartPage   *int   `json:"startPage,omitempty"`   // page only; default 1
+
+	MaxPages int `json:"maxPages,omitempty"` // default 10
+	MaxBytes int `json:"maxBytes,omitempty"` // total of all pages; default 5 MiB
 }
 
 // HTTPBodyOutputMode - how to map HTTP response body into tool outputs.
@@ -99,15 +217,158 @@ const (
 	HTTPBodyOutputModeImage HTTPBodyOutputMode = "image"
 )
 
+// HTTPOutputTransform - how to shape a response body before it reaches the model.
+// Select, Fields and Template need a JSON body and produce a single text block.
+type HTTPOutputTransform struct {
+	// Path into the body, as a dot-path (data.items[0].name) or JSONPath ($.data.items[*].name).
+	// "[*]" projects the rest of the path over all elements of an array. Empty selects the whole body.
+	Select string `json:"select,omitempty"`
+	// Paths kept from every object of the selected value (or selected array); keyed by path in the result.
+	Fields []string `json:"fields,omitempty"`
+	// Go text/template rendering the result, with "." bound to it and a "json" func. Default: compact JSON.
+	Template string `json:"template,omitempty"`
+	// Caps text outputs; longer text is truncated with a notice. 0: no cap.
+	MaxBytes int `json:"maxBytes,omitempty"`
+}
+
 type HTTPResponse struct {
-	SuccessCodes   []int              `json:"successCodes,omitempty"` // default: any 2xx
-	ErrorMode      string             `json:"errorMode,omitempty"`    // "fail"(dflt) | "empty"
-	BodyOutputMode HTTPBodyOutputMode `json:"bodyOutputMode,omitempty"`
+	SuccessCodes   []int                `json:"successCodes,omitempty"` // default: any 2xx
+	ErrorMode      string               `json:"errorMode,omitempty"`    // "fail"(dflt) | "empty"
+	BodyOutputMode HTTPBodyOutputMode   `json:"bodyOutputMode,omitempty"`
+	Transform      *HTTPOutputTransform `json:"transform,omitempty"`
 }
 
 type HTTPToolImpl struct {
-	Request  HTTPRequest  `json:"request"`
-	Response HTTPResponse `json:"response"`
+	Request  HTTPRequest  `json:"request,omitzero"`
+	Response HTTPResponse `json:"response,omitzero"`
+
+	// Steps replaces Request and Response with an ordered chain of requests.
+	Steps []HTTPStep `json:"steps,omitempty"`
+	// OutputStep names the step whose response becomes the tool output. Default: the last step.
+	OutputStep string `json:"outputStep,omitempty"`
+}
+
+// HTTPStep - one request of a multi-step HTTP tool. Templates of later steps reference the values extracted here as
+// ${step:<name>.<var>}.
+type HTTPStep struct {
+	Name     string            `json:"name"`
+	Request  HTTPRequest       `json:"request"`
+	Response HTTPResponse      `json:"response,omitzero"`
+	Extract  map[string]string `json:"extract,omitempty"` // var: path into the JSON response body
+	Poll     *HTTPPoll         `json:"poll,omitempty"`
+}
+
+// HTTPPoll - repeat a step until the value at Until (a path into the JSON response body) is one of Values.
+type HTTPPoll struct {
+	Until       string   `json:"until"`
+	Values      []string `json:"values"`
+	IntervalMs  int      `json:"intervalMs,omitempty"`  // default 1000
+	MaxAttempts int      `json:"maxAttempts,omitempty"` // default 10
+}
+
+// ExecArgsMode - how the args of a call reach an exec tool.
+// "stdin" (default): the JSON args are written to stdin.
+// "argv": only through the ${var} placeholders of Args; stdin is empty.
+type ExecArgsMode string
+
+const (
+	ExecArgsModeStdin ExecArgsMode = "stdin"
+	ExecArgsModeArgv  ExecArgsMode = "argv"
+)
+
+// ExecToolImpl - a local command run as a subprocess for every call. The process runs in WorkDir with only the
+// allowed environment, and its whole process group is killed on timeout or cancellation.
+type ExecToolImpl struct {
+	// Command is an absolute path, a path relative to WorkDir, or a name looked up in PATH.
+	Command string `json:"command"`
+	// Args are argv templates. ${var} is replaced with the argument var; an element that is only ${var} is left out
+	// when var is not set and spread when var is an array. Values may not start an element with '-' before a literal
+	// "--" element.
+	Args     []string     `json:"args,omitempty"`
+	ArgsMode ExecArgsMode `json:"argsMode,omitempty"`
+
+	// WorkDir is the absolute working directory and jail of the process: PathArgs and a relative Command must resolve
+	// inside it.
+	WorkDir string `json:"workDir"`
+	// PathArgs names the arguments that are file paths. They are resolved against WorkDir, symlinks included, and
+	// replaced with the absolute path.
+	PathArgs []string `json:"pathArgs,omitempty"`
+
+	// Env is set on top of the variables of the app environment named in EnvAllowlist (default:
+	// DefaultExecEnvAllowlist).
+	Env          map[string]string `json:"env,omitempty"`
+	EnvAllowlist []string          `json:"envAllowlist,omitempty"`
+
+	OutputEncoding   string `json:"outputEncoding,omitempty"`   // "text"(dflt) | "json"
+	SuccessExitCodes []int  `json:"successExitCodes,omitempty"` // default: 0
+	TimeoutMs        int    `json:"timeoutMs,omitempty"`        // default 30 000
+	MaxOutputBytes   int    `json:"maxOutputBytes,omitempty"`   // stdout cap; default 1 MiB
+}
+
+// MCPToolImpl - A tool discovered from the MCP server of its bundle.
+type MCPToolImpl struct {
+	// ToolName is the name of the tool on the server. Tool slugs only allow letters, digits and dashes, so the slug
+	// may differ.
+	ToolName string `json:"toolName"`
+}
+
+type MCPTransport string
+
+const (
+	MCPTransportStdio          MCPTransport = "stdio"
+	MCPTransportStreamableHTTP MCPTransport = "streamableHTTP"
+)
+
+const (
+	// MCPToolVersion is the version of every discovered MCP tool. Servers do not version their tools.
+	MCPToolVersion bundleitemutils.ItemVersion = "mcp"
+
+	DefaultMCPCallTimeoutMs = 60_000
+)
+
+// MCPServerConfig describes how to reach a Model Context Protocol server. A bundle with a server config exposes the
+// tools the server lists instead of stored tools.
+type MCPServerConfig struct {
+	Transport MCPTransport `json:"transport"`
+
+	// Stdio: the server process is spawned and managed by the backend.
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	WorkDir string            `json:"workDir,omitempty"`
+
+	// Streamable HTTP.
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Default timeout of tool calls, default 60 000.
+	TimeoutMs int `json:"timeoutMs,omitempty"`
+}
+
+type MCPServerState string
+
+const (
+	MCPServerStateStopped MCPServerState = "stopped"
+	MCPServerStateRunning MCPServerState = "running"
+	MCPServerStateFailed  MCPServerState = "failed"
+)
+
+// MCPServerStatus is the runtime state of the server of an MCP bundle. Servers are started on first use.
+type MCPServerStatus struct {
+	BundleID bundleitemutils.BundleID `json:"bundleID"`
+	State    MCPServerState           `json:"state"`
+
+	ServerName      string `json:"serverName,omitempty"`
+	ServerVersion   string `json:"serverVersion,omitempty"`
+	ProtocolVersion string `json:"protocolVersion,omitempty"`
+	ToolCount       int    `json:"toolCount"`
+
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	// Restarts counts the starts after the first one.
+	Restarts  int    `json:"restarts"`
+	LastError string `json:"lastError,omitempty"`
+	// NextRetryAt is set while a failed server waits before it is started again.
+	NextRetryAt *time.Time `json:"nextRetryAt,omitempty"`
 }
 
 type ToolStoreChoiceType string
@@ -217,6 +478,8 @@ type Tool struct {
 	GoImpl   *GoToolImpl   `json:"goImpl,omitempty"`
 	HTTPImpl *HTTPToolImpl `json:"httpImpl,omitempty"`
 	SDKImpl  *SDKToolImpl  `json:"sdkImpl,omitempty"`
+	MCPImpl  *MCPToolImpl  `json:"mcpImpl,omitempty"`
+	ExecImpl *ExecToolImpl `json:"execImpl,omitempty"`
 
 	IsEnabled  bool      `json:"isEnabled"`
 	IsBuiltIn  bool      `json:"isBuiltIn"`
@@ -232,6 +495,9 @@ type ToolBundle struct {
 	DisplayName string `json:"displayName,omitempty"`
 	Description string `json:"description,omitempty"`
 
+	// MCPServer, if set, makes this bundle expose the tools of an MCP server.
+	MCPServer *MCPServerConfig `json:"mcpServer,omitempty"`
+
 	IsEnabled     bool       `json:"isEnabled"`
 	IsBuiltIn     bool       `json:"isBuiltIn"`
 	CreatedAt     time.Time  `json:"createdAt"`
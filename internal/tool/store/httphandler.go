@@ -45,6 +45,30 @@ func InitToolStoreHandlers(api huma.API, store *ToolStore) {
 		Tags:        []string{toolTag},
 	}, store.ListToolBundles)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "get-mcp-server-status",
+		Method:      http.MethodGet,
+		Path:        toolPathPrefix + "/bundles/{bundleID}/mcp/status",
+		Summary:     "Get the runtime state of the MCP server of a bundle",
+		Tags:        []string{toolTag},
+	}, store.GetMCPServerStatus)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "restart-mcp-server",
+		Method:      http.MethodPost,
+		Path:        toolPathPrefix + "/bundles/{bundleID}/mcp/restart",
+		Summary:     "Restart the MCP server of a bundle and rediscover its tools",
+		Tags:        []string{toolTag},
+	}, store.RestartMCPServer)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "import-openapi-bundle",
+		Method:      http.MethodPost,
+		Path:        toolPathPrefix + "/bundles/{bundleID}/openapi/import",
+		Summary:     "Import the operations of an OpenAPI document as HTTP tools of a bundle",
+		Tags:        []string{toolTag},
+	}, store.ImportOpenAPIBundle)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "put-tool",
 		Method:      http.MethodPut,
@@ -1,23 +1,29 @@
 package store
 
 import (
+	"cmp"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
 	"github.com/flexigpt/flexigpt-app/internal/tool/goregistry"
+	"github.com/flexigpt/flexigpt-app/internal/tool/httprunner"
 	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
 	"github.com/flexigpt/llmtools-go/fstool"
 	llmtoolsgoSpec "github.com/flexigpt/llmtools-go/spec"
@@ -56,6 +62,7 @@ func TestInvokeTool(t *testing.T) {
 		handler       handlerFn
 		mkTool        mkToolFn
 		args          string
+		mkArgs        func(baseURL string) string
 		httpOptions   *spec.InvokeHTTPOptions
 		disableBundle bool
 		disableTool   bool
@@ -453,271 +460,1746 @@ func TestInvokeTool(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:    "transform_select_fields_template",
+			handler: itemsJSONHandler,
+			mkTool: func(baseURL string) spec.HTTPToolImpl {
+				impl := defaultTool(baseURL, "/items")
+				impl.Response.Transform = &spec.HTTPOutputTransform{
+					Select:   "$.data.items",
+					Fields:   []string{"id", "owner.login"},
+					Template: `{{range .}}{{index . "id"}} {{index . "owner.login"}};{{end}}`,
+				}
+				return impl
+			},
+			args: `{}`,
+			verify: func(t *testing.T, resp *spec.InvokeToolResponse, err error) {
+				t.Helper()
+				if err != nil {
+					t.Fatalf("InvokeTool error: %v", err)
+				}
+				if resp.Body.IsError {
+					t.Fatalf("unexpected IsError=true: %q", resp.Body.ErrorMessage)
+				}
+				if got := getOneTextOutput(t, resp.Body); got != "1 u1;2 u2;" {
+					t.Fatalf("text output = %q", got)
+				}
+			},
+		},
+		{
+			name:    "transform_wildcard_projection_and_max_bytes",
+			handler: itemsJSONHandler,
+			mkTool: func(baseURL string) spec.HTTPToolImpl {
+				impl := defaultTool(baseURL, "/items")
+				impl.Response.Transform = &spec.HTTPOutputTransform{
+					Select:   "data.items[*].name",
+					MaxBytes: 5,
+				}
+				return impl
+			},
+			args: `{}`,
+			verify: func(t *testing.T, resp *spec.InvokeToolResponse, err error) {
+				t.Helper()
+				if err != nil {
+					t.Fatalf("InvokeTool error: %v", err)
+				}
+				if resp.Body.IsError {
+					t.Fatalf("unexpected IsError=true: %q", resp.Body.ErrorMessage)
+				}
+				want := `["a",` + "\n\n[truncated: showing 5 of 9 bytes]"
+				if got := getOneTextOutput(t, resp.Body); got != want {
+					t.Fatalf("text output = %q, want %q", got, want)
+				}
+				if resp.Body.Meta["truncated"] != true {
+					t.Fatalf("meta.truncated = %v, want true", resp.Body.Meta["truncated"])
+				}
+			},
+		},
+		{
+			name:    "transform_select_missing_sets_is_error",
+			handler: itemsJSONHandler,
+			mkTool: func(baseURL string) spec.HTTPToolImpl {
+				impl := defaultTool(baseURL, "/items")
+				impl.Response.Transform = &spec.HTTPOutputTransform{Select: "data.missing"}
+				return impl
+			},
+			args: `{}`,
+			verify: func(t *testing.T, resp *spec.InvokeToolResponse, err error) {
+				t.Helper()
+				if err != nil {
+					t.Fatalf("InvokeTool error: %v", err)
+				}
+				if !resp.Body.IsError || !strings.Contains(resp.Body.ErrorMessage, "matched nothing") {
+					t.Fatalf("IsError = %v, ErrorMessage = %q", resp.Body.IsError, resp.Body.ErrorMessage)
+				}
+			},
+		},
+		{
+			name:    "templated_host_to_loopback_denied",
+			handler: itemsJSONHandler,
+			mkTool: func(string) spec.HTTPToolImpl {
+				return defaultTool("http://${host}", "/items")
+			},
+			args:   `{"host":"127.0.0.1:1"}`,
+			verify: verifyDestinationDenied,
+		},
+		{
+			name:    "userinfo_injection_denied",
+			handler: itemsJSONHandler,
+			mkTool: func(string) spec.HTTPToolImpl {
+				return defaultTool("http://${host}", "/items")
+			},
+			args:   `{"host":"api.example.com@127.0.0.1:1"}`,
+			verify: verifyDestinationDenied,
+		},
+		{
+			name: "redirect_to_metadata_endpoint_denied",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+			},
+			mkTool: func(baseURL string) spec.HTTPToolImpl {
+				return defaultTool(baseURL, "/items")
+			},
+			args:   `{}`,
+			verify: verifyDestinationDenied,
+		},
+		{
+			name:    "tool_allowed_hosts_exclude_url_host",
+			handler: itemsJSONHandler,
+			mkTool: func(baseURL string) spec.HTTPToolImpl {
+				impl := defaultTool(baseURL, "/items")
+				impl.Request.NetworkPolicy = &spec.HTTPNetworkPolicy{AllowedHosts: []string{"*.example.com"}}
+				return impl
+			},
+			args:   `{}`,
+			verify: verifyDestinationDenied,
+		},
+		{
+			name:    "tool_allowed_hosts_permit_templated_loopback_host",
+			handler: itemsJSONHandler,
+			mkTool: func(string) spec.HTTPToolImpl {
+				impl := defaultTool("http://${host}", "/items")
+				impl.Request.NetworkPolicy = &spec.HTTPNetworkPolicy{AllowedHosts: []string{"127.0.0.1"}}
+				return impl
+			},
+			mkArgs: func(baseURL string) string {
+				return `{"host":"` + strings.TrimPrefix(baseURL, "http://") + `"}`
+			},
+			verify: func(t *testing.T, resp *spec.InvokeToolResponse, err error) {
+				t.Helper()
+				if err != nil {
+					t.Fatalf("InvokeTool error: %v", err)
+				}
+				if resp.Body.IsError {
+					t.Fatalf("unexpected IsError=true: %q", resp.Body.ErrorMessage)
+				}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Test HTTP server for this case.
+			srv := httptest.NewServer(http.HandlerFunc(tc.handler))
+			defer srv.Close()
+
+			baseDir := t.TempDir()
+			ts, err := NewToolStore(baseDir, WithFTS(false))
+			if err != nil {
+				t.Fatalf("NewToolStore: %v", err)
+			}
+			defer ts.Close()
+
+			// Create bundle and tool.
+			const (
+				bundleID   = bundleitemutils.BundleID("bundle-1")
+				bundleSlug = bundleitemutils.BundleSlug("bundle1")
+				toolSlug   = bundleitemutils.ItemSlug("tool1")
+				version    = bundleitemutils.ItemVersion("v1")
+			)
+
+			if _, err := ts.PutToolBundle(t.Context(), &spec.PutToolBundleRequest{
+				BundleID: bundleID,
+				Body: &spec.PutToolBundleRequestBody{
+					Slug:        bundleSlug,
+					DisplayName: "Bundle 1",
+					IsEnabled:   true,
+					Description: "test bundle",
+				},
+			}); err != nil {
+				t.Fatalf("PutToolBundle: %v", err)
+			}
+
+			// Tool (HTTP-only custom tools).
+			impl := tc.mkTool(srv.URL)
+			if _, err := ts.PutTool(t.Context(), &spec.PutToolRequest{
+				BundleID: bundleID,
+				ToolSlug: toolSlug,
+				Version:  version,
+				Body: &spec.PutToolRequestBody{
+					DisplayName:  "Tool 1",
+					Description:  "test tool",
+					UserCallable: true,
+					LLMCallable:  true,
+
+					Tags:      []string{"t"},
+					IsEnabled: true,
+					ArgSchema: "{}",
+					Type:      spec.ToolTypeHTTP,
+					HTTPImpl:  &impl,
+				},
+			}); err != nil {
+				t.Fatalf("PutTool: %v", err)
+			}
+
+			// Optional: disable bundle or tool prior to invocation.
+			if tc.disableBundle {
+				if _, err := ts.PatchToolBundle(t.Context(), &spec.PatchToolBundleRequest{
+					BundleID: bundleID,
+					Body:     &spec.PatchToolBundleRequestBody{IsEnabled: false},
+				}); err != nil {
+					t.Fatalf("PatchToolBundle: %v", err)
+				}
+			}
+			if tc.disableTool {
+				if _, err := ts.PatchTool(t.Context(), &spec.PatchToolRequest{
+					BundleID: bundleID,
+					ToolSlug: toolSlug,
+					Version:  version,
+					Body:     &spec.PatchToolRequestBody{IsEnabled: false},
+				}); err != nil {
+					t.Fatalf("PatchTool: %v", err)
+				}
+			}
+
+			args := tc.args
+			if tc.mkArgs != nil {
+				args = tc.mkArgs(srv.URL)
+			}
+			resp, err := ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
+				BundleID: bundleID,
+				ToolSlug: toolSlug,
+				Version:  version,
+				Body: &spec.InvokeToolRequestBody{
+					Args:        args,
+					HTTPOptions: tc.httpOptions,
+				},
+			})
+
+			if tc.wantErrIs != nil {
+				if !errors.Is(err, tc.wantErrIs) {
+					t.Fatalf("InvokeTool error = %v, want errors.Is(..., %v)", err, tc.wantErrIs)
+				}
+				return
+			}
+
+			if tc.verify != nil {
+				tc.verify(t, resp, err)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("InvokeTool error: %v", err)
+			}
+			if resp == nil || resp.Body == nil {
+				t.Fatalf("nil response/body")
+			}
+			if resp.Body.IsError {
+				t.Fatalf("expected IsError=false, got true (ErrorMessage=%q)", resp.Body.ErrorMessage)
+			}
+			if resp.Body.Meta == nil {
+				t.Fatalf("meta is nil")
+			}
+			if typ, _ := resp.Body.Meta["type"].(string); typ != string(spec.ToolTypeHTTP) {
+				t.Fatalf("meta.type = %v, want http", typ)
+			}
+		})
+	}
+}
+
+func TestInvokeTool_InvalidRequest(t *testing.T) {
+	t.Parallel()
+
+	baseDir := t.TempDir()
+	ts, err := NewToolStore(baseDir, WithFTS(false))
+	if err != nil {
+		t.Fatalf("NewToolStore: %v", err)
+	}
+	defer ts.Close()
+
+	// Missing required fields.
+	_, err = ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
+		BundleID: "",
+		ToolSlug: "",
+		Version:  "",
+		Body:     &spec.InvokeToolRequestBody{Args: "{}"},
+	})
+	if !errors.Is(err, spec.ErrInvalidRequest) {
+		t.Fatalf("err = %v, want ErrInvalidRequest", err)
+	}
+}
+
+func TestInvokeTool_RequestBodyTemplating_PathQueryHeaderAuth(t *testing.T) {
+	t.Parallel()
+
+	// Handler asserts templated values for path, query, header, and Authorization.
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Path element is last segment.
+		gotID := path.Base(r.URL.Path)
+		if gotID == "" {
+			t.Fatalf("empty path base")
+		}
+		qv := r.URL.Query().Get("id")
+		if qv == "" {
+			t.Fatalf("missing query 'id'")
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			t.Fatalf("Authorization header unexpected: %q", auth)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"pathID":  gotID,
+			"queryID": qv,
+			"auth":    auth,
+		})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+
+	baseDir := t.TempDir()
+	ts, err := NewToolStore(baseDir, WithFTS(false))
+	if err != nil {
+		t.Fatalf("NewToolStore: %v", err)
+	}
+	defer ts.Close()
+
+	const (
+		bundleID   = bundleitemutils.BundleID("bundle-2")
+		bundleSlug = bundleitemutils.BundleSlug("bundle2")
+		toolSlug   = bundleitemutils.ItemSlug("tool2")
+		version    = bundleitemutils.ItemVersion("v1")
+	)
+
+	_, err = ts.PutToolBundle(t.Context(), &spec.PutToolBundleRequest{
+		BundleID: bundleID,
+		Body: &spec.PutToolBundleRequestBody{
+			Slug:        bundleSlug,
+			DisplayName: "Bundle 2",
+			IsEnabled:   true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("PutToolBundle: %v", err)
+	}
+
+	impl := spec.HTTPToolImpl{
+		Request: spec.HTTPRequest{
+			Method:      "GET",
+			URLTemplate: srv.URL + "/items/${id}",
+			Query:       map[string]string{"id": "${id}"},
+			Headers:     map[string]string{"X-Trace": "${id}"},
+			Auth: &spec.HTTPAuth{
+				Type:          "bearer",
+				ValueTemplate: "${SECRET}",
+			},
+		},
+		Response: spec.HTTPResponse{},
+	}
+
+	_, err = ts.PutTool(t.Context(), &spec.PutToolRequest{
+		BundleID: bundleID,
+		ToolSlug: toolSlug,
+		Version:  version,
+		Body: &spec.PutToolRequestBody{
+			DisplayName:  "Tool 2",
+			IsEnabled:    true,
+			UserCallable: true,
+			LLMCallable:  true,
+
+			ArgSchema: "{}",
+			Type:      spec.ToolTypeHTTP,
+			HTTPImpl:  &impl,
+		},
+	})
+	if err != nil {
+		t.Fatalf("PutTool: %v", err)
+	}
+
+	resp, err := ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
+		BundleID: bundleID,
+		ToolSlug: toolSlug,
+		Version:  version,
+		Body: &spec.InvokeToolRequestBody{
+			Args:        `{"id":"42"}`,
+			HTTPOptions: &spec.InvokeHTTPOptions{Secrets: map[string]string{"SECRET": "abc123"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("InvokeTool: %v", err)
+	}
+	if resp == nil || resp.Body == nil {
+		t.Fatalf("nil response/body")
+	}
+	if resp.Body.IsError {
+		t.Fatalf("expected IsError=false, got true (ErrorMessage=%q)", resp.Body.ErrorMessage)
+	}
+
+	var got map[string]any
+	textOut := getOneTextOutput(t, resp.Body)
+	if err := json.Unmarshal([]byte(textOut), &got); err != nil {
+		t.Fatalf("unmarshal output: %v; raw: %q", err, textOut)
+	}
+	if got["pathID"] != "42" || got["queryID"] != "42" {
+		t.Fatalf("templating mismatch: got=%v", got)
+	}
+	if a, _ := got["auth"].(string); a != "Bearer abc123" {
+		t.Fatalf("auth = %v, want 'Bearer abc123'", got["auth"])
+	}
+}
+
+func TestInvokeTool_WholeBodyPlaceholder(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"body": string(body)})
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		body        string
+		bodyFromArg bool
+		args        string
+		wantBody    string
+		wantErr     string
+		wantPutErr  bool
+	}{
+		{
+			// Tools without bodyFromArg splice the value into the template as before.
+			name:     "template_splices_string",
+			body:     "${payload}",
+			args:     `{"payload":"{\"a\":1}"}`,
+			wantBody: `{"a":1}`,
+		},
+		{
+			name:    "template_missing_arg_is_invalid_json",
+			body:    "${payload}",
+			args:    `{}`,
+			wantErr: "must be valid JSON",
+		},
+		{
+			name:    "template_object_is_not_encoded",
+			body:    "${payload}",
+			args:    `{"payload":{"a":1}}`,
+			wantErr: "must be valid JSON",
+		},
+		{
+			name:        "from_arg_encodes_object",
+			body:        "${payload}",
+			bodyFromArg: true,
+			args:        `{"payload":{"a":[1,2]}}`,
+			wantBody:    `{"a":[1,2]}`,
+		},
+		{
+			name:        "from_arg_encodes_string",
+			body:        "${payload}",
+			bodyFromArg: true,
+			args:        `{"payload":"x"}`,
+			wantBody:    `"x"`,
+		},
+		{
+			name:        "from_arg_missing_sends_no_body",
+			body:        "${payload}",
+			bodyFromArg: true,
+			args:        `{}`,
+			wantBody:    ``,
+		},
+		{
+			name:        "from_arg_needs_single_placeholder",
+			body:        `{"a":"${payload}"}`,
+			bodyFromArg: true,
+			wantPutErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ts, err := NewToolStore(t.TempDir(), WithFTS(false))
+			if err != nil {
+				t.Fatalf("NewToolStore: %v", err)
+			}
+			defer ts.Close()
+
+			const (
+				bundleID = bundleitemutils.BundleID("bundle-body")
+				toolSlug = bundleitemutils.ItemSlug("tool-body")
+				version  = bundleitemutils.ItemVersion("v1")
+			)
+			putBundle(t, ts, bundleID, "bundle-body", true)
+			impl := spec.HTTPToolImpl{
+				Request: spec.HTTPRequest{
+					Method:      "POST",
+					URLTemplate: srv.URL + "/echo",
+					Body:        tc.body,
+					BodyFromArg: tc.bodyFromArg,
+				},
+			}
+			_, err = ts.PutTool(t.Context(), &spec.PutToolRequest{
+				BundleID: bundleID,
+				ToolSlug: toolSlug,
+				Version:  version,
+				Body: &spec.PutToolRequestBody{
+					DisplayName:  "Tool body",
+					IsEnabled:    true,
+					UserCallable: true,
+					LLMCallable:  true,
+					ArgSchema:    "{}",
+					Type:         spec.ToolTypeHTTP,
+					HTTPImpl:     &impl,
+				},
+			})
+			if tc.wantPutErr {
+				if err == nil {
+					t.Fatal("PutTool: expected a validation error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PutTool: %v", err)
+			}
+
+			resp, err := ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
+				BundleID: bundleID,
+				ToolSlug: toolSlug,
+				Version:  version,
+				Body:     &spec.InvokeToolRequestBody{Args: tc.args},
+			})
+			if err != nil {
+				t.Fatalf("InvokeTool: %v", err)
+			}
+			if tc.wantErr != "" {
+				if !resp.Body.IsError || !strings.Contains(resp.Body.ErrorMessage, tc.wantErr) {
+					t.Fatalf("IsError = %v, ErrorMessage = %q, want %q",
+						resp.Body.IsError, resp.Body.ErrorMessage, tc.wantErr)
+				}
+				return
+			}
+			if resp.Body.IsError {
+				t.Fatalf("unexpected IsError=true: %q", resp.Body.ErrorMessage)
+			}
+			var got map[string]string
+			if err := json.Unmarshal([]byte(getOneTextOutput(t, resp.Body)), &got); err != nil {
+				t.Fatalf("decode output: %v", err)
+			}
+			if got["body"] != tc.wantBody {
+				t.Fatalf("sent body = %q, want %q", got["body"], tc.wantBody)
+			}
+		})
+	}
+}
+
+type mapSecretResolver map[string]string
+
+func (m mapSecretResolver) ResolveSecret(_ context.Context, ref string) (string, error) {
+	v, ok := m[ref]
+	if !ok {
+		return "", fmt.Errorf("no secret %s", ref)
+	}
+	return v, nil
+}
+
+func TestInvokeTool_SecretReferences(t *testing.T) {
+	t.Parallel()
+
+	secrets := mapSecretResolver{"github/token": "ghp-secret-1", "svc/key": "svc secret/2"}
+	echoHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"auth": r.Header.Get("Authorization"),
+			"key":  r.URL.Query().Get("key"),
+		})
+	}
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		resolver httprunner.SecretResolver
+		query    map[string]string
+		verify   func(t *testing.T, body *spec.InvokeToolResponseBody)
+	}{
+		{
+			name:     "resolved_and_redacted_in_meta",
+			handler:  echoHandler,
+			resolver: secrets,
+			query:    map[string]string{"key": "${secret:svc/key}"},
+			verify: func(t *testing.T, body *spec.InvokeToolResponseBody) {
+				t.Helper()
+				if body.IsError {
+					t.Fatalf("unexpected IsError=true: %q", body.ErrorMessage)
+				}
+				want := `{"auth":"Bearer ghp-secret-1","key":"svc secret/2"}` + "\n"
+				if got := getOneTextOutput(t, body); got != want {
+					t.Fatalf("text output = %q, want %q", got, want)
+				}
+				u, _ := body.Meta["url"].(string)
+				if strings.Contains(u, "svc+secret%2F2") || !strings.Contains(u, "key=***") {
+					t.Fatalf("meta.url = %q, want the secret redacted", u)
+				}
+			},
+		},
+		{
+			name: "redacted_in_error_message",
+			handler: func(http.ResponseWriter, *http.Request) {
+				panic(http.ErrAbortHandler)
+			},
+			resolver: secrets,
+			query:    map[string]string{"key": "${secret:svc/key}"},
+			verify: func(t *testing.T, body *spec.InvokeToolResponseBody) {
+				t.Helper()
+				if !body.IsError || strings.Contains(body.ErrorMessage, "secret%2F2") {
+					t.Fatalf("IsError = %v, ErrorMessage = %q", body.IsError, body.ErrorMessage)
+				}
+			},
+		},
+		{
+			name:     "unknown_secret_sets_is_error",
+			handler:  echoHandler,
+			resolver: secrets,
+			query:    map[string]string{"key": "${secret:svc/missing}"},
+			verify: func(t *testing.T, body *spec.InvokeToolResponseBody) {
+				t.Helper()
+				if !body.IsError || !strings.Contains(body.ErrorMessage, `"svc/missing"`) {
+					t.Fatalf("IsError = %v, ErrorMessage = %q", body.IsError, body.ErrorMessage)
+				}
+			},
+		},
+		{
+			name:    "no_resolver_sets_is_error",
+			handler: echoHandler,
+			verify: func(t *testing.T, body *spec.InvokeToolResponseBody) {
+				t.Helper()
+				if !body.IsError || !strings.Contains(body.ErrorMessage, "no secret store") {
+					t.Fatalf("IsError = %v, ErrorMessage = %q", body.IsError, body.ErrorMessage)
+				}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(tc.handler)
+			defer srv.Close()
+
+			opts := []Option{WithFTS(false)}
+			if tc.resolver != nil {
+				opts = append(opts, WithSecretResolver(tc.resolver))
+			}
+			ts, err := NewToolStore(t.TempDir(), opts...)
+			if err != nil {
+				t.Fatalf("NewToolStore: %v", err)
+			}
+			defer ts.Close()
+
+			const (
+				bundleID = bundleitemutils.BundleID("bundle-secrets")
+				toolSlug = bundleitemutils.ItemSlug("tool-secrets")
+				version  = bundleitemutils.ItemVersion("v1")
+			)
+			putBundle(t, ts, bundleID, "bundle-secrets", true)
+
+			impl := spec.HTTPToolImpl{
+				Request: spec.HTTPRequest{
+					Method:      "GET",
+					URLTemplate: srv.URL + "/echo",
+					Query:       tc.query,
+					Auth:        &spec.HTTPAuth{Type: "bearer", ValueTemplate: "${secret:github/token}"},
+				},
+			}
+			if _, err := ts.PutTool(t.Context(), &spec.PutToolRequest{
+				BundleID: bundleID,
+				ToolSlug: toolSlug,
+				Version:  version,
+				Body: &spec.PutToolRequestBody{
+					DisplayName:  "Tool secrets",
+					IsEnabled:    true,
+					UserCallable: true,
+					LLMCallable:  true,
+					ArgSchema:    "{}",
+					Type:         spec.ToolTypeHTTP,
+					HTTPImpl:     &impl,
+				},
+			}); err != nil {
+				t.Fatalf("PutTool: %v", err)
+			}
+
+			resp, err := ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
+				BundleID: bundleID,
+				ToolSlug: toolSlug,
+				Version:  version,
+				Body:     &spec.InvokeToolRequestBody{Args: `{}`},
+			})
+			if err != nil {
+				t.Fatalf("InvokeTool: %v", err)
+			}
+			tc.verify(t, resp.Body)
+		})
+	}
+}
+
+// oauth2Stub is a token endpoint plus an API that accepts the tokens it issued and not revoked.
+type oauth2Stub struct {
+	mu        sync.Mutex
+	expiresIn int
+	issued    int
+	grants    []string // grant_type, or refresh_token:<token> for refresh grants
+	clients   []string // basic auth user of each token request
+	revoked   map[string]bool
+	// Token requests (1-based) answered with invalid_grant, and the first one whose reply has no refresh token.
+	rejected        map[int]bool
+	omitRefreshFrom int
+}
+
+func (s *oauth2Stub) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = r.ParseForm()
+	grant := r.PostForm.Get("grant_type")
+	if grant == "refresh_token" {
+		grant += ":" + r.PostForm.Get("refresh_token")
+	}
+	user, _, _ := r.BasicAuth()
+	s.grants = append(s.grants, grant)
+	s.clients = append(s.clients, user)
+	w.Header().Set("Content-Type", "application/json")
+	if s.rejected[len(s.grants)] {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": "invalid_grant"})
+		return
+	}
+	s.issued++
+	reply := map[string]any{
+		"access_token":  fmt.Sprintf("tok-%d", s.issued),
+		"token_type":    "bearer",
+		"expires_in":    s.expiresIn,
+		"refresh_token": fmt.Sprintf("r-%d", s.issued),
+	}
+	if s.omitRefreshFrom > 0 && len(s.grants) >= s.omitRefreshFrom {
+		delete(reply, "refresh_token")
+	}
+	_ = json.NewEncoder(w).Encode(reply)
+}
+
+func (s *oauth2Stub) apiHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || s.revoked[tok] {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	_, _ = w.Write([]byte(tok))
+}
+
+// snapshot returns the token requests so far.
+func (s *oauth2Stub) snapshot() (grants, clients []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.grants), slices.Clone(s.clients)
+}
+
+// reverseEncoder stands in for the keyring encoder of the token cache file.
+type reverseEncoder struct{}
+
+func (reverseEncoder) Encode(w io.Writer, value any) error {
+	v, _ := value.(string)
+	b := []byte(v)
+	slices.Reverse(b)
+	_, err := w.Write(b)
+	return err
+}
+
+func (reverseEncoder) Decode(r io.Reader, value any) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	slices.Reverse(b)
+	*(value.(*any)) = string(b)
+	return nil
+}
+
+func TestInvokeTool_OAuth2(t *testing.T) {
+	t.Parallel()
+
+	clientCredentials := func(tokenURL string) *spec.HTTPAuth {
+		return &spec.HTTPAuth{
+			Type: "oauth2ClientCredentials",
+			OAuth2: &spec.HTTPOAuth2{
+				TokenURL:             tokenURL,
+				ClientIDTemplate:     "cid",
+				ClientSecretTemplate: "${secret:svc/client}",
+				Scopes:               []string{"read", "write"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		expiresIn       int
+		revoke          []string
+		rejected        []int
+		omitRefreshFrom int
+		auth            func(tokenURL string) *spec.HTTPAuth
+		calls           int
+		reopen          bool     // invoke the second time from a new store on the same directory
+		wantOut         []string // "" expects a tool error
+		wantGrants      []string
+	}{
+		{
+			name:       "client_credentials_token_is_cached",
+			expiresIn:  3600,
+			auth:       clientCredentials,
+			calls:      2,
+			wantOut:    []string{"tok-1", "tok-1"},
+			wantGrants: []string{"client_credentials"},
+		},
+		{
+			name:       "token_expiring_soon_is_refreshed",
+			expiresIn:  30,
+			auth:       clientCredentials,
+			calls:      2,
+			wantOut:    []string{"tok-1", "tok-2"},
+			wantGrants: []string{"client_credentials", "refresh_token:r-1"},
+		},
+		{
+			name:       "rejected_token_is_replaced_and_request_retried",
+			expiresIn:  3600,
+			revoke:     []string{"tok-1"},
+			auth:       clientCredentials,
+			calls:      1,
+			wantOut:    []string{"tok-2"},
+			wantGrants: []string{"client_credentials", "refresh_token:r-1"},
+		},
+		{
+			name:            "rejected_refresh_falls_back_to_client_credentials",
+			expiresIn:       30,
+			rejected:        []int{2},
+			omitRefreshFrom: 3,
+			auth:            clientCredentials,
+			calls:           3,
+			wantOut:         []string{"tok-1", "tok-2", "tok-3"},
+			// The token from the fallback has no refresh token, so the rejected one is not tried again.
+			wantGrants: []string{"client_credentials", "refresh_token:r-1", "client_credentials", "client_credentials"},
+		},
+		{
+			name:       "invalid_grant_drops_cached_token",
+			expiresIn:  30,
+			rejected:   []int{2, 3},
+			auth:       clientCredentials,
+			calls:      3,
+			reopen:     true,
+			wantOut:    []string{"tok-1", "", "tok-2"},
+			wantGrants: []string{"client_credentials", "refresh_token:r-1", "client_credentials", "client_credentials"},
+		},
+		{
+			name:      "refresh_token_grant_uses_rotated_token",
+			expiresIn: 30,
+			auth: func(tokenURL string) *spec.HTTPAuth {
+				return &spec.HTTPAuth{
+					Type: "oauth2RefreshToken",
+					OAuth2: &spec.HTTPOAuth2{
+						TokenURL:             tokenURL,
+						ClientIDTemplate:     "cid",
+						RefreshTokenTemplate: "${secret:svc/refresh}",
+					},
+				}
+			},
+			calls:      2,
+			wantOut:    []string{"tok-1", "tok-2"},
+			wantGrants: []string{"refresh_token:r-0", "refresh_token:r-1"},
+		},
+		{
+			name:       "encrypted_cache_survives_restart",
+			expiresIn:  3600,
+			auth:       clientCredentials,
+			calls:      2,
+			reopen:     true,
+			wantOut:    []string{"tok-1", "tok-1"},
+			wantGrants: []string{"client_credentials"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := &oauth2Stub{
+				expiresIn:       tc.expiresIn,
+				revoked:         map[string]bool{},
+				rejected:        map[int]bool{},
+				omitRefreshFrom: tc.omitRefreshFrom,
+			}
+			for _, tok := range tc.revoke {
+				stub.revoked[tok] = true
+			}
+			for _, n := range tc.rejected {
+				stub.rejected[n] = true
+			}
+			tokenSrv := httptest.NewServer(http.HandlerFunc(stub.tokenHandler))
+			defer tokenSrv.Close()
+			apiSrv := httptest.NewServer(http.HandlerFunc(stub.apiHandler))
+			defer apiSrv.Close()
+
+			baseDir := t.TempDir()
+			newStore := func() *ToolStore {
+				ts, err := NewToolStore(baseDir,
+					WithFTS(false),
+					WithSecretResolver(mapSecretResolver{"svc/client": "csecret", "svc/refresh": "r-0"}),
+					WithOAuth2TokenEncoder(reverseEncoder{}),
+				)
+				if err != nil {
+					t.Fatalf("NewToolStore: %v", err)
+				}
+				return ts
+			}
+			ts := newStore()
+			defer func() { ts.Close() }()
+
+			const (
+				bundleID = bundleitemutils.BundleID("bundle-oauth2")
+				toolSlug = bundleitemutils.ItemSlug("tool-oauth2")
+				version  = bundleitemutils.ItemVersion("v1")
+			)
+			putBundle(t, ts, bundleID, "bundle-oauth2", true)
+			impl := spec.HTTPToolImpl{
+				Request: spec.HTTPRequest{
+					Method:      "GET",
+					URLTemplate: apiSrv.URL + "/me",
+					Auth:        tc.auth(tokenSrv.URL + "/token"),
+				},
+				Response: spec.HTTPResponse{BodyOutputMode: spec.HTTPBodyOutputModeText},
+			}
+			if _, err := ts.PutTool(t.Context(), &spec.PutToolRequest{
+				BundleID: bundleID,
+				ToolSlug: toolSlug,
+				Version:  version,
+				Body: &spec.PutToolRequestBody{
+					DisplayName:  "Tool oauth2",
+					IsEnabled:    true,
+					UserCallable: true,
+					LLMCallable:  true,
+					ArgSchema:    "{}",
+					Type:         spec.ToolTypeHTTP,
+					HTTPImpl:     &impl,
+				},
+			}); err != nil {
+				t.Fatalf("PutTool: %v", err)
+			}
+
+			for i := range tc.calls {
+				if tc.reopen && i > 0 {
+					ts.Close()
+					ts = newStore()
+				}
+				resp, err := ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
+					BundleID: bundleID,
+					ToolSlug: toolSlug,
+					Version:  version,
+					Body:     &spec.InvokeToolRequestBody{Args: `{}`},
+				})
+				if err != nil {
+					t.Fatalf("InvokeTool: %v", err)
+				}
+				if tc.wantOut[i] == "" {
+					if !resp.Body.IsError || !strings.Contains(resp.Body.ErrorMessage, "invalid_grant") {
+						t.Fatalf("call %d: IsError = %v, ErrorMessage = %q, want invalid_grant",
+							i, resp.Body.IsError, resp.Body.ErrorMessage)
+					}
+					continue
+				}
+				if resp.Body.IsError {
+					t.Fatalf("call %d: unexpected IsError=true: %q", i, resp.Body.ErrorMessage)
+				}
+				if got := getOneTextOutput(t, resp.Body); got != tc.wantOut[i] {
+					t.Fatalf("call %d: token = %q, want %q", i, got, tc.wantOut[i])
+				}
+			}
+
+			grants, clients := stub.snapshot()
+			if !slices.Equal(grants, tc.wantGrants) {
+				t.Fatalf("token requests = %v, want %v", grants, tc.wantGrants)
+			}
+			for _, c := range clients {
+				if c != "cid" {
+					t.Fatalf("token request client = %q, want cid", c)
+				}
+			}
+			if tc.reopen {
+				data, err := os.ReadFile(filepath.Join(baseDir, spec.ToolOAuth2TokensFileName))
+				if err != nil {
+					t.Fatalf("read token cache: %v", err)
+				}
+				if strings.Contains(string(data), "tok-1") {
+					t.Fatalf("token cache file holds the token in plain text: %s", data)
+				}
+			}
+		})
+	}
+}
+
+func TestInvokeTool_Steps(t *testing.T) {
+	t.Parallel()
+
+	// POST /jobs creates a job; GET /jobs/{id} reports it pending until the third poll.
+	var (
+		mu    sync.Mutex
+		polls int
+	)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/jobs":
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(string(body), `"q":"hello"`) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"job":{"id":"j1"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/jobs/j1":
+			mu.Lock()
+			polls++
+			n := polls
+			mu.Unlock()
+			if n < 3 {
+				_, _ = w.Write([]byte(`{"status":"pending"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"done","result":{"answer":42}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+
+	steps := func(createCodes []int, outputStep string) spec.HTTPToolImpl {
+		return spec.HTTPToolImpl{
+			Steps: []spec.HTTPStep{
+				{
+					Name: "create",
+					Request: spec.HTTPRequest{
+						Method:      "POST",
+						URLTemplate: srv.URL + "/jobs",
+						Body:        `{"q":"${q}"}`,
+					},
+					Response: spec.HTTPResponse{SuccessCodes: createCodes},
+					Extract:  map[string]string{"id": "$.job.id"},
+				},
+				{
+					Name:    "status",
+					Request: spec.HTTPRequest{Method: "GET", URLTemplate: srv.URL + "/jobs/${step:create.id}"},
+					Response: spec.HTTPResponse{
+						Transform: &spec.HTTPOutputTransform{Select: "$.result"},
+					},
+					Poll: &spec.HTTPPoll{Until: "$.status", Values: []string{"done", "failed"}, IntervalMs: 1},
+				},
+			},
+			OutputStep: outputStep,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		impl       spec.HTTPToolImpl
+		wantPutErr string
+		wantErr    string
+		wantOut    string
+		wantSteps  int
+	}{
+		{
+			name:      "create_then_poll_until_done",
+			impl:      steps([]int{201}, ""),
+			wantOut:   `{"answer":42}`,
+			wantSteps: 2,
+		},
+		{
+			name:      "output_from_earlier_step",
+			impl:      steps([]int{201}, "create"),
+			wantOut:   `{"job":{"id":"j1"}}`,
+			wantSteps: 2,
+		},
+		{
+			name:      "step_status_outside_its_success_codes",
+			impl:      steps([]int{200}, ""),
+			wantErr:   "step create: http status 201 not in success set",
+			wantSteps: 1,
+		},
+		{
+			name: "reference_to_failed_step_stops_chain",
+			impl: func() spec.HTTPToolImpl {
+				impl := steps([]int{200}, "")
+				impl.Steps[0].Response.ErrorMode = "empty"
+				return impl
+			}(),
+			wantErr: "step status: urlTemplate expansion failed: http step variable is not available: " +
+				"create.id: step create did not succeed",
+			wantSteps: 1,
+		},
+		{
+			name: "reference_to_later_step_rejected",
+			impl: func() spec.HTTPToolImpl {
+				impl := steps(nil, "")
+				impl.Steps[0], impl.Steps[1] = impl.Steps[1], impl.Steps[0]
+				return impl
+			}(),
+			wantPutErr: `references step "create", which does not run before it`,
+		},
+		{
+			name: "reference_to_unextracted_var_rejected",
+			impl: func() spec.HTTPToolImpl {
+				impl := steps(nil, "")
+				impl.Steps[0].Extract = map[string]string{"jobID": "$.job.id"}
+				return impl
+			}(),
+			wantPutErr: `references "id", which step "create" does not extract`,
+		},
+		{
+			name:       "unknown_output_step_rejected",
+			impl:       steps(nil, "missing"),
+			wantPutErr: `outputStep "missing" is not a step`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Not parallel: the cases share the poll counter of the server.
+			mu.Lock()
+			polls = 0
+			mu.Unlock()
+
+			ts, err := NewToolStore(t.TempDir(), WithFTS(false))
+			if err != nil {
+				t.Fatalf("NewToolStore: %v", err)
+			}
+			defer ts.Close()
+
+			const (
+				bundleID = bundleitemutils.BundleID("bundle-steps")
+				toolSlug = bundleitemutils.ItemSlug("tool-steps")
+				version  = bundleitemutils.ItemVersion("v1")
+			)
+			putBundle(t, ts, bundleID, "bundle-steps", true)
+			_, err = ts.PutTool(t.Context(), &spec.PutToolRequest{
+				BundleID: bundleID,
+				ToolSlug: toolSlug,
+				Version:  version,
+				Body: &spec.PutToolRequestBody{
+					DisplayName:  "Tool steps",
+					IsEnabled:    true,
+					UserCallable: true,
+					LLMCallable:  true,
+					ArgSchema:    "{}",
+					Type:         spec.ToolTypeHTTP,
+					HTTPImpl:     &tc.impl,
+				},
+			})
+			if tc.wantPutErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantPutErr) {
+					t.Fatalf("PutTool err = %v, want %q", err, tc.wantPutErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PutTool: %v", err)
+			}
+
+			resp, err := ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
+				BundleID: bundleID,
+				ToolSlug: toolSlug,
+				Version:  version,
+				Body:     &spec.InvokeToolRequestBody{Args: `{"q":"hello"}`},
+			})
+			if err != nil {
+				t.Fatalf("InvokeTool: %v", err)
+			}
+			if tc.wantErr != "" {
+				if !resp.Body.IsError || !strings.Contains(resp.Body.ErrorMessage, tc.wantErr) {
+					t.Fatalf("IsError = %v, ErrorMessage = %q, want %q",
+						resp.Body.IsError, resp.Body.ErrorMessage, tc.wantErr)
+				}
+			} else {
+				if resp.Body.IsError {
+					t.Fatalf("unexpected IsError=true: %q", resp.Body.ErrorMessage)
+				}
+				if got := getOneTextOutput(t, resp.Body); got != tc.wantOut {
+					t.Fatalf("output = %q, want %q", got, tc.wantOut)
+				}
+			}
+			if got := len(resp.Body.Meta["steps"].([]map[string]any)); got != tc.wantSteps {
+				t.Fatalf("meta.steps has %d entries, want %d", got, tc.wantSteps)
+			}
+		})
+	}
+}
+
+func TestInvokeTool_RetryAndPagination(t *testing.T) {
+	t.Parallel()
+
+	// Items 1..5, two per page.
+	pageOf := func(page int) []int {
+		var items []int
+		for i := 2*page - 1; i <= min(2*page, 5); i++ {
+			items = append(items, i)
+		}
+		return items
+	}
+	var (
+		mu    sync.Mutex
+		calls = map[string]int{}
+	)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		n := calls[r.URL.Path]
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		case "/slow-down":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/link":
+			if page == 0 {
+				page = 1
+			}
+			if page < 3 {
+				w.Header().Set("Link", fmt.Sprintf(`</link?page=%d>; rel="next", </link?page=3>; rel="last"`, page+1))
+			}
+			_ = json.NewEncoder(w).Encode(pageOf(page))
+		case "/cursor":
+			page = 1
+			if after := r.URL.Query().Get("after"); after != "" {
+				page, _ = strconv.Atoi(strings.TrimPrefix(after, "c"))
+			}
+			next := ""
+			if page < 3 {
+				next = fmt.Sprintf("c%d", page+1)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"data": pageOf(page),
+				"meta": map[string]any{"next": next},
+			})
+		case "/pages":
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": pageOf(page)})
+		case "/pages0":
+			// Zero-based page numbers.
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": pageOf(page + 1)})
+		case "/drop":
+			// Lose the connection without a response.
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err == nil {
+				_ = conn.Close()
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+	zeroPage := 0
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		query     map[string]string
+		retry     *spec.HTTPRetryPolicy
+		paginate  *spec.HTTPPagination
+		wantOut   string
+		wantErr   string
+		wantCalls int
+		wantMeta  map[string]any
+	}{
+		{
+			name:      "retry_after_honoured_until_success",
+			path:      "/flaky",
+			retry:     &spec.HTTPRetryPolicy{MaxAttempts: 3, BaseDelayMs: 1},
+			wantOut:   `{"ok":true}`,
+			wantCalls: 3,
+			wantMeta:  map[string]any{"retries": 2},
+		},
+		{
+			name:      "retries_exhausted",
+			path:      "/flaky",
+			retry:     &spec.HTTPRetryPolicy{MaxAttempts: 2, BaseDelayMs: 1},
+			wantErr:   "http status 503 not in success set",
+			wantCalls: 2,
+		},
+		{
+			name:      "no_retry_policy_single_attempt",
+			path:      "/flaky",
+			wantErr:   "http status 503 not in success set",
+			wantCalls: 1,
+		},
+		{
+			name:      "retry_after_beyond_max_delay_not_waited_for",
+			path:      "/slow-down",
+			retry:     &spec.HTTPRetryPolicy{MaxAttempts: 3, MaxDelayMs: 1000},
+			wantErr:   "http status 429 not in success set",
+			wantCalls: 1,
+		},
+		{
+			name:      "transport_error_retried_for_get",
+			path:      "/drop",
+			retry:     &spec.HTTPRetryPolicy{MaxAttempts: 3, BaseDelayMs: 1},
+			wantErr:   "http.Do",
+			wantCalls: 3,
+		},
+		{
+			name:      "transport_error_not_retried_for_post",
+			method:    "POST",
+			path:      "/drop",
+			retry:     &spec.HTTPRetryPolicy{MaxAttempts: 3, BaseDelayMs: 1},
+			wantErr:   "http.Do",
+			wantCalls: 1,
+		},
+		{
+			name:      "transport_error_retried_for_post_when_opted_in",
+			method:    "POST",
+			path:      "/drop",
+			retry:     &spec.HTTPRetryPolicy{MaxAttempts: 3, BaseDelayMs: 1, RetryNonIdempotent: true},
+			wantErr:   "http.Do",
+			wantCalls: 3,
+		},
+		{
+			name:      "link_header_pages_merged",
+			path:      "/link",
+			paginate:  &spec.HTTPPagination{Type: spec.HTTPPaginationLinkHeader},
+			wantOut:   `[1,2,3,4,5]`,
+			wantCalls: 3,
+			wantMeta:  map[string]any{"pages": 3},
+		},
+		{
+			name: "cursor_pages_merged",
+			path: "/cursor",
+			paginate: &spec.HTTPPagination{
+				Type:        spec.HTTPPaginationCursor,
+				ItemsPath:   "$.data",
+				CursorPath:  "$.meta.next",
+				CursorParam: "after",
+			},
+			wantOut:   `[1,2,3,4,5]`,
+			wantCalls: 3,
+			wantMeta:  map[string]any{"pages": 3},
+		},
+		{
+			name:      "page_numbers_until_empty_page",
+			path:      "/pages",
+			paginate:  &spec.HTTPPagination{Type: spec.HTTPPaginationPage, ItemsPath: "data", PageParam: "page"},
+			wantOut:   `[1,2,3,4,5]`,
+			wantCalls: 4,
+			wantMeta:  map[string]any{"pages": 4},
+		},
+		{
+			name: "page_numbers_from_zero",
+			path: "/pages0",
+			paginate: &spec.HTTPPagination{
+				Type:      spec.HTTPPaginationPage,
+				ItemsPath: "data",
+				PageParam: "page",
+				StartPage: &zeroPage,
+			},
+			wantOut:   `[1,2,3,4,5]`,
+			wantCalls: 4,
+			wantMeta:  map[string]any{"pages": 4},
+		},
+		{
+			name:      "page_numbers_from_query_template",
+			path:      "/pages",
+			query:     map[string]string{"page": "2"},
+			paginate:  &spec.HTTPPagination{Type: spec.HTTPPaginationPage, ItemsPath: "data", PageParam: "page"},
+			wantOut:   `[3,4,5]`,
+			wantCalls: 3,
+			wantMeta:  map[string]any{"pages": 3},
+		},
+		{
+			name: "page_limit_truncates",
+			path: "/pages",
+			paginate: &spec.HTTPPagination{
+				Type:      spec.HTTPPaginationPage,
+				ItemsPath: "data",
+				PageParam: "page",
+				MaxPages:  2,
+			},
+			wantOut:   `[1,2,3,4]`,
+			wantCalls: 2,
+			wantMeta:  map[string]any{"pages": 2, "pagesTruncated": true},
+		},
+		{
+			name:      "byte_limit_truncates",
+			path:      "/link",
+			paginate:  &spec.HTTPPagination{Type: spec.HTTPPaginationLinkHeader, MaxBytes: 12},
+			wantOut:   `[1,2,3,4]`,
+			wantCalls: 3,
+			wantMeta:  map[string]any{"pages": 2, "pagesTruncated": true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Not parallel: the cases share the call counters of the server.
+			mu.Lock()
+			clear(calls)
+			mu.Unlock()
+
+			ts, err := NewToolStore(t.TempDir(), WithFTS(false))
+			if err != nil {
+				t.Fatalf("NewToolStore: %v", err)
+			}
+			defer ts.Close()
+
+			const (
+				bundleID = bundleitemutils.BundleID("bundle-retry")
+				toolSlug = bundleitemutils.ItemSlug("tool-retry")
+				version  = bundleitemutils.ItemVersion("v1")
+			)
+			putBundle(t, ts, bundleID, "bundle-retry", true)
+			impl := spec.HTTPToolImpl{
+				Request: spec.HTTPRequest{
+					Method:      cmp.Or(tc.method, "GET"),
+					URLTemplate: srv.URL + tc.path,
+					Query:       tc.query,
+					Retry:       tc.retry,
+					Pagination:  tc.paginate,
+				},
+				Response: spec.HTTPResponse{BodyOutputMode: spec.HTTPBodyOutputModeText},
+			}
+			if _, err := ts.PutTool(t.Context(), &spec.PutToolRequest{
+				BundleID: bundleID,
+				ToolSlug: toolSlug,
+				Version:  version,
+				Body: &spec.PutToolRequestBody{
+					DisplayName:  "Tool retry",
+					IsEnabled:    true,
+					UserCallable: true,
+					LLMCallable:  true,
+					ArgSchema:    "{}",
+					Type:         spec.ToolTypeHTTP,
+					HTTPImpl:     &impl,
+				},
+			}); err != nil {
+				t.Fatalf("PutTool: %v", err)
+			}
+
+			resp, err := ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
+				BundleID: bundleID,
+				ToolSlug: toolSlug,
+				Version:  version,
+				Body:     &spec.InvokeToolRequestBody{Args: `{}`},
+			})
+			if err != nil {
+				t.Fatalf("InvokeTool: %v", err)
+			}
+			if tc.wantErr != "" {
+				if !resp.Body.IsError || !strings.Contains(resp.Body.ErrorMessage, tc.wantErr) {
+					t.Fatalf("IsError = %v, ErrorMessage = %q, want %q",
+						resp.Body.IsError, resp.Body.ErrorMessage, tc.wantErr)
+				}
+			} else {
+				if resp.Body.IsError {
+					t.Fatalf("unexpected IsError=true: %q", resp.Body.ErrorMessage)
+				}
+				if got := strings.TrimSpace(getOneTextOutput(t, resp.Body)); got != tc.wantOut {
+					t.Fatalf("output = %q, want %q", got, tc.wantOut)
+				}
+			}
+			mu.Lock()
+			gotCalls := calls[tc.path]
+			mu.Unlock()
+			if gotCalls != tc.wantCalls {
+				t.Fatalf("server calls = %d, want %d", gotCalls, tc.wantCalls)
+			}
+			for k, want := range tc.wantMeta {
+				if got := resp.Body.Meta[k]; got != want {
+					t.Fatalf("meta[%s] = %v, want %v", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInvokeTool_Exec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("exec cases use /bin/sh")
+	}
+	t.Parallel()
+
+	outside := t.TempDir()
+	sh := func(workDir, script string, args ...string) spec.ExecToolImpl {
+		return spec.ExecToolImpl{
+			Command:  "/bin/sh",
+			Args:     append([]string{"-c", script, "sh"}, args...),
+			ArgsMode: spec.ExecArgsModeArgv,
+			WorkDir:  workDir,
+		}
+	}
+	tests := []struct {
+		name       string
+		mkImpl     func(workDir string) spec.ExecToolImpl
+		args       string
+		wantPutErr string
+		wantErr    string
+		wantOut    string
+		wantMeta   map[string]any
+		maxElapsed time.Duration
+	}{
+		{
+			name: "json_args_on_stdin_and_json_output",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				return spec.ExecToolImpl{
+					Command:        "cat",
+					WorkDir:        workDir,
+					OutputEncoding: spec.JSONEncoding,
+				}
+			},
+			args:     `{"q": "hi", "n": 2}`,
+			wantOut:  `{"q":"hi","n":2}`,
+			wantMeta: map[string]any{"type": "exec", "exitCode": 0, "stderr": ""},
+		},
+		{
+			name: "argv_templating_spreads_arrays_and_drops_unset",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				return sh(workDir, `printf '%s|' "$@"`, "--name=${q}", "${files}", "${missing}")
+			},
+			args:    `{"q":"hi","files":["a","b"]}`,
+			wantOut: "--name=hi|a|b|",
+		},
+		{
+			name: "argv_value_may_not_become_an_option",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				return sh(workDir, `printf '%s|' "$@"`, "${q}")
+			},
+			args:    `{"q":"--output=/tmp/x"}`,
+			wantErr: `argument value "--output=/tmp/x" may not start with '-'`,
+		},
+		{
+			name: "argv_array_value_may_not_become_an_option",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				return sh(workDir, `printf '%s|' "$@"`, "${files}")
+			},
+			args:    `{"files":["a","-rf"]}`,
+			wantErr: `argument value "-rf" may not start with '-'`,
+		},
+		{
+			name: "argv_dash_values_allowed_after_end_of_options",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				return sh(workDir, `printf '%s|' "$@"`, "--flag=${q}", "--", "${q}", "${files}")
+			},
+			args:    `{"q":"-x","files":["-y"]}`,
+			wantOut: "--flag=-x|--|-x|-y|",
+		},
+		{
+			name: "environment_allowlist",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				impl := sh(workDir, `printf '%s|%s' "$FOO" "$HOME"`)
+				impl.Env = map[string]string{"FOO": "x"}
+				impl.EnvAllowlist = []string{"PATH"}
+				return impl
+			},
+			args:    `{}`,
+			wantOut: "x|",
+		},
+		{
+			name: "exit_code_and_stderr_in_meta",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				return sh(workDir, `echo partial; echo oops >&2; exit 3`)
+			},
+			args:     `{}`,
+			wantErr:  "exited with code 3: oops",
+			wantMeta: map[string]any{"exitCode": 3, "stderr": "oops\n"},
+		},
+		{
+			name: "custom_success_exit_codes",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				impl := sh(workDir, `printf 'no match'; exit 1`)
+				impl.SuccessExitCodes = []int{0, 1}
+				return impl
+			},
+			args:     `{}`,
+			wantOut:  "no match",
+			wantMeta: map[string]any{"exitCode": 1},
+		},
+		{
+			name: "stdout_capped",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				impl := sh(workDir, `printf 0123456789`)
+				impl.MaxOutputBytes = 4
+				return impl
+			},
+			args:     `{}`,
+			wantOut:  "0123\n\n[truncated: showing 4 of 10 bytes]",
+			wantMeta: map[string]any{"stdoutTruncated": true},
+		},
+		{
+			name: "timeout_kills_process_group",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				// Without the group kill the background sleep would hold stdout open past the wait delay.
+				impl := sh(workDir, `sleep 30 & wait`)
+				impl.TimeoutMs = 200
+				return impl
+			},
+			args:       `{}`,
+			wantErr:    "timed out after 200 ms",
+			wantMeta:   map[string]any{"timedOut": true},
+			maxElapsed: 1500 * time.Millisecond,
+		},
+		{
+			name: "path_arg_inside_work_dir",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				impl := sh(workDir, `cat "$1"`, "${file}")
+				impl.PathArgs = []string{"file"}
+				return impl
+			},
+			args:    `{"file":"notes.txt"}`,
+			wantOut: "notes",
+		},
+		{
+			name: "path_arg_escaping_work_dir",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				impl := sh(workDir, `cat "$1"`, "${file}")
+				impl.PathArgs = []string{"file"}
+				return impl
+			},
+			args:    `{"file":"../secret.txt"}`,
+			wantErr: "outside the working directory",
+		},
+		{
+			name: "path_arg_escaping_through_symlink",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				impl := spec.ExecToolImpl{Command: "cat", WorkDir: workDir, PathArgs: []string{"file"}}
+				return impl
+			},
+			args:    `{"file":"out/secret.txt"}`,
+			wantErr: "outside the working directory",
+		},
+		{
+			name: "relative_work_dir_rejected",
+			mkImpl: func(string) spec.ExecToolImpl {
+				return spec.ExecToolImpl{Command: "cat", WorkDir: "scripts"}
+			},
+			wantPutErr: "workDir must be an absolute path",
+		},
+		{
+			name: "relative_command_outside_work_dir_rejected",
+			mkImpl: func(workDir string) spec.ExecToolImpl {
+				return spec.ExecToolImpl{Command: "../bin/tool", WorkDir: workDir}
+			},
+			wantPutErr: "outside the working directory",
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
+			workDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(workDir, "notes.txt"), []byte("notes"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink(outside, filepath.Join(workDir, "out")); err != nil {
+				t.Fatal(err)
+			}
 
-			// Test HTTP server for this case.
-			srv := httptest.NewServer(http.HandlerFunc(tc.handler))
-			defer srv.Close()
-
-			baseDir := t.TempDir()
-			ts, err := NewToolStore(baseDir, WithFTS(false))
+			ts, err := NewToolStore(t.TempDir(), WithFTS(false))
 			if err != nil {
 				t.Fatalf("NewToolStore: %v", err)
 			}
 			defer ts.Close()
 
-			// Create bundle and tool.
 			const (
-				bundleID   = bundleitemutils.BundleID("bundle-1")
-				bundleSlug = bundleitemutils.BundleSlug("bundle1")
-				toolSlug   = bundleitemutils.ItemSlug("tool1")
-				version    = bundleitemutils.ItemVersion("v1")
+				bundleID = bundleitemutils.BundleID("bundle-exec")
+				toolSlug = bundleitemutils.ItemSlug("tool-exec")
+				version  = bundleitemutils.ItemVersion("v1")
 			)
-
-			if _, err := ts.PutToolBundle(t.Context(), &spec.PutToolBundleRequest{
-				BundleID: bundleID,
-				Body: &spec.PutToolBundleRequestBody{
-					Slug:        bundleSlug,
-					DisplayName: "Bundle 1",
-					IsEnabled:   true,
-					Description: "test bundle",
-				},
-			}); err != nil {
-				t.Fatalf("PutToolBundle: %v", err)
-			}
-
-			// Tool (HTTP-only custom tools).
-			impl := tc.mkTool(srv.URL)
-			if _, err := ts.PutTool(t.Context(), &spec.PutToolRequest{
+			putBundle(t, ts, bundleID, "bundle-exec", true)
+			impl := tc.mkImpl(workDir)
+			_, err = ts.PutTool(t.Context(), &spec.PutToolRequest{
 				BundleID: bundleID,
 				ToolSlug: toolSlug,
 				Version:  version,
 				Body: &spec.PutToolRequestBody{
-					DisplayName:  "Tool 1",
-					Description:  "test tool",
+					DisplayName:  "Tool exec",
+					IsEnabled:    true,
 					UserCallable: true,
 					LLMCallable:  true,
-
-					Tags:      []string{"t"},
-					IsEnabled: true,
-					ArgSchema: "{}",
-					Type:      spec.ToolTypeHTTP,
-					HTTPImpl:  &impl,
+					ArgSchema:    "{}",
+					Type:         spec.ToolTypeExec,
+					ExecImpl:     &impl,
 				},
-			}); err != nil {
-				t.Fatalf("PutTool: %v", err)
-			}
-
-			// Optional: disable bundle or tool prior to invocation.
-			if tc.disableBundle {
-				if _, err := ts.PatchToolBundle(t.Context(), &spec.PatchToolBundleRequest{
-					BundleID: bundleID,
-					Body:     &spec.PatchToolBundleRequestBody{IsEnabled: false},
-				}); err != nil {
-					t.Fatalf("PatchToolBundle: %v", err)
+			})
+			if tc.wantPutErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantPutErr) {
+					t.Fatalf("PutTool err = %v, want %q", err, tc.wantPutErr)
 				}
+				return
 			}
-			if tc.disableTool {
-				if _, err := ts.PatchTool(t.Context(), &spec.PatchToolRequest{
-					BundleID: bundleID,
-					ToolSlug: toolSlug,
-					Version:  version,
-					Body:     &spec.PatchToolRequestBody{IsEnabled: false},
-				}); err != nil {
-					t.Fatalf("PatchTool: %v", err)
-				}
+			if err != nil {
+				t.Fatalf("PutTool: %v", err)
 			}
 
+			start := time.Now()
 			resp, err := ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
 				BundleID: bundleID,
 				ToolSlug: toolSlug,
 				Version:  version,
-				Body: &spec.InvokeToolRequestBody{
-					Args:        tc.args,
-					HTTPOptions: tc.httpOptions,
-				},
+				Body:     &spec.InvokeToolRequestBody{Args: tc.args},
 			})
-
-			if tc.wantErrIs != nil {
-				if !errors.Is(err, tc.wantErrIs) {
-					t.Fatalf("InvokeTool error = %v, want errors.Is(..., %v)", err, tc.wantErrIs)
-				}
-				return
-			}
-
-			if tc.verify != nil {
-				tc.verify(t, resp, err)
-				return
-			}
-
 			if err != nil {
-				t.Fatalf("InvokeTool error: %v", err)
-			}
-			if resp == nil || resp.Body == nil {
-				t.Fatalf("nil response/body")
+				t.Fatalf("InvokeTool: %v", err)
 			}
-			if resp.Body.IsError {
-				t.Fatalf("expected IsError=false, got true (ErrorMessage=%q)", resp.Body.ErrorMessage)
+			if tc.maxElapsed > 0 && time.Since(start) > tc.maxElapsed {
+				t.Fatalf("InvokeTool took %v, want at most %v", time.Since(start), tc.maxElapsed)
 			}
-			if resp.Body.Meta == nil {
-				t.Fatalf("meta is nil")
+			if tc.wantErr != "" {
+				if !resp.Body.IsError || !strings.Contains(resp.Body.ErrorMessage, tc.wantErr) {
+					t.Fatalf("IsError = %v, ErrorMessage = %q, want %q",
+						resp.Body.IsError, resp.Body.ErrorMessage, tc.wantErr)
+				}
+			} else {
+				if resp.Body.IsError {
+					t.Fatalf("unexpected IsError=true: %q", resp.Body.ErrorMessage)
+				}
+				if got := getOneTextOutput(t, resp.Body); got != tc.wantOut {
+					t.Fatalf("output = %q, want %q", got, tc.wantOut)
+				}
 			}
-			if typ, _ := resp.Body.Meta["type"].(string); typ != string(spec.ToolTypeHTTP) {
-				t.Fatalf("meta.type = %v, want http", typ)
+			for k, want := range tc.wantMeta {
+				if got := resp.Body.Meta[k]; got != want {
+					t.Fatalf("meta[%s] = %v, want %v", k, got, want)
+				}
 			}
 		})
 	}
 }
 
-func TestInvokeTool_InvalidRequest(t *testing.T) {
-	t.Parallel()
-
-	baseDir := t.TempDir()
-	ts, err := NewToolStore(baseDir, WithFTS(false))
-	if err != nil {
-		t.Fatalf("NewToolStore: %v", err)
-	}
-	defer ts.Close()
-
-	// Missing required fields.
-	_, err = ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
-		BundleID: "",
-		ToolSlug: "",
-		Version:  "",
-		Body:     &spec.InvokeToolRequestBody{Args: "{}"},
-	})
-	if !errors.Is(err, spec.ErrInvalidRequest) {
-		t.Fatalf("err = %v, want ErrInvalidRequest", err)
-	}
-}
-
-func TestInvokeTool_RequestBodyTemplating_PathQueryHeaderAuth(t *testing.T) {
-	t.Parallel()
-
-	// Handler asserts templated values for path, query, header, and Authorization.
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		// Path element is last segment.
-		gotID := path.Base(r.URL.Path)
-		if gotID == "" {
-			t.Fatalf("empty path base")
-		}
-		qv := r.URL.Query().Get("id")
-		if qv == "" {
-			t.Fatalf("missing query 'id'")
-		}
-		auth := r.Header.Get("Authorization")
-		if !strings.HasPrefix(auth, "Bearer ") {
-			t.Fatalf("Authorization header unexpected: %q", auth)
-		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{
-			"pathID":  gotID,
-			"queryID": qv,
-			"auth":    auth,
-		})
-	}
-
-	srv := httptest.NewServer(http.HandlerFunc(handler))
-	defer srv.Close()
-
-	baseDir := t.TempDir()
-	ts, err := NewToolStore(baseDir, WithFTS(false))
-	if err != nil {
-		t.Fatalf("NewToolStore: %v", err)
-	}
-	defer ts.Close()
-
-	const (
-		bundleID   = bundleitemutils.BundleID("bundle-2")
-		bundleSlug = bundleitemutils.BundleSlug("bundle2")
-		toolSlug   = bundleitemutils.ItemSlug("tool2")
-		version    = bundleitemutils.ItemVersion("v1")
-	)
-
-	_, err = ts.PutToolBundle(t.Context(), &spec.PutToolBundleRequest{
-		BundleID: bundleID,
-		Body: &spec.PutToolBundleRequestBody{
-			Slug:        bundleSlug,
-			DisplayName: "Bundle 2",
-			IsEnabled:   true,
-		},
-	})
-	if err != nil {
-		t.Fatalf("PutToolBundle: %v", err)
-	}
-
-	impl := spec.HTTPToolImpl{
-		Request: spec.HTTPRequest{
-			Method:      "GET",
-			URLTemplate: srv.URL + "/items/${id}",
-			Query:       map[string]string{"id": "${id}"},
-			Headers:     map[string]string{"X-Trace": "${id}"},
-			Auth: &spec.HTTPAuth{
-				Type:          "bearer",
-				ValueTemplate: "${SECRET}",
-			},
-		},
-		Response: spec.HTTPResponse{},
-	}
-
-	_, err = ts.PutTool(t.Context(), &spec.PutToolRequest{
-		BundleID: bundleID,
-		ToolSlug: toolSlug,
-		Version:  version,
-		Body: &spec.PutToolRequestBody{
-			DisplayName:  "Tool 2",
-			IsEnabled:    true,
-			UserCallable: true,
-			LLMCallable:  true,
-
-			ArgSchema: "{}",
-			Type:      spec.ToolTypeHTTP,
-			HTTPImpl:  &impl,
-		},
-	})
-	if err != nil {
-		t.Fatalf("PutTool: %v", err)
-	}
-
-	resp, err := ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
-		BundleID: bundleID,
-		ToolSlug: toolSlug,
-		Version:  version,
-		Body: &spec.InvokeToolRequestBody{
-			Args:        `{"id":"42"}`,
-			HTTPOptions: &spec.InvokeHTTPOptions{Secrets: map[string]string{"SECRET": "abc123"}},
-		},
-	})
-	if err != nil {
-		t.Fatalf("InvokeTool: %v", err)
-	}
-	if resp == nil || resp.Body == nil {
-		t.Fatalf("nil response/body")
-	}
-	if resp.Body.IsError {
-		t.Fatalf("expected IsError=false, got true (ErrorMessage=%q)", resp.Body.ErrorMessage)
-	}
-
-	var got map[string]any
-	textOut := getOneTextOutput(t, resp.Body)
-	if err := json.Unmarshal([]byte(textOut), &got); err != nil {
-		t.Fatalf("unmarshal output: %v; raw: %q", err, textOut)
-	}
-	if got["pathID"] != "42" || got["queryID"] != "42" {
-		t.Fatalf("templating mismatch: got=%v", got)
-	}
-	if a, _ := got["auth"].(string); a != "Bearer abc123" {
-		t.Fatalf("auth = %v, want 'Bearer abc123'", got["auth"])
-	}
-}
-
 // TestInvokeTool_Go_CustomRegistered covers invoking user-created Go tools
 // by directly inserting Tool records (type=go) into the directory-store.
-// We bypass PutTool because it only accepts custom HTTP tools.
+// We bypass PutTool because it only accepts custom HTTP and exec tools.
 func TestInvokeGoCustomRegistered(t *testing.T) {
 	t.Parallel()
 
@@ -1403,6 +2885,24 @@ func addGoToolFile(
 	)
 }
 
+func verifyDestinationDenied(t *testing.T, resp *spec.InvokeToolResponse, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("InvokeTool error: %v", err)
+	}
+	if !resp.Body.IsError || resp.Body.ErrorCode != spec.ToolErrorCodeDestinationDenied {
+		t.Fatalf("IsError = %v, ErrorCode = %q, ErrorMessage = %q",
+			resp.Body.IsError, resp.Body.ErrorCode, resp.Body.ErrorMessage)
+	}
+}
+
+func itemsJSONHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"data":{"items":[` +
+		`{"id":1,"name":"a","extra":"x","owner":{"login":"u1"}},` +
+		`{"id":2,"name":"b","owner":{"login":"u2"}}]}}`))
+}
+
 func putBundle(
 	t *testing.T,
 	ts *ToolStore,
@@ -0,0 +1,288 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
+	"github.com/flexigpt/flexigpt-app/internal/tool/mcpclient"
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+const (
+	mcpToolTag = "mcp"
+	// mcpListWait bounds how long listing tools waits for MCP servers that are not running yet.
+	mcpListWait = 3 * time.Second
+)
+
+// GetMCPServerStatus reports the runtime state of the server of an MCP bundle.
+func (ts *ToolStore) GetMCPServerStatus(
+	ctx context.Context, req *spec.GetMCPServerStatusRequest,
+) (*spec.GetMCPServerStatusResponse, error) {
+	if req == nil || req.BundleID == "" {
+		return nil, fmt.Errorf("%w: bundleID required", spec.ErrInvalidRequest)
+	}
+	b, err := ts.getMCPBundle(req.BundleID)
+	if err != nil {
+		return nil, err
+	}
+	st := ts.mcp.Status(string(b.ID))
+	st.BundleID = b.ID
+	return &spec.GetMCPServerStatusResponse{Body: &st}, nil
+}
+
+// RestartMCPServer stops the server of an MCP bundle and starts it again, rediscovering its tools.
+func (ts *ToolStore) RestartMCPServer(
+	ctx context.Context, req *spec.RestartMCPServerRequest,
+) (*spec.RestartMCPServerResponse, error) {
+	if req == nil || req.BundleID == "" {
+		return nil, fmt.Errorf("%w: bundleID required", spec.ErrInvalidRequest)
+	}
+	b, err := ts.getMCPBundle(req.BundleID)
+	if err != nil {
+		return nil, err
+	}
+	if !b.IsEnabled {
+		return nil, fmt.Errorf("%w: %s", spec.ErrBundleDisabled, b.ID)
+	}
+	if err := ts.mcp.Restart(ctx, string(b.ID), b.MCPServer); err != nil {
+		return nil, err
+	}
+	slog.Info("restartMCPServer", "bundleID", b.ID)
+	st := ts.mcp.Status(string(b.ID))
+	st.BundleID = b.ID
+	return &spec.RestartMCPServerResponse{Body: &st}, nil
+}
+
+func (ts *ToolStore) getMCPBundle(id bundleitemutils.BundleID) (spec.ToolBundle, error) {
+	b, err := ts.getUserBundle(id)
+	if err != nil {
+		return b, err
+	}
+	if b.MCPServer == nil {
+		return b, fmt.Errorf("%w: %s", spec.ErrNotMCPBundle, id)
+	}
+	return b, nil
+}
+
+// mcpTools returns the tools of the server of an MCP bundle, starting the server if needed.
+func (ts *ToolStore) mcpTools(ctx context.Context, b spec.ToolBundle) ([]spec.Tool, error) {
+	listed, err := ts.mcp.Tools(ctx, string(b.ID), b.MCPServer)
+	if err != nil {
+		return nil, err
+	}
+	return mcpBundleTools(b, listed), nil
+}
+
+// mcpBundleTools maps the tools listed by the server of an MCP bundle into tools of the bundle. Tools that cannot be
+// mapped are skipped.
+func mcpBundleTools(b spec.ToolBundle, listed []mcpclient.Tool) []spec.Tool {
+	tools := make([]spec.Tool, 0, len(listed))
+	seen := map[bundleitemutils.ItemSlug]string{}
+	for _, lt := range listed {
+		t, err := mcpTool(b, lt)
+		if err != nil {
+			slog.Warn("skipping mcp tool", "bundleID", b.ID, "tool", lt.Name, "err", err)
+			continue
+		}
+		if prev, dup := seen[t.Slug]; dup {
+			slog.Warn("skipping mcp tool with duplicate slug",
+				"bundleID", b.ID, "tool", lt.Name, "slug", t.Slug, "other", prev)
+			continue
+		}
+		seen[t.Slug] = lt.Name
+		tools = append(tools, t)
+	}
+	return tools
+}
+
+// getMCPTool finds a tool of an enabled MCP bundle by slug and version.
+func (ts *ToolStore) getMCPTool(
+	ctx context.Context,
+	b spec.ToolBundle,
+	slug bundleitemutils.ItemSlug,
+	version bundleitemutils.ItemVersion,
+) (*spec.Tool, error) {
+	if !b.IsEnabled {
+		// Disabled bundles do not start their server.
+		return nil, fmt.Errorf("%w: %s", spec.ErrBundleDisabled, b.ID)
+	}
+	tools, err := ts.mcpTools(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tools {
+		if tools[i].Slug == slug && tools[i].Version == version {
+			return &tools[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", spec.ErrToolNotFound, slug)
+}
+
+// listMCPTools returns the tools of enabled MCP bundles that pass include, sorted by bundle ID. Servers that are not
+// running are started in the background and waited for at most mcpListWait in total; servers that are still starting
+// or cannot be started are skipped, so that one slow or broken server does not hold up or hide all tools.
+func (ts *ToolStore) listMCPTools(
+	ctx context.Context,
+	bundles map[bundleitemutils.BundleID]spec.ToolBundle,
+	include func(bundleitemutils.BundleID, *spec.Tool) bool,
+) []spec.ToolListItem {
+	ids := make([]bundleitemutils.BundleID, 0)
+	servers := map[string]*spec.MCPServerConfig{}
+	for id, b := range bundles {
+		if b.MCPServer != nil && b.IsEnabled && !isSoftDeletedTool(b) {
+			ids = append(ids, id)
+			servers[string(id)] = b.MCPServer
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	slices.Sort(ids)
+	listed := ts.mcp.StartedTools(ctx, servers, mcpListWait)
+
+	var out []spec.ToolListItem
+	for _, id := range ids {
+		b := bundles[id]
+		lts, ok := listed[string(id)]
+		if !ok {
+			slog.Warn("skipping tools of mcp server that is not running", "bundleID", id,
+				"lastError", ts.mcp.Status(string(id)).LastError)
+			continue
+		}
+		tools := mcpBundleTools(b, lts)
+		for i := range tools {
+			if !include(id, &tools[i]) {
+				continue
+			}
+			out = append(out, spec.ToolListItem{
+				BundleID:       id,
+				BundleSlug:     b.Slug,
+				ToolSlug:       tools[i].Slug,
+				ToolVersion:    tools[i].Version,
+				IsBuiltIn:      false,
+				ToolDefinition: tools[i],
+			})
+		}
+	}
+	return out
+}
+
+// invokeMCPTool calls a tool on the server of its bundle. Errors reported by the tool are returned as errors together
+// with the outputs, like runner errors of other tool types.
+func (ts *ToolStore) invokeMCPTool(
+	ctx context.Context,
+	b spec.ToolBundle,
+	tool *spec.Tool,
+	args []byte,
+	opts *spec.InvokeMCPOptions,
+) ([]spec.ToolStoreOutputUnion, map[string]any, error) {
+	if b.MCPServer == nil {
+		return nil, nil, fmt.Errorf("%w: %s", spec.ErrNotMCPBundle, b.ID)
+	}
+	timeoutMs := b.MCPServer.TimeoutMs
+	if opts != nil && opts.TimeoutMs > 0 {
+		timeoutMs = opts.TimeoutMs
+	}
+	if timeoutMs <= 0 {
+		timeoutMs = spec.DefaultMCPCallTimeoutMs
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+
+	md := map[string]any{
+		"type":     "mcp",
+		"toolName": tool.MCPImpl.ToolName,
+	}
+	start := time.Now()
+	res, err := ts.mcp.CallTool(ctx, string(b.ID), b.MCPServer, tool.MCPImpl.ToolName, args)
+	md["durationMs"] = time.Since(start).Milliseconds()
+	if err != nil {
+		return nil, md, err
+	}
+	outputs := mcpclient.Outputs(res)
+	if res.IsError {
+		return outputs, md, errors.New(mcpclient.ErrorText(res))
+	}
+	return outputs, md, nil
+}
+
+// mcpTool maps a listed MCP tool into a tool of the bundle. Tools of MCP bundles are callable by users and models
+// and enabled together with their bundle.
+func mcpTool(b spec.ToolBundle, lt mcpclient.Tool) (spec.Tool, error) {
+	slug := mcpToolSlug(lt.Name)
+	if err := bundleitemutils.ValidateItemSlug(slug); err != nil {
+		return spec.Tool{}, err
+	}
+	argSchema := lt.InputSchema
+	if len(argSchema) == 0 {
+		argSchema = spec.JSONSchema(`{"type":"object"}`)
+	}
+	displayName := lt.Title
+	if strings.TrimSpace(displayName) == "" {
+		displayName = lt.Name
+	}
+	t := spec.Tool{
+		SchemaVersion: spec.SchemaVersion,
+		ID:            bundleitemutils.ItemID(string(b.ID) + "-" + string(slug)),
+		Slug:          slug,
+		Version:       spec.MCPToolVersion,
+		DisplayName:   displayName,
+		Description:   lt.Description,
+		Tags:          []string{mcpToolTag},
+		UserCallable:  true,
+		LLMCallable:   true,
+		ArgSchema:     argSchema,
+		LLMToolType:   spec.ToolStoreChoiceTypeFunction,
+		Type:          spec.ToolTypeMCP,
+		MCPImpl:       &spec.MCPToolImpl{ToolName: lt.Name},
+		IsEnabled:     true,
+		CreatedAt:     b.ModifiedAt,
+		ModifiedAt:    b.ModifiedAt,
+	}
+	return t, validateTool(&t)
+}
+
+// mcpToolSlug maps an MCP tool name to a slug by replacing runes slugs do not allow with dashes.
+func mcpToolSlug(name string) bundleitemutils.ItemSlug {
+	slug := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			return r
+		}
+		return '-'
+	}, name)
+	return bundleitemutils.ItemSlug(slug)
+}
+
+func validateMCPServerConfig(cfg *spec.MCPServerConfig) error {
+	if cfg.TimeoutMs < 0 {
+		return errors.New("mcpServer.timeoutMs must not be negative")
+	}
+	switch cfg.Transport {
+	case spec.MCPTransportStdio:
+		if strings.TrimSpace(cfg.Command) == "" {
+			return errors.New("mcpServer.command is required for transport 'stdio'")
+		}
+		if cfg.URL != "" {
+			return errors.New("mcpServer.url must be unset for transport 'stdio'")
+		}
+	case spec.MCPTransportStreamableHTTP:
+		u, err := url.Parse(cfg.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("mcpServer.url %q is not an http(s) URL", cfg.URL)
+		}
+		if cfg.Command != "" {
+			return errors.New("mcpServer.command must be unset for transport 'streamableHTTP'")
+		}
+	default:
+		return fmt.Errorf("invalid mcpServer.transport %q", cfg.Transport)
+	}
+	return nil
+}
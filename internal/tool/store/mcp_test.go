@@ -0,0 +1,226 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+// mcpStubHandler is a streamable HTTP MCP server with an echo_text tool and a fail tool.
+func mcpStubHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				Text string `json:"text"`
+			} `json:"arguments"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil || msg.ID == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	var result any
+	switch msg.Method {
+	case "initialize":
+		result = map[string]any{
+			"protocolVersion": "2025-06-18",
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "stub", "version": "1.0.0"},
+		}
+	case "tools/list":
+		result = map[string]any{"tools": []map[string]any{
+			{
+				"name":        "echo_text",
+				"title":       "Echo",
+				"inputSchema": map[string]any{"type": "object"},
+			},
+			{"name": "fail", "inputSchema": map[string]any{"type": "object"}},
+		}}
+	case "tools/call":
+		if msg.Params.Name == "fail" {
+			result = map[string]any{"content": []map[string]any{{"type": "text", "text": "boom"}}, "isError": true}
+		} else {
+			result = map[string]any{"content": []map[string]any{{"type": "text", "text": msg.Params.Arguments.Text}}}
+		}
+	default:
+		result = map[string]any{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+}
+
+func TestMCPBundle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(mcpStubHandler))
+	defer srv.Close()
+
+	ts, err := NewToolStore(t.TempDir(), WithFTS(false))
+	if err != nil {
+		t.Fatalf("NewToolStore: %v", err)
+	}
+	defer ts.Close()
+
+	const bundleID bundleitemutils.BundleID = "mcp-bundle"
+	putMCPBundle := func(cfg *spec.MCPServerConfig) error {
+		_, err := ts.PutToolBundle(t.Context(), &spec.PutToolBundleRequest{
+			BundleID: bundleID,
+			Body: &spec.PutToolBundleRequestBody{
+				Slug:        "mcp",
+				DisplayName: "MCP",
+				IsEnabled:   true,
+				MCPServer:   cfg,
+			},
+		})
+		return err
+	}
+	if err := putMCPBundle(&spec.MCPServerConfig{Transport: spec.MCPTransportStdio}); err == nil {
+		t.Fatal("expected an invalid server config to be rejected")
+	}
+	if err := putMCPBundle(&spec.MCPServerConfig{
+		Transport: spec.MCPTransportStreamableHTTP,
+		URL:       srv.URL,
+	}); err != nil {
+		t.Fatalf("PutToolBundle: %v", err)
+	}
+
+	list, err := ts.ListTools(t.Context(), &spec.ListToolsRequest{BundleIDs: []bundleitemutils.BundleID{bundleID}})
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	items := list.Body.ToolListItems
+	if len(items) != 2 || items[0].ToolSlug != "echo-text" || items[0].ToolVersion != spec.MCPToolVersion ||
+		items[0].ToolDefinition.DisplayName != "Echo" || items[0].ToolDefinition.Type != spec.ToolTypeMCP {
+		t.Fatalf("list items = %+v", items)
+	}
+
+	got, err := ts.GetTool(t.Context(), &spec.GetToolRequest{
+		BundleID: bundleID, ToolSlug: "echo-text", Version: spec.MCPToolVersion,
+	})
+	if err != nil {
+		t.Fatalf("GetTool: %v", err)
+	}
+	if got.Body.MCPImpl == nil || got.Body.MCPImpl.ToolName != "echo_text" {
+		t.Fatalf("tool = %+v", got.Body)
+	}
+
+	resp, err := ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
+		BundleID: bundleID, ToolSlug: "echo-text", Version: spec.MCPToolVersion,
+		Body: &spec.InvokeToolRequestBody{Args: `{"text":"hello"}`},
+	})
+	if err != nil {
+		t.Fatalf("InvokeTool: %v", err)
+	}
+	if text := getOneTextOutput(t, resp.Body); text != "hello" || resp.Body.IsError {
+		t.Fatalf("invoke = %+v", resp.Body)
+	}
+	if typ := resp.Body.Meta["type"]; typ != "mcp" {
+		t.Errorf("meta.type = %v, want mcp", typ)
+	}
+
+	resp, err = ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
+		BundleID: bundleID, ToolSlug: "fail", Version: spec.MCPToolVersion,
+		Body: &spec.InvokeToolRequestBody{Args: `{}`},
+	})
+	if err != nil {
+		t.Fatalf("InvokeTool: %v", err)
+	}
+	if !resp.Body.IsError || resp.Body.ErrorMessage != "boom" {
+		t.Errorf("invoke fail = %+v", resp.Body)
+	}
+
+	_, err = ts.PutTool(t.Context(), &spec.PutToolRequest{
+		BundleID: bundleID, ToolSlug: "other", Version: "v1",
+		Body: &spec.PutToolRequestBody{
+			DisplayName:  "Other",
+			IsEnabled:    true,
+			UserCallable: true,
+			ArgSchema:    `{"type":"object"}`,
+			Type:         spec.ToolTypeHTTP,
+		},
+	})
+	if !errors.Is(err, spec.ErrMCPToolsReadOnly) {
+		t.Errorf("PutTool err = %v, want ErrMCPToolsReadOnly", err)
+	}
+
+	st, err := ts.GetMCPServerStatus(t.Context(), &spec.GetMCPServerStatusRequest{BundleID: bundleID})
+	if err != nil {
+		t.Fatalf("GetMCPServerStatus: %v", err)
+	}
+	if st.Body.State != spec.MCPServerStateRunning || st.Body.ServerName != "stub" || st.Body.ToolCount != 2 {
+		t.Errorf("status = %+v", st.Body)
+	}
+
+	// Disabling the bundle stops its server and hides its tools.
+	if _, err := ts.PatchToolBundle(t.Context(), &spec.PatchToolBundleRequest{
+		BundleID: bundleID, Body: &spec.PatchToolBundleRequestBody{IsEnabled: false},
+	}); err != nil {
+		t.Fatalf("PatchToolBundle: %v", err)
+	}
+	st, err = ts.GetMCPServerStatus(t.Context(), &spec.GetMCPServerStatusRequest{BundleID: bundleID})
+	if err != nil {
+		t.Fatalf("GetMCPServerStatus: %v", err)
+	}
+	if st.Body.State != spec.MCPServerStateStopped {
+		t.Errorf("status after disable = %+v", st.Body)
+	}
+	if _, err := ts.GetTool(t.Context(), &spec.GetToolRequest{
+		BundleID: bundleID, ToolSlug: "echo-text", Version: spec.MCPToolVersion,
+	}); !errors.Is(err, spec.ErrBundleDisabled) {
+		t.Errorf("GetTool on disabled bundle err = %v", err)
+	}
+	if _, err := ts.RestartMCPServer(t.Context(), &spec.RestartMCPServerRequest{
+		BundleID: bundleID,
+	}); !errors.Is(err, spec.ErrBundleDisabled) {
+		t.Errorf("RestartMCPServer on disabled bundle err = %v", err)
+	}
+
+	putBundle(t, ts, "plain", "plain", true)
+	if _, err := ts.GetMCPServerStatus(t.Context(), &spec.GetMCPServerStatusRequest{
+		BundleID: "plain",
+	}); !errors.Is(err, spec.ErrNotMCPBundle) {
+		t.Errorf("GetMCPServerStatus on plain bundle err = %v", err)
+	}
+}
+
+func TestValidateMCPServerConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     spec.MCPServerConfig
+		wantErr bool
+	}{
+		{"stdio", spec.MCPServerConfig{Transport: spec.MCPTransportStdio, Command: "server"}, false},
+		{"stdio without command", spec.MCPServerConfig{Transport: spec.MCPTransportStdio}, true},
+		{
+			"stdio with url",
+			spec.MCPServerConfig{Transport: spec.MCPTransportStdio, Command: "server", URL: "http://x"},
+			true,
+		},
+		{"http", spec.MCPServerConfig{Transport: spec.MCPTransportStreamableHTTP, URL: "https://x/mcp"}, false},
+		{"http bad url", spec.MCPServerConfig{Transport: spec.MCPTransportStreamableHTTP, URL: "ftp://x"}, true},
+		{
+			"negative timeout",
+			spec.MCPServerConfig{Transport: spec.MCPTransportStdio, Command: "server", TimeoutMs: -1},
+			true,
+		},
+		{"unknown transport", spec.MCPServerConfig{Transport: "sse", URL: "https://x"}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validateMCPServerConfig(&tc.cfg); (err != nil) != tc.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
+	"github.com/flexigpt/flexigpt-app/internal/tool/openapi"
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+	"github.com/ppipada/mapstore-go"
+	"github.com/ppipada/mapstore-go/jsonencdec"
+)
+
+const (
+	defaultOpenAPIBundleSlug = "openapi"
+	defaultOpenAPIVersion    = "v1"
+)
+
+// ImportOpenAPIBundle maps the operations of an OpenAPI 3.x document into HTTP tools of a bundle, creating the bundle
+// if needed. Tools are immutable: an operation that changed since the last import gets a new version, an unchanged one
+// keeps its latest version. All tools are validated before the bundle or any tool is written.
+func (ts *ToolStore) ImportOpenAPIBundle(
+	ctx context.Context, req *spec.ImportOpenAPIBundleRequest,
+) (*spec.ImportOpenAPIBundleResponse, error) {
+	if req == nil || req.Body == nil || req.BundleID == "" || strings.TrimSpace(req.Body.Document) == "" {
+		return nil, fmt.Errorf("%w: bundleID and document required", spec.ErrInvalidRequest)
+	}
+	if req.Body.FilePath != "" {
+		return nil, fmt.Errorf("%w: filePath is not read here, send the document content", spec.ErrInvalidRequest)
+	}
+	doc, err := openapi.Parse([]byte(req.Body.Document))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", spec.ErrInvalidRequest, err)
+	}
+	tools, warnings, err := openapi.Tools(doc, openapi.Options{
+		OperationIDs:   req.Body.OperationIDs,
+		BaseURL:        req.Body.BaseURL,
+		SecretRef:      req.Body.SecretRef,
+		OAuth2ClientID: req.Body.OAuth2ClientID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", spec.ErrInvalidRequest, err)
+	}
+
+	bundle, create, err := ts.openAPIBundle(ctx, req, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Plan and validate every tool first, so that an invalid operation leaves the store untouched.
+	out := make([]spec.ImportedTool, 0, len(tools))
+	var puts []*spec.PutToolRequest
+	now := time.Now().UTC()
+	for _, t := range tools {
+		var existing []spec.Tool
+		if create == nil {
+			if existing, err = ts.toolVersions(bundle, t.Slug); err != nil {
+				return nil, err
+			}
+		}
+		if latest := latestTool(existing); latest != nil && sameImportedTool(latest, &t) {
+			out = append(out, spec.ImportedTool{
+				OperationID: t.OperationID,
+				ToolSlug:    t.Slug,
+				ToolVersion: latest.Version,
+			})
+			continue
+		}
+
+		version := nextImportVersion(doc.Info.Version, existing)
+		impl := t.HTTPImpl
+		put := &spec.PutToolRequest{
+			BundleID: bundle.ID,
+			ToolSlug: t.Slug,
+			Version:  version,
+			Body: &spec.PutToolRequestBody{
+				DisplayName:  t.DisplayName,
+				Description:  t.Description,
+				Tags:         t.Tags,
+				IsEnabled:    true,
+				UserCallable: true,
+				LLMCallable:  true,
+				ArgSchema:    string(t.ArgSchema),
+				Type:         spec.ToolTypeHTTP,
+				HTTPImpl:     &impl,
+			},
+		}
+		if err := validatePutToolRequest(put); err != nil {
+			return nil, fmt.Errorf("operation %s: %w", t.OperationID, err)
+		}
+		if _, err := newCustomTool(put, now); err != nil {
+			return nil, fmt.Errorf("operation %s: %w", t.OperationID, err)
+		}
+		puts = append(puts, put)
+		out = append(out, spec.ImportedTool{
+			OperationID: t.OperationID,
+			ToolSlug:    t.Slug,
+			ToolVersion: version,
+			Created:     true,
+		})
+	}
+	if len(puts) > 0 && create == nil && !bundle.IsEnabled {
+		return nil, fmt.Errorf("%w: %s", spec.ErrBundleDisabled, bundle.ID)
+	}
+
+	if create != nil {
+		if _, err := ts.PutToolBundle(ctx, create); err != nil {
+			return nil, err
+		}
+	}
+	for _, put := range puts {
+		if _, err := ts.PutTool(ctx, put); err != nil {
+			return nil, fmt.Errorf("tool %s: %w", put.ToolSlug, err)
+		}
+	}
+	slog.Info("importOpenAPIBundle", "bundleID", bundle.ID, "tools", len(out), "warnings", len(warnings))
+	return &spec.ImportOpenAPIBundleResponse{
+		Body: &spec.ImportOpenAPIBundleResponseBody{Tools: out, Warnings: warnings},
+	}, nil
+}
+
+// openAPIBundle returns the bundle to import into. When it does not exist, it also returns the validated request that
+// creates it from the document info; the returned bundle then only carries its ID and slug.
+func (ts *ToolStore) openAPIBundle(
+	ctx context.Context,
+	req *spec.ImportOpenAPIBundleRequest,
+	doc *openapi.Document,
+) (spec.ToolBundle, *spec.PutToolBundleRequest, error) {
+	b, isBI, err := ts.getAnyBundle(ctx, req.BundleID)
+	switch {
+	case err == nil && isBI:
+		return b, nil, fmt.Errorf("%w: bundleID %q", spec.ErrBuiltInReadOnly, req.BundleID)
+	case err == nil && b.MCPServer != nil:
+		return b, nil, fmt.Errorf("%w: %s", spec.ErrMCPToolsReadOnly, req.BundleID)
+	case err == nil:
+		return b, nil, nil
+	case !errors.Is(err, spec.ErrBundleNotFound):
+		return b, nil, err
+	}
+
+	slug := req.Body.Slug
+	if slug == "" {
+		slug = openAPIBundleSlug(doc.Info.Title)
+	}
+	displayName := strings.TrimSpace(req.Body.DisplayName)
+	if displayName == "" {
+		displayName = strings.TrimSpace(doc.Info.Title)
+	}
+	if displayName == "" {
+		displayName = string(slug)
+	}
+	if err := bundleitemutils.ValidateBundleSlug(slug); err != nil {
+		return b, nil, fmt.Errorf("%w: %w", spec.ErrInvalidRequest, err)
+	}
+	create := &spec.PutToolBundleRequest{
+		BundleID: req.BundleID,
+		Body: &spec.PutToolBundleRequestBody{
+			Slug:        slug,
+			DisplayName: displayName,
+			Description: doc.Info.Description,
+			IsEnabled:   true,
+		},
+	}
+	return spec.ToolBundle{ID: req.BundleID, Slug: slug, IsEnabled: true}, create, nil
+}
+
+// toolVersions returns the stored versions of a tool of a user bundle.
+func (ts *ToolStore) toolVersions(b spec.ToolBundle, slug bundleitemutils.ItemSlug) ([]spec.Tool, error) {
+	dirInfo, err := bundleitemutils.BuildBundleDir(b.ID, b.Slug)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		tools []spec.Tool
+		tok   string
+	)
+	for {
+		files, next, err := ts.toolStore.ListFiles(
+			mapstore.ListingConfig{
+				FilterPartitions: []string{dirInfo.DirName},
+				FilenamePrefix:   url.PathEscape(string(slug)) + "_",
+				PageSize:         fetchBatchTools,
+			}, tok,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			fi, err := bundleitemutils.ParseItemFileName(f.BaseRelativePath)
+			if err != nil || fi.Slug != slug {
+				continue
+			}
+			raw, err := ts.toolStore.GetFileData(
+				bundleitemutils.GetBundlePartitionFileKey(fi.FileName, dirInfo.DirName), false,
+			)
+			if err != nil {
+				return nil, err
+			}
+			var t spec.Tool
+			if err := jsonencdec.MapToStructWithJSONTags(raw, &t); err != nil {
+				return nil, err
+			}
+			tools = append(tools, t)
+		}
+		if next == "" {
+			return tools, nil
+		}
+		tok = next
+	}
+}
+
+func latestTool(tools []spec.Tool) *spec.Tool {
+	var latest *spec.Tool
+	for i := range tools {
+		if latest == nil || tools[i].CreatedAt.After(latest.CreatedAt) {
+			latest = &tools[i]
+		}
+	}
+	return latest
+}
+
+// sameImportedTool reports whether a stored tool matches the tool generated for an operation.
+func sameImportedTool(stored *spec.Tool, t *openapi.Tool) bool {
+	if stored.Type != spec.ToolTypeHTTP || stored.HTTPImpl == nil ||
+		stored.DisplayName != t.DisplayName || stored.Description != t.Description ||
+		!slices.Equal(stored.Tags, t.Tags) {
+		return false
+	}
+	return jsonEqual(stored.ArgSchema, t.ArgSchema) && jsonEqual(stored.HTTPImpl, &t.HTTPImpl)
+}
+
+// jsonEqual compares the JSON encodings of a and b as decoded values, so that formatting and key order do not
+// matter.
+func jsonEqual(a, b any) bool {
+	decode := func(v any) (any, bool) {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		var out any
+		if err := json.Unmarshal(raw, &out); err != nil {
+			return nil, false
+		}
+		return out, true
+	}
+	da, okA := decode(a)
+	db, okB := decode(b)
+	return okA && okB && reflect.DeepEqual(da, db)
+}
+
+// nextImportVersion is the version of the document if no version of the tool has it yet, else the version with the
+// first free "-<n>" suffix.
+func nextImportVersion(docVersion string, existing []spec.Tool) bundleitemutils.ItemVersion {
+	base := strings.Trim(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' {
+			return r
+		}
+		return '-'
+	}, strings.TrimSpace(docVersion)), "-.")
+	if bundleitemutils.ValidateItemVersion(bundleitemutils.ItemVersion(base)) != nil {
+		base = defaultOpenAPIVersion
+	}
+	taken := func(v bundleitemutils.ItemVersion) bool {
+		return slices.ContainsFunc(existing, func(t spec.Tool) bool { return t.Version == v })
+	}
+	v := bundleitemutils.ItemVersion(base)
+	for n := 2; taken(v); n++ {
+		v = bundleitemutils.ItemVersion(fmt.Sprintf("%s-%d", base, n))
+	}
+	return v
+}
+
+// openAPIBundleSlug maps the title of a document to a bundle slug.
+func openAPIBundleSlug(title string) bundleitemutils.BundleSlug {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(title)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	slug := bundleitemutils.BundleSlug(strings.TrimSuffix(b.String(), "-"))
+	if bundleitemutils.ValidateBundleSlug(slug) != nil {
+		return defaultOpenAPIBundleSlug
+	}
+	return slug
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+const notesOpenAPI = `
+openapi: 3.0.3
+info:
+  title: Notes API
+  version: 1.0.0
+servers:
+  - url: /api
+paths:
+  /notes/{noteId}:
+    get:
+      operationId: getNote
+      summary: Get a note
+      parameters:
+        - {name: noteId, in: path, required: true, schema: {type: string}}
+        - {name: fields, in: query, schema: {type: string}}
+  /notes:
+    post:
+      operationId: createNote
+      summary: Create a note
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                text: {type: string}
+`
+
+func TestImportOpenAPIBundle(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"fields": r.URL.Query().Get("fields"),
+			"body":   string(body),
+		})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+
+	ts, err := NewToolStore(t.TempDir(), WithFTS(false))
+	if err != nil {
+		t.Fatalf("NewToolStore: %v", err)
+	}
+	defer ts.Close()
+
+	const bundleID bundleitemutils.BundleID = "notes-bundle"
+	importDoc := func(doc string) *spec.ImportOpenAPIBundleResponseBody {
+		t.Helper()
+		resp, err := ts.ImportOpenAPIBundle(t.Context(), &spec.ImportOpenAPIBundleRequest{
+			BundleID: bundleID,
+			Body: &spec.ImportOpenAPIBundleRequestBody{
+				Document: doc,
+				BaseURL:  srv.URL + "/api",
+			},
+		})
+		if err != nil {
+			t.Fatalf("ImportOpenAPIBundle: %v", err)
+		}
+		return resp.Body
+	}
+	versions := func(body *spec.ImportOpenAPIBundleResponseBody) map[string]string {
+		out := map[string]string{}
+		for _, tl := range body.Tools {
+			v := string(tl.ToolVersion)
+			if !tl.Created {
+				v = "=" + v
+			}
+			out[tl.OperationID] = v
+		}
+		return out
+	}
+
+	// The first import creates the bundle and a tool per operation at the document version.
+	first := importDoc(notesOpenAPI)
+	if got := versions(first); got["getNote"] != "1.0.0" || got["createNote"] != "1.0.0" || len(got) != 2 {
+		t.Fatalf("first import = %v", got)
+	}
+	b, err := ts.getUserBundle(bundleID)
+	if err != nil || b.Slug != "notes-api" || b.DisplayName != "Notes API" {
+		t.Fatalf("bundle = %+v, err = %v", b, err)
+	}
+
+	// Re-importing an unchanged document keeps the tools.
+	if got := versions(importDoc(notesOpenAPI)); got["getNote"] != "=1.0.0" || got["createNote"] != "=1.0.0" {
+		t.Fatalf("unchanged import = %v", got)
+	}
+
+	// A changed operation gets a new version, the others are kept.
+	changed := strings.Replace(notesOpenAPI, "summary: Get a note", "summary: Fetch a note", 1)
+	if got := versions(importDoc(changed)); got["getNote"] != "1.0.0-2" || got["createNote"] != "=1.0.0" {
+		t.Fatalf("changed import = %v", got)
+	}
+	bumped := strings.Replace(changed, "version: 1.0.0", "version: 1.1.0", 1)
+	bumped = strings.Replace(bumped, "text: {type: string}",
+		"text: {type: string}\n                tags: {type: array}", 1)
+	if got := versions(importDoc(bumped)); got["getNote"] != "=1.0.0-2" || got["createNote"] != "1.1.0" {
+		t.Fatalf("bumped import = %v", got)
+	}
+
+	invoke := func(slug bundleitemutils.ItemSlug, version bundleitemutils.ItemVersion, args string) map[string]any {
+		t.Helper()
+		resp, err := ts.InvokeTool(t.Context(), &spec.InvokeToolRequest{
+			BundleID: bundleID,
+			ToolSlug: slug,
+			Version:  version,
+			Body:     &spec.InvokeToolRequestBody{Args: args},
+		})
+		if err != nil {
+			t.Fatalf("InvokeTool: %v", err)
+		}
+		if resp.Body.IsError {
+			t.Fatalf("InvokeTool error: %s", resp.Body.ErrorMessage)
+		}
+		var out map[string]any
+		if err := json.Unmarshal([]byte(getOneTextOutput(t, resp.Body)), &out); err != nil {
+			t.Fatalf("decode output: %v", err)
+		}
+		return out
+	}
+	if got := invoke("getNote", "1.0.0-2", `{"noteId":"n1","fields":"text"}`); got["path"] != "/api/notes/n1" ||
+		got["fields"] != "text" || got["method"] != "GET" {
+		t.Errorf("getNote = %v", got)
+	}
+	got := invoke("createNote", "1.1.0", `{"body":{"text":"hi","tags":["a"]}}`)
+	var sent map[string]any
+	if err := json.Unmarshal([]byte(got["body"].(string)), &sent); err != nil ||
+		sent["text"] != "hi" || got["method"] != "POST" {
+		t.Errorf("createNote = %v", got)
+	}
+
+	// Without the body argument, no body is sent.
+	if got := invoke("createNote", "1.1.0", `{}`); got["body"] != "" {
+		t.Errorf("createNote without body = %v", got)
+	}
+
+	// A document that cannot be parsed is an invalid request.
+	_, err = ts.ImportOpenAPIBundle(t.Context(), &spec.ImportOpenAPIBundleRequest{
+		BundleID: bundleID,
+		Body:     &spec.ImportOpenAPIBundleRequestBody{Document: "openapi: [unclosed"},
+	})
+	if !errors.Is(err, spec.ErrInvalidRequest) {
+		t.Errorf("unparsable document err = %v, want ErrInvalidRequest", err)
+	}
+
+	// The store never reads local files; only the desktop app turns a file path into document content.
+	_, err = ts.ImportOpenAPIBundle(t.Context(), &spec.ImportOpenAPIBundleRequest{
+		BundleID: bundleID,
+		Body:     &spec.ImportOpenAPIBundleRequestBody{Document: notesOpenAPI, FilePath: "/etc/passwd"},
+	})
+	if !errors.Is(err, spec.ErrInvalidRequest) {
+		t.Errorf("filePath err = %v, want ErrInvalidRequest", err)
+	}
+
+	// An operation that maps to an invalid tool fails the import before the bundle or any tool is written.
+	const otherBundleID bundleitemutils.BundleID = "notes-oauth"
+	invalid := notesOpenAPI + `
+components:
+  securitySchemes:
+    oauth:
+      type: oauth2
+      flows:
+        clientCredentials:
+          tokenUrl: /oauth/token
+          scopes: {}
+security:
+  - oauth: []
+`
+	_, err = ts.ImportOpenAPIBundle(t.Context(), &spec.ImportOpenAPIBundleRequest{
+		BundleID: otherBundleID,
+		Body: &spec.ImportOpenAPIBundleRequestBody{
+			Document:       invalid,
+			BaseURL:        srv.URL + "/api",
+			OAuth2ClientID: "client",
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "tokenURL") {
+		t.Fatalf("invalid tool err = %v, want a tokenURL validation error", err)
+	}
+	if _, err := ts.getUserBundle(otherBundleID); !errors.Is(err, spec.ErrBundleNotFound) {
+		t.Errorf("bundle after a failed import: err = %v, want ErrBundleNotFound", err)
+	}
+}
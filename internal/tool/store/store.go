@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -16,9 +17,11 @@ import (
 
 	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
 	"github.com/flexigpt/flexigpt-app/internal/jsonutil"
+	"github.com/flexigpt/flexigpt-app/internal/tool/execrunner"
 	"github.com/flexigpt/flexigpt-app/internal/tool/fts"
 	"github.com/flexigpt/flexigpt-app/internal/tool/goregistry"
 	"github.com/flexigpt/flexigpt-app/internal/tool/httprunner"
+	"github.com/flexigpt/flexigpt-app/internal/tool/mcpclient"
 	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
 	"github.com/flexigpt/llmtools-go"
 	"github.com/ppipada/mapstore-go"
@@ -54,6 +57,19 @@ type ToolStore struct {
 
 	slugLock *slugLocks
 
+	// Servers of MCP bundles.
+	mcp *mcpclient.Manager
+
+	// Global network policy of HTTP tools.
+	httpPolicy *spec.HTTPNetworkPolicy
+
+	// Resolves ${secret:<type>/<name>} references of HTTP tools.
+	secretResolver httprunner.SecretResolver
+
+	// OAuth2 tokens of HTTP tools; persisted only when an encoder is configured.
+	tokenEncoder mapstore.IOEncoderDecoder
+	tokenCache   *httprunner.OAuth2TokenCache
+
 	// Cleanup loop plumbing.
 	cleanOnce sync.Once
 	cleanKick chan struct{}
@@ -76,6 +92,34 @@ func WithFTS(enabled bool) Option {
 	}
 }
 
+// WithHTTPNetworkPolicy sets the allowed hosts and denied CIDRs enforced for all HTTP tools, in addition to the
+// policy of each tool. A nil DeniedCIDRs keeps spec.DefaultHTTPDeniedCIDRs.
+func WithHTTPNetworkPolicy(p spec.HTTPNetworkPolicy) Option {
+	return func(ts *ToolStore) error {
+		if err := httprunner.ValidateHTTPNetworkPolicy(&p); err != nil {
+			return fmt.Errorf("invalid http network policy: %w", err)
+		}
+		ts.httpPolicy = &p
+		return nil
+	}
+}
+
+// WithSecretResolver resolves named secret references of HTTP tools at invocation time.
+func WithSecretResolver(sr httprunner.SecretResolver) Option {
+	return func(ts *ToolStore) error {
+		ts.secretResolver = sr
+		return nil
+	}
+}
+
+// WithOAuth2TokenEncoder persists the OAuth2 tokens of HTTP tools, encrypted with enc, so they survive restarts.
+func WithOAuth2TokenEncoder(enc mapstore.IOEncoderDecoder) Option {
+	return func(ts *ToolStore) error {
+		ts.tokenEncoder = enc
+		return nil
+	}
+}
+
 // NewToolStore initialises a ToolStore rooted at baseDir.
 func NewToolStore(baseDir string, opts ...Option) (*ToolStore, error) {
 	ts := &ToolStore{
@@ -89,6 +133,18 @@ func NewToolStore(baseDir string, opts ...Option) (*ToolStore, error) {
 	}
 	ctx := context.Background()
 
+	var cacheOpts []httprunner.OAuth2CacheOption
+	if ts.tokenEncoder != nil {
+		cacheOpts = append(cacheOpts, httprunner.WithOAuth2CacheFile(
+			filepath.Join(ts.baseDir, spec.ToolOAuth2TokensFileName), ts.tokenEncoder,
+		))
+	}
+	tokenCache, err := httprunner.NewOAuth2TokenCache(cacheOpts...)
+	if err != nil {
+		return nil, err
+	}
+	ts.tokenCache = tokenCache
+
 	// Built-in overlay.
 	bi, err := NewBuiltInToolData(ctx, ts.baseDir, builtInSnapshotMaxAge, WithLLMToolsGoBuiltins(true))
 	if err != nil {
@@ -140,18 +196,25 @@ func NewToolStore(baseDir string, opts ...Option) (*ToolStore, error) {
 	}
 
 	ts.slugLock = newSlugLocks()
+	ts.mcp = mcpclient.NewManager(mcpclient.WithLogger(slog.Default()))
 	ts.startCleanupLoop()
 
 	slog.Info("tool-store ready", "baseDir", ts.baseDir, "fts", ts.enableFTS)
 	return ts, nil
 }
 
-// Close shuts down the background sweep.
+// Close shuts down the background sweep and the servers of MCP bundles.
 func (ts *ToolStore) Close() {
 	if ts.cleanStop != nil {
 		ts.cleanStop()
 	}
 	ts.wg.Wait()
+	if ts.mcp != nil {
+		ts.mcp.Close()
+	}
+	if ts.tokenCache != nil {
+		_ = ts.tokenCache.Close()
+	}
 }
 
 // PutToolBundle creates or replaces a bundle.
@@ -165,6 +228,11 @@ func (ts *ToolStore) PutToolBundle(
 	if err := bundleitemutils.ValidateBundleSlug(req.Body.Slug); err != nil {
 		return nil, err
 	}
+	if req.Body.MCPServer != nil {
+		if err := validateMCPServerConfig(req.Body.MCPServer); err != nil {
+			return nil, fmt.Errorf("%w: %w", spec.ErrInvalidRequest, err)
+		}
+	}
 
 	// Built-ins are immutable.
 	if ts.builtinData != nil {
@@ -183,9 +251,14 @@ func (ts *ToolStore) PutToolBundle(
 
 	now := time.Now().UTC()
 	createdAt := now
-	if ex, ok := all.Bundles[req.BundleID]; ok && !ex.CreatedAt.IsZero() {
+	ex, exists := all.Bundles[req.BundleID]
+	if exists && !ex.CreatedAt.IsZero() {
 		createdAt = ex.CreatedAt
 	}
+	if exists && (ex.MCPServer == nil) != (req.Body.MCPServer == nil) {
+		// Stored tools and discovered tools do not mix.
+		return nil, fmt.Errorf("%w: a bundle cannot switch between stored and MCP server tools", spec.ErrInvalidRequest)
+	}
 
 	b := spec.ToolBundle{
 		SchemaVersion: spec.SchemaVersion,
@@ -193,6 +266,7 @@ func (ts *ToolStore) PutToolBundle(
 		Slug:          req.Body.Slug,
 		DisplayName:   req.Body.DisplayName,
 		Description:   req.Body.Description,
+		MCPServer:     req.Body.MCPServer,
 		IsEnabled:     req.Body.IsEnabled,
 		IsBuiltIn:     false,
 		CreatedAt:     createdAt,
@@ -204,6 +278,10 @@ func (ts *ToolStore) PutToolBundle(
 	if err := ts.writeAllBundles(all); err != nil {
 		return nil, err
 	}
+	if exists && ex.MCPServer != nil {
+		// The server is started again with the new configuration on its next use.
+		ts.mcp.Stop(string(req.BundleID))
+	}
 	slog.Info("putToolBundle", "bundleID", req.BundleID)
 	return &spec.PutToolBundleResponse{}, nil
 }
@@ -250,6 +328,9 @@ func (ts *ToolStore) PatchToolBundle(
 	if err := ts.writeAllBundles(all); err != nil {
 		return nil, err
 	}
+	if bl.MCPServer != nil && !bl.IsEnabled {
+		ts.mcp.Stop(string(req.BundleID))
+	}
 	slog.Info("patchToolBundle", "id", req.BundleID, "enabled", req.Body.IsEnabled)
 	return &spec.PatchToolBundleResponse{}, nil
 }
@@ -305,6 +386,9 @@ func (ts *ToolStore) DeleteToolBundle(
 	if err := ts.writeAllBundles(all); err != nil {
 		return nil, err
 	}
+	if b.MCPServer != nil {
+		ts.mcp.Forget(string(req.BundleID))
+	}
 
 	ts.kickCleanupLoop()
 	slog.Info("deleteToolBundle", "bundleID", req.BundleID)
@@ -427,25 +511,11 @@ func (ts *ToolStore) ListToolBundles(
 	}, nil
 }
 
-// PutTool creates a new tool version (immutable). Only HTTPImpl function tools are allowed to be added as of now.
+// PutTool creates a new tool version (immutable). Only HTTP and exec function tools are allowed to be added as of now.
 func (ts *ToolStore) PutTool(
 	ctx context.Context, req *spec.PutToolRequest,
 ) (*spec.PutToolResponse, error) {
-	if req == nil || req.Body == nil ||
-		req.BundleID == "" || req.ToolSlug == "" || req.Version == "" {
-		return nil, fmt.Errorf("%w: bundleID, toolSlug, version required", spec.ErrInvalidRequest)
-	}
-	if req.Body.Type != spec.ToolTypeHTTP {
-		return nil, fmt.Errorf("%w: only custom http tools can be added", spec.ErrInvalidRequest)
-	}
-	if !req.Body.UserCallable && !req.Body.LLMCallable {
-		return nil, fmt.Errorf("%w: a tool needs to be callable", spec.ErrInvalidRequest)
-	}
-
-	if err := bundleitemutils.ValidateItemSlug(req.ToolSlug); err != nil {
-		return nil, err
-	}
-	if err := bundleitemutils.ValidateItemVersion(req.Version); err != nil {
+	if err := validatePutToolRequest(req); err != nil {
 		return nil, err
 	}
 
@@ -456,6 +526,9 @@ func (ts *ToolStore) PutTool(
 	if isBI {
 		return nil, fmt.Errorf("%w: bundleID %q", spec.ErrBuiltInReadOnly, req.BundleID)
 	}
+	if bundle.MCPServer != nil {
+		return nil, fmt.Errorf("%w: %s", spec.ErrMCPToolsReadOnly, req.BundleID)
+	}
 	if !bundle.IsEnabled {
 		return nil, fmt.Errorf("%w: %s", spec.ErrBundleDisabled, req.BundleID)
 	}
@@ -481,7 +554,42 @@ func (ts *ToolStore) PutTool(
 		}
 	}
 
-	now := time.Now().UTC()
+	t, err := newCustomTool(req, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	mp, _ := jsonencdec.StructWithJSONTagsToMap(t)
+	if err := ts.toolStore.SetFileData(
+		bundleitemutils.GetBundlePartitionFileKey(finf.FileName, dirInfo.DirName),
+		mp,
+	); err != nil {
+		return nil, err
+	}
+	slog.Info("putTool", "bundleID", req.BundleID, "slug", req.ToolSlug, "ver", req.Version)
+	return &spec.PutToolResponse{}, nil
+}
+
+// validatePutToolRequest checks the fields of a PutTool request that do not depend on the stored bundle.
+func validatePutToolRequest(req *spec.PutToolRequest) error {
+	if req == nil || req.Body == nil ||
+		req.BundleID == "" || req.ToolSlug == "" || req.Version == "" {
+		return fmt.Errorf("%w: bundleID, toolSlug, version required", spec.ErrInvalidRequest)
+	}
+	if req.Body.Type != spec.ToolTypeHTTP && req.Body.Type != spec.ToolTypeExec {
+		return fmt.Errorf("%w: only custom http and exec tools can be added", spec.ErrInvalidRequest)
+	}
+	if !req.Body.UserCallable && !req.Body.LLMCallable {
+		return fmt.Errorf("%w: a tool needs to be callable", spec.ErrInvalidRequest)
+	}
+
+	if err := bundleitemutils.ValidateItemSlug(req.ToolSlug); err != nil {
+		return err
+	}
+	return bundleitemutils.ValidateItemVersion(req.Version)
+}
+
+// newCustomTool builds and validates the tool of a checked PutTool request, created at now.
+func newCustomTool(req *spec.PutToolRequest, now time.Time) (spec.Tool, error) {
 	uuid, _ := uuidv7filename.NewUUIDv7String()
 	argSchemaStr := req.Body.ArgSchema
 	if argSchemaStr == "" {
@@ -505,6 +613,7 @@ func (ts *ToolStore) PutTool(
 		LLMToolType: spec.ToolStoreChoiceTypeFunction,
 		Type:        req.Body.Type,
 		HTTPImpl:    req.Body.HTTPImpl,
+		ExecImpl:    req.Body.ExecImpl,
 		IsEnabled:   req.Body.IsEnabled,
 		IsBuiltIn:   false,
 		CreatedAt:   now,
@@ -512,18 +621,9 @@ func (ts *ToolStore) PutTool(
 	}
 
 	if err := validateTool(&t); err != nil {
-		return nil, fmt.Errorf("validation failed: %w", err)
-	}
-
-	mp, _ := jsonencdec.StructWithJSONTagsToMap(t)
-	if err := ts.toolStore.SetFileData(
-		bundleitemutils.GetBundlePartitionFileKey(finf.FileName, dirInfo.DirName),
-		mp,
-	); err != nil {
-		return nil, err
+		return spec.Tool{}, fmt.Errorf("validation failed: %w", err)
 	}
-	slog.Info("putTool", "bundleID", req.BundleID, "slug", req.ToolSlug, "ver", req.Version)
-	return &spec.PutToolResponse{}, nil
+	return t, nil
 }
 
 // PatchTool toggles enabled flag on a tool version.
@@ -562,6 +662,9 @@ func (ts *ToolStore) PatchTool(
 			"ver", req.Version, "enabled", req.Body.IsEnabled)
 		return &spec.PatchToolResponse{}, nil
 	}
+	if bundle.MCPServer != nil {
+		return nil, fmt.Errorf("%w: %s", spec.ErrMCPToolsReadOnly, req.BundleID)
+	}
 	if !bundle.IsEnabled {
 		return nil, fmt.Errorf("%w: %s", spec.ErrBundleDisabled, req.BundleID)
 	}
@@ -615,6 +718,9 @@ func (ts *ToolStore) DeleteTool(
 	if isBI {
 		return nil, fmt.Errorf("%w: bundleID %q", spec.ErrBuiltInReadOnly, req.BundleID)
 	}
+	if bundle.MCPServer != nil {
+		return nil, fmt.Errorf("%w: %s", spec.ErrMCPToolsReadOnly, req.BundleID)
+	}
 
 	dirInfo, _ := bundleitemutils.BuildBundleDir(bundle.ID, bundle.Slug)
 	lock := ts.slugLock.lockKey(bundle.ID, req.ToolSlug)
@@ -633,7 +739,8 @@ func (ts *ToolStore) DeleteTool(
 
 // InvokeTool locates a tool version and executes it according to its type.
 // - Validates struct (validateTool), bundle/tool enabled state.
-// - Dispatches to HTTP or Go runner with functional options constructed from the request body.
+// - Dispatches to HTTP, Go or exec runner with functional options constructed from the request body, or to the server
+// of an MCP bundle.
 func (ts *ToolStore) InvokeTool(
 	ctx context.Context,
 	req *spec.InvokeToolRequest,
@@ -694,11 +801,19 @@ func (ts *ToolStore) InvokeTool(
 		md      map[string]any
 		isError bool
 		errMsg  string
+		errCode spec.ToolErrorCode
 	)
 
 	switch tool.Type {
 	case spec.ToolTypeHTTP:
 		var hopts []httprunner.HTTPOption
+		if ts.httpPolicy != nil {
+			hopts = append(hopts, httprunner.WithHTTPNetworkPolicy(*ts.httpPolicy))
+		}
+		if ts.secretResolver != nil {
+			hopts = append(hopts, httprunner.WithHTTPSecretResolver(ts.secretResolver))
+		}
+		hopts = append(hopts, httprunner.WithHTTPOAuth2TokenCache(ts.tokenCache))
 		if req.Body.HTTPOptions != nil {
 			if req.Body.HTTPOptions.TimeoutMs > 0 {
 				hopts = append(hopts, httprunner.WithHTTPTimeoutMs(req.Body.HTTPOptions.TimeoutMs))
@@ -739,6 +854,19 @@ func (ts *ToolStore) InvokeTool(
 			"type":     "go",
 			"funcName": tool.GoImpl.Func,
 		}
+	case spec.ToolTypeMCP:
+		outputs, md, err = ts.invokeMCPTool(ctx, bundle, tool, args, req.Body.MCPOptions)
+	case spec.ToolTypeExec:
+		var eopts []execrunner.ExecOption
+		if req.Body.ExecOptions != nil && req.Body.ExecOptions.TimeoutMs > 0 {
+			eopts = append(eopts, execrunner.WithExecTimeoutMs(req.Body.ExecOptions.TimeoutMs))
+		}
+		r, configErr := execrunner.NewExecToolRunner(*tool.ExecImpl, eopts...)
+		if configErr != nil {
+			return nil, configErr
+		}
+
+		outputs, md, err = r.Run(ctx, args)
 	case spec.ToolTypeSDK:
 		// SDK-backed tools are not invoked through ToolStore; they are surfaced to the model as provider server tools.
 		// Invoking them directly is a misuse.
@@ -751,7 +879,9 @@ func (ts *ToolStore) InvokeTool(
 		// instead of failing the entire call.
 		isError = true
 		errMsg = err.Error()
-
+		if errors.Is(err, spec.ErrHTTPDestinationDenied) {
+			errCode = spec.ToolErrorCodeDestinationDenied
+		}
 	}
 
 	return &spec.InvokeToolResponse{
@@ -761,6 +891,7 @@ func (ts *ToolStore) InvokeTool(
 			IsBuiltIn:    isBI,
 			IsError:      isError,
 			ErrorMessage: errMsg,
+			ErrorCode:    errCode,
 		},
 	}, nil
 }
@@ -783,6 +914,13 @@ func (ts *ToolStore) GetTool(
 		}
 		return &spec.GetToolResponse{Body: &tool}, nil
 	}
+	if bundle.MCPServer != nil {
+		tool, err := ts.getMCPTool(ctx, bundle, req.ToolSlug, req.Version)
+		if err != nil {
+			return nil, err
+		}
+		return &spec.GetToolResponse{Body: tool}, nil
+	}
 	dirInfo, _ := bundleitemutils.BuildBundleDir(bundle.ID, bundle.Slug)
 	lock := ts.slugLock.lockKey(bundle.ID, req.ToolSlug)
 	lock.RLock()
@@ -805,7 +943,8 @@ func (ts *ToolStore) GetTool(
 	return &spec.GetToolResponse{Body: &t}, nil
 }
 
-// ListTools enumerates every stored tool version subject to filters.
+// ListTools enumerates every stored tool version subject to filters, and the tools of enabled MCP bundles, whose
+// servers are started as needed.
 func (ts *ToolStore) ListTools(
 	ctx context.Context, req *spec.ListToolsRequest,
 ) (*spec.ListToolsResponse, error) {
@@ -928,6 +1067,12 @@ func (ts *ToolStore) ListTools(
 	}
 	userBundles := allUserBundles.Bundles
 
+	// MCP server tools next, in one go like built-ins.
+	if !tok.MCPDone {
+		out = append(out, ts.listMCPTools(ctx, userBundles, include)...)
+		tok.MCPDone = true
+	}
+
 	// User tools until pageHint filled.
 	for len(out) < pageHint {
 		files, next, err := ts.toolStore.ListFiles(
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/flexigpt/flexigpt-app/internal/bundleitemutils"
+	"github.com/flexigpt/flexigpt-app/internal/tool/execrunner"
 	"github.com/flexigpt/flexigpt-app/internal/tool/httprunner"
 	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
 )
@@ -70,6 +71,12 @@ func validateTool(t *spec.Tool) error {
 		if t.SDKImpl != nil {
 			return errors.New("sdkImpl must be unset for type 'go'")
 		}
+		if t.MCPImpl != nil {
+			return errors.New("mcpImpl must be unset for type 'go'")
+		}
+		if t.ExecImpl != nil {
+			return errors.New("execImpl must be unset for type 'go'")
+		}
 	case spec.ToolTypeHTTP:
 		if t.HTTPImpl == nil {
 			return errors.New("httpImpl is required for type 'http'")
@@ -80,8 +87,14 @@ func validateTool(t *spec.Tool) error {
 		if t.SDKImpl != nil {
 			return errors.New("sdkImpl must be unset for type 'http'")
 		}
+		if t.MCPImpl != nil {
+			return errors.New("mcpImpl must be unset for type 'http'")
+		}
+		if t.ExecImpl != nil {
+			return errors.New("execImpl must be unset for type 'http'")
+		}
 		if err := httprunner.ValidateHTTPImpl(t.HTTPImpl); err != nil {
-			return errors.New("invalid implementation for type 'http'")
+			return fmt.Errorf("invalid implementation for type 'http': %w", err)
 		}
 	case spec.ToolTypeSDK:
 		// SDK-backed tools are surfaced to the provider SDK as
@@ -92,12 +105,36 @@ func validateTool(t *spec.Tool) error {
 		if t.HTTPImpl != nil {
 			return errors.New("httpImpl must be unset for type 'sdk'")
 		}
+		if t.MCPImpl != nil {
+			return errors.New("mcpImpl must be unset for type 'sdk'")
+		}
+		if t.ExecImpl != nil {
+			return errors.New("execImpl must be unset for type 'sdk'")
+		}
 		if t.SDKImpl == nil {
 			return errors.New("sdk metadata is required for type 'sdk'")
 		}
 		if strings.TrimSpace(t.SDKImpl.SDKType) == "" {
 			return errors.New("sdk.sdkType is required for type 'sdk'")
 		}
+	case spec.ToolTypeMCP:
+		// MCP tools are discovered from the server of their bundle and invoked there.
+		if t.GoImpl != nil || t.HTTPImpl != nil || t.SDKImpl != nil || t.ExecImpl != nil {
+			return errors.New("only mcpImpl may be set for type 'mcp'")
+		}
+		if t.MCPImpl == nil || strings.TrimSpace(t.MCPImpl.ToolName) == "" {
+			return errors.New("mcpImpl.toolName is required for type 'mcp'")
+		}
+	case spec.ToolTypeExec:
+		if t.GoImpl != nil || t.HTTPImpl != nil || t.SDKImpl != nil || t.MCPImpl != nil {
+			return errors.New("only execImpl may be set for type 'exec'")
+		}
+		if t.ExecImpl == nil {
+			return errors.New("execImpl is required for type 'exec'")
+		}
+		if err := execrunner.ValidateExecImpl(t.ExecImpl); err != nil {
+			return fmt.Errorf("invalid implementation for type 'exec': %w", err)
+		}
 	default:
 		return fmt.Errorf("invalid type %q", t.Type)
 	}
@@ -0,0 +1,34 @@
+// Package toolutil holds helpers shared by the tool runners.
+package toolutil
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/flexigpt/flexigpt-app/internal/tool/spec"
+)
+
+// TemplateValue renders a JSON value for templating: strings and numbers as written, other values as JSON.
+func TemplateValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case json.Number:
+		return x.String()
+	case bool:
+		return fmt.Sprint(x)
+	default:
+		b, _ := json.Marshal(x)
+		return string(b)
+	}
+}
+
+// TextOutput wraps text into a tool output.
+func TextOutput(text string) spec.ToolStoreOutputUnion {
+	return spec.ToolStoreOutputUnion{
+		Kind:     spec.ToolStoreOutputKindText,
+		TextItem: &spec.ToolStoreOutputText{Text: text},
+	}
+}
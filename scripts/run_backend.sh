@@ -7,6 +7,10 @@ export SERVICE_CONVERSATIONS_DIR_PATH="./out/conversationsv1"
 export SERVICE_MODEL_PRESETS_DIR_PATH="./out/modelpresetsv1"
 export SERVICE_PROMPT_TEMPLATES_DIR_PATH="./out/prompttemplates"
 export SERVICE_TOOLS_DIR_PATH="./out/toolsv1"
+export SERVICE_BATCH_JOBS_DIR_PATH="./out/batchjobsv1"
+export SERVICE_COMPLETION_JOURNAL_DIR_PATH="./out/completionjournalv1"
+export SERVICE_TOKEN_QUOTAS_DIR_PATH="./out/tokenquotasv1"
+export SERVICE_FILE_UPLOADS_DIR_PATH="./out/fileuploadsv1"
 export SERVICE_LOGS_DIR_PATH="./out/logs"
 export SERVICE_DEBUG="true"
 